@@ -19,6 +19,8 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/ogt11/certm3/mw/internal/acme"
+	"github.com/ogt11/certm3/mw/internal/api"
 	"github.com/ogt11/certm3/mw/internal/app"
 	"github.com/ogt11/certm3/mw/internal/config"
 	"github.com/ogt11/certm3/mw/internal/logging"
@@ -82,6 +84,33 @@ func main() {
 	// Initialize JWT manager
 	jwtManager := security.NewJWTManager(config.AppServer.JWTSecret, "certM3", "certM3-app")
 
+	// Initialize signing ticket manager, shared secret with the signer
+	tickets := security.NewTicketManager(config.Signer.TicketSecret, config.Signer.TicketTTL)
+
+	// Connect to the signer over the configured transport
+	signerClient, err := app.NewSignerClient(config)
+	if err != nil {
+		logger.Fatalf("Failed to set up signer client: %v", err)
+	}
+	defer signerClient.Close()
+
+	// Client certificate authentication, passed on by the TLS terminator;
+	// the signer reports whether certificates were revoked
+	certAuth, err := app.NewClientCertAuth(config, signerClient)
+	if err != nil {
+		logger.Fatalf("Failed to set up client certificate authentication: %v", err)
+	}
+
+	// Register issued certificates with the backend, retrying from a
+	// durable outbox
+	outbox, err := app.OpenCertificateOutbox(config.AppServer.CertificateOutboxPath, api.NewClient(config.AppServer.BackendAPIURL), logger, m)
+	if err != nil {
+		logger.Fatalf("Failed to open certificate outbox: %v", err)
+	}
+	stopOutbox := make(chan struct{})
+	go outbox.Run(stopOutbox)
+	defer close(stopOutbox)
+
 	// Create HTTP client with mTLS
 	client := &http.Client{
 		Transport: &http.Transport{
@@ -99,7 +128,7 @@ func main() {
 	}
 
 	// Create handler
-	h := app.NewHandler(logger, m, jwtManager, client, config.AppServer.BackendAPIURL, *testAPI, config)
+	h := app.NewHandler(logger, m, jwtManager, tickets, signerClient, outbox, certAuth, client, config.AppServer.BackendAPIURL, *testAPI, config)
 
 	// If test API mode is enabled, run the test API flow and exit
 	if *testAPI {
@@ -109,6 +138,24 @@ func main() {
 		return
 	}
 
+	// ACME server for automated clients, bound to certM3 users
+	var acmeServer *acme.Server
+	acmePrefix := ""
+	if config.AppServer.ACMEEnabled {
+		acmeServer, err = h.NewACMEServer()
+		if err != nil {
+			logger.Fatalf("Failed to set up ACME server: %v", err)
+		}
+		acmePrefix = acmeServer.Prefix()
+	}
+
+	// EST enrollment for devices
+	if config.AppServer.ESTEnabled {
+		if err := h.EnableEST(); err != nil {
+			logger.Fatalf("Failed to set up EST: %v", err)
+		}
+	}
+
 	// Create router for external HTTPS
 	r := mux.NewRouter()
 
@@ -116,10 +163,13 @@ func main() {
 	r.Use(m.HTTPMiddleware)
 	r.Use(app.LoggingMiddleware(logger))
 	r.Use(app.NewRateLimiter(config.AppServer.RateLimitPerIP, time.Second, m).RateLimitMiddleware)
-	r.Use(app.AuthMiddleware(jwtManager, logger, m))
+	r.Use(app.AuthMiddleware(jwtManager, certAuth, acmePrefix, logger, m))
 
 	// Register routes
 	app.RegisterRoutes(r, h)
+	if acmeServer != nil {
+		acmeServer.RegisterRoutes(r)
+	}
 
 	// Add metrics endpoint
 	r.Handle("/metrics", m.Handler())
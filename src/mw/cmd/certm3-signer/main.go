@@ -1,23 +1,32 @@
 package main
 
 import (
-	"crypto/x509"
-	"encoding/pem"
+	"context"
 	"flag"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
+	"github.com/ogt11/certm3/mw/internal/cakey"
 	"github.com/ogt11/certm3/mw/internal/config"
 	"github.com/ogt11/certm3/mw/internal/logging"
+	"github.com/ogt11/certm3/mw/internal/security"
 	"github.com/ogt11/certm3/mw/internal/signer"
 	"github.com/ogt11/certm3/mw/pkg/metrics"
+	"google.golang.org/grpc"
 )
 
 func main() {
+	// "certm3-signer policy test ..." evaluates requests offline
+	if len(os.Args) > 1 && os.Args[1] == "policy" {
+		os.Exit(runPolicyCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	// Parse command line flags
 	configPath := flag.String("config", "config.yaml", "Path to config file")
 	flag.Parse()
@@ -37,140 +46,266 @@ func main() {
 	// Initialize metrics
 	m := metrics.New()
 
-	// Read CA certificate
-	caCertPEM, err := os.ReadFile(config.Signer.CACertPath)
+	// Load the CA certificates and open their keys from the configured
+	// backend. With pkcs11 or remote the private keys stay on the token or
+	// signing service. Each key is checked against its certificate here so
+	// a mismatch stops the signer at startup.
+	cas, err := cakey.OpenAll(config)
 	if err != nil {
-		if os.IsNotExist(err) {
-			logger.Fatal("CA certificate file not found at %s", config.Signer.CACertPath)
-		}
-		logger.Fatal("Failed to read CA certificate file: %v", err)
+		logger.Fatalf("Failed to load CA (key backend %s): %v", config.Signer.CAKeyBackend, err)
 	}
-
-	// Read CA key
-	caKeyPEM, err := os.ReadFile(config.Signer.CAKeyPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			logger.Fatal("CA key file not found at %s", config.Signer.CAKeyPath)
-		}
-		logger.Fatal("Failed to read CA key file: %v", err)
-	}
-
-	// Decode CA certificate
-	caCertBlock, _ := pem.Decode(caCertPEM)
-	if caCertBlock == nil {
-		logger.Fatal("Failed to decode CA certificate PEM block - file exists but is not in valid PEM format")
-	}
-
-	// Decode CA key
-	caKeyBlock, _ := pem.Decode(caKeyPEM)
-	if caKeyBlock == nil {
-		logger.Fatal("Failed to decode CA key PEM block - file exists but is not in valid PEM format")
-	}
-
-	// Parse CA certificate
-	caCert, err := x509.ParseCertificate(caCertBlock.Bytes)
-	if err != nil {
-		logger.Fatal("Failed to parse CA certificate - file exists and is PEM encoded but not a valid X.509 certificate: %v", err)
-	}
-
-	// Parse CA key
-	var caKey interface{}
-	// TODO: Following Postel's Law, we should be more liberal in what we accept.
-	// Currently we only handle PKCS#1 (RSA/EC) and PKCS#8 formats.
-	// We should consider adding support for:
-	// - PKCS#12 (.p12/.pfx)
-	// - OpenSSH private key format
-	// - Other common key formats
-	switch caKeyBlock.Type {
-	case "RSA PRIVATE KEY":
-		caKey, err = x509.ParsePKCS1PrivateKey(caKeyBlock.Bytes)
-	case "EC PRIVATE KEY":
-		caKey, err = x509.ParseECPrivateKey(caKeyBlock.Bytes)
-	case "PRIVATE KEY":
-		caKey, err = x509.ParsePKCS8PrivateKey(caKeyBlock.Bytes)
-	default:
-		logger.Fatal("CA key file exists but is not in a supported format. Found format: %s, supported formats: RSA PRIVATE KEY, EC PRIVATE KEY, PRIVATE KEY", caKeyBlock.Type)
-	}
-	if err != nil {
-		logger.Fatal("Failed to parse CA key - file exists and is PEM encoded but not a valid private key: %v", err)
+	defer func() { closeCAs(cas) }()
+	for _, ca := range cas {
+		logger.Infof("Loaded CA %s with %s key backend", ca.Certificate.Subject.String(), config.Signer.CAKeyBackend)
 	}
 
 	// Initialize signer
-	s := signer.New(config, logger, m, caCert, caKey, config.Signer.GroupExtensionOID)
+	s := signer.New(config, logger, m, cas[0].Certificate, cas[0].Key, cas[0].Chain, config.Signer.GroupExtensionOID)
+	if len(cas) > 1 {
+		if err := s.SetIssuingCAs(issuingCAs(config, cas)); err != nil {
+			logger.Fatalf("Failed to set up issuing CAs: %v", err)
+		}
+	}
 
 	// Initialize handler
-	h := signer.NewHandler(logger, m, s)
+	// Requests must carry a signing ticket from the app server
+	if config.Signer.TicketSecret == "" {
+		logger.Fatalf("No signing ticket secret configured; set ticket_secret or create %s", config.Signer.TicketSecretPath)
+	}
+	tickets := security.NewTicketManager(config.Signer.TicketSecret, config.Signer.TicketTTL)
+	h := signer.NewHandler(logger, m, s, tickets)
 
 	// Create socket directory
 	socketDir := filepath.Dir(config.Signer.SocketPath)
 	if err := os.MkdirAll(socketDir, 0755); err != nil {
-		logger.Error("Failed to create socket directory: %v", err)
+		logger.Errorf("Failed to create socket directory: %v", err)
 		os.Exit(1)
 	}
 
 	// Remove existing socket if it exists
 	if err := os.Remove(config.Signer.SocketPath); err != nil && !os.IsNotExist(err) {
-		logger.Error("Failed to remove existing socket: %v", err)
+		logger.Errorf("Failed to remove existing socket: %v", err)
 		os.Exit(1)
 	}
 
 	// Create Unix domain socket listener
-	// Protocol: Raw JSON messages over Unix domain socket
-	// Request format:
-	// {
-	//   "requestId": "string",
-	//   "csr": "string",  // PEM-encoded CSR
-	//   "groups": ["string"],
-	//   "token": "string"
-	// }
-	// Response format:
-	// {
-	//   "success": true,
-	//   "data": {
-	//     "certificate": "string",  // PEM-encoded signed certificate
-	//     "caCertificate": "string" // PEM-encoded CA certificate
-	//   }
-	// }
+	// Protocol: see package signerproto. Clients either open a connection
+	// with the version 1 preamble and exchange length-prefixed frames, or
+	// send a single raw JSON request (version 0) and read one response.
+	// gRPC clients (see proto/certm3/signer/v1) may use the socket too.
 	listener, err := net.Listen("unix", config.Signer.SocketPath)
 	if err != nil {
-		logger.Error("Failed to create Unix domain socket: %v", err)
+		logger.Errorf("Failed to create Unix domain socket: %v", err)
 		os.Exit(1)
 	}
 
-	// Set socket permissions
-	if err := os.Chmod(config.Signer.SocketPath, 0666); err != nil {
-		logger.Error("Failed to set socket permissions: %v", err)
+	// Set socket ownership and permissions; connecting peers are checked
+	// against allowed_peer_uids/allowed_peer_gids as well
+	if err := signer.ConfigureSocket(config.Signer.SocketPath, config.Signer.SocketOwner, config.Signer.SocketGroup, config.Signer.SocketMode); err != nil {
+		logger.Errorf("Failed to configure socket: %v", err)
 		os.Exit(1)
 	}
 
+	// Serve gRPC on the socket alongside the framed protocol
+	grpcServer := signer.NewGRPCServer(h)
+	h.ServeGRPC(grpcServer, listener.Addr())
+
+	// And over TCP with mTLS, if configured
+	var grpcTCPServer *grpc.Server
+	if config.Signer.GRPCListenAddr != "" {
+		creds, err := signer.GRPCServerCredentials(config.Signer.GRPCCertPath, config.Signer.GRPCKeyPath, config.Signer.GRPCClientCAPath)
+		if err != nil {
+			logger.Fatalf("Failed to set up gRPC credentials: %v", err)
+		}
+		grpcListener, err := net.Listen("tcp", config.Signer.GRPCListenAddr)
+		if err != nil {
+			logger.Fatalf("Failed to listen on %s: %v", config.Signer.GRPCListenAddr, err)
+		}
+		if len(config.Signer.GRPCAllowedClients) == 0 && len(config.Signer.GRPCAdminClients) == 0 {
+			logger.Warnf("No gRPC clients are allowed; set grpc_allowed_clients or grpc_admin_clients to use %s", config.Signer.GRPCListenAddr)
+		}
+		grpcTCPServer = signer.NewGRPCServer(h,
+			grpc.Creds(creds),
+			grpc.UnaryInterceptor(h.AllowedClientsInterceptor(config.Signer.GRPCAllowedClients, config.Signer.GRPCAdminClients)),
+		)
+		go func() {
+			logger.Infof("Serving gRPC on %s", config.Signer.GRPCListenAddr)
+			if err := grpcTCPServer.Serve(grpcListener); err != nil {
+				logger.Fatalf("gRPC server failed: %v", err)
+			}
+		}()
+	}
+
 	// Start server
-	logger.Info("Starting server on %s", config.Signer.SocketPath)
+	logger.Infof("Starting server on %s", config.Signer.SocketPath)
 	go func() {
 		for {
 			conn, err := listener.Accept()
 			if err != nil {
-				logger.Error("Failed to accept connection: %v", err)
+				logger.Errorf("Failed to accept connection: %v", err)
 				continue
 			}
 			go h.HandleConnection(conn)
 		}
 	}()
 
-	// Wait for interrupt signal
+	// Publish CRLs and answer OCSP requests over HTTP at the configured
+	// URLs, along with the SSH CA key and KRL
+	stopCRL := make(chan struct{})
+	var httpServer *http.Server
+	httpMux := http.NewServeMux()
+	if config.Signer.CRLDistributionURL != "" {
+		if err := s.RegisterCRLRoutes(httpMux); err != nil {
+			logger.Fatalf("Failed to register CRL routes: %v", err)
+		}
+		go s.RunCRLScheduler(stopCRL)
+	} else {
+		logger.Warn("No crl_distribution_url configured; CRLs will not be published")
+	}
+	if config.Signer.OCSPURL != "" {
+		if err := s.RegisterOCSPRoutes(httpMux); err != nil {
+			logger.Fatalf("Failed to register OCSP routes: %v", err)
+		}
+	}
+	sshPublished := config.Signer.SSHCAKeyURL != "" || config.Signer.SSHKRLURL != ""
+	if sshPublished {
+		if err := s.RegisterSSHRoutes(httpMux); err != nil {
+			logger.Fatalf("Failed to register SSH CA routes: %v", err)
+		}
+	}
+	if config.Signer.CRLDistributionURL != "" || config.Signer.OCSPURL != "" || sshPublished {
+		httpServer = &http.Server{
+			Addr:         config.Signer.HTTPListenAddr,
+			Handler:      httpMux,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+		}
+		go func() {
+			logger.Infof("Serving CRL/OCSP/SSH CA on %s", config.Signer.HTTPListenAddr)
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatalf("CRL/OCSP server failed: %v", err)
+			}
+		}()
+	}
+
+	// Wait for interrupt signal; SIGUSR1 forces a new full CRL and SIGHUP
+	// reloads the issuance policy and the issuing CAs
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGHUP)
+	for sig := range quit {
+		if sig == syscall.SIGHUP {
+			if err := reloadPolicy(*configPath, s); err != nil {
+				logger.Errorf("Failed to reload the issuance policy, keeping the current one: %v", err)
+			} else {
+				logger.Infof("Reloaded the issuance policy")
+			}
+			reloaded, err := reloadCAs(*configPath, s)
+			if err != nil {
+				logger.Errorf("Failed to reload issuing CAs, keeping the current ones: %v", err)
+				continue
+			}
+			closeCAs(cas)
+			cas = reloaded
+			logger.Infof("Reloaded %d issuing CAs", len(cas))
+			continue
+		}
+		if sig != syscall.SIGUSR1 {
+			break
+		}
+		if _, err := s.GenerateCRL(); err != nil {
+			logger.Errorf("On-demand CRL generation failed: %v", err)
+		}
+	}
 
 	// Shutdown server
 	logger.Info("Shutting down server...")
+	close(stopCRL)
+	if httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := httpServer.Shutdown(ctx); err != nil {
+			logger.Errorf("Failed to shut down CRL/OCSP server: %v", err)
+		}
+		cancel()
+	}
+	if grpcTCPServer != nil {
+		grpcTCPServer.GracefulStop()
+	}
 	if err := listener.Close(); err != nil {
-		logger.Error("Failed to close listener: %v", err)
+		logger.Errorf("Failed to close listener: %v", err)
 	}
+	grpcServer.GracefulStop()
 
 	// Remove socket file
 	if err := os.Remove(config.Signer.SocketPath); err != nil && !os.IsNotExist(err) {
-		logger.Error("Failed to remove socket file: %v", err)
+		logger.Errorf("Failed to remove socket file: %v", err)
 	}
 
 	logger.Info("Server exited properly")
 }
+
+// issuingCAs describes the CAs opened by cakey.OpenAll for the signer: the
+// main CA first, then those of issuing_cas
+func issuingCAs(cfg *config.Config, cas []*cakey.CA) []signer.IssuingCA {
+	issuing := make([]signer.IssuingCA, len(cas))
+	for i, ca := range cas {
+		issuing[i] = signer.IssuingCA{
+			Certificate: ca.Certificate,
+			Key:         ca.Key,
+			Chain:       ca.Chain,
+		}
+		if i == 0 {
+			issuing[i].CRLDistributionURL = cfg.Signer.CRLDistributionURL
+			issuing[i].DeltaCRLURL = cfg.Signer.DeltaCRLURL
+			issuing[i].AIAIssuerURL = cfg.Signer.AIAIssuerURL
+			continue
+		}
+		ic := cfg.Signer.IssuingCAs[i-1]
+		issuing[i].ActivateAt = ic.ActivateAt
+		issuing[i].CRLDistributionURL = ic.CRLDistributionURL
+		issuing[i].DeltaCRLURL = ic.DeltaCRLURL
+		issuing[i].AIAIssuerURL = ic.AIAIssuerURL
+	}
+	return issuing
+}
+
+// reloadPolicy reads the config file again and switches the signer to the
+// issuance policy it names. Like reloadCAs, it leaves the rest of the
+// configuration alone; SIGHUP runs both.
+func reloadPolicy(configPath string, s *signer.Signer) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	policy, err := signer.LoadPolicy(cfg.Signer.PolicyPath)
+	if err != nil {
+		return err
+	}
+	s.SetPolicy(policy)
+	return nil
+}
+
+// reloadCAs reads the config file again and switches the signer to the CAs
+// it lists; nothing else is reloaded. Encrypted keys need a passphrase file
+// or credential, as the environment variable is gone by now.
+func reloadCAs(configPath string, s *signer.Signer) ([]*cakey.CA, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	cas, err := cakey.OpenAll(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SetIssuingCAs(issuingCAs(cfg, cas)); err != nil {
+		closeCAs(cas)
+		return nil, err
+	}
+	return cas, nil
+}
+
+// closeCAs releases the keys of cas
+func closeCAs(cas []*cakey.CA) {
+	for _, ca := range cas {
+		ca.Close()
+	}
+}
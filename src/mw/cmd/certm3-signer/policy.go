@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+	"github.com/ogt11/certm3/mw/internal/signer"
+)
+
+// policyUsage describes the policy subcommand
+const policyUsage = `usage: certm3-signer policy test [flags]
+
+Evaluates a CSR for a user against the issuance policy without signing or
+asking the group source, and reports the groups, roles and validity the
+certificate would get or why it would be denied. Exits 0 if the request
+would be allowed, 1 if denied and 2 on errors.
+`
+
+// runPolicyCommand runs "certm3-signer policy ..." and returns the exit
+// status
+func runPolicyCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprint(stderr, policyUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("policy test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, policyUsage+"\n")
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", "config.yaml", "Path to config file")
+	policyPath := flags.String("policy", "", "Policy file (default: the config's policy_path)")
+	csrPath := flags.String("csr", "", "PEM CSR to evaluate")
+	username := flags.String("user", "", "Username the request is authenticated for")
+	requested := flags.String("groups", "", "Comma-separated groups requested")
+	member := flags.String("member-of", "", "Comma-separated groups the user is in (default: the requested groups)")
+	profile := flags.String("profile", "", "Certificate profile (default: the config's default_profile)")
+	asJSON := flags.Bool("json", false, "Print the decision as JSON")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *csrPath == "" || *username == "" {
+		flags.Usage()
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to load config: %v\n", err)
+		return 2
+	}
+	if *policyPath == "" {
+		*policyPath = cfg.Signer.PolicyPath
+	}
+	policy, err := signer.LoadPolicy(*policyPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to load policy: %v\n", err)
+		return 2
+	}
+	csrPEM, err := os.ReadFile(*csrPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to read CSR: %v\n", err)
+		return 2
+	}
+
+	requestedGroups := splitList(*requested)
+	memberGroups := requestedGroups
+	if *member != "" {
+		memberGroups = splitList(*member)
+	}
+	decision, err := signer.EvaluateOffline(cfg, policy, csrPEM, *username, requestedGroups, memberGroups, *profile)
+	if err != nil {
+		fmt.Fprintf(stderr, "Request rejected before policy evaluation: %v\n", err)
+		if errors.Is(err, signer.ErrPolicyDenied) || errors.Is(err, signer.ErrSubjectMismatch) {
+			return 1
+		}
+		return 2
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]interface{}{
+			"allowed":  len(decision.Reasons) == 0,
+			"groups":   decision.Groups,
+			"roles":    decision.Roles,
+			"validity": decision.Validity.String(),
+			"reasons":  decision.Reasons,
+		})
+	} else if len(decision.Reasons) == 0 {
+		fmt.Fprintf(stdout, "ALLOW\ngroups:   %s\nroles:    %s\nvalidity: %s\n",
+			strings.Join(decision.Groups, ", "), strings.Join(decision.Roles, ", "), decision.Validity)
+	} else {
+		fmt.Fprintln(stdout, "DENY")
+		for _, reason := range decision.Reasons {
+			fmt.Fprintf(stdout, "  %s: %s\n", reason.Rule, reason.Message)
+		}
+	}
+	if len(decision.Reasons) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,244 @@
+package acme
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// EABKey is an external account binding key handed to a user, who gives it
+// to their ACME client
+type EABKey struct {
+	KeyID   string
+	HMACKey []byte
+	Expires time.Time
+}
+
+// CreateEABKey creates a binding key for user. Until it expires unused, it
+// can bind one new ACME account to the user.
+func (s *Server) CreateEABKey(user User) (*EABKey, error) {
+	if user.ID == "" || user.Username == "" {
+		return nil, fmt.Errorf("binding keys need a user ID and username")
+	}
+	hmacKey := make([]byte, 32)
+	if _, err := rand.Read(hmacKey); err != nil {
+		return nil, fmt.Errorf("failed to generate binding key: %v", err)
+	}
+	now := time.Now().UTC()
+	key := &eabKey{
+		ID:        newID(),
+		HMACKey:   hmacKey,
+		UserID:    user.ID,
+		Username:  user.Username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.cfg.EABKeyTTL),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.st.prune(now)
+	s.st.EABKeys[key.ID] = key
+	if err := s.st.save(s.cfg.StatePath); err != nil {
+		delete(s.st.EABKeys, key.ID)
+		return nil, err
+	}
+	s.logger.LogSecurityEvent("acme_eab_key_created", map[string]interface{}{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"key_id":   key.ID,
+	})
+	return &EABKey{KeyID: key.ID, HMACKey: hmacKey, Expires: key.ExpiresAt}, nil
+}
+
+// accountJSON is the account object (RFC 8555 section 7.1.2)
+func (s *Server) accountJSON(acct *account) map[string]interface{} {
+	obj := map[string]interface{}{
+		"status": acct.Status,
+		"orders": s.url("/account/%s/orders", acct.ID),
+	}
+	if len(acct.Contact) > 0 {
+		obj["contact"] = acct.Contact
+	}
+	return obj
+}
+
+// checkContacts accepts mailto: contacts only
+func checkContacts(contacts []string) *problem {
+	for _, contact := range contacts {
+		addr := strings.TrimPrefix(contact, "mailto:")
+		if addr == contact {
+			return newProblem(http.StatusBadRequest, "unsupportedContact", "only mailto: contacts are supported")
+		}
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return newProblem(http.StatusBadRequest, "invalidContact", "invalid contact %q", contact)
+		}
+	}
+	return nil
+}
+
+// newAccount creates an account bound to the user who holds the external
+// account binding key, or finds the account for the request's key (RFC 8555
+// section 7.3)
+func (s *Server) newAccount(w http.ResponseWriter, r *http.Request, req *request) *problem {
+	var payload struct {
+		Contact                []string        `json:"contact"`
+		TermsOfServiceAgreed   bool            `json:"termsOfServiceAgreed"`
+		OnlyReturnExisting     bool            `json:"onlyReturnExisting"`
+		ExternalAccountBinding json.RawMessage `json:"externalAccountBinding"`
+	}
+	if prob := req.decode(&payload); prob != nil {
+		return prob
+	}
+	tp, err := thumbprint(req.key)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "badPublicKey", "%v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing := s.st.accountByThumbprint(tp); existing != nil {
+		w.Header().Set("Location", s.url("/account/%s", existing.ID))
+		writeJSON(w, http.StatusOK, s.accountJSON(existing))
+		return nil
+	}
+	if payload.OnlyReturnExisting {
+		return newProblem(http.StatusBadRequest, "accountDoesNotExist", "no account exists with this key")
+	}
+	if prob := checkContacts(payload.Contact); prob != nil {
+		return prob
+	}
+	if len(payload.ExternalAccountBinding) == 0 {
+		return newProblem(http.StatusBadRequest, "externalAccountRequired",
+			"accounts must be bound to a certM3 user; create a binding key in certM3")
+	}
+
+	binding, err := parseEAB(payload.ExternalAccountBinding)
+	if err != nil {
+		return malformed("%v", err)
+	}
+	key, ok := s.st.EABKeys[binding.KeyID]
+	now := time.Now()
+	if !ok || key.AccountID != "" || now.After(key.ExpiresAt) {
+		s.logger.LogSecurityEvent("acme_eab_rejected", map[string]interface{}{
+			"key_id":    binding.KeyID,
+			"remote_ip": r.RemoteAddr,
+			"reason":    "unknown, used or expired key",
+		})
+		s.metrics.RecordSecurityEvent("acme_eab_rejected")
+		return unauthorized("external account binding key is unknown, used or expired")
+	}
+	if err := binding.verify(key.HMACKey, req.url, tp); err != nil {
+		s.logger.LogSecurityEvent("acme_eab_rejected", map[string]interface{}{
+			"key_id":    binding.KeyID,
+			"remote_ip": r.RemoteAddr,
+			"reason":    err.Error(),
+		})
+		s.metrics.RecordSecurityEvent("acme_eab_rejected")
+		return unauthorized("%v", err)
+	}
+
+	acct := &account{
+		ID:         newID(),
+		Status:     statusValid,
+		Contact:    payload.Contact,
+		Key:        req.jwk,
+		Thumbprint: tp,
+		UserID:     key.UserID,
+		Username:   key.Username,
+		EABKeyID:   key.ID,
+		CreatedAt:  now.UTC(),
+	}
+	s.st.Accounts[acct.ID] = acct
+	key.AccountID = acct.ID
+	if err := s.st.save(s.cfg.StatePath); err != nil {
+		delete(s.st.Accounts, acct.ID)
+		key.AccountID = ""
+		return serverInternal("%v", err)
+	}
+	s.logger.LogSecurityEvent("acme_account_created", map[string]interface{}{
+		"account_id": acct.ID,
+		"user_id":    acct.UserID,
+		"username":   acct.Username,
+		"key_id":     key.ID,
+	})
+
+	w.Header().Set("Location", s.url("/account/%s", acct.ID))
+	writeJSON(w, http.StatusCreated, s.accountJSON(acct))
+	return nil
+}
+
+// updateAccount returns, updates or deactivates the requesting account
+// (RFC 8555 sections 7.3.2 and 7.3.6)
+func (s *Server) updateAccount(w http.ResponseWriter, r *http.Request, req *request) *problem {
+	if mux.Vars(r)["id"] != req.account.ID {
+		return unauthorized("requests for an account must be signed by it")
+	}
+	var payload struct {
+		Contact []string `json:"contact"`
+		Status  string   `json:"status"`
+	}
+	if !req.postAsGet() {
+		if prob := req.decode(&payload); prob != nil {
+			return prob
+		}
+	}
+	if payload.Status != "" && payload.Status != statusDeactivated {
+		return malformed("accounts can only be deactivated")
+	}
+	if payload.Contact != nil {
+		if prob := checkContacts(payload.Contact); prob != nil {
+			return prob
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acct := s.st.Accounts[req.account.ID]
+	if payload.Contact != nil || payload.Status != "" {
+		saved := *acct
+		if payload.Contact != nil {
+			acct.Contact = payload.Contact
+		}
+		if payload.Status != "" {
+			acct.Status = payload.Status
+		}
+		if err := s.st.save(s.cfg.StatePath); err != nil {
+			*acct = saved
+			return serverInternal("%v", err)
+		}
+		if payload.Status != "" {
+			s.logger.LogSecurityEvent("acme_account_deactivated", map[string]interface{}{
+				"account_id": acct.ID,
+				"username":   acct.Username,
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, s.accountJSON(acct))
+	return nil
+}
+
+// listOrders returns the URLs of the account's unexpired orders (RFC 8555
+// section 7.1.2.1)
+func (s *Server) listOrders(w http.ResponseWriter, r *http.Request, req *request) *problem {
+	if mux.Vars(r)["id"] != req.account.ID {
+		return unauthorized("requests for an account must be signed by it")
+	}
+	now := time.Now()
+	s.mu.Lock()
+	orders := []string{}
+	for _, o := range s.st.Orders {
+		if o.AccountID == req.account.ID && o.Expires.After(now) {
+			orders = append(orders, s.url("/order/%s", o.ID))
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"orders": orders})
+	return nil
+}
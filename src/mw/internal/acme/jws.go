@@ -0,0 +1,245 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// jwsMessage is a JWS in the flattened JSON serialization ACME uses for
+// every POST (RFC 8555 section 6.2)
+type jwsMessage struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// jwsHeader is the protected header of an ACME request
+type jwsHeader struct {
+	Alg   string          `json:"alg"`
+	Nonce string          `json:"nonce"`
+	URL   string          `json:"url"`
+	JWK   json.RawMessage `json:"jwk,omitempty"`
+	KID   string          `json:"kid,omitempty"`
+}
+
+// jsonWebKey is the public part of an RSA or EC JWK (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// decodeB64 decodes unpadded base64url, as JOSE uses throughout
+func decodeB64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// parseJWK returns the public key in a JWK
+func parseJWK(raw []byte) (crypto.PublicKey, error) {
+	var jwk jsonWebKey
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return nil, fmt.Errorf("invalid JWK: %v", err)
+	}
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeB64(jwk.N)
+		if err != nil || len(n) == 0 {
+			return nil, fmt.Errorf("invalid RSA modulus")
+		}
+		e, err := decodeB64(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		key := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		return key, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeB64(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate")
+		}
+		y, err := decodeB64(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate")
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("EC point is not on the curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// thumbprint returns the base64url RFC 7638 SHA-256 thumbprint of key,
+// which identifies an account key
+func thumbprint(key crypto.PublicKey) (string, error) {
+	var members string
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		e := big.NewInt(int64(key.E)).Bytes()
+		members = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+			base64.RawURLEncoding.EncodeToString(e),
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()))
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		members = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`,
+			key.Curve.Params().Name,
+			base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+			base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))))
+	default:
+		return "", fmt.Errorf("unsupported key type %T", key)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// verifySignature checks a JWS signature made with alg by key over the
+// signing input
+func verifySignature(alg string, key crypto.PublicKey, input, sig []byte) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return fmt.Errorf("algorithm %s does not match an RSA key", alg)
+		}
+		digest := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig)
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch {
+		case alg == "ES256" && key.Curve == elliptic.P256():
+			sum := sha256.Sum256(input)
+			digest = sum[:]
+		case alg == "ES384" && key.Curve == elliptic.P384():
+			sum := sha512.Sum384(input)
+			digest = sum[:]
+		case alg == "ES512" && key.Curve == elliptic.P521():
+			sum := sha512.Sum512(input)
+			digest = sum[:]
+		default:
+			return fmt.Errorf("algorithm %s does not match the %s key", alg, key.Curve.Params().Name)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("ECDSA signature has the wrong length")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("ECDSA signature does not verify")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %T", key)
+}
+
+// supportedAlgorithm reports whether alg may sign ACME requests
+func supportedAlgorithm(alg string) bool {
+	switch alg {
+	case "RS256", "ES256", "ES384", "ES512":
+		return true
+	}
+	return false
+}
+
+// eabBinding is the parsed externalAccountBinding of a newAccount request
+// (RFC 8555 section 7.3.4): a JWS made with a MAC key the CA gave the user,
+// whose payload is the account key
+type eabBinding struct {
+	KeyID string
+	url   string
+	jwk   []byte
+	input []byte
+	mac   []byte
+}
+
+// parseEAB decodes an externalAccountBinding without checking its MAC,
+// which needs the key it names
+func parseEAB(raw json.RawMessage) (*eabBinding, error) {
+	var msg jwsMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, fmt.Errorf("invalid externalAccountBinding: %v", err)
+	}
+	protected, err := decodeB64(msg.Protected)
+	if err != nil {
+		return nil, fmt.Errorf("invalid externalAccountBinding header encoding")
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(protected, &header); err != nil {
+		return nil, fmt.Errorf("invalid externalAccountBinding header: %v", err)
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("externalAccountBinding must use HS256")
+	}
+	if header.KID == "" || header.Nonce != "" || len(header.JWK) != 0 {
+		return nil, fmt.Errorf("externalAccountBinding header must have a kid and no nonce or jwk")
+	}
+	jwk, err := decodeB64(msg.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid externalAccountBinding payload encoding")
+	}
+	mac, err := decodeB64(msg.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid externalAccountBinding signature encoding")
+	}
+	return &eabBinding{
+		KeyID: header.KID,
+		url:   header.URL,
+		jwk:   jwk,
+		input: []byte(msg.Protected + "." + msg.Payload),
+		mac:   mac,
+	}, nil
+}
+
+// verify checks that the binding was made for url with hmacKey over the
+// account key with the given thumbprint
+func (b *eabBinding) verify(hmacKey []byte, url, accountThumbprint string) error {
+	if b.url != url {
+		return fmt.Errorf("externalAccountBinding is for a different URL")
+	}
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(b.input)
+	if !hmac.Equal(mac.Sum(nil), b.mac) {
+		return fmt.Errorf("externalAccountBinding MAC does not verify")
+	}
+	key, err := parseJWK(b.jwk)
+	if err != nil {
+		return fmt.Errorf("externalAccountBinding payload: %v", err)
+	}
+	bound, err := thumbprint(key)
+	if err != nil {
+		return err
+	}
+	if bound != accountThumbprint {
+		return fmt.Errorf("externalAccountBinding is for a different account key")
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package acme
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SpoolMailer writes messages as files to a mail spool directory, the way
+// the backend sends its validation emails
+type SpoolMailer struct {
+	Dir string
+}
+
+// Send writes the message to the spool
+func (m SpoolMailer) Send(to, username, subject, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("header values must not contain line breaks")
+	}
+	timestamp := strings.NewReplacer(":", "-", ".", "-").Replace(time.Now().UTC().Format("2006-01-02T15:04:05.000Z"))
+	name := fmt.Sprintf("%s-%s-acme.txt", timestamp, filepath.Base(username))
+	content := fmt.Sprintf("\nTo: %s\nSubject: %s\n\n%s", to, subject, body)
+	if err := os.WriteFile(filepath.Join(m.Dir, name), []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write email: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,665 @@
+package acme
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+// challengeEmailLink is the challenge type for email identifiers: the
+// server mails a confirmation link to the address, and following it proves
+// control of the mailbox
+const challengeEmailLink = "email-link-00"
+
+// issueTimeout bounds how long finalize waits for the signer
+const issueTimeout = 30 * time.Second
+
+// normalizeEmail returns the canonical form of an email identifier, or ""
+// if value is not a bare address
+func normalizeEmail(value string) string {
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Name != "" || addr.Address != value {
+		return ""
+	}
+	return strings.ToLower(addr.Address)
+}
+
+// refreshAuthorization expires a pending or valid authorization past its
+// lifetime; callers must hold mu
+func refreshAuthorization(authz *authorization, now time.Time) {
+	if (authz.Status == statusPending || authz.Status == statusValid) && now.After(authz.Expires) {
+		authz.Status = statusExpired
+	}
+}
+
+// refreshOrder moves an order on as its authorizations change or it
+// expires; callers must hold mu
+func (s *Server) refreshOrder(o *order, now time.Time) {
+	if o.Status != statusPending && o.Status != statusReady {
+		return
+	}
+	if now.After(o.Expires) {
+		o.Status = statusInvalid
+		o.Error = unauthorized("order expired")
+		s.metrics.RecordACMEOrder("expired")
+		return
+	}
+	if o.Status == statusReady {
+		return
+	}
+	ready := true
+	for _, id := range o.Authorizations {
+		authz, ok := s.st.Authorizations[id]
+		if !ok {
+			ready = false
+			continue
+		}
+		refreshAuthorization(authz, now)
+		switch authz.Status {
+		case statusValid:
+		case statusPending:
+			ready = false
+		default:
+			o.Status = statusInvalid
+			o.Error = unauthorized("authorization for %s is %s", authz.Identifier.Value, authz.Status)
+			s.metrics.RecordACMEOrder("unauthorized")
+			return
+		}
+	}
+	if ready {
+		o.Status = statusReady
+	}
+}
+
+// orderJSON is the order object (RFC 8555 section 7.1.3)
+func (s *Server) orderJSON(o *order) map[string]interface{} {
+	authzs := make([]string, len(o.Authorizations))
+	for i, id := range o.Authorizations {
+		authzs[i] = s.url("/authz/%s", id)
+	}
+	obj := map[string]interface{}{
+		"status":         o.Status,
+		"expires":        o.Expires.UTC().Format(time.RFC3339),
+		"identifiers":    o.Identifiers,
+		"authorizations": authzs,
+		"finalize":       s.url("/order/%s/finalize", o.ID),
+	}
+	if o.CertificateID != "" {
+		obj["certificate"] = s.url("/cert/%s", o.CertificateID)
+	}
+	if o.Error != nil {
+		obj["error"] = o.Error
+	}
+	return obj
+}
+
+// challengeJSON is the challenge object (RFC 8555 section 7.1.5)
+func (s *Server) challengeJSON(ch *challenge) map[string]interface{} {
+	obj := map[string]interface{}{
+		"type":   ch.Type,
+		"url":    s.url("/chall/%s", ch.ID),
+		"status": ch.Status,
+		"token":  ch.Token,
+	}
+	if !ch.Validated.IsZero() {
+		obj["validated"] = ch.Validated.UTC().Format(time.RFC3339)
+	}
+	if ch.Error != nil {
+		obj["error"] = ch.Error
+	}
+	return obj
+}
+
+// authorizationJSON is the authorization object (RFC 8555 section 7.1.4);
+// callers must hold mu
+func (s *Server) authorizationJSON(authz *authorization) map[string]interface{} {
+	challenges := []map[string]interface{}{}
+	for _, id := range authz.Challenges {
+		if ch, ok := s.st.Challenges[id]; ok {
+			challenges = append(challenges, s.challengeJSON(ch))
+		}
+	}
+	return map[string]interface{}{
+		"identifier": authz.Identifier,
+		"status":     authz.Status,
+		"expires":    authz.Expires.UTC().Format(time.RFC3339),
+		"challenges": challenges,
+	}
+}
+
+// newOrder creates an order for email identifiers (RFC 8555 section
+// 7.4). Authorizations the account already holds are reused; the user's
+// own address is authorized without a challenge.
+func (s *Server) newOrder(w http.ResponseWriter, r *http.Request, req *request) *problem {
+	var payload struct {
+		Identifiers []identifier `json:"identifiers"`
+		NotBefore   string       `json:"notBefore"`
+		NotAfter    string       `json:"notAfter"`
+	}
+	if prob := req.decode(&payload); prob != nil {
+		return prob
+	}
+	if payload.NotBefore != "" || payload.NotAfter != "" {
+		return malformed("notBefore and notAfter are not supported; validity is set by the certificate profile")
+	}
+	if len(payload.Identifiers) == 0 || len(payload.Identifiers) > maxIdentifiers {
+		return malformed("orders need between 1 and %d identifiers", maxIdentifiers)
+	}
+	seen := make(map[string]bool)
+	var identifiers []identifier
+	for _, id := range payload.Identifiers {
+		if id.Type != "email" {
+			return newProblem(http.StatusBadRequest, "unsupportedIdentifier", "only email identifiers are supported, not %q", id.Type)
+		}
+		email := normalizeEmail(id.Value)
+		if email == "" {
+			return newProblem(http.StatusBadRequest, "rejectedIdentifier", "%q is not an email address", id.Value)
+		}
+		if !seen[email] {
+			seen[email] = true
+			identifiers = append(identifiers, identifier{Type: "email", Value: email})
+		}
+	}
+	sort.Slice(identifiers, func(i, j int) bool { return identifiers[i].Value < identifiers[j].Value })
+
+	// The user must still exist; their address is pre-authorized
+	ctx, cancel := context.WithTimeout(r.Context(), issueTimeout)
+	defer cancel()
+	user, err := s.issuer.LookupUser(ctx, req.account.UserID)
+	if err != nil {
+		return serverInternal("failed to look up certM3 user %s: %v", req.account.Username, err)
+	}
+	userEmail := strings.ToLower(user.Email)
+
+	now := time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.st.prune(now)
+
+	o := &order{
+		ID:          newID(),
+		AccountID:   req.account.ID,
+		Status:      statusPending,
+		Expires:     now.Add(s.cfg.OrderTTL),
+		Identifiers: identifiers,
+	}
+	for _, id := range identifiers {
+		authz := s.reusableAuthorization(req.account.ID, id, now)
+		if authz == nil {
+			authz = &authorization{
+				ID:         newID(),
+				AccountID:  req.account.ID,
+				Identifier: id,
+				Status:     statusPending,
+				Expires:    o.Expires,
+			}
+			if id.Value == userEmail {
+				authz.Status = statusValid
+				authz.PreApproved = true
+			} else {
+				ch := &challenge{
+					ID:              newID(),
+					AuthorizationID: authz.ID,
+					Type:            challengeEmailLink,
+					Status:          statusPending,
+					Token:           newID(),
+				}
+				s.st.Challenges[ch.ID] = ch
+				authz.Challenges = []string{ch.ID}
+			}
+			s.st.Authorizations[authz.ID] = authz
+		}
+		o.Authorizations = append(o.Authorizations, authz.ID)
+	}
+	s.refreshOrder(o, now)
+	s.st.Orders[o.ID] = o
+	if err := s.st.save(s.cfg.StatePath); err != nil {
+		return serverInternal("%v", err)
+	}
+	s.logger.Infof("ACME order %s for %s: %d identifiers, %s", o.ID, req.account.Username, len(identifiers), o.Status)
+
+	w.Header().Set("Location", s.url("/order/%s", o.ID))
+	writeJSON(w, http.StatusCreated, s.orderJSON(o))
+	return nil
+}
+
+// reusableAuthorization returns an unexpired authorization the account
+// already holds for id, other than a pre-approval, which is decided anew
+// for each order; callers must hold mu
+func (s *Server) reusableAuthorization(accountID string, id identifier, now time.Time) *authorization {
+	for _, authz := range s.st.Authorizations {
+		if authz.AccountID != accountID || authz.Identifier != id || authz.PreApproved {
+			continue
+		}
+		refreshAuthorization(authz, now)
+		if authz.Status == statusValid || authz.Status == statusPending {
+			return authz
+		}
+	}
+	return nil
+}
+
+// lookupOrder returns the account's order with the given ID; callers must
+// hold mu
+func (s *Server) lookupOrder(id string, acct *account) (*order, *problem) {
+	o, ok := s.st.Orders[id]
+	if !ok || o.AccountID != acct.ID {
+		return nil, notFound("no such order")
+	}
+	return o, nil
+}
+
+// getOrder returns an order (RFC 8555 section 7.4)
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request, req *request) *problem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, prob := s.lookupOrder(mux.Vars(r)["id"], req.account)
+	if prob != nil {
+		return prob
+	}
+	s.refreshOrder(o, time.Now())
+	writeJSON(w, http.StatusOK, s.orderJSON(o))
+	return nil
+}
+
+// finalize issues the certificate for a ready order (RFC 8555 section
+// 7.4). The CSR must name the account's user as its CommonName, as every
+// certM3 certificate does, and exactly the order's addresses.
+func (s *Server) finalize(w http.ResponseWriter, r *http.Request, req *request) *problem {
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if prob := req.decode(&payload); prob != nil {
+		return prob
+	}
+	der, err := decodeB64(payload.CSR)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "badCSR", "invalid CSR encoding")
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "badCSR", "invalid CSR: %v", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return newProblem(http.StatusBadRequest, "badCSR", "CSR signature: %v", err)
+	}
+	if csr.Subject.CommonName != req.account.Username {
+		return newProblem(http.StatusBadRequest, "badCSR", "CSR CommonName must be the certM3 username %q", req.account.Username)
+	}
+	if len(csr.DNSNames) > 0 || len(csr.IPAddresses) > 0 || len(csr.URIs) > 0 {
+		return newProblem(http.StatusBadRequest, "badCSR", "CSR may only contain email addresses")
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	o, prob := s.lookupOrder(mux.Vars(r)["id"], req.account)
+	if prob != nil {
+		s.mu.Unlock()
+		return prob
+	}
+	s.refreshOrder(o, now)
+	if o.Status != statusReady {
+		s.mu.Unlock()
+		return newProblem(http.StatusForbidden, "orderNotReady", "order is %s", o.Status)
+	}
+	requested := make(map[string]bool)
+	for _, email := range csr.EmailAddresses {
+		requested[strings.ToLower(email)] = true
+	}
+	matches := len(requested) == len(o.Identifiers)
+	for _, id := range o.Identifiers {
+		matches = matches && requested[id.Value]
+	}
+	if !matches {
+		s.mu.Unlock()
+		return newProblem(http.StatusBadRequest, "badCSR", "CSR email addresses must be exactly the order's identifiers")
+	}
+	o.Status = statusProcessing
+	if err := s.st.save(s.cfg.StatePath); err != nil {
+		o.Status = statusReady
+		s.mu.Unlock()
+		return serverInternal("%v", err)
+	}
+	orderID := o.ID
+	s.mu.Unlock()
+
+	// Talk to the signer without holding the lock
+	ctx, cancel := context.WithTimeout(r.Context(), issueTimeout)
+	defer cancel()
+	user := User{ID: req.account.UserID, Username: req.account.Username}
+	csrPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	certPEM, chainPEM, issueErr := s.issuer.Issue(ctx, user, "acme-"+orderID, csrPEM)
+
+	var cert *x509.Certificate
+	if issueErr == nil {
+		block, _ := pem.Decode([]byte(certPEM))
+		if block == nil {
+			issueErr = fmt.Errorf("signer returned a certificate that is not PEM encoded")
+		} else if cert, err = x509.ParseCertificate(block.Bytes); err != nil {
+			issueErr = fmt.Errorf("failed to parse issued certificate: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o = s.st.Orders[orderID]
+	if issueErr != nil {
+		prob = issueProblem(issueErr)
+		o.Status = statusInvalid
+		o.Error = prob
+		s.metrics.RecordACMEOrder("failed")
+		if err := s.st.save(s.cfg.StatePath); err != nil {
+			s.logger.Errorf("Failed to save ACME state: %v", err)
+		}
+		return prob
+	}
+
+	issued := &certificate{
+		ID:        newID(),
+		AccountID: req.account.ID,
+		Serial:    cert.SerialNumber.Text(16),
+		Chain:     strings.TrimRight(certPEM, "\n") + "\n" + chainPEM,
+		NotAfter:  cert.NotAfter,
+	}
+	s.st.Certificates[issued.ID] = issued
+	o.CertificateID = issued.ID
+	o.Status = statusValid
+	s.metrics.RecordACMEOrder("valid")
+	if err := s.st.save(s.cfg.StatePath); err != nil {
+		// The signer issued it; keep serving it from memory
+		s.logger.Errorf("Failed to save ACME state after issuing %s: %v", issued.Serial, err)
+	}
+	s.logger.LogSecurityEvent("acme_certificate_issued", map[string]interface{}{
+		"account_id": req.account.ID,
+		"user_id":    req.account.UserID,
+		"username":   req.account.Username,
+		"order_id":   orderID,
+		"serial":     issued.Serial,
+	})
+
+	w.Header().Set("Location", s.url("/order/%s", orderID))
+	writeJSON(w, http.StatusOK, s.orderJSON(o))
+	return nil
+}
+
+// issueProblem describes a failed issuance. Only errors about the request
+// itself are shown to the client.
+func issueProblem(err error) *problem {
+	var perr *signerproto.Error
+	if errors.As(err, &perr) {
+		switch perr.Code {
+		case signerproto.CodeBadRequest, signerproto.CodeBadCSR, signerproto.CodePolicyDenied:
+			return newProblem(http.StatusBadRequest, "badCSR", "%s", perr.Message)
+		}
+	}
+	return serverInternal("failed to issue certificate: %v", err)
+}
+
+// getAuthorization returns or deactivates an authorization (RFC 8555
+// sections 7.5 and 7.5.2)
+func (s *Server) getAuthorization(w http.ResponseWriter, r *http.Request, req *request) *problem {
+	var payload struct {
+		Status string `json:"status"`
+	}
+	if !req.postAsGet() {
+		if prob := req.decode(&payload); prob != nil {
+			return prob
+		}
+		if payload.Status != statusDeactivated {
+			return malformed("authorizations can only be deactivated")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	authz, ok := s.st.Authorizations[mux.Vars(r)["id"]]
+	if !ok || authz.AccountID != req.account.ID {
+		return notFound("no such authorization")
+	}
+	refreshAuthorization(authz, time.Now())
+	if payload.Status == statusDeactivated {
+		if authz.Status != statusPending && authz.Status != statusValid {
+			return malformed("authorization is %s", authz.Status)
+		}
+		authz.Status = statusDeactivated
+		if err := s.st.save(s.cfg.StatePath); err != nil {
+			return serverInternal("%v", err)
+		}
+	}
+	writeJSON(w, http.StatusOK, s.authorizationJSON(authz))
+	return nil
+}
+
+// respondChallenge starts validation of an email-link-00 challenge by
+// mailing the confirmation link to the address (RFC 8555 section 7.5.1).
+// The challenge stays processing until the link is followed.
+func (s *Server) respondChallenge(w http.ResponseWriter, r *http.Request, req *request) *problem {
+	s.mu.Lock()
+	ch, ok := s.st.Challenges[mux.Vars(r)["id"]]
+	var authz *authorization
+	if ok {
+		authz, ok = s.st.Authorizations[ch.AuthorizationID]
+	}
+	if !ok || authz.AccountID != req.account.ID {
+		s.mu.Unlock()
+		return notFound("no such challenge")
+	}
+	refreshAuthorization(authz, time.Now())
+
+	var send bool
+	if !req.postAsGet() && ch.Status == statusPending {
+		if authz.Status != statusPending {
+			s.mu.Unlock()
+			return malformed("authorization is %s", authz.Status)
+		}
+		ch.Status = statusProcessing
+		ch.Secret = newID()
+		if err := s.st.save(s.cfg.StatePath); err != nil {
+			ch.Status = statusPending
+			ch.Secret = ""
+			s.mu.Unlock()
+			return serverInternal("%v", err)
+		}
+		send = true
+	}
+	to := authz.Identifier.Value
+	link := s.url("/chall/%s/confirm/%s", ch.ID, ch.Secret)
+	expires := authz.Expires
+	s.mu.Unlock()
+
+	if send {
+		subject := "Confirm your email address for certM3"
+		body := fmt.Sprintf(`An ACME client acting for certM3 user %s asked for a certificate
+containing this email address. If you requested it, confirm the address by
+following this link:
+
+   %s
+
+The link expires at %s. If you did not request a certificate, ignore this
+message.
+`, req.account.Username, link, expires.UTC().Format(time.RFC1123))
+		if err := s.mailer.Send(to, req.account.Username, subject, body); err != nil {
+			s.mu.Lock()
+			ch.Status = statusPending
+			ch.Secret = ""
+			s.st.save(s.cfg.StatePath)
+			s.mu.Unlock()
+			return serverInternal("failed to send confirmation email: %v", err)
+		}
+		s.logger.Infof("Sent ACME email confirmation for %s to %s", req.account.Username, to)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Add("Link", fmt.Sprintf("<%s>;rel=\"up\"", s.url("/authz/%s", authz.ID)))
+	writeJSON(w, http.StatusOK, s.challengeJSON(ch))
+	return nil
+}
+
+// confirmChallenge validates an email-link-00 challenge when the link
+// mailed for it is followed
+func (s *Server) confirmChallenge(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch, ok := s.st.Challenges[vars["id"]]
+	var authz *authorization
+	if ok {
+		authz, ok = s.st.Authorizations[ch.AuthorizationID]
+	}
+	if ok {
+		refreshAuthorization(authz, now)
+	}
+	if !ok || ch.Status != statusProcessing || authz.Status != statusPending ||
+		subtle.ConstantTimeCompare([]byte(ch.Secret), []byte(vars["secret"])) != 1 {
+		s.metrics.RecordACMERequest("confirm", "invalid")
+		http.Error(w, "Invalid or expired confirmation link", http.StatusNotFound)
+		return
+	}
+
+	ch.Status = statusValid
+	ch.Validated = now.UTC()
+	ch.Secret = ""
+	authz.Status = statusValid
+	authz.Expires = now.Add(s.cfg.AuthorizationTTL)
+	if err := s.st.save(s.cfg.StatePath); err != nil {
+		s.logger.Errorf("Failed to save ACME state: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.logger.LogSecurityEvent("acme_email_confirmed", map[string]interface{}{
+		"account_id": authz.AccountID,
+		"email":      authz.Identifier.Value,
+		"remote_ip":  r.RemoteAddr,
+	})
+	s.metrics.RecordACMERequest("confirm", "ok")
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s is confirmed. Your ACME client can now finish its order.\n", authz.Identifier.Value)
+}
+
+// getCertificate downloads an issued certificate chain (RFC 8555 section
+// 7.4.2)
+func (s *Server) getCertificate(w http.ResponseWriter, r *http.Request, req *request) *problem {
+	if !req.postAsGet() {
+		return malformed("certificates are fetched with POST-as-GET")
+	}
+	s.mu.Lock()
+	cert, ok := s.st.Certificates[mux.Vars(r)["id"]]
+	var chain string
+	if ok {
+		chain = cert.Chain
+	}
+	s.mu.Unlock()
+	if !ok || cert.AccountID != req.account.ID {
+		return notFound("no such certificate")
+	}
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(chain))
+	return nil
+}
+
+// revokeCertificate revokes a certificate (RFC 8555 section 7.6). The
+// request is signed either by an account of the user the certificate was
+// issued to, or by the certificate's own key.
+func (s *Server) revokeCertificate(w http.ResponseWriter, r *http.Request, req *request) *problem {
+	var payload struct {
+		Certificate string `json:"certificate"`
+		Reason      *int   `json:"reason"`
+	}
+	if prob := req.decode(&payload); prob != nil {
+		return prob
+	}
+	der, err := decodeB64(payload.Certificate)
+	if err != nil {
+		return malformed("invalid certificate encoding")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return malformed("invalid certificate: %v", err)
+	}
+	reason := 0
+	if payload.Reason != nil {
+		reason = *payload.Reason
+	}
+	// 7 is unused and removeFromCRL (8) only applies to delta CRLs
+	if reason < 0 || reason > 10 || reason == 7 || reason == 8 {
+		return newProblem(http.StatusBadRequest, "badRevocationReason", "unsupported revocation reason %d", reason)
+	}
+
+	user := User{Username: cert.Subject.CommonName}
+	if req.account != nil {
+		if cert.Subject.CommonName != req.account.Username {
+			return unauthorized("certificate was not issued to this account's user")
+		}
+		user.ID = req.account.UserID
+	} else {
+		certKey, err := thumbprint(cert.PublicKey)
+		if err != nil {
+			return unauthorized("certificate key does not match the request key")
+		}
+		reqKey, err := thumbprint(req.key)
+		if err != nil || reqKey != certKey {
+			return unauthorized("certificate key does not match the request key")
+		}
+	}
+
+	serial := cert.SerialNumber.Text(16)
+	s.mu.Lock()
+	for _, issued := range s.st.Certificates {
+		if issued.Serial == serial && issued.Revoked {
+			s.mu.Unlock()
+			return newProblem(http.StatusBadRequest, "alreadyRevoked", "certificate is already revoked")
+		}
+	}
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), issueTimeout)
+	defer cancel()
+	if err := s.issuer.Revoke(ctx, user, cert, reason); err != nil {
+		var perr *signerproto.Error
+		if errors.As(err, &perr) {
+			switch perr.Code {
+			case signerproto.CodeNotFound, signerproto.CodePermissionDenied:
+				return unauthorized("%s", perr.Message)
+			case signerproto.CodeBadRequest:
+				return malformed("%s", perr.Message)
+			}
+		}
+		return serverInternal("failed to revoke certificate: %v", err)
+	}
+
+	s.mu.Lock()
+	for _, issued := range s.st.Certificates {
+		if issued.Serial == serial {
+			issued.Revoked = true
+		}
+	}
+	if err := s.st.save(s.cfg.StatePath); err != nil {
+		s.logger.Errorf("Failed to save ACME state: %v", err)
+	}
+	s.mu.Unlock()
+
+	s.logger.LogSecurityEvent("acme_certificate_revoked", map[string]interface{}{
+		"serial":      serial,
+		"username":    user.Username,
+		"reason":      reason,
+		"by_cert_key": req.account == nil,
+	})
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
@@ -0,0 +1,54 @@
+package acme
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// problem is an ACME error, sent as an RFC 7807 problem document
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// Error implements error
+func (p *problem) Error() string {
+	return p.Type + ": " + p.Detail
+}
+
+// errorNS is the namespace of the ACME error types (RFC 8555 section 6.7)
+const errorNS = "urn:ietf:params:acme:error:"
+
+// newProblem returns an ACME error of the given type, a name in errorNS
+func newProblem(status int, kind, format string, args ...interface{}) *problem {
+	return &problem{
+		Type:   errorNS + kind,
+		Detail: fmt.Sprintf(format, args...),
+		Status: status,
+	}
+}
+
+func malformed(format string, args ...interface{}) *problem {
+	return newProblem(http.StatusBadRequest, "malformed", format, args...)
+}
+
+func unauthorized(format string, args ...interface{}) *problem {
+	return newProblem(http.StatusForbidden, "unauthorized", format, args...)
+}
+
+func notFound(format string, args ...interface{}) *problem {
+	return newProblem(http.StatusNotFound, "malformed", format, args...)
+}
+
+func serverInternal(format string, args ...interface{}) *problem {
+	return newProblem(http.StatusInternalServerError, "serverInternal", format, args...)
+}
+
+// kind returns the problem's ACME error name, for metrics
+func (p *problem) kind() string {
+	if len(p.Type) > len(errorNS) && p.Type[:len(errorNS)] == errorNS {
+		return p.Type[len(errorNS):]
+	}
+	return p.Type
+}
@@ -0,0 +1,349 @@
+// Package acme implements an ACME (RFC 8555) server in front of the certM3
+// signer, so automated clients can get certificates without the web
+// front-end.
+//
+// Every account is bound, by external account binding, to the certM3 user
+// who created the binding key, and acts for that user: certificates are
+// issued with the user's name as the subject, exactly as for the web
+// flow. Orders are for email identifiers (RFC 8823). The user's own
+// address is pre-authorized; other addresses are validated with the
+// email-link-00 challenge, which mails a confirmation link to the address.
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ogt11/certm3/mw/internal/logging"
+	"github.com/ogt11/certm3/mw/pkg/metrics"
+)
+
+// User is the certM3 user an ACME account acts for
+type User struct {
+	ID       string
+	Username string
+	Email    string
+}
+
+// Issuer issues and revokes certificates for ACME accounts, through the
+// signer
+type Issuer interface {
+	// LookupUser returns the user with the given backend ID
+	LookupUser(ctx context.Context, userID string) (User, error)
+
+	// Issue has the signer sign csrPEM for user and returns the PEM
+	// certificate and the PEM chain above it
+	Issue(ctx context.Context, user User, requestID, csrPEM string) (certPEM, chainPEM string, err error)
+
+	// Revoke revokes cert, which the signer must have issued to user,
+	// with an RFC 5280 reason code
+	Revoke(ctx context.Context, user User, cert *x509.Certificate, reason int) error
+}
+
+// Mailer sends the email-link-00 challenge messages
+type Mailer interface {
+	Send(to, username, subject, body string) error
+}
+
+// Config configures the ACME server
+type Config struct {
+	BaseURL          string // public URL the directory lives under
+	StatePath        string
+	OrderTTL         time.Duration
+	AuthorizationTTL time.Duration
+	EABKeyTTL        time.Duration
+}
+
+// Lifetime and size limits
+const (
+	nonceTTL       = time.Hour
+	maxNonces      = 100000
+	maxRequestSize = 64 * 1024
+	maxIdentifiers = 10
+)
+
+// Server is the ACME server
+type Server struct {
+	cfg     Config
+	prefix  string // path of BaseURL
+	issuer  Issuer
+	mailer  Mailer
+	logger  *logging.Logger
+	metrics *metrics.Metrics
+
+	mu      sync.Mutex // guards st and the state file
+	st      *state
+	nonceMu sync.Mutex // guards nonces
+	// nonces maps unused nonces to when they were issued
+	nonces map[string]time.Time
+}
+
+// NewServer loads the ACME state and returns the server
+func NewServer(cfg Config, issuer Issuer, mailer Mailer, logger *logging.Logger, metrics *metrics.Metrics) (*Server, error) {
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("ACME base URL %q is not an absolute URL", cfg.BaseURL)
+	}
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	st, err := loadState(cfg.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		cfg:     cfg,
+		prefix:  strings.TrimSuffix(base.Path, "/"),
+		issuer:  issuer,
+		mailer:  mailer,
+		logger:  logger,
+		metrics: metrics,
+		st:      st,
+		nonces:  make(map[string]time.Time),
+	}, nil
+}
+
+// Prefix returns the path the server's resources live under
+func (s *Server) Prefix() string {
+	return s.prefix
+}
+
+// RegisterRoutes adds the ACME resources to r
+func (s *Server) RegisterRoutes(r *mux.Router) {
+	sub := r.PathPrefix(s.prefix + "/").Subrouter()
+	sub.HandleFunc("/directory", s.directory).Methods("GET")
+	sub.HandleFunc("/new-nonce", s.newNonce).Methods("GET", "HEAD")
+	sub.HandleFunc("/new-account", s.post("new-account", true, s.newAccount)).Methods("POST")
+	sub.HandleFunc("/account/{id}", s.post("account", false, s.updateAccount)).Methods("POST")
+	sub.HandleFunc("/account/{id}/orders", s.post("orders", false, s.listOrders)).Methods("POST")
+	sub.HandleFunc("/new-order", s.post("new-order", false, s.newOrder)).Methods("POST")
+	sub.HandleFunc("/order/{id}", s.post("order", false, s.getOrder)).Methods("POST")
+	sub.HandleFunc("/order/{id}/finalize", s.post("finalize", false, s.finalize)).Methods("POST")
+	sub.HandleFunc("/authz/{id}", s.post("authz", false, s.getAuthorization)).Methods("POST")
+	sub.HandleFunc("/chall/{id}", s.post("challenge", false, s.respondChallenge)).Methods("POST")
+	sub.HandleFunc("/chall/{id}/confirm/{secret}", s.confirmChallenge).Methods("GET")
+	sub.HandleFunc("/cert/{id}", s.post("certificate", false, s.getCertificate)).Methods("POST")
+	sub.HandleFunc("/revoke-cert", s.post("revoke-cert", true, s.revokeCertificate)).Methods("POST")
+}
+
+// url returns the public URL of the resource at path
+func (s *Server) url(path string, args ...interface{}) string {
+	return s.cfg.BaseURL + fmt.Sprintf(path, args...)
+}
+
+// directory serves the directory object (RFC 8555 section 7.1.1)
+func (s *Server) directory(w http.ResponseWriter, r *http.Request) {
+	s.metrics.RecordACMERequest("directory", "ok")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"newNonce":   s.url("/new-nonce"),
+		"newAccount": s.url("/new-account"),
+		"newOrder":   s.url("/new-order"),
+		"revokeCert": s.url("/revoke-cert"),
+		"meta": map[string]interface{}{
+			"externalAccountRequired": true,
+		},
+	})
+}
+
+// newNonce serves a fresh nonce (RFC 8555 section 7.2)
+func (s *Server) newNonce(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", s.issueNonce())
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Link", fmt.Sprintf("<%s>;rel=\"index\"", s.url("/directory")))
+	if r.Method == http.MethodGet {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// issueNonce returns a new nonce, forgetting expired ones
+func (s *Server) issueNonce() string {
+	nonce := newID()
+	now := time.Now()
+	s.nonceMu.Lock()
+	defer s.nonceMu.Unlock()
+	if len(s.nonces) >= maxNonces {
+		for n, issued := range s.nonces {
+			if now.Sub(issued) > nonceTTL {
+				delete(s.nonces, n)
+			}
+		}
+		if len(s.nonces) >= maxNonces {
+			// Still full; drop an arbitrary nonce rather than grow
+			for n := range s.nonces {
+				delete(s.nonces, n)
+				break
+			}
+		}
+	}
+	s.nonces[nonce] = now
+	return nonce
+}
+
+// useNonce consumes nonce, reporting whether it was valid
+func (s *Server) useNonce(nonce string) bool {
+	s.nonceMu.Lock()
+	defer s.nonceMu.Unlock()
+	issued, ok := s.nonces[nonce]
+	if !ok {
+		return false
+	}
+	delete(s.nonces, nonce)
+	return time.Since(issued) <= nonceTTL
+}
+
+// request is an authenticated ACME request
+type request struct {
+	url     string
+	payload []byte // empty for POST-as-GET
+	key     crypto.PublicKey
+	jwk     []byte   // when signed with an embedded key
+	account *account // when signed by an account
+}
+
+// postAsGet reports whether the request is a POST-as-GET
+func (req *request) postAsGet() bool {
+	return len(req.payload) == 0
+}
+
+// decode unmarshals the payload into v
+func (req *request) decode(v interface{}) *problem {
+	if err := json.Unmarshal(req.payload, v); err != nil {
+		return malformed("invalid request payload: %v", err)
+	}
+	return nil
+}
+
+// handlerFunc handles an authenticated ACME request
+type handlerFunc func(w http.ResponseWriter, r *http.Request, req *request) *problem
+
+// post wraps an ACME POST handler: it verifies the JWS and answers
+// problems. Only resources that allowJWK may be signed with an embedded key
+// instead of an account's.
+func (s *Server) post(resource string, allowJWK bool, h handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", s.issueNonce())
+		w.Header().Set("Link", fmt.Sprintf("<%s>;rel=\"index\"", s.url("/directory")))
+
+		req, prob := s.verify(r, allowJWK)
+		if prob == nil {
+			prob = h(w, r, req)
+		}
+		if prob != nil {
+			s.metrics.RecordACMERequest(resource, prob.kind())
+			if prob.Status >= 500 {
+				s.logger.Errorf("ACME %s request failed: %s", resource, prob.Detail)
+			}
+			writeProblem(w, prob)
+			return
+		}
+		s.metrics.RecordACMERequest(resource, "ok")
+	}
+}
+
+// verify authenticates an ACME POST (RFC 8555 section 6.2)
+func (s *Server) verify(r *http.Request, allowJWK bool) (*request, *problem) {
+	if ct := r.Header.Get("Content-Type"); ct != "application/jose+json" {
+		return nil, newProblem(http.StatusUnsupportedMediaType, "malformed", "Content-Type must be application/jose+json")
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err != nil {
+		return nil, malformed("failed to read request")
+	}
+	if len(body) > maxRequestSize {
+		return nil, malformed("request is too large")
+	}
+
+	var msg jwsMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, malformed("request is not a flattened JWS: %v", err)
+	}
+	protected, err := decodeB64(msg.Protected)
+	if err != nil {
+		return nil, malformed("invalid protected header encoding")
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(protected, &header); err != nil {
+		return nil, malformed("invalid protected header: %v", err)
+	}
+	payload, err := decodeB64(msg.Payload)
+	if err != nil {
+		return nil, malformed("invalid payload encoding")
+	}
+	sig, err := decodeB64(msg.Signature)
+	if err != nil {
+		return nil, malformed("invalid signature encoding")
+	}
+
+	if !supportedAlgorithm(header.Alg) {
+		return nil, newProblem(http.StatusBadRequest, "badSignatureAlgorithm", "unsupported algorithm %q; use RS256, ES256, ES384 or ES512", header.Alg)
+	}
+	if !s.useNonce(header.Nonce) {
+		return nil, newProblem(http.StatusBadRequest, "badNonce", "invalid or reused nonce")
+	}
+	want := s.cfg.BaseURL + strings.TrimPrefix(r.URL.Path, s.prefix)
+	if header.URL != want {
+		return nil, unauthorized("JWS url %q does not match the request URL", header.URL)
+	}
+
+	req := &request{url: header.URL, payload: payload}
+	switch {
+	case len(header.JWK) != 0 && header.KID != "":
+		return nil, malformed("JWS must have either jwk or kid, not both")
+	case len(header.JWK) != 0:
+		if !allowJWK {
+			return nil, malformed("this resource must be signed by an account key (kid)")
+		}
+		if req.key, err = parseJWK(header.JWK); err != nil {
+			return nil, newProblem(http.StatusBadRequest, "badPublicKey", "%v", err)
+		}
+		req.jwk = header.JWK
+	case header.KID != "":
+		id := strings.TrimPrefix(header.KID, s.url("/account/"))
+		s.mu.Lock()
+		acct, ok := s.st.Accounts[id]
+		var copied account
+		if ok {
+			copied = *acct
+		}
+		s.mu.Unlock()
+		if !ok || id == header.KID {
+			return nil, newProblem(http.StatusBadRequest, "accountDoesNotExist", "no such account")
+		}
+		if copied.Status != statusValid {
+			return nil, unauthorized("account is %s", copied.Status)
+		}
+		if req.key, err = parseJWK(copied.Key); err != nil {
+			return nil, serverInternal("stored account key: %v", err)
+		}
+		req.account = &copied
+	default:
+		return nil, malformed("JWS must have a jwk or kid")
+	}
+
+	if err := verifySignature(header.Alg, req.key, []byte(msg.Protected+"."+msg.Payload), sig); err != nil {
+		return nil, malformed("JWS signature: %v", err)
+	}
+	return req, nil
+}
+
+// writeJSON answers with a JSON resource
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeProblem answers with an ACME error
+func writeProblem(w http.ResponseWriter, p *problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,202 @@
+package acme
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Resource statuses (RFC 8555 section 7.1.6)
+const (
+	statusPending     = "pending"
+	statusProcessing  = "processing"
+	statusReady       = "ready"
+	statusValid       = "valid"
+	statusInvalid     = "invalid"
+	statusDeactivated = "deactivated"
+	statusExpired     = "expired"
+	statusRevoked     = "revoked"
+)
+
+// identifier is an ACME identifier. Only email identifiers (RFC 8823) are
+// supported: certM3 certificates name a user and their addresses.
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// eabKey is an external account binding key a certM3 user created. It
+// binds at most one account, which then acts for that user.
+type eabKey struct {
+	ID        string    `json:"id"`
+	HMACKey   []byte    `json:"hmacKey"`
+	UserID    string    `json:"userId"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	AccountID string    `json:"accountId,omitempty"`
+}
+
+// account is an ACME account, bound to a certM3 user
+type account struct {
+	ID         string          `json:"id"`
+	Status     string          `json:"status"`
+	Contact    []string        `json:"contact,omitempty"`
+	Key        json.RawMessage `json:"key"`
+	Thumbprint string          `json:"thumbprint"`
+	UserID     string          `json:"userId"`
+	Username   string          `json:"username"`
+	EABKeyID   string          `json:"eabKeyId"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+// order is a request for a certificate
+type order struct {
+	ID             string       `json:"id"`
+	AccountID      string       `json:"accountId"`
+	Status         string       `json:"status"`
+	Expires        time.Time    `json:"expires"`
+	Identifiers    []identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	CertificateID  string       `json:"certificateId,omitempty"`
+	Error          *problem     `json:"error,omitempty"`
+}
+
+// authorization is an account's authority to get certificates for an
+// identifier
+type authorization struct {
+	ID          string     `json:"id"`
+	AccountID   string     `json:"accountId"`
+	Identifier  identifier `json:"identifier"`
+	Status      string     `json:"status"`
+	Expires     time.Time  `json:"expires"`
+	Challenges  []string   `json:"challenges"`
+	PreApproved bool       `json:"preApproved,omitempty"`
+}
+
+// challenge is a way to prove control of an authorization's identifier.
+// For email-link-00 the server mails a link carrying Secret to the
+// address; following it validates the challenge.
+type challenge struct {
+	ID              string    `json:"id"`
+	AuthorizationID string    `json:"authorizationId"`
+	Type            string    `json:"type"`
+	Status          string    `json:"status"`
+	Token           string    `json:"token"`
+	Secret          string    `json:"secret,omitempty"`
+	Validated       time.Time `json:"validated,omitempty"`
+	Error           *problem  `json:"error,omitempty"`
+}
+
+// certificate is a certificate issued for an order
+type certificate struct {
+	ID        string    `json:"id"`
+	AccountID string    `json:"accountId"`
+	Serial    string    `json:"serial"` // hexadecimal
+	Chain     string    `json:"chain"`  // PEM, leaf first
+	NotAfter  time.Time `json:"notAfter"`
+	Revoked   bool      `json:"revoked,omitempty"`
+}
+
+// state is everything the ACME server keeps, written to one file
+type state struct {
+	EABKeys        map[string]*eabKey        `json:"eabKeys"`
+	Accounts       map[string]*account       `json:"accounts"`
+	Orders         map[string]*order         `json:"orders"`
+	Authorizations map[string]*authorization `json:"authorizations"`
+	Challenges     map[string]*challenge     `json:"challenges"`
+	Certificates   map[string]*certificate   `json:"certificates"`
+}
+
+// loadState reads the state file at path, creating it if needed
+func loadState(path string) (*state, error) {
+	st := &state{
+		EABKeys:        make(map[string]*eabKey),
+		Accounts:       make(map[string]*account),
+		Orders:         make(map[string]*order),
+		Authorizations: make(map[string]*authorization),
+		Challenges:     make(map[string]*challenge),
+		Certificates:   make(map[string]*certificate),
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read ACME state: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create ACME state directory: %v", err)
+		}
+		return st, st.save(path)
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("failed to parse ACME state: %v", err)
+	}
+	return st, nil
+}
+
+// save writes the state atomically
+func (st *state) save(path string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal ACME state: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write ACME state: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace ACME state: %v", err)
+	}
+	return nil
+}
+
+// prune drops what clients can no longer use: unused binding keys,
+// orders and authorizations that expired a day ago, and certificates
+// that expired a week ago
+func (st *state) prune(now time.Time) {
+	for id, key := range st.EABKeys {
+		if key.AccountID == "" && now.After(key.ExpiresAt) {
+			delete(st.EABKeys, id)
+		}
+	}
+	grace := now.Add(-24 * time.Hour)
+	for id, o := range st.Orders {
+		if o.Expires.Before(grace) {
+			delete(st.Orders, id)
+		}
+	}
+	for id, authz := range st.Authorizations {
+		if authz.Expires.Before(grace) {
+			for _, chID := range authz.Challenges {
+				delete(st.Challenges, chID)
+			}
+			delete(st.Authorizations, id)
+		}
+	}
+	for id, cert := range st.Certificates {
+		if cert.NotAfter.Before(now.Add(-7 * 24 * time.Hour)) {
+			delete(st.Certificates, id)
+		}
+	}
+}
+
+// accountByThumbprint returns the account with the given key
+func (st *state) accountByThumbprint(thumbprint string) *account {
+	for _, acct := range st.Accounts {
+		if acct.Thumbprint == thumbprint {
+			return acct
+		}
+	}
+	return nil
+}
+
+// newID returns a random identifier for a resource or token
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
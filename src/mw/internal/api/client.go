@@ -2,17 +2,55 @@ package api
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 )
 
+// ErrAlreadyExists is returned when the backend already has the record
+// being stored
+var ErrAlreadyExists = errors.New("already exists")
+
+// ErrAlreadyRevoked is returned when the backend already records the
+// certificate as revoked
+var ErrAlreadyRevoked = errors.New("already revoked")
+
+// ErrNotFound is returned when the backend has no record of what was
+// looked up
+var ErrNotFound = errors.New("not found")
+
 // Client represents an API client
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	token      string
+	attempts   int
+	backoff    time.Duration
+}
+
+// ClientConfig configures a Client for a particular caller
+type ClientConfig struct {
+	BaseURL string
+	Timeout time.Duration // per attempt
+
+	// Attempts is how often a lookup is tried before giving up; lookups
+	// are retried after network errors and 5xx answers, waiting
+	// RetryBackoff and then twice as long each time
+	Attempts     int
+	RetryBackoff time.Duration
+
+	Token    string // bearer token, optional
+	CertPath string // client certificate for mTLS, optional
+	KeyPath  string
+	CAPath   string // CA for the backend's certificate, optional
 }
 
 // NewClient creates a new API client
@@ -22,9 +60,109 @@ func NewClient(baseURL string) *Client {
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		attempts: 1,
 	}
 }
 
+// NewClientWithConfig creates an API client with its own timeouts, retries
+// and TLS settings
+func NewClientWithConfig(cfg ClientConfig) (*Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.CertPath != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertPath, cfg.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load backend client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CAPath != "" {
+		caPEM, err := os.ReadFile(cfg.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backend CA: %v", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in backend CA file %s", cfg.CAPath)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	attempts := cfg.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{
+		baseURL: strings.TrimSuffix(cfg.BaseURL, "/"),
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+		token:    cfg.Token,
+		attempts: attempts,
+		backoff:  cfg.RetryBackoff,
+	}, nil
+}
+
+// do sends req with the client's credentials
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.httpClient.Do(req)
+}
+
+// getJSON fetches path and decodes the JSON answer into v, retrying after
+// network errors and 5xx answers
+func (c *Client) getJSON(path string, v interface{}) error {
+	backoff := c.backoff
+	var lastErr error
+	for attempt := 0; attempt < c.attempts; attempt++ {
+		if attempt > 0 && backoff > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		req, err := http.NewRequest("GET", c.baseURL+path, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %v", err)
+		}
+		resp, err := c.do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to send request: %v", err)
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch {
+		case err != nil:
+			lastErr = fmt.Errorf("failed to read response: %v", err)
+			continue
+		case resp.StatusCode >= 500:
+			lastErr = fmt.Errorf("API error: %s - %s", resp.Status, string(body))
+			continue
+		case resp.StatusCode == http.StatusNotFound:
+			return fmt.Errorf("%s: %w", path, ErrNotFound)
+		case resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("API error: %s - %s", resp.Status, string(body))
+		}
+		if err := json.Unmarshal(body, v); err != nil {
+			return fmt.Errorf("failed to decode response: %v", err)
+		}
+		return nil
+	}
+	if c.attempts > 1 {
+		return fmt.Errorf("%v (after %d attempts)", lastErr, c.attempts)
+	}
+	return lastErr
+}
+
 // RequestStatus represents the status of a certificate request
 type RequestStatus struct {
 	Status     string    `json:"status"`
@@ -59,6 +197,13 @@ type CertificateMetadata struct {
 	UpdatedBy    string    `json:"updatedBy"`
 }
 
+// CertificateRevocation records the revocation of a certificate
+type CertificateRevocation struct {
+	SerialNumber     string `json:"serialNumber"`
+	RevokedBy        string `json:"revokedBy"`
+	RevocationReason string `json:"revocationReason"`
+}
+
 // GetRequestStatus gets the status of a certificate request
 func (c *Client) GetRequestStatus(requestID string) (*RequestStatus, error) {
 	url := fmt.Sprintf("%s/requests/%s", c.baseURL, requestID)
@@ -67,7 +212,7 @@ func (c *Client) GetRequestStatus(requestID string) (*RequestStatus, error) {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %v", err)
 	}
@@ -86,73 +231,66 @@ func (c *Client) GetRequestStatus(requestID string) (*RequestStatus, error) {
 	return &status, nil
 }
 
-// GetUserGroups gets the groups for a user
+// GetUserGroups gets the names of the groups a user belongs to. It returns
+// ErrNotFound if the backend does not know the user.
 func (c *Client) GetUserGroups(username string) ([]string, error) {
-	url := fmt.Sprintf("%s/users?filter[where][username]=%s", c.baseURL, username)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+	var user struct {
+		ID string `json:"id"`
 	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
+	if err := c.getJSON("/users/username/"+url.PathEscape(username), &user); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s - %s", resp.Status, string(body))
+	if user.ID == "" {
+		return nil, fmt.Errorf("user %s has no ID", username)
 	}
 
-	var users []struct {
-		ID string `json:"id"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %v", err)
+	var groups []string
+	if err := c.getJSON("/users/"+url.PathEscape(user.ID)+"/groups", &groups); err != nil {
+		return nil, err
 	}
+	return groups, nil
+}
 
-	if len(users) == 0 {
-		return nil, fmt.Errorf("user not found")
+// StoreCertificateMetadata stores certificate metadata in the API
+func (c *Client) StoreCertificateMetadata(metadata *CertificateMetadata) error {
+	url := fmt.Sprintf("%s/certificates", c.baseURL)
+	body, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %v", err)
 	}
 
-	// Get user's groups
-	url = fmt.Sprintf("%s/users/%s/groups", c.baseURL, users[0].ID)
-	req, err = http.NewRequest("GET", url, nil)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return fmt.Errorf("failed to create request: %v", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	resp, err = c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
+		return fmt.Errorf("failed to send request: %v", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s - %s", resp.Status, string(body))
+	if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("certificate %s: %w", metadata.SerialNumber, ErrAlreadyExists)
 	}
-
-	var groups []Group
-	if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %v", err)
-	}
-
-	groupNames := make([]string, len(groups))
-	for i, group := range groups {
-		groupNames[i] = group.Name
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error: %s - %s", resp.Status, string(body))
 	}
 
-	return groupNames, nil
+	return nil
 }
 
-// StoreCertificateMetadata stores certificate metadata in the API
-func (c *Client) StoreCertificateMetadata(metadata *CertificateMetadata) error {
-	url := fmt.Sprintf("%s/certificates", c.baseURL)
-	body, err := json.Marshal(metadata)
+// RevokeCertificate marks a certificate as revoked in the API
+func (c *Client) RevokeCertificate(revocation *CertificateRevocation) error {
+	url := fmt.Sprintf("%s/certificates/%s/revoke", c.baseURL, revocation.SerialNumber)
+	body, err := json.Marshal(map[string]string{
+		"revokedBy":        revocation.RevokedBy,
+		"revocationReason": revocation.RevocationReason,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %v", err)
+		return fmt.Errorf("failed to marshal revocation: %v", err)
 	}
 
 	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
@@ -161,13 +299,17 @@ func (c *Client) StoreCertificateMetadata(metadata *CertificateMetadata) error {
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %v", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+	// The backend answers 400 when the certificate is already revoked
+	if resp.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("certificate %s: %w", revocation.SerialNumber, ErrAlreadyRevoked)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
 		body, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("API error: %s - %s", resp.Status, string(body))
 	}
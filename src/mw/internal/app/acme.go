@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/acme"
+	"github.com/ogt11/certm3/mw/internal/security"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+// NewACMEServer sets up the ACME server, which issues through this
+// handler's signer client. Its emails go to the same spool as the
+// backend's.
+func (h *Handler) NewACMEServer() (*acme.Server, error) {
+	cfg := h.config.AppServer
+	server, err := acme.NewServer(acme.Config{
+		BaseURL:          cfg.ACMEBaseURL,
+		StatePath:        cfg.ACMEStatePath,
+		OrderTTL:         cfg.ACMEOrderTTL,
+		AuthorizationTTL: cfg.ACMEAuthorizationTTL,
+		EABKeyTTL:        cfg.ACMEEABKeyTTL,
+	}, acmeIssuer{h}, acme.SpoolMailer{Dir: cfg.TestEmailDir}, h.logger, h.metrics)
+	if err != nil {
+		return nil, err
+	}
+	h.acme = server
+	return server, nil
+}
+
+// CreateACMEBinding gives the authenticated user an external account
+// binding key for their ACME client
+func (h *Handler) CreateACMEBinding(w http.ResponseWriter, r *http.Request) {
+	if h.acme == nil {
+		http.Error(w, "ACME is not enabled", http.StatusNotFound)
+		return
+	}
+	username, _ := r.Context().Value("username").(string)
+	userID, _ := r.Context().Value("user_id").(string)
+	if username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if userID == "" {
+		var err error
+		if userID, err = h.lookupUserID(username); err != nil {
+			h.logger.Errorf("Failed to look up user %s for ACME binding: %v", username, err)
+			http.Error(w, "Failed to look up user", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	key, err := h.acme.CreateEABKey(acme.User{ID: userID, Username: username})
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":     r.URL.Path,
+			"user_id":  userID,
+			"username": username,
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"directory": h.config.AppServer.ACMEBaseURL + "/directory",
+		"keyId":     key.KeyID,
+		"hmacKey":   base64.RawURLEncoding.EncodeToString(key.HMACKey),
+		"expires":   key.Expires,
+	})
+}
+
+// acmeIssuer issues and revokes certificates for ACME accounts the way the
+// web flow does: with a signing ticket for the account's user, registering
+// the results with the backend
+type acmeIssuer struct {
+	h *Handler
+}
+
+// LookupUser fetches a user's name and registered email from the backend
+func (i acmeIssuer) LookupUser(ctx context.Context, userID string) (acme.User, error) {
+	return i.h.lookupUser(ctx, userID)
+}
+
+// lookupUser fetches a user's name and registered email from the backend
+func (h *Handler) lookupUser(ctx context.Context, userID string) (acme.User, error) {
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, "GET", h.config.AppServer.BackendAPIURL+"/users/"+userID, nil)
+	if err != nil {
+		return acme.User{}, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		h.metrics.RecordBackendRequest("GET", "/users", "error", time.Since(start), err)
+		return acme.User{}, err
+	}
+	defer resp.Body.Close()
+	h.metrics.RecordBackendRequest("GET", "/users", strconv.Itoa(resp.StatusCode), time.Since(start), nil)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return acme.User{}, fmt.Errorf("%s: %w", userID, errUnknownUser)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return acme.User{}, fmt.Errorf("backend returned status %d", resp.StatusCode)
+	}
+	var user struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return acme.User{}, fmt.Errorf("failed to decode user: %v", err)
+	}
+	return acme.User{ID: userID, Username: user.Username, Email: user.Email}, nil
+}
+
+// Issue signs csrPEM for user with the ACME profile, asking for all of the
+// user's groups
+func (i acmeIssuer) Issue(ctx context.Context, user acme.User, requestID, csrPEM string) (string, string, error) {
+	result, err := i.h.signWithUserGroups(ctx, "acme", user.ID, user.Username, requestID, csrPEM, i.h.config.AppServer.ACMEProfile)
+	if err != nil {
+		return "", "", err
+	}
+	return result.Certificate, result.CACertificate, nil
+}
+
+// Revoke revokes one of user's certificates; the signer checks ownership,
+// and that its ledger holds cert itself and not just its serial
+func (i acmeIssuer) Revoke(ctx context.Context, user acme.User, cert *x509.Certificate, reason int) error {
+	h := i.h
+	serial := cert.SerialNumber.Text(16)
+	fingerprint := sha256.Sum256(cert.Raw)
+	requestID := newRequestID("acme-revoke")
+	ticket, err := h.tickets.IssueTicket(user.ID, user.Username, requestID, security.TicketActionRevoke, []byte(serial))
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	result, err := h.signer.Revoke(ctx, &signerproto.RevokeRequest{
+		RequestID:   requestID,
+		Serial:      serial,
+		Reason:      strconv.Itoa(reason),
+		Token:       ticket,
+		UserID:      user.ID,
+		Username:    user.Username,
+		Fingerprint: hex.EncodeToString(fingerprint[:]),
+	})
+	if err != nil {
+		h.metrics.RecordSignerRequest("error", time.Since(start), err)
+		var perr *signerproto.Error
+		status := "error"
+		if errors.As(err, &perr) && perr.Code == signerproto.CodeNotFound {
+			status = "denied"
+		}
+		h.metrics.RecordRevocationRequest("acme", status)
+		return err
+	}
+	h.metrics.RecordSignerRequest("success", time.Since(start), nil)
+	h.metrics.RecordRevocationRequest("acme", "revoked")
+	h.logger.LogSecurityEvent("certificate_revoked", map[string]interface{}{
+		"serial":     result.Serial,
+		"reason":     result.Reason,
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"request_id": requestID,
+		"admin":      false,
+	})
+
+	h.recordRevocation(result, user.Username)
+	return nil
+}
@@ -0,0 +1,310 @@
+package app
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+	xacme "golang.org/x/crypto/acme"
+)
+
+// newACMEEnv returns a test environment serving ACME
+func newACMEEnv(t *testing.T) *testEnv {
+	t.Helper()
+	return newTestEnv(t, func(cfg *config.Config) {
+		cfg.AppServer.ACMEEnabled = true
+	})
+}
+
+// acmeClient returns an ACME client with a fresh key that is not yet
+// registered
+func (env *testEnv) acmeClient(t *testing.T) *xacme.Client {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &xacme.Client{Key: key, DirectoryURL: env.cfg.AppServer.ACMEBaseURL + "/directory"}
+}
+
+// eab has the app create an external account binding for username
+func (env *testEnv) eab(t *testing.T, username string) *xacme.ExternalAccountBinding {
+	t.Helper()
+	code, body := env.post(t, "/app/acme/eab", "", env.bearer(t, username))
+	if code != http.StatusOK {
+		t.Fatalf("creating a binding for %s: %d %s", username, code, body)
+	}
+	var binding struct{ KeyID, HMACKey string }
+	if err := json.Unmarshal(body, &binding); err != nil {
+		t.Fatal(err)
+	}
+	key, err := base64.RawURLEncoding.DecodeString(binding.HMACKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &xacme.ExternalAccountBinding{KID: binding.KeyID, Key: key}
+}
+
+// acmeAccount returns a client with an account bound to username
+func (env *testEnv) acmeAccount(t *testing.T, username string) *xacme.Client {
+	t.Helper()
+	client := env.acmeClient(t)
+	if _, err := client.Register(context.Background(), &xacme.Account{ExternalAccountBinding: env.eab(t, username)}, xacme.AcceptTOS); err != nil {
+		t.Fatalf("registering an account for %s: %v", username, err)
+	}
+	return client
+}
+
+// acmeCertificate has client order and finalize a certificate for
+// commonName with the given addresses, which must already be authorized
+func acmeCertificate(t *testing.T, client *xacme.Client, commonName string, emails ...string) (*x509.Certificate, string, crypto.Signer) {
+	t.Helper()
+	ctx := context.Background()
+	var ids []xacme.AuthzID
+	for _, email := range emails {
+		ids = append(ids, xacme.AuthzID{Type: "email", Value: email})
+	}
+	order, err := client.AuthorizeOrder(ctx, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != xacme.StatusReady {
+		t.Fatalf("order for %v is %s, want ready", emails, order.Status)
+	}
+	csr, key := newTestCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}, EmailAddresses: emails})
+	certs, certURL, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf, certURL, key
+}
+
+// isACMEProblem reports whether err is the ACME problem with type
+// urn:ietf:params:acme:error:<problem>
+func isACMEProblem(err error, problem string) bool {
+	var aerr *xacme.Error
+	return errors.As(err, &aerr) && aerr.ProblemType == "urn:ietf:params:acme:error:"+problem
+}
+
+func TestACMEExternalAccountBinding(t *testing.T) {
+	env := newACMEEnv(t)
+	ctx := context.Background()
+
+	alice := env.acmeClient(t)
+	if _, err := alice.Register(ctx, &xacme.Account{}, xacme.AcceptTOS); !isACMEProblem(err, "externalAccountRequired") {
+		t.Errorf("registering without a binding: %v", err)
+	}
+	account, err := alice.Register(ctx, &xacme.Account{Contact: []string{"mailto:alice@example.com"}, ExternalAccountBinding: env.eab(t, "alice")}, xacme.AcceptTOS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Status != xacme.StatusValid {
+		t.Errorf("account status = %s, want valid", account.Status)
+	}
+
+	// A binding key binds a single account
+	binding := env.eab(t, "bob")
+	if _, err := env.acmeClient(t).Register(ctx, &xacme.Account{ExternalAccountBinding: binding}, xacme.AcceptTOS); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.acmeClient(t).Register(ctx, &xacme.Account{ExternalAccountBinding: binding}, xacme.AcceptTOS); err == nil {
+		t.Error("a binding key was used for a second account")
+	}
+}
+
+func TestACMEOrderForOwnAddress(t *testing.T) {
+	env := newACMEEnv(t)
+	ctx := context.Background()
+	alice := env.acmeAccount(t, "alice")
+	bob := env.acmeAccount(t, "bob")
+
+	// The user's own address is authorized in advance
+	order, err := alice.AuthorizeOrder(ctx, []xacme.AuthzID{{Type: "email", Value: "alice@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != xacme.StatusReady {
+		t.Fatalf("order status = %s, want ready", order.Status)
+	}
+	csr, _ := newTestCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "mallory"}, EmailAddresses: []string{"alice@example.com"}})
+	if _, _, err := alice.CreateOrderCert(ctx, order.FinalizeURL, csr, false); !isACMEProblem(err, "badCSR") {
+		t.Errorf("finalizing with another user's name: %v", err)
+	}
+	csr, _ = newTestCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "alice"}, EmailAddresses: []string{"alice@example.com"}})
+	certs, certURL, err := alice.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("got %d certificates, want the leaf and the CA", len(certs))
+	}
+	leaf, err := x509.ParseCertificate(certs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.CommonName != "alice" || len(leaf.EmailAddresses) != 1 || leaf.EmailAddresses[0] != "alice@example.com" {
+		t.Errorf("issued to %q with addresses %v", leaf.Subject.CommonName, leaf.EmailAddresses)
+	}
+	if err := leaf.CheckSignatureFrom(env.ca); err != nil {
+		t.Errorf("certificate not issued by the CA: %v", err)
+	}
+
+	// Orders and certificates belong to the account
+	if _, err := bob.FetchCert(ctx, certURL, false); err == nil {
+		t.Error("another account fetched the certificate")
+	}
+	if _, err := bob.GetOrder(ctx, order.URI); err == nil {
+		t.Error("another account fetched the order")
+	}
+}
+
+func TestACMEEmailChallenge(t *testing.T) {
+	env := newACMEEnv(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	alice := env.acmeAccount(t, "alice")
+
+	order, err := alice.AuthorizeOrder(ctx, []xacme.AuthzID{{Type: "email", Value: "alice.work@example.org"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != xacme.StatusPending {
+		t.Fatalf("order for another address is %s, want pending", order.Status)
+	}
+	authz, err := alice.GetAuthorization(ctx, order.AuthzURLs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authz.Challenges) != 1 || authz.Challenges[0].Type != "email-link-00" {
+		t.Fatalf("challenges = %+v, want one email-link-00", authz.Challenges)
+	}
+	challenge, err := alice.Accept(ctx, authz.Challenges[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge.Status != xacme.StatusProcessing {
+		t.Errorf("accepted challenge is %s, want processing", challenge.Status)
+	}
+
+	mails, err := filepath.Glob(filepath.Join(env.cfg.AppServer.TestEmailDir, "*-alice-acme.txt"))
+	if err != nil || len(mails) != 1 {
+		t.Fatalf("mails to alice: %v %v", mails, err)
+	}
+	mail, err := os.ReadFile(mails[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(mail), "To: alice.work@example.org") {
+		t.Errorf("challenge mail not sent to the address:\n%s", mail)
+	}
+	link := regexp.MustCompile(`http://\S+/confirm/\S+`).FindString(string(mail))
+	if link == "" {
+		t.Fatalf("no confirmation link in\n%s", mail)
+	}
+	confirm := func(link string) int {
+		resp, err := http.Get(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := confirm(link + "x"); code != http.StatusNotFound {
+		t.Errorf("wrong link: %d", code)
+	}
+	if code := confirm(link); code != http.StatusOK {
+		t.Fatalf("confirmation link: %d", code)
+	}
+	if code := confirm(link); code != http.StatusNotFound {
+		t.Errorf("confirmation link used twice: %d", code)
+	}
+
+	if order, err = alice.WaitOrder(ctx, order.URI); err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != xacme.StatusReady {
+		t.Fatalf("order after confirmation is %s, want ready", order.Status)
+	}
+	// The authorization is reused for later orders
+	leaf, _, _ := acmeCertificate(t, alice, "alice", "alice.work@example.org", "alice@example.com")
+	if len(leaf.EmailAddresses) != 2 {
+		t.Errorf("addresses = %v", leaf.EmailAddresses)
+	}
+}
+
+func TestACMERevocation(t *testing.T) {
+	env := newACMEEnv(t)
+	ctx := context.Background()
+	alice := env.acmeAccount(t, "alice")
+	bob := env.acmeAccount(t, "bob")
+	byKey, _, key := acmeCertificate(t, alice, "alice", "alice@example.com")
+	byAccount, _, _ := acmeCertificate(t, alice, "alice", "alice@example.com")
+
+	if err := bob.RevokeCert(ctx, nil, byAccount.Raw, xacme.CRLReasonUnspecified); err == nil {
+		t.Error("another user's account revoked the certificate")
+	}
+
+	// A certificate with the same name and serial but the attacker's key
+	// proves nothing about the real one
+	attackerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := &x509.Certificate{
+		SerialNumber: byKey.SerialNumber,
+		Subject:      byKey.Subject,
+		Issuer:       byKey.Issuer,
+		NotBefore:    byKey.NotBefore,
+		NotAfter:     byKey.NotAfter,
+	}
+	forgedDER, err := x509.CreateCertificate(rand.Reader, forged, forged, &attackerKey.PublicKey, attackerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.acmeClient(t).RevokeCert(ctx, attackerKey, forgedDER, xacme.CRLReasonKeyCompromise); err == nil {
+		t.Error("a forged certificate revoked a real one")
+	}
+	if len(env.revokedSerials(t)) != 0 {
+		t.Fatal("certificates were revoked by unauthorized requests")
+	}
+
+	// Revoked with the certificate's own key, by a client without an
+	// account, and by the user's account
+	if err := env.acmeClient(t).RevokeCert(ctx, key, byKey.Raw, xacme.CRLReasonKeyCompromise); err != nil {
+		t.Fatalf("revoking with the certificate key: %v", err)
+	}
+	if err := alice.RevokeCert(ctx, nil, byAccount.Raw, xacme.CRLReasonSuperseded); err != nil {
+		t.Fatalf("revoking with the account: %v", err)
+	}
+	// The client takes alreadyRevoked for success
+	if err := alice.RevokeCert(ctx, nil, byAccount.Raw, xacme.CRLReasonSuperseded); err != nil {
+		t.Errorf("revoking again: %v", err)
+	}
+
+	revoked := env.revokedSerials(t)
+	if reason, ok := revoked[byKey.SerialNumber.Text(16)]; !ok || reason != int(xacme.CRLReasonKeyCompromise) {
+		t.Errorf("certificate revoked by key: listed %v, reason %d", ok, reason)
+	}
+	if reason, ok := revoked[byAccount.SerialNumber.Text(16)]; !ok || reason != int(xacme.CRLReasonSuperseded) {
+		t.Errorf("certificate revoked by account: listed %v, reason %d", ok, reason)
+	}
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ogt11/certm3/mw/internal/security"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+// RefreshAttributeCertificate issues a fresh attribute certificate for one
+// of the user's certificates whose profile carries the groups that way, so
+// a change of groups does not need a new certificate. The signer checks
+// ownership and authorizes the groups again; without requested groups
+// those of the certificate are asked for.
+func (h *Handler) RefreshAttributeCertificate(w http.ResponseWriter, r *http.Request) {
+	username, _ := r.Context().Value("username").(string)
+	userID, _ := r.Context().Value("user_id").(string)
+	requestID, _ := r.Context().Value("request_id").(string)
+	if username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if requestID == "" {
+		requestID = newRequestID("attrcert")
+	}
+
+	serial, ok := parseSerial(mux.Vars(r)["serial"])
+	if !ok {
+		http.Error(w, "Invalid serial number", http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional
+	var req struct {
+		Groups []string `json:"groups"`
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 16*1024))
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "Invalid request format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	h.metrics.RecordCertificateRequest("attribute_certificate")
+	ticket, err := h.tickets.IssueTicket(userID, username, requestID, security.TicketActionSignAttributeCert,
+		security.IssuancePayload([]byte(serial), "", req.Groups))
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"request_id": requestID,
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(r.Context(), signerRequestTimeout)
+	defer cancel()
+	result, err := h.signer.SignAttributeCert(ctx, &signerproto.SignAttributeCertRequest{
+		RequestID: requestID,
+		Serial:    serial,
+		Groups:    req.Groups,
+		Token:     ticket,
+		UserID:    userID,
+		Username:  username,
+	})
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"username":   username,
+			"request_id": requestID,
+			"serial":     serial,
+		})
+		h.metrics.RecordSignerRequest("error", time.Since(start), err)
+		writeSignerError(w, err, "Failed to issue attribute certificate")
+		return
+	}
+	h.metrics.RecordSignerRequest("success", time.Since(start), nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"serial":               serial,
+		"attributeCertificate": result.AttributeCertificate,
+	})
+}
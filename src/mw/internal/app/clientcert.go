@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+// ClientCertAuth authenticates users by the client certificate the TLS
+// terminator in front of the app server verified and passed on in a
+// header. The terminator must overwrite any header of that name sent by the
+// client, since certificates are public; the chain is still verified here
+// against the CA, and the signer is asked whether the certificate is still
+// good. The username is the certificate's CommonName, as the signer issues
+// it.
+type ClientCertAuth struct {
+	header string
+	roots  *x509.CertPool
+	signer SignerClient
+}
+
+// NewClientCertAuth returns the client certificate authenticator for cfg,
+// or nil if no client CA is configured. Without ClientCertHeader it only
+// verifies certificates presented in request bodies, as renewals do.
+// Revocation is checked with signer.
+func NewClientCertAuth(cfg *config.Config, signer SignerClient) (*ClientCertAuth, error) {
+	if cfg.AppServer.ClientCAPath == "" {
+		return nil, nil
+	}
+	caPEM, err := os.ReadFile(cfg.AppServer.ClientCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", cfg.AppServer.ClientCAPath)
+	}
+	return &ClientCertAuth{
+		header: cfg.AppServer.ClientCertHeader,
+		roots:  roots,
+		signer: signer,
+	}, nil
+}
+
+// Present reports whether r carries a client certificate
+func (a *ClientCertAuth) Present(r *http.Request) bool {
+	return a != nil && a.header != "" && r.Header.Get(a.header) != ""
+}
+
+// Authenticate verifies the client certificate carried by r and returns
+// the username it was issued to
+func (a *ClientCertAuth) Authenticate(r *http.Request) (string, error) {
+	cert, err := a.Certificate(r)
+	if err != nil {
+		return "", err
+	}
+	return cert.Subject.CommonName, nil
+}
+
+// Certificate returns the verified client certificate carried by r
+func (a *ClientCertAuth) Certificate(r *http.Request) (*x509.Certificate, error) {
+	certPEM, err := url.QueryUnescape(r.Header.Get(a.header))
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate encoding: %v", err)
+	}
+	return a.Parse(r.Context(), certPEM)
+}
+
+// Parse parses a PEM client certificate and verifies it was issued by the
+// client CA for client authentication, names a user and has not been
+// revoked
+func (a *ClientCertAuth) Parse(ctx context.Context, certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("client certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client certificate: %v", err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:     a.roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return nil, fmt.Errorf("client certificate not trusted: %v", err)
+	}
+	if cert.Subject.CommonName == "" {
+		return nil, fmt.Errorf("client certificate has no CommonName")
+	}
+
+	// The chain says nothing about revocation; the signer's records do
+	ctx, cancel := context.WithTimeout(ctx, signerRequestTimeout)
+	defer cancel()
+	status, err := a.signer.Status(ctx, &signerproto.StatusRequest{Serial: cert.SerialNumber.Text(16)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check client certificate status: %v", err)
+	}
+	if status.Status != signerproto.StatusGood {
+		return nil, fmt.Errorf("client certificate %s is %s", status.Serial, status.Status)
+	}
+	return cert, nil
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errInvalidEnrollmentCode is returned for unknown, used or expired codes
+var errInvalidEnrollmentCode = errors.New("invalid enrollment code")
+
+// enrollmentCode is a one-time code a user created so a device can enroll
+// for them. Only a hash of the code is stored.
+type enrollmentCode struct {
+	Hash      string    `json:"hash"` // hex SHA-256 of the code
+	UserID    string    `json:"userId"`
+	Username  string    `json:"username"`
+	Label     string    `json:"label,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// EnrollmentCodes holds the outstanding EST enrollment codes in a file,
+// written atomically on every change. A code is taken when a device
+// authenticates with it and put back if enrollment fails, so each code
+// issues at most one certificate.
+type EnrollmentCodes struct {
+	mu    sync.Mutex
+	path  string
+	ttl   time.Duration
+	codes []enrollmentCode
+}
+
+// OpenEnrollmentCodes loads the enrollment codes at path, creating the file
+// if needed. New codes are valid for ttl.
+func OpenEnrollmentCodes(path string, ttl time.Duration) (*EnrollmentCodes, error) {
+	c := &EnrollmentCodes{path: path, ttl: ttl}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read enrollment codes: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create enrollment code directory: %v", err)
+		}
+		return c, c.save()
+	}
+	if err := json.Unmarshal(data, &c.codes); err != nil {
+		return nil, fmt.Errorf("failed to parse enrollment codes: %v", err)
+	}
+	return c, nil
+}
+
+// save drops expired codes and writes the rest atomically; callers must
+// hold mu
+func (c *EnrollmentCodes) save() error {
+	now := time.Now()
+	live := c.codes[:0]
+	for _, code := range c.codes {
+		if now.Before(code.ExpiresAt) {
+			live = append(live, code)
+		}
+	}
+	c.codes = live
+
+	data, err := json.MarshalIndent(c.codes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal enrollment codes: %v", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write enrollment codes: %v", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to replace enrollment codes: %v", err)
+	}
+	return nil
+}
+
+// Create returns a new code for the user and when it expires
+func (c *EnrollmentCodes) Create(userID, username, label string) (string, time.Time, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate enrollment code: %v", err)
+	}
+	encoded := base32.StdEncoding.EncodeToString(b)
+	code := encoded[0:4] + "-" + encoded[4:8] + "-" + encoded[8:12] + "-" + encoded[12:16]
+
+	now := time.Now().UTC()
+	entry := enrollmentCode{
+		Hash:      hashEnrollmentCode(code),
+		UserID:    userID,
+		Username:  username,
+		Label:     label,
+		CreatedAt: now,
+		ExpiresAt: now.Add(c.ttl),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.codes = append(c.codes, entry)
+	if err := c.save(); err != nil {
+		c.codes = c.codes[:len(c.codes)-1]
+		return "", time.Time{}, err
+	}
+	return code, entry.ExpiresAt, nil
+}
+
+// Take removes and returns the user's entry for code
+func (c *EnrollmentCodes) Take(username, code string) (enrollmentCode, error) {
+	hash := hashEnrollmentCode(code)
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, entry := range c.codes {
+		if subtle.ConstantTimeCompare([]byte(entry.Hash), []byte(hash)) != 1 {
+			continue
+		}
+		if entry.Username != username || !now.Before(entry.ExpiresAt) {
+			break
+		}
+		c.codes = append(c.codes[:i], c.codes[i+1:]...)
+		if err := c.save(); err != nil {
+			c.codes = append(c.codes, entry)
+			return enrollmentCode{}, err
+		}
+		return entry, nil
+	}
+	return enrollmentCode{}, errInvalidEnrollmentCode
+}
+
+// Restore puts back a code taken for an enrollment that failed
+func (c *EnrollmentCodes) Restore(entry enrollmentCode) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.codes = append(c.codes, entry)
+	return c.save()
+}
+
+// hashEnrollmentCode hashes a code as stored, ignoring case and the
+// grouping dashes, which people retype inconsistently
+func hashEnrollmentCode(code string) string {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
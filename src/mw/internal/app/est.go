@@ -0,0 +1,484 @@
+package app
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ogt11/certm3/mw/internal/pkcs7"
+	"github.com/ogt11/certm3/mw/internal/security"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+// estPrefix is where EST clients find the server (RFC 7030 section 3.2.2).
+// An optional label after it names the certificate profile.
+const estPrefix = "/.well-known/est/"
+
+// maxESTRequestSize bounds the CSRs EST clients may send
+const maxESTRequestSize = 64 * 1024
+
+// CSR attributes suggested to EST clients: certM3 certificates name the
+// user in the CommonName and may carry email addresses
+var (
+	oidAttributeCommonName   = asn1.ObjectIdentifier{2, 5, 4, 3}
+	oidAttributeEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+)
+
+// errESTUnauthenticated is returned for EST requests without credentials
+var errESTUnauthenticated = errors.New("no client certificate or basic credentials")
+
+// EnableEST opens the enrollment code store, turning on the EST endpoints
+func (h *Handler) EnableEST() error {
+	codes, err := OpenEnrollmentCodes(h.config.AppServer.ESTCodesPath, h.config.AppServer.ESTCodeTTL)
+	if err != nil {
+		return err
+	}
+	h.enrollment = codes
+	return nil
+}
+
+// CreateEnrollmentCode gives the authenticated user a one-time code with
+// which a device can enroll for them over EST
+func (h *Handler) CreateEnrollmentCode(w http.ResponseWriter, r *http.Request) {
+	if h.enrollment == nil {
+		http.Error(w, "EST is not enabled", http.StatusNotFound)
+		return
+	}
+	username, _ := r.Context().Value("username").(string)
+	userID, _ := r.Context().Value("user_id").(string)
+	if username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if userID == "" {
+		var err error
+		if userID, err = h.lookupUserID(username); err != nil {
+			h.logger.Errorf("Failed to look up user %s for an enrollment code: %v", username, err)
+			http.Error(w, "Failed to look up user", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	// The body is optional; a label helps the user tell codes apart
+	var req struct {
+		Label string `json:"label"`
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "Invalid request format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	code, expires, err := h.enrollment.Create(userID, username, req.Label)
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":     r.URL.Path,
+			"user_id":  userID,
+			"username": username,
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.logger.LogSecurityEvent("est_enrollment_code_created", map[string]interface{}{
+		"user_id":  userID,
+		"username": username,
+		"label":    req.Label,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"username": username,
+		"code":     code,
+		"expires":  expires,
+	})
+}
+
+// ESTCACerts returns the CA certificates (RFC 7030 section 4.1)
+func (h *Handler) ESTCACerts(w http.ResponseWriter, r *http.Request) {
+	if h.enrollment == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var certs [][]byte
+	for _, path := range []string{h.config.Signer.CACertPath, h.config.Signer.CAChainPath} {
+		if path == "" {
+			continue
+		}
+		caPEM, err := os.ReadFile(path)
+		if err != nil {
+			h.logger.Errorf("Failed to read CA certificates for EST: %v", err)
+			h.metrics.RecordESTRequest("cacerts", "error")
+			http.Error(w, "CA certificates unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		certs = append(certs, decodePEMCertificates(string(caPEM))...)
+	}
+	h.metrics.RecordESTRequest("cacerts", "ok")
+	h.writeCertsOnly(w, certs)
+}
+
+// ESTCSRAttrs suggests what CSRs should contain (RFC 7030 section 4.5)
+func (h *Handler) ESTCSRAttrs(w http.ResponseWriter, r *http.Request) {
+	if h.enrollment == nil {
+		http.NotFound(w, r)
+		return
+	}
+	attrs := []asn1.ObjectIdentifier{oidAttributeCommonName}
+	if h.profileAllowsEmail(h.estProfile(r)) {
+		attrs = append(attrs, oidAttributeEmailAddress)
+	}
+	der, err := asn1.Marshal(attrs)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.metrics.RecordESTRequest("csrattrs", "ok")
+	writeBase64(w, "application/csrattrs", der)
+}
+
+// ESTSimpleEnroll issues a certificate to a device enrolling with an
+// enrollment code or a client certificate (RFC 7030 section 4.2.1)
+func (h *Handler) ESTSimpleEnroll(w http.ResponseWriter, r *http.Request) {
+	if h.enrollment == nil {
+		http.NotFound(w, r)
+		return
+	}
+	// A client certificate enrolls through the renewal path, so the signer
+	// checks that certificate is still good and its owner's
+	if h.certAuth.Present(r) {
+		h.estReenroll(w, r, "simpleenroll", h.estProfile(r))
+		return
+	}
+	userID, username, code, err := h.estAuthenticate(r)
+	if err != nil {
+		h.estUnauthorized(w, r, "simpleenroll", err)
+		return
+	}
+	// Give the code back if this enrollment does not produce a certificate
+	issued := false
+	defer func() {
+		if !issued {
+			if err := h.enrollment.Restore(*code); err != nil {
+				h.logger.Errorf("Failed to restore enrollment code for %s: %v", username, err)
+			}
+		}
+	}()
+
+	csrPEM, err := readESTCSR(r)
+	if err != nil {
+		h.metrics.RecordESTRequest("simpleenroll", "bad_request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.checkCSREmails(r.Context(), userID, csrPEM); err != nil {
+		h.estEmailDenied(w, r, "simpleenroll", userID, err)
+		return
+	}
+
+	requestID := newRequestID("est")
+	ctx, cancel := context.WithTimeout(r.Context(), signerRequestTimeout)
+	defer cancel()
+	result, err := h.signWithUserGroups(ctx, "est", userID, username, requestID, csrPEM, h.estProfile(r))
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"username":   username,
+			"request_id": requestID,
+		})
+		h.metrics.RecordESTRequest("simpleenroll", "error")
+		writeSignerError(w, err, "Failed to enroll")
+		return
+	}
+	issued = true
+
+	h.logger.LogSecurityEvent("est_enrolled", map[string]interface{}{
+		"user_id":    userID,
+		"username":   username,
+		"request_id": requestID,
+		"serial":     result.Serial,
+		"method":     "enrollment_code",
+	})
+	h.metrics.RecordESTRequest("simpleenroll", "ok")
+	h.writeCertsOnlyPEM(w, result.Certificate)
+}
+
+// ESTSimpleReenroll renews the client certificate the request is
+// authenticated with (RFC 7030 section 4.2.2). Like /app/renew, the new
+// certificate keeps the identity and gets freshly checked groups.
+func (h *Handler) ESTSimpleReenroll(w http.ResponseWriter, r *http.Request) {
+	if h.enrollment == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !h.certAuth.Present(r) {
+		h.estUnauthorized(w, r, "simplereenroll", errESTUnauthenticated)
+		return
+	}
+	h.estReenroll(w, r, "simplereenroll", "")
+}
+
+// estReenroll issues the replacement for the client certificate r is
+// authenticated with, using the requested profile or else the old
+// certificate's. operation labels the EST request metric.
+func (h *Handler) estReenroll(w http.ResponseWriter, r *http.Request, operation, requestedProfile string) {
+	old, err := h.certAuth.Certificate(r)
+	if err != nil {
+		h.estUnauthorized(w, r, operation, err)
+		return
+	}
+	username := old.Subject.CommonName
+	oldSerial := old.SerialNumber.Text(16)
+
+	csrPEM, err := readESTCSR(r)
+	if err != nil {
+		h.metrics.RecordESTRequest(operation, "bad_request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, err := h.lookupUserID(username)
+	if errors.Is(err, errUnknownUser) {
+		h.metrics.RecordESTRequest(operation, "denied")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		h.logger.Errorf("Failed to look up user %s for EST re-enrollment: %v", username, err)
+		h.metrics.RecordESTRequest(operation, "error")
+		http.Error(w, "Failed to look up user", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := h.checkCSREmails(r.Context(), userID, csrPEM); err != nil {
+		h.estEmailDenied(w, r, operation, userID, err)
+		return
+	}
+
+	requestID := newRequestID("est")
+	profile, err := h.renewalProfile(r.Context(), oldSerial, requestedProfile)
+	if err != nil {
+		h.logger.Errorf("Failed to look up the profile of certificate %s for EST re-enrollment: %v", oldSerial, err)
+		h.metrics.RecordESTRequest(operation, "error")
+		http.Error(w, "Failed to look up certificate", http.StatusServiceUnavailable)
+		return
+	}
+	if profile, err = h.authorizeProfile(userID, profile); err != nil {
+		h.logger.LogSecurityEvent("profile_denied", map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"request_id": requestID,
+			"error":      err.Error(),
+		})
+		h.metrics.RecordSecurityEvent("profile_denied")
+		h.metrics.RecordESTRequest(operation, "denied")
+		http.Error(w, "Certificate profile not allowed", http.StatusForbidden)
+		return
+	}
+
+	h.metrics.RecordCertificateRequest("renewal")
+	ticket, err := h.tickets.IssueTicket(userID, username, requestID, security.TicketActionRenew,
+		security.IssuancePayload(security.RenewalPayload(csrPEM, oldSerial), profile, nil))
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"request_id": requestID,
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(r.Context(), signerRequestTimeout)
+	defer cancel()
+	result, err := h.signer.Sign(ctx, &signerproto.SignRequest{
+		UserID:    userID,
+		Username:  username,
+		RequestID: requestID,
+		CSR:       csrPEM,
+		Token:     ticket,
+		Profile:   profile,
+		Renews:    oldSerial,
+	})
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"request_id": requestID,
+			"renews":     oldSerial,
+		})
+		h.metrics.RecordSignerRequest("error", time.Since(start), err)
+		h.metrics.RecordESTRequest(operation, "error")
+		writeSignerError(w, err, "Failed to re-enroll")
+		return
+	}
+	h.metrics.RecordSignerRequest("success", time.Since(start), nil)
+	h.registerCertificate(result.Certificate, userID, username)
+
+	h.logger.LogSecurityEvent("est_reenrolled", map[string]interface{}{
+		"user_id":    userID,
+		"username":   username,
+		"request_id": requestID,
+		"serial":     result.Serial,
+		"renews":     oldSerial,
+	})
+	h.metrics.RecordESTRequest(operation, "ok")
+	h.writeCertsOnlyPEM(w, result.Certificate)
+}
+
+// estAuthenticate establishes who an enrollment is for: the user whose
+// enrollment code was given as the basic auth password. The code is taken
+// from the store and returned so it can be restored if enrollment fails.
+func (h *Handler) estAuthenticate(r *http.Request) (string, string, *enrollmentCode, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return "", "", nil, errESTUnauthenticated
+	}
+	code, err := h.enrollment.Take(username, password)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return code.UserID, code.Username, &code, nil
+}
+
+// estUnauthorized answers an EST request that failed authentication
+func (h *Handler) estUnauthorized(w http.ResponseWriter, r *http.Request, operation string, err error) {
+	if !errors.Is(err, errESTUnauthenticated) {
+		username, _, _ := r.BasicAuth()
+		h.logger.LogSecurityEvent("est_auth_failed", map[string]interface{}{
+			"path":       r.URL.Path,
+			"remote_ip":  r.RemoteAddr,
+			"user_agent": r.UserAgent(),
+			"username":   username,
+			"error":      err.Error(),
+		})
+		h.metrics.RecordSecurityEvent("est_auth_failed")
+	}
+	h.metrics.RecordESTRequest(operation, "unauthorized")
+	w.Header().Set("WWW-Authenticate", `Basic realm="certM3 EST"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// estEmailDenied answers an EST request whose CSR names an email address
+// that is not the user's
+func (h *Handler) estEmailDenied(w http.ResponseWriter, r *http.Request, operation, userID string, err error) {
+	h.logger.LogSecurityEvent("email_denied", map[string]interface{}{
+		"path":    r.URL.Path,
+		"user_id": userID,
+		"error":   err.Error(),
+	})
+	h.metrics.RecordSecurityEvent("email_denied")
+	h.metrics.RecordESTRequest(operation, "denied")
+	http.Error(w, "Email address not allowed", http.StatusForbidden)
+}
+
+// estProfile returns the certificate profile for an EST request: the
+// label in its path if there is one, otherwise the configured EST profile
+func (h *Handler) estProfile(r *http.Request) string {
+	if label := mux.Vars(r)["label"]; label != "" {
+		return label
+	}
+	return h.config.AppServer.ESTProfile
+}
+
+// profileAllowsEmail reports whether the named profile copies email
+// addresses from CSRs
+func (h *Handler) profileAllowsEmail(name string) bool {
+	if name == "" {
+		name = h.config.Signer.DefaultProfile
+	}
+	profile, ok := h.config.Signer.Profiles[name]
+	if !ok {
+		// the default profile built without configured profiles
+		return len(h.config.Signer.Profiles) == 0
+	}
+	for _, sanType := range profile.AllowedSANTypes {
+		if sanType == "email" {
+			return true
+		}
+	}
+	return false
+}
+
+// readESTCSR reads the base64 DER PKCS#10 request of an enrollment and
+// returns it PEM encoded, as the signer takes it
+func readESTCSR(r *http.Request) (string, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxESTRequestSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read request")
+	}
+	defer r.Body.Close()
+	if len(body) > maxESTRequestSize {
+		return "", fmt.Errorf("request is too large")
+	}
+
+	var der []byte
+	if block, _ := pem.Decode(body); block != nil {
+		// Some clients send PEM despite the RFC
+		der = block.Bytes
+	} else if der, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(body)), "")); err != nil {
+		return "", fmt.Errorf("request must be a base64 encoded PKCS#10 CSR")
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return "", fmt.Errorf("invalid CSR: %v", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return "", fmt.Errorf("invalid CSR signature: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})), nil
+}
+
+// writeCertsOnlyPEM answers with the PEM certificates as a certs-only
+// PKCS#7 message
+func (h *Handler) writeCertsOnlyPEM(w http.ResponseWriter, certPEM string) {
+	h.writeCertsOnly(w, decodePEMCertificates(certPEM))
+}
+
+// writeCertsOnly answers with the DER certificates as a base64 certs-only
+// PKCS#7 message (RFC 7030 section 4.1.3)
+func (h *Handler) writeCertsOnly(w http.ResponseWriter, certs [][]byte) {
+	der, err := pkcs7.EncodeCertsOnly(certs)
+	if err != nil {
+		h.logger.Errorf("Failed to encode EST response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeBase64(w, "application/pkcs7-mime; smime-type=certs-only", der)
+}
+
+// writeBase64 answers with base64 encoded content in 64 character lines,
+// as EST clients expect
+func writeBase64(w http.ResponseWriter, contentType string, der []byte) {
+	encoded := base64.StdEncoding.EncodeToString(der)
+	var body strings.Builder
+	for len(encoded) > 64 {
+		body.WriteString(encoded[:64] + "\r\n")
+		encoded = encoded[64:]
+	}
+	body.WriteString(encoded + "\r\n")
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Transfer-Encoding", "base64")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, body.String())
+}
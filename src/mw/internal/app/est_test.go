@@ -0,0 +1,202 @@
+package app
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/pkcs7"
+	"github.com/ogt11/certm3/mw/internal/signer"
+)
+
+func TestEnrollmentCodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "est", "codes.json")
+	codes, err := OpenEnrollmentCodes(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, expires, err := codes.Create("id-alice", "alice", "router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(expires) < 59*time.Minute {
+		t.Errorf("code expires at %s, want in an hour", expires)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(code)) || bytes.Contains(data, []byte(strings.ReplaceAll(code, "-", ""))) {
+		t.Error("the code is stored in the clear")
+	}
+
+	// Codes survive a restart
+	if codes, err = OpenEnrollmentCodes(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codes.Take("bob", code); !errors.Is(err, errInvalidEnrollmentCode) {
+		t.Errorf("another user took the code: %v", err)
+	}
+	entry, err := codes.Take("alice", strings.ToLower(strings.ReplaceAll(code, "-", "")))
+	if err != nil {
+		t.Fatalf("taking the code retyped without dashes in lower case: %v", err)
+	}
+	if entry.UserID != "id-alice" || entry.Label != "router" {
+		t.Errorf("entry = %+v", entry)
+	}
+	if _, err := codes.Take("alice", code); !errors.Is(err, errInvalidEnrollmentCode) {
+		t.Errorf("the code was taken twice: %v", err)
+	}
+	if err := codes.Restore(entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codes.Take("alice", code); err != nil {
+		t.Errorf("taking a restored code: %v", err)
+	}
+
+	expired, err := OpenEnrollmentCodes(filepath.Join(t.TempDir(), "codes.json"), -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _, err = expired.Create("id-alice", "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := expired.Take("alice", code); !errors.Is(err, errInvalidEnrollmentCode) {
+		t.Errorf("took an expired code: %v", err)
+	}
+}
+
+// estResponse decodes the base64 body of an EST response
+func estResponse(t *testing.T, body []byte) []byte {
+	t.Helper()
+	der, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(body), "\r\n", ""))
+	if err != nil {
+		t.Fatalf("EST response is not base64: %v\n%s", err, body)
+	}
+	return der
+}
+
+// estEnroll posts a base64 CSR for commonName to an EST operation,
+// authenticated by header, and returns the status and the issued
+// certificate
+func (env *testEnv) estEnroll(t *testing.T, operation, commonName string, header map[string]string) (int, *x509.Certificate) {
+	t.Helper()
+	csr, _ := newTestCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}})
+	if header == nil {
+		header = make(map[string]string)
+	}
+	header["Content-Type"] = "application/pkcs10"
+	code, body := env.post(t, estPrefix+operation, base64.StdEncoding.EncodeToString(csr), header)
+	if code != http.StatusOK {
+		return code, nil
+	}
+	certs, err := pkcs7.ParseCertsOnly(estResponse(t, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 {
+		t.Fatalf("%s returned %d certificates", operation, len(certs))
+	}
+	return code, certs[0]
+}
+
+// basicAuth returns the headers for HTTP basic authentication
+func basicAuth(username, password string) map[string]string {
+	return map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))}
+}
+
+func TestESTEnrollment(t *testing.T) {
+	env := newTestEnv(t, nil)
+	if code, _ := env.do(t, http.MethodGet, estPrefix+"cacerts", "", nil); code != http.StatusNotFound {
+		t.Errorf("cacerts with EST disabled: %d", code)
+	}
+	if err := env.handler.EnableEST(); err != nil {
+		t.Fatal(err)
+	}
+
+	code, body := env.do(t, http.MethodGet, estPrefix+"cacerts", "", nil)
+	if code != http.StatusOK {
+		t.Fatalf("cacerts: %d %s", code, body)
+	}
+	cas, err := pkcs7.ParseCertsOnly(estResponse(t, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cas) != 1 || !cas[0].Equal(env.ca) {
+		t.Errorf("cacerts returned %d certificates, want the CA", len(cas))
+	}
+	code, body = env.do(t, http.MethodGet, estPrefix+"csrattrs", "", nil)
+	if code != http.StatusOK {
+		t.Fatalf("csrattrs: %d %s", code, body)
+	}
+	var attrs []asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(estResponse(t, body), &attrs); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(attrs, []asn1.ObjectIdentifier{oidAttributeCommonName, oidAttributeEmailAddress}) {
+		t.Errorf("csrattrs = %v, want CommonName and emailAddress", attrs)
+	}
+
+	code, body = env.post(t, "/app/est/codes", `{"label":"router"}`, env.bearer(t, "alice"))
+	if code != http.StatusOK {
+		t.Fatalf("creating an enrollment code: %d %s", code, body)
+	}
+	var created struct{ Code string }
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _ := env.estEnroll(t, "simpleenroll", "alice", nil); code != http.StatusUnauthorized {
+		t.Errorf("enrolling without credentials: %d", code)
+	}
+	if code, _ := env.estEnroll(t, "simpleenroll", "bob", basicAuth("bob", created.Code)); code != http.StatusUnauthorized {
+		t.Errorf("enrolling with another user's code: %d", code)
+	}
+	// A failed enrollment leaves the code usable
+	if code, _ := env.estEnroll(t, "simpleenroll", "mallory", basicAuth("alice", created.Code)); code == http.StatusOK {
+		t.Error("enrolled a CSR for another user")
+	}
+	code, cert := env.estEnroll(t, "simpleenroll", "alice", basicAuth("alice", strings.ToLower(created.Code)))
+	if code != http.StatusOK {
+		t.Fatalf("enrolling with the code: %d", code)
+	}
+	if cert.Subject.CommonName != "alice" {
+		t.Errorf("enrolled certificate issued to %q", cert.Subject.CommonName)
+	}
+	if code, _ := env.estEnroll(t, "simpleenroll", "alice", basicAuth("alice", created.Code)); code != http.StatusUnauthorized {
+		t.Errorf("enrolling with a used code: %d", code)
+	}
+
+	code, renewed := env.estEnroll(t, "simplereenroll", "alice", clientCert(pemCertificate(cert)))
+	if code != http.StatusOK {
+		t.Fatalf("reenrolling: %d", code)
+	}
+	if renewed.SerialNumber.Cmp(cert.SerialNumber) == 0 || renewed.Subject.CommonName != "alice" {
+		t.Errorf("reenrollment returned serial %s for %q", renewed.SerialNumber.Text(16), renewed.Subject.CommonName)
+	}
+	if code, _ := env.estEnroll(t, "simplereenroll", "mallory", clientCert(pemCertificate(cert))); code == http.StatusOK {
+		t.Error("reenrolled to another identity")
+	}
+	code, enrolled := env.estEnroll(t, "simpleenroll", "alice", clientCert(pemCertificate(renewed)))
+	if code != http.StatusOK {
+		t.Fatalf("enrolling with a client certificate: %d", code)
+	}
+	// Revoked certificates enroll nothing
+	if _, err := env.signer.Revoke(enrolled.SerialNumber, signer.ReasonKeyCompromise); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := env.estEnroll(t, "simpleenroll", "alice", clientCert(pemCertificate(enrolled))); code != http.StatusUnauthorized {
+		t.Errorf("enrolling with a revoked client certificate: %d", code)
+	}
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/ogt11/certm3/mw/internal/pkcs7"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+// Output formats for issued certificates
+const (
+	FormatPEM   = "pem"   // PEM strings, plus the chain as one PEM bundle
+	FormatDER   = "der"   // base64 DER strings, plus the chain as a list
+	FormatPKCS7 = "pkcs7" // a base64 certs-only PKCS#7 of the chain
+)
+
+// validFormat reports whether format names an output format; empty means
+// FormatPEM
+func validFormat(format string) bool {
+	switch format {
+	case "", FormatPEM, FormatDER, FormatPKCS7:
+		return true
+	}
+	return false
+}
+
+// certificateResponse renders a signing result in format. The chain runs
+// from the new certificate to its issuing CA, and on up to the root when
+// includeChain is set and the signer knows the issuers above its CA. An
+// attribute certificate issued alongside is rendered on its own, PEM or
+// base64 DER.
+func certificateResponse(result *signerproto.SignResult, format string, includeChain bool) (map[string]interface{}, error) {
+	response, err := renderChain(result, format, includeChain)
+	if err != nil || result.AttributeCertificate == "" {
+		return response, err
+	}
+	if format == "" || format == FormatPEM {
+		response["attributeCertificate"] = result.AttributeCertificate
+	} else if block, _ := pem.Decode([]byte(result.AttributeCertificate)); block != nil {
+		response["attributeCertificate"] = base64.StdEncoding.EncodeToString(block.Bytes)
+	}
+	return response, nil
+}
+
+// renderChain renders the certificate and its chain in format
+func renderChain(result *signerproto.SignResult, format string, includeChain bool) (map[string]interface{}, error) {
+	chainPEM := []string{result.Certificate, result.CACertificate}
+	if includeChain {
+		chainPEM = append(chainPEM, result.Chain...)
+	}
+	if format == "" {
+		format = FormatPEM
+	}
+
+	switch format {
+	case FormatPEM:
+		var bundle strings.Builder
+		for _, certPEM := range chainPEM {
+			bundle.WriteString(strings.TrimSpace(certPEM) + "\n")
+		}
+		return map[string]interface{}{
+			"format":        format,
+			"certificate":   result.Certificate,
+			"caCertificate": result.CACertificate,
+			"chain":         bundle.String(),
+		}, nil
+	case FormatDER:
+		chain := make([]string, 0, len(chainPEM))
+		for _, certPEM := range chainPEM {
+			certs := decodePEMCertificates(certPEM)
+			if len(certs) != 1 {
+				return nil, fmt.Errorf("expected one PEM certificate from the signer, got %d", len(certs))
+			}
+			chain = append(chain, base64.StdEncoding.EncodeToString(certs[0]))
+		}
+		return map[string]interface{}{
+			"format":        format,
+			"certificate":   chain[0],
+			"caCertificate": chain[1],
+			"chain":         chain,
+		}, nil
+	case FormatPKCS7:
+		var certs [][]byte
+		for _, certPEM := range chainPEM {
+			certs = append(certs, decodePEMCertificates(certPEM)...)
+		}
+		der, err := pkcs7.EncodeCertsOnly(certs)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"format":      format,
+			"certificate": base64.StdEncoding.EncodeToString(der),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown certificate format %q", format)
+}
+
+// decodePEMCertificates returns the DER bytes of the certificates in
+// certPEM
+func decodePEMCertificates(certPEM string) [][]byte {
+	var certs [][]byte
+	for block, rest := pem.Decode([]byte(certPEM)); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, block.Bytes)
+		}
+	}
+	return certs
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+	"github.com/ogt11/certm3/mw/internal/pkcs7"
+)
+
+// newChainEnv returns a test environment whose CA is an intermediate below
+// a root it returns
+func newChainEnv(t *testing.T) (*testEnv, *x509.Certificate) {
+	t.Helper()
+	root, rootKey := newTestCACert(t, "Root CA", nil, nil)
+	ca, caKey := newTestCACert(t, "Issuing CA", root, rootKey)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		dir := filepath.Dir(cfg.Signer.CACertPath)
+		writeTestCA(t, dir, ca, caKey)
+		cfg.Signer.CAChainPath = filepath.Join(dir, "chain.pem")
+		writeTestFile(t, cfg.Signer.CAChainPath, []byte(pemCertificate(root)))
+	})
+	return env, root
+}
+
+// submitCSR submits a CSR for alice with the given options and returns the
+// status and the decoded response
+func (env *testEnv) submitCSR(t *testing.T, requestID string, options map[string]interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	csr, _ := csrPEM(t, "alice")
+	request := map[string]interface{}{"csr": csr}
+	for name, value := range options {
+		request[name] = value
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, data := env.post(t, "/app/submit-csr", string(body), env.bearerFor(t, "alice", requestID))
+	if code != http.StatusOK {
+		return code, nil
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return code, resp
+}
+
+// decodeBase64 decodes a base64 string from a response
+func decodeBase64(t *testing.T, value interface{}) []byte {
+	t.Helper()
+	s, _ := value.(string)
+	der, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("%q is not base64: %v", value, err)
+	}
+	return der
+}
+
+func TestCertificateFormats(t *testing.T) {
+	env, root := newChainEnv(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(env.ca)
+	verify := func(name string, der []byte) {
+		t.Helper()
+		leaf, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	code, resp := env.submitCSR(t, "req-pem", nil)
+	if code != http.StatusOK {
+		t.Fatalf("PEM: %d", code)
+	}
+	chain, _ := resp["chain"].(string)
+	if resp["format"] != FormatPEM || strings.Count(chain, "BEGIN CERTIFICATE") != 2 {
+		t.Errorf("PEM response has format %v and chain\n%s", resp["format"], chain)
+	}
+	verify("PEM", parseCertPEM(t, resp["certificate"].(string)).Raw)
+
+	code, resp = env.submitCSR(t, "req-pem-chain", map[string]interface{}{"includeChain": true})
+	if code != http.StatusOK {
+		t.Fatalf("PEM with chain: %d", code)
+	}
+	if chain, _ := resp["chain"].(string); strings.Count(chain, "BEGIN CERTIFICATE") != 3 {
+		t.Errorf("PEM chain up to the root has\n%s", chain)
+	}
+
+	code, resp = env.submitCSR(t, "req-der", map[string]interface{}{"format": FormatDER, "includeChain": true})
+	if code != http.StatusOK {
+		t.Fatalf("DER: %d", code)
+	}
+	ders, _ := resp["chain"].([]interface{})
+	if len(ders) != 3 {
+		t.Fatalf("DER chain has %d certificates, want 3", len(ders))
+	}
+	verify("DER", decodeBase64(t, resp["certificate"]))
+	if top, err := x509.ParseCertificate(decodeBase64(t, ders[2])); err != nil || !top.Equal(root) {
+		t.Errorf("DER chain does not end at the root: %v", err)
+	}
+
+	code, resp = env.submitCSR(t, "req-pkcs7", map[string]interface{}{"format": FormatPKCS7, "includeChain": true})
+	if code != http.StatusOK {
+		t.Fatalf("PKCS#7: %d", code)
+	}
+	certs, err := pkcs7.ParseCertsOnly(decodeBase64(t, resp["certificate"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 3 || !certs[1].Equal(env.ca) || !certs[2].Equal(root) {
+		t.Fatalf("PKCS#7 has %d certificates, want the leaf, CA and root", len(certs))
+	}
+	verify("PKCS#7", certs[0].Raw)
+
+	if code, _ := env.submitCSR(t, "req-jks", map[string]interface{}{"format": "jks"}); code != http.StatusBadRequest {
+		t.Errorf("unknown format: %d", code)
+	}
+}
@@ -2,19 +2,26 @@ package app
 
 import (
 	"bytes"
+	"context"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"math"
-	"net"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/ogt11/certm3/mw/internal/acme"
 	"github.com/ogt11/certm3/mw/internal/config"
 	"github.com/ogt11/certm3/mw/internal/logging"
 	"github.com/ogt11/certm3/mw/internal/security"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
 	"github.com/ogt11/certm3/mw/pkg/metrics"
 )
 
@@ -23,11 +30,23 @@ func min(x, y int) int {
 	return int(math.Min(float64(x), float64(y)))
 }
 
+// Timeouts for talking to the signer
+const (
+	signerDialTimeout    = 5 * time.Second
+	signerRequestTimeout = 30 * time.Second
+)
+
 // Handler holds the dependencies for the handlers
 type Handler struct {
 	logger     *logging.Logger
 	metrics    *metrics.Metrics
 	jwtManager *security.JWTManager
+	tickets    *security.TicketManager
+	signer     SignerClient
+	outbox     *CertificateOutbox
+	certAuth   *ClientCertAuth
+	acme       *acme.Server     // set by NewACMEServer
+	enrollment *EnrollmentCodes // set by EnableEST
 	client     *http.Client
 	backendURL string
 	testMode   bool
@@ -38,11 +57,15 @@ type Handler struct {
 // IMPORTANT: We use the same backend API call code path in both test and production modes.
 // This ensures that any issues with the frontend can be isolated from backend API integration issues.
 // The testMode flag is only used to bypass JWT validation in SubmitCSR, not to modify backend API calls.
-func NewHandler(logger *logging.Logger, metrics *metrics.Metrics, jwtManager *security.JWTManager, client *http.Client, backendURL string, testMode bool, config *config.Config) *Handler {
+func NewHandler(logger *logging.Logger, metrics *metrics.Metrics, jwtManager *security.JWTManager, tickets *security.TicketManager, signer SignerClient, outbox *CertificateOutbox, certAuth *ClientCertAuth, client *http.Client, backendURL string, testMode bool, config *config.Config) *Handler {
 	return &Handler{
 		logger:     logger,
 		metrics:    metrics,
 		jwtManager: jwtManager,
+		tickets:    tickets,
+		signer:     signer,
+		outbox:     outbox,
+		certAuth:   certAuth,
 		client:     client,
 		backendURL: backendURL,
 		testMode:   testMode,
@@ -192,7 +215,7 @@ func (h *Handler) InitiateRequest(w http.ResponseWriter, r *http.Request) {
 	defer resp.Body.Close()
 
 	// Record backend request metrics
-	h.metrics.RecordBackendRequest("POST", "/requests", string(resp.StatusCode), time.Since(start), nil)
+	h.metrics.RecordBackendRequest("POST", "/requests", strconv.Itoa(resp.StatusCode), time.Since(start), nil)
 
 	// Record request initiation result
 	if resp.StatusCode == http.StatusOK {
@@ -350,7 +373,7 @@ func (h *Handler) ValidateEmail(w http.ResponseWriter, r *http.Request) {
 	defer resp.Body.Close()
 
 	// Record backend request metrics
-	h.metrics.RecordBackendRequest("POST", "/requests/validate", string(resp.StatusCode), time.Since(start), nil)
+	h.metrics.RecordBackendRequest("POST", "/requests/validate", strconv.Itoa(resp.StatusCode), time.Since(start), nil)
 
 	// Read response body
 	respBody, err := io.ReadAll(resp.Body)
@@ -690,7 +713,7 @@ func (h *Handler) ValidateEmail(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Generate JWT token
-		token, err := h.jwtManager.GenerateToken(backendResp.UserID, req.RequestID)
+		token, err := h.jwtManager.GenerateToken(backendResp.UserID, requestData.Username, req.RequestID)
 		if err != nil {
 			h.logger.LogError(err, map[string]interface{}{
 				"path":       r.URL.Path,
@@ -730,7 +753,7 @@ func (h *Handler) ValidateEmail(w http.ResponseWriter, r *http.Request) {
 
 // SubmitCSR handles CSR submission
 func (h *Handler) SubmitCSR(w http.ResponseWriter, r *http.Request) {
-	var userID, requestID string
+	var userID, username, requestID string
 	var ok bool
 
 	if !h.testMode {
@@ -757,11 +780,39 @@ func (h *Handler) SubmitCSR(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+
+		// Tokens issued before the username claim existed carry only the
+		// request ID; recover the username from the validated request
+		username, _ = r.Context().Value("username").(string)
+		if username == "" {
+			var err error
+			username, err = h.lookupRequestUsername(requestID)
+			if err != nil {
+				h.logger.LogSecurityEvent("missing_username", map[string]interface{}{
+					"path":       r.URL.Path,
+					"remote_ip":  r.RemoteAddr,
+					"user_agent": r.UserAgent(),
+					"user_id":    userID,
+					"request_id": requestID,
+					"error":      err.Error(),
+				})
+				h.metrics.RecordSecurityEvent("missing_username")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+	} else {
+		// The test flow still goes through the auth middleware, so use the
+		// identity it established; the signer binds tickets to it
+		userID, _ = r.Context().Value("user_id").(string)
+		username, _ = r.Context().Value("username").(string)
+		requestID, _ = r.Context().Value("request_id").(string)
 	}
 
 	// Log the CSR submission
 	h.logger.WithFields(map[string]interface{}{
 		"user_id":    userID,
+		"username":   username,
 		"request_id": requestID,
 	}).Info("CSR submission received")
 
@@ -792,8 +843,14 @@ func (h *Handler) SubmitCSR(w http.ResponseWriter, r *http.Request) {
 	// The CSR must be sent as a PEM-encoded string in the csr field of a JSON object.
 	// The request can also contain a "groups" field, which is an array of strings.
 	var req struct {
-		CSR    string   `json:"csr"`
-		Groups []string `json:"groups"` // Added to receive requested groups
+		CSR     string   `json:"csr"`
+		Groups  []string `json:"groups"`  // Added to receive requested groups
+		Profile string   `json:"profile"` // Optional certificate profile name
+
+		// Output format (FormatPEM by default) and whether to include
+		// the issuers above the issuing CA, up to the root
+		Format       string `json:"format"`
+		IncludeChain bool   `json:"includeChain"`
 	}
 	if err := json.Unmarshal(body, &req); err != nil {
 		h.logger.LogSecurityEvent("invalid_csr_format", map[string]interface{}{
@@ -826,29 +883,67 @@ func (h *Handler) SubmitCSR(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "CSR is required", http.StatusBadRequest)
 		return
 	}
+	if !validFormat(req.Format) {
+		http.Error(w, "format must be pem, der or pkcs7", http.StatusBadRequest)
+		return
+	}
+
+	// Decide whether this user may request the profile
+	profile, err := h.authorizeProfile(userID, req.Profile)
+	if err != nil {
+		h.logger.LogSecurityEvent("profile_denied", map[string]interface{}{
+			"path":       r.URL.Path,
+			"remote_ip":  r.RemoteAddr,
+			"user_agent": r.UserAgent(),
+			"user_id":    userID,
+			"request_id": requestID,
+			"profile":    req.Profile,
+			"error":      err.Error(),
+		})
+		h.metrics.RecordSecurityEvent("profile_denied")
+		http.Error(w, "Certificate profile not allowed", http.StatusForbidden)
+		return
+	}
+
+	if err := h.checkCSREmails(r.Context(), userID, req.CSR); err != nil {
+		h.logger.LogSecurityEvent("email_denied", map[string]interface{}{
+			"path":       r.URL.Path,
+			"remote_ip":  r.RemoteAddr,
+			"user_agent": r.UserAgent(),
+			"user_id":    userID,
+			"request_id": requestID,
+			"error":      err.Error(),
+		})
+		h.metrics.RecordSecurityEvent("email_denied")
+		http.Error(w, "Email address not allowed", http.StatusForbidden)
+		return
+	}
 
 	// Record certificate request
 	h.metrics.RecordCertificateRequest("submitted")
 
-	// Create signer request
-	// Protocol: Raw JSON messages over Unix domain socket
-	// Request format:
-	// {
-	//   "requestId": "string",
-	//   "csr": "string",  // PEM-encoded CSR
-	//   "groups": ["string"],
-	//   "token": "string"
-	// }
-	signerReq := struct {
-		RequestID string   `json:"requestId"`
-		CSR       string   `json:"csr"`
-		Groups    []string `json:"groups"`
-		Token     string   `json:"token"`
-	}{
+	// Issue a single-use ticket authorizing the signer to sign exactly this
+	// CSR for this user and request, with this profile and these groups
+	ticket, err := h.tickets.IssueTicket(userID, username, requestID, security.TicketActionSign, security.IssuancePayload([]byte(req.CSR), profile, req.Groups))
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"request_id": requestID,
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Create signer request; see package signerproto for the wire protocol
+	signerReq := &signerproto.SignRequest{
+		UserID:    userID,
+		Username:  username,
 		RequestID: requestID,
 		CSR:       req.CSR,
-		Groups:    req.Groups,                    // Pass the groups received in the request
-		Token:     r.Header.Get("Authorization"), // Send the JWT token
+		Groups:    req.Groups, // Pass the groups received in the request
+		Token:     ticket,
+		Profile:   profile,
 	}
 
 	// Log the groups being sent to the signer
@@ -856,13 +951,14 @@ func (h *Handler) SubmitCSR(w http.ResponseWriter, r *http.Request) {
 		"user_id":          userID,
 		"request_id":       requestID,
 		"requested_groups": req.Groups,
+		"profile":          profile,
 	}).Info("Sending CSR and requested groups to signer service")
 
 	// Send request to signer
 	start := time.Now()
-
-	// Create Unix domain socket connection to signer
-	conn, err := net.Dial("unix", h.config.Signer.SocketPath)
+	ctx, cancel := context.WithTimeout(r.Context(), signerRequestTimeout)
+	defer cancel()
+	signerResp, err := h.signer.Sign(ctx, signerReq)
 	if err != nil {
 		h.logger.LogError(err, map[string]interface{}{
 			"path":       r.URL.Path,
@@ -872,68 +968,179 @@ func (h *Handler) SubmitCSR(w http.ResponseWriter, r *http.Request) {
 			"request_id": requestID,
 		})
 		h.metrics.RecordSignerRequest("error", time.Since(start), err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeSignerError(w, err, "Failed to sign CSR")
 		return
 	}
-	defer conn.Close()
+	h.metrics.RecordSignerRequest("success", time.Since(start), nil)
+
+	// Add the certificate to the backend's inventory
+	h.registerCertificate(signerResp.Certificate, userID, username)
 
-	// Send request as raw JSON
-	if err := json.NewEncoder(conn).Encode(signerReq); err != nil {
+	// Return the signed certificate in the requested format
+	resp, err := certificateResponse(signerResp, req.Format, req.IncludeChain)
+	if err != nil {
 		h.logger.LogError(err, map[string]interface{}{
 			"path":       r.URL.Path,
-			"remote_ip":  r.RemoteAddr,
-			"user_agent": r.UserAgent(),
 			"user_id":    userID,
 			"request_id": requestID,
 		})
-		h.metrics.RecordSignerRequest("error", time.Since(start), err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
 
-	// Read response
-	var signerResp struct {
-		Success bool `json:"success"`
-		Data    struct {
-			Certificate   string `json:"certificate"`
-			CACertificate string `json:"caCertificate"`
-		} `json:"data,omitempty"`
-		Error string `json:"error,omitempty"`
+// registerCertificate queues an issued certificate for registration with
+// the backend. The user gets the certificate either way; failures here are
+// logged for operators to act on.
+func (h *Handler) registerCertificate(certPEM, userID, username string) {
+	if h.outbox == nil {
+		return
 	}
-
-	if err := json.NewDecoder(conn).Decode(&signerResp); err != nil {
-		h.logger.LogError(err, map[string]interface{}{
-			"component":  "middleware",
-			"path":       r.URL.Path,
-			"remote_ip":  r.RemoteAddr,
-			"user_agent": r.UserAgent(),
-			"user_id":    userID,
-			"request_id": requestID,
+	metadata, err := certificateMetadata(certPEM, userID, username)
+	if err != nil {
+		h.logger.Errorf("Cannot register certificate for user %s with the backend: %v", username, err)
+		h.metrics.RecordCertificateRegistration("invalid")
+		return
+	}
+	if err := h.outbox.Enqueue(metadata); err != nil {
+		h.logger.LogSecurityEvent("certificate_registration_lost", map[string]interface{}{
+			"serial":   metadata.SerialNumber,
+			"user_id":  userID,
+			"username": username,
+			"error":    err.Error(),
 		})
+		h.metrics.RecordCertificateRegistration("lost")
+	}
+}
+
+// signWithUserGroups has the signer sign csrPEM for the user with the
+// named profile and registers the certificate with the backend. Enrollment
+// protocols use it where the web flow lets the user pick groups: it asks
+// for all of the user's groups, which the signer still intersects with the
+// backend's. kind labels the certificate request metric.
+func (h *Handler) signWithUserGroups(ctx context.Context, kind, userID, username, requestID, csrPEM, profileName string) (*signerproto.SignResult, error) {
+	profile, err := h.authorizeProfile(userID, profileName)
+	if err != nil {
+		return nil, signerproto.Errorf(signerproto.CodePolicyDenied, "%v", err)
+	}
+	groups, err := h.fetchUserGroupsByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up groups: %v", err)
+	}
+
+	h.metrics.RecordCertificateRequest(kind)
+	ticket, err := h.tickets.IssueTicket(userID, username, requestID, security.TicketActionSign, security.IssuancePayload([]byte(csrPEM), profile, groups))
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	result, err := h.signer.Sign(ctx, &signerproto.SignRequest{
+		UserID:    userID,
+		Username:  username,
+		RequestID: requestID,
+		CSR:       csrPEM,
+		Groups:    groups,
+		Token:     ticket,
+		Profile:   profile,
+	})
+	if err != nil {
 		h.metrics.RecordSignerRequest("error", time.Since(start), err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, err
+	}
+	h.metrics.RecordSignerRequest("success", time.Since(start), nil)
+
+	h.registerCertificate(result.Certificate, userID, username)
+	return result, nil
+}
+
+// checkCSREmails checks that every email address in csrPEM is the user's
+// registered one. The signer cannot tell whose addresses a CSR names; ACME
+// proves control of them with its challenge instead, so it does not use
+// this. A CSR that does not parse is left for the signer to reject.
+func (h *Handler) checkCSREmails(ctx context.Context, userID, csrPEM string) error {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil {
+		return nil
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil || len(csr.EmailAddresses) == 0 {
+		return nil
+	}
+	user, err := h.lookupUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to look up user for email check: %v", err)
+	}
+	for _, address := range csr.EmailAddresses {
+		if user.Email == "" || !strings.EqualFold(address, user.Email) {
+			return fmt.Errorf("email address %s is not the user's registered address", address)
+		}
+	}
+	return nil
+}
+
+// writeSignerError answers with the HTTP status matching a signer failure.
+// Only errors about the request itself are shown to the user; others get
+// the failure message.
+func writeSignerError(w http.ResponseWriter, err error, failure string) {
+	var perr *signerproto.Error
+	if !errors.As(err, &perr) {
+		// The signer could not be reached at all
+		http.Error(w, "Signing service unavailable", http.StatusServiceUnavailable)
 		return
 	}
 
-	if !signerResp.Success {
-		h.logger.LogError(fmt.Errorf("signer error: %s", signerResp.Error), map[string]interface{}{
-			"path":       r.URL.Path,
-			"remote_ip":  r.RemoteAddr,
-			"user_agent": r.UserAgent(),
-			"user_id":    userID,
-			"request_id": requestID,
+	status := perr.Code.HTTPStatus()
+	if len(perr.Reasons) > 0 {
+		// Policy denials say which rules the request broke
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   perr.Message,
+			"reasons": perr.Reasons,
 		})
-		h.metrics.RecordSignerRequest("error", time.Since(start), fmt.Errorf(signerResp.Error))
-		http.Error(w, "Failed to sign CSR", http.StatusInternalServerError)
 		return
 	}
+	switch perr.Code {
+	case signerproto.CodeBadRequest, signerproto.CodeBadCSR, signerproto.CodePolicyDenied, signerproto.CodeNotFound:
+		http.Error(w, perr.Message, status)
+	default:
+		http.Error(w, failure, status)
+	}
+}
 
-	// Return the signed certificate
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"certificate":   signerResp.Data.Certificate,
-		"caCertificate": signerResp.Data.CACertificate,
-	})
+// lookupRequestUsername returns the username of a validated request
+func (h *Handler) lookupRequestUsername(requestID string) (string, error) {
+	start := time.Now()
+	req, err := http.NewRequest("GET", h.config.AppServer.BackendAPIURL+"/requests/"+requestID, nil)
+	if err != nil {
+		h.metrics.RecordBackendRequest("GET", "/requests", "error", time.Since(start), err)
+		return "", err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		h.metrics.RecordBackendRequest("GET", "/requests", "error", time.Since(start), err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	h.metrics.RecordBackendRequest("GET", "/requests", strconv.Itoa(resp.StatusCode), time.Since(start), nil)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("backend returned status %d for request %s", resp.StatusCode, requestID)
+	}
+
+	var requestData struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&requestData); err != nil {
+		return "", fmt.Errorf("failed to decode request: %v", err)
+	}
+	if requestData.Username == "" {
+		return "", fmt.Errorf("request %s has no username", requestID)
+	}
+	return requestData.Username, nil
 }
 
 // CheckUsername handles username availability check
@@ -1119,7 +1326,7 @@ func (h *Handler) GetUserGroups(w http.ResponseWriter, r *http.Request) {
 	defer groupsResp.Body.Close()
 
 	// Record backend request metrics
-	h.metrics.RecordBackendRequest("GET", "/users/groups", string(groupsResp.StatusCode), time.Since(start), nil)
+	h.metrics.RecordBackendRequest("GET", "/users/groups", strconv.Itoa(groupsResp.StatusCode), time.Since(start), nil)
 
 	if groupsResp.StatusCode != http.StatusOK {
 		h.logger.LogError(fmt.Errorf("unexpected status code: %d", groupsResp.StatusCode), map[string]interface{}{
@@ -1155,5 +1362,18 @@ func RegisterRoutes(r *mux.Router, h *Handler) {
 	r.HandleFunc("/app/submit-csr", h.SubmitCSR).Methods("POST")
 	r.HandleFunc("/app/check-username/{username}", h.CheckUsername).Methods("GET")
 	r.HandleFunc("/app/groups/{username}", h.GetUserGroups).Methods("GET")
+	r.HandleFunc("/app/renew", h.RenewCertificate).Methods("POST")
+	r.HandleFunc("/app/certificates/{serial}/revoke", h.RevokeCertificate).Methods("POST")
+	r.HandleFunc("/app/certificates/{serial}/attribute-certificate", h.RefreshAttributeCertificate).Methods("POST")
+	r.HandleFunc("/app/admin/certificates/{serial}/revoke", h.AdminRevokeCertificate).Methods("POST")
+	r.HandleFunc("/app/acme/eab", h.CreateACMEBinding).Methods("POST")
+	r.HandleFunc("/app/est/codes", h.CreateEnrollmentCode).Methods("POST")
+	r.HandleFunc("/app/ssh/certificate", h.SignSSHKey).Methods("POST")
+	for _, prefix := range []string{estPrefix, estPrefix + "{label}/"} {
+		r.HandleFunc(prefix+"cacerts", h.ESTCACerts).Methods("GET")
+		r.HandleFunc(prefix+"csrattrs", h.ESTCSRAttrs).Methods("GET")
+		r.HandleFunc(prefix+"simpleenroll", h.ESTSimpleEnroll).Methods("POST")
+		r.HandleFunc(prefix+"simplereenroll", h.ESTSimpleReenroll).Methods("POST")
+	}
 	r.HandleFunc("/app/health", h.HealthCheck).Methods("GET")
 }
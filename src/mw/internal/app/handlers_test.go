@@ -0,0 +1,443 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ogt11/certm3/mw/internal/acme"
+	"github.com/ogt11/certm3/mw/internal/api"
+	"github.com/ogt11/certm3/mw/internal/cakey"
+	"github.com/ogt11/certm3/mw/internal/config"
+	"github.com/ogt11/certm3/mw/internal/logging"
+	"github.com/ogt11/certm3/mw/internal/security"
+	"github.com/ogt11/certm3/mw/internal/signer"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+	"github.com/ogt11/certm3/mw/pkg/metrics"
+)
+
+// testMetrics is shared, as metrics register with the default registry
+var testMetrics = metrics.New()
+
+// testClientCertHeader is the header the test proxy passes client
+// certificates in
+const testClientCertHeader = "X-SSL-Client-Cert"
+
+// newTestLogger returns a logger for tests that only reports errors
+func newTestLogger(t *testing.T) *logging.Logger {
+	t.Helper()
+	logger, err := logging.New("error", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logger
+}
+
+// testBackend is a fake backend API. Users have the ID "id-<username>" and
+// an address at example.com, and are in the groups set for them or else in
+// "users". Certificate records are accepted and revocations recorded.
+type testBackend struct {
+	mu          sync.Mutex
+	groups      map[string][]string
+	revocations []api.CertificateRevocation
+}
+
+// setGroups sets the groups username is in
+func (b *testBackend) setGroups(username string, groups ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.groups == nil {
+		b.groups = make(map[string][]string)
+	}
+	b.groups[username] = groups
+}
+
+// revoked returns the revocations delivered so far
+func (b *testBackend) revoked() []api.CertificateRevocation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]api.CertificateRevocation(nil), b.revocations...)
+}
+
+func (b *testBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch path := r.URL.Path; {
+	case strings.HasPrefix(path, "/users/username/"):
+		json.NewEncoder(w).Encode(map[string]string{"id": "id-" + strings.TrimPrefix(path, "/users/username/")})
+	case strings.HasPrefix(path, "/users/id-") && strings.HasSuffix(path, "/groups"):
+		groups, ok := b.groups[strings.TrimSuffix(strings.TrimPrefix(path, "/users/id-"), "/groups")]
+		if !ok {
+			groups = []string{"users"}
+		}
+		json.NewEncoder(w).Encode(groups)
+	case strings.HasPrefix(path, "/users/id-"):
+		username := strings.TrimPrefix(path, "/users/id-")
+		json.NewEncoder(w).Encode(map[string]string{"username": username, "email": username + "@example.com"})
+	case strings.HasPrefix(path, "/certificates/") && strings.HasSuffix(path, "/revoke"):
+		var revocation api.CertificateRevocation
+		if err := json.NewDecoder(r.Body).Decode(&revocation); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		revocation.SerialNumber = strings.TrimSuffix(strings.TrimPrefix(path, "/certificates/"), "/revoke")
+		b.revocations = append(b.revocations, revocation)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// testEnv is an app server wired to a signer and a fake backend the way
+// main wires them, with the signer on a Unix socket
+type testEnv struct {
+	dir     string
+	cfg     *config.Config
+	ca      *x509.Certificate
+	signer  *signer.Signer
+	tickets *security.TicketManager
+	client  *signerproto.Client
+	backend *testBackend
+	outbox  *CertificateOutbox
+	jwt     *security.JWTManager
+	handler *Handler
+	server  *httptest.Server
+}
+
+// newTestEnv starts a test environment with a fresh self-signed CA. Its
+// files are in a temporary directory, and ACME and EST, when enabled, are
+// set up there too. configure, if not nil, adjusts the configuration
+// before anything is opened.
+func newTestEnv(t *testing.T, configure func(*config.Config)) *testEnv {
+	t.Helper()
+	env := &testEnv{dir: t.TempDir(), backend: &testBackend{}}
+	cert, key := newTestCACert(t, "Test CA", nil, nil)
+	writeTestCA(t, env.dir, cert, key)
+	if err := os.Mkdir(filepath.Join(env.dir, "mail"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := httptest.NewServer(env.backend)
+	t.Cleanup(backend.Close)
+	env.server = httptest.NewUnstartedServer(nil)
+	t.Cleanup(env.server.Close)
+
+	cfg := &config.Config{}
+	cfg.Signer.CACertPath = filepath.Join(env.dir, "ca.pem")
+	cfg.Signer.CAKeyPath = filepath.Join(env.dir, "ca.key")
+	cfg.Signer.DefaultProfile = "default"
+	cfg.Signer.RevocationDBPath = filepath.Join(env.dir, "revocations.json")
+	cfg.Signer.IssuedDBPath = filepath.Join(env.dir, "issued.jsonl")
+	cfg.Signer.CRLValidity = 48 * time.Hour
+	cfg.Signer.CertValidityDays = 30
+	cfg.AppServer.BackendAPIURL = backend.URL
+	cfg.AppServer.ClientCertHeader = testClientCertHeader
+	cfg.AppServer.ClientCAPath = cfg.Signer.CACertPath
+	cfg.AppServer.AdminGroups = []string{"admin"}
+	cfg.AppServer.TestEmailDir = filepath.Join(env.dir, "mail")
+	cfg.AppServer.ACMEBaseURL = "http://" + env.server.Listener.Addr().String() + "/acme"
+	cfg.AppServer.ACMEStatePath = filepath.Join(env.dir, "acme.json")
+	cfg.AppServer.ACMEOrderTTL = time.Hour
+	cfg.AppServer.ACMEAuthorizationTTL = time.Hour
+	cfg.AppServer.ACMEEABKeyTTL = time.Hour
+	cfg.AppServer.ESTCodesPath = filepath.Join(env.dir, "est-codes.json")
+	cfg.AppServer.ESTCodeTTL = time.Hour
+	if configure != nil {
+		configure(cfg)
+	}
+	env.cfg = cfg
+
+	logger := newTestLogger(t)
+	ca, err := cakey.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ca.Close() })
+	env.ca = ca.Certificate
+	env.signer = signer.New(cfg, logger, testMetrics, ca.Certificate, ca.Key, ca.Chain, "1.3.6.1.4.1.10049.2")
+	env.tickets = security.NewTicketManager("test-secret", time.Minute)
+	env.client = signerproto.NewClient("unix", serveSigner(t, signer.NewHandler(logger, testMetrics, env.signer, env.tickets)), time.Second)
+	t.Cleanup(func() { env.client.Close() })
+
+	env.outbox, err = OpenCertificateOutbox(filepath.Join(env.dir, "outbox.json"), api.NewClient(backend.URL), logger, testMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.jwt = security.NewJWTManager("test-jwt-secret", "certM3", "certM3-app")
+	certAuth, err := NewClientCertAuth(cfg, env.client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.handler = NewHandler(logger, testMetrics, env.jwt, env.tickets, env.client, env.outbox, certAuth, http.DefaultClient, backend.URL, false, cfg)
+
+	var acmeServer *acme.Server
+	acmePrefix := ""
+	if cfg.AppServer.ACMEEnabled {
+		acmeServer, err = env.handler.NewACMEServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		acmePrefix = acmeServer.Prefix()
+	}
+	r := mux.NewRouter()
+	r.Use(AuthMiddleware(env.jwt, certAuth, acmePrefix, logger, testMetrics))
+	RegisterRoutes(r, env.handler)
+	if acmeServer != nil {
+		acmeServer.RegisterRoutes(r)
+	}
+	env.server.Config.Handler = r
+	env.server.Start()
+	return env
+}
+
+// newTestCACert returns a CA certificate issued by parent, or self-signed
+// if parent is nil, and its key
+func newTestCACert(t *testing.T, commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(48 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// writeTestCA writes a CA certificate and its key to ca.pem and ca.key in
+// dir
+func writeTestCA(t *testing.T, dir string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "ca.pem"), []byte(pemCertificate(cert)))
+	writeTestFile(t, filepath.Join(dir, "ca.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+// writeTestFile writes data to path, readable only by the owner
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveSigner serves h on a Unix socket until the test ends, returning the
+// socket's path
+func serveSigner(t *testing.T, h *signer.Handler) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "signer.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go h.HandleConnection(conn)
+		}
+	}()
+	return path
+}
+
+// newTestCSR returns a DER CSR for template, signed with a fresh key, and
+// the key
+func newTestCSR(t *testing.T, template *x509.CertificateRequest) ([]byte, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der, key
+}
+
+// csrPEM returns a PEM CSR with the given CommonName and its key
+func csrPEM(t *testing.T, commonName string) (string, *ecdsa.PrivateKey) {
+	t.Helper()
+	der, key := newTestCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}})
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})), key
+}
+
+// issue has the signer issue a certificate to username, as the app does
+// for an approved request, returning its serial, the PEM certificate and
+// its key
+func (env *testEnv) issue(t *testing.T, username string) (string, string, *ecdsa.PrivateKey) {
+	t.Helper()
+	csr, key := csrPEM(t, username)
+	requestID := "req-" + username
+	token, err := env.tickets.IssueTicket("id-"+username, username, requestID, security.TicketActionSign, security.IssuancePayload([]byte(csr), "", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := env.client.Sign(context.Background(), &signerproto.SignRequest{
+		RequestID: requestID,
+		CSR:       csr,
+		Token:     token,
+		UserID:    "id-" + username,
+		Username:  username,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Serial, result.Certificate, key
+}
+
+// bearer returns the headers authenticating a request as username with a
+// JWT
+func (env *testEnv) bearer(t *testing.T, username string) map[string]string {
+	t.Helper()
+	return env.bearerFor(t, username, "req-"+username)
+}
+
+// bearerFor returns the headers authenticating a request as username with
+// a JWT for the request requestID
+func (env *testEnv) bearerFor(t *testing.T, username, requestID string) map[string]string {
+	t.Helper()
+	token, err := env.jwt.GenerateToken("id-"+username, username, requestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+// clientCert returns the headers the proxy sets for a client presenting
+// the PEM certificate certPEM
+func clientCert(certPEM string) map[string]string {
+	return map[string]string{testClientCertHeader: url.QueryEscape(certPEM)}
+}
+
+// do sends a request to the app server and returns the response status and
+// body
+func (env *testEnv) do(t *testing.T, method, path, body string, header map[string]string) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, env.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+// post posts body to path on the app server
+func (env *testEnv) post(t *testing.T, path, body string, header map[string]string) (int, []byte) {
+	t.Helper()
+	return env.do(t, http.MethodPost, path, body, header)
+}
+
+// parseCertPEM parses a PEM certificate
+func parseCertPEM(t *testing.T, certPEM string) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		t.Fatalf("no PEM block in %q", certPEM)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// pemCertificate encodes cert as PEM
+func pemCertificate(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+// revokedSerials returns the reasons of the entries in the signer's CRL by
+// serial, in hex
+func (env *testEnv) revokedSerials(t *testing.T) map[string]int {
+	t.Helper()
+	der, err := env.signer.GenerateCRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serials := make(map[string]int)
+	for _, entry := range crl.RevokedCertificateEntries {
+		serials[entry.SerialNumber.Text(16)] = entry.ReasonCode
+	}
+	return serials
+}
+
+func TestSubmitCSREmailAddresses(t *testing.T) {
+	env := newTestEnv(t, nil)
+	submit := func(requestID string, emails ...string) int {
+		t.Helper()
+		der, _ := newTestCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "alice"}, EmailAddresses: emails})
+		body, err := json.Marshal(map[string]string{"csr": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _ := env.post(t, "/app/submit-csr", string(body), env.bearerFor(t, "alice", requestID))
+		return code
+	}
+
+	if code := submit("req-own", "Alice@example.com"); code != http.StatusOK {
+		t.Errorf("own address: %d, want 200", code)
+	}
+	if code := submit("req-foreign", "mallory@example.com"); code != http.StatusForbidden {
+		t.Errorf("foreign address: %d, want 403", code)
+	}
+	if code := submit("req-mixed", "alice@example.com", "bob@example.com"); code != http.StatusForbidden {
+		t.Errorf("own and foreign address: %d, want 403", code)
+	}
+}
@@ -93,14 +93,24 @@ func LoggingMiddleware(log *logging.Logger) mux.MiddlewareFunc {
 	}
 }
 
-// AuthMiddleware returns a middleware that validates JWT tokens
-func AuthMiddleware(jwtManager *security.JWTManager, log *logging.Logger, metrics *metrics.Metrics) mux.MiddlewareFunc {
+// AuthMiddleware returns a middleware that validates JWT tokens. Requests
+// without a token may authenticate with a client certificate instead when
+// certAuth is set; they carry a username but no user or request ID. Paths
+// under acmePrefix, if set, are left to the ACME server, and EST paths to
+// the EST handlers.
+func AuthMiddleware(jwtManager *security.JWTManager, certAuth *ClientCertAuth, acmePrefix string, log *logging.Logger, metrics *metrics.Metrics) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Skip authentication for health check, metrics, initiate-request, validate-email, and check-username endpoints
+			// Skip authentication for health check, metrics, initiate-request, validate-email, and check-username endpoints.
+			// Renewals are authenticated by the certificate being renewed, which the handler checks,
+			// ACME requests by their JWS signatures, and EST requests by client
+			// certificate or enrollment code.
 			if r.URL.Path == "/app/health" || r.URL.Path == "/metrics" ||
 				r.URL.Path == "/app/initiate-request" || r.URL.Path == "/app/validate-email" ||
-				strings.HasPrefix(r.URL.Path, "/app/check-username/") {
+				r.URL.Path == "/app/renew" ||
+				strings.HasPrefix(r.URL.Path, "/app/check-username/") ||
+				strings.HasPrefix(r.URL.Path, estPrefix) ||
+				(acmePrefix != "" && strings.HasPrefix(r.URL.Path, acmePrefix+"/")) {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -112,6 +122,23 @@ func AuthMiddleware(jwtManager *security.JWTManager, log *logging.Logger, metric
 				"auth_header": authHeader,
 				"headers":     r.Header,
 			})
+			if authHeader == "" && certAuth.Present(r) {
+				username, err := certAuth.Authenticate(r)
+				if err != nil {
+					log.LogSecurityEvent("invalid_client_certificate", map[string]interface{}{
+						"path":       r.URL.Path,
+						"remote_ip":  r.RemoteAddr,
+						"user_agent": r.UserAgent(),
+						"error":      err.Error(),
+					})
+					metrics.RecordSecurityEvent("invalid_client_certificate")
+					http.Error(w, "Invalid client certificate", http.StatusUnauthorized)
+					return
+				}
+				ctx := context.WithValue(r.Context(), "username", username)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
 			if authHeader == "" {
 				log.LogSecurityEvent("missing_auth_header", map[string]interface{}{
 					"path":       r.URL.Path,
@@ -156,6 +183,7 @@ func AuthMiddleware(jwtManager *security.JWTManager, log *logging.Logger, metric
 			// Add claims to request context
 			ctx := r.Context()
 			ctx = context.WithValue(ctx, "user_id", claims.UserID)
+			ctx = context.WithValue(ctx, "username", claims.Username)
 			ctx = context.WithValue(ctx, "request_id", claims.RequestID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
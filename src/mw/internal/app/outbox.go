@@ -0,0 +1,316 @@
+package app
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/api"
+	"github.com/ogt11/certm3/mw/internal/logging"
+	"github.com/ogt11/certm3/mw/pkg/metrics"
+)
+
+// certificateCodeVersion identifies the issuing code in the backend's
+// certificate inventory
+const certificateCodeVersion = "certm3-mw-1.0.0"
+
+// Retry schedule for registrations the backend did not accept
+const (
+	outboxInitialBackoff = 30 * time.Second
+	outboxMaxBackoff     = time.Hour
+)
+
+// outboxEntry is a change waiting to be sent to the backend: either a
+// certificate to register or a revocation to record
+type outboxEntry struct {
+	Metadata    *api.CertificateMetadata   `json:"metadata,omitempty"`
+	Revocation  *api.CertificateRevocation `json:"revocation,omitempty"`
+	Attempts    int                        `json:"attempts"`
+	NextAttempt time.Time                  `json:"nextAttempt"`
+	LastError   string                     `json:"lastError,omitempty"`
+}
+
+// CertificateOutbox keeps the backend's certificate inventory in step with
+// the signer. Every issued certificate and every revocation is written to a
+// file before the first delivery attempt and only removed once the backend
+// has it, so changes made while the backend is down or the app server
+// restarts are delivered later rather than lost. Entries that are due are
+// delivered in the order they were queued.
+type CertificateOutbox struct {
+	mu      sync.Mutex
+	path    string
+	entries []outboxEntry
+	client  *api.Client
+	logger  *logging.Logger
+	metrics *metrics.Metrics
+	wake    chan struct{}
+}
+
+// OpenCertificateOutbox loads the outbox at path, creating it if needed
+func OpenCertificateOutbox(path string, client *api.Client, logger *logging.Logger, metrics *metrics.Metrics) (*CertificateOutbox, error) {
+	o := &CertificateOutbox{
+		path:    path,
+		client:  client,
+		logger:  logger,
+		metrics: metrics,
+		wake:    make(chan struct{}, 1),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read certificate outbox: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create certificate outbox directory: %v", err)
+		}
+		return o, o.save()
+	}
+	if err := json.Unmarshal(data, &o.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse certificate outbox: %v", err)
+	}
+	metrics.SetCertificateOutboxPending(len(o.entries))
+	return o, nil
+}
+
+// save writes the outbox atomically; callers must hold mu
+func (o *CertificateOutbox) save() error {
+	data, err := json.MarshalIndent(o.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal certificate outbox: %v", err)
+	}
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write certificate outbox: %v", err)
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return fmt.Errorf("failed to replace certificate outbox: %v", err)
+	}
+	o.metrics.SetCertificateOutboxPending(len(o.entries))
+	return nil
+}
+
+// Enqueue stores metadata for registration and wakes the delivery loop
+func (o *CertificateOutbox) Enqueue(metadata *api.CertificateMetadata) error {
+	return o.enqueue(outboxEntry{Metadata: metadata, NextAttempt: time.Now()})
+}
+
+// EnqueueRevocation stores a revocation for the backend and wakes the
+// delivery loop
+func (o *CertificateOutbox) EnqueueRevocation(revocation *api.CertificateRevocation) error {
+	return o.enqueue(outboxEntry{Revocation: revocation, NextAttempt: time.Now()})
+}
+
+// EnqueueRevocationAt stores a revocation the signer will make at t, to be
+// sent to the backend from then on
+func (o *CertificateOutbox) EnqueueRevocationAt(revocation *api.CertificateRevocation, t time.Time) error {
+	return o.enqueue(outboxEntry{Revocation: revocation, NextAttempt: t})
+}
+
+// enqueue persists entry and wakes the delivery loop
+func (o *CertificateOutbox) enqueue(entry outboxEntry) error {
+	o.mu.Lock()
+	o.entries = append(o.entries, entry)
+	err := o.save()
+	if err != nil {
+		o.entries = o.entries[:len(o.entries)-1]
+	}
+	o.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers queued changes until stop is closed
+func (o *CertificateOutbox) Run(stop <-chan struct{}) {
+	for {
+		next := o.deliverDue()
+
+		var timer <-chan time.Time
+		if !next.IsZero() {
+			timer = time.After(time.Until(next))
+		}
+		select {
+		case <-stop:
+			return
+		case <-o.wake:
+		case <-timer:
+		}
+	}
+}
+
+// deliverDue attempts every entry that is due and returns when the next
+// attempt is due, or the zero time if the outbox is empty
+func (o *CertificateOutbox) deliverDue() time.Time {
+	// Entries are only ever appended while delivery runs, so positions
+	// taken here still name the same entries afterwards
+	o.mu.Lock()
+	var due []int
+	pending := make([]outboxEntry, len(o.entries))
+	copy(pending, o.entries)
+	now := time.Now()
+	for i, entry := range pending {
+		if !entry.NextAttempt.After(now) {
+			due = append(due, i)
+		}
+	}
+	o.mu.Unlock()
+
+	// Talk to the backend without holding the lock so Enqueue never waits
+	// on it
+	results := make(map[int]error, len(due))
+	for _, i := range due {
+		results[i] = o.deliver(pending[i])
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	remaining := o.entries[:0]
+	for i, entry := range o.entries {
+		err, attempted := results[i]
+		switch {
+		case !attempted:
+		case err == nil:
+			o.record(entry, "delivered")
+			continue
+		default:
+			entry.Attempts++
+			entry.LastError = err.Error()
+			entry.NextAttempt = time.Now().Add(outboxBackoff(entry.Attempts))
+			o.record(entry, "retry")
+			o.logger.Errorf("Failed to send %s to the backend (attempt %d, next at %s): %v",
+				entry.describe(), entry.Attempts, entry.NextAttempt.Format(time.RFC3339), err)
+		}
+		remaining = append(remaining, entry)
+	}
+	o.entries = remaining
+	if len(results) > 0 {
+		if err := o.save(); err != nil {
+			o.logger.Errorf("Failed to save certificate outbox: %v", err)
+		}
+	}
+
+	var next time.Time
+	for _, entry := range o.entries {
+		if next.IsZero() || entry.NextAttempt.Before(next) {
+			next = entry.NextAttempt
+		}
+	}
+	return next
+}
+
+// deliver sends one entry to the backend
+func (o *CertificateOutbox) deliver(entry outboxEntry) error {
+	var err error
+	switch {
+	case entry.Metadata != nil:
+		err = o.client.StoreCertificateMetadata(entry.Metadata)
+	case entry.Revocation != nil:
+		err = o.client.RevokeCertificate(entry.Revocation)
+	default:
+		return nil
+	}
+	if errors.Is(err, api.ErrAlreadyExists) || errors.Is(err, api.ErrAlreadyRevoked) {
+		// An earlier attempt got through even if we did not hear back
+		err = nil
+	}
+	if err == nil {
+		o.logger.Infof("Sent %s to the backend", entry.describe())
+	}
+	return err
+}
+
+// record counts a delivery outcome for entry
+func (o *CertificateOutbox) record(entry outboxEntry, status string) {
+	if entry.Revocation != nil {
+		o.metrics.RecordBackendRevocation(status)
+		return
+	}
+	o.metrics.RecordCertificateRegistration(status)
+}
+
+// describe names entry in log messages
+func (e outboxEntry) describe() string {
+	switch {
+	case e.Metadata != nil:
+		return fmt.Sprintf("registration of certificate %s for user %s", e.Metadata.SerialNumber, e.Metadata.Username)
+	case e.Revocation != nil:
+		return fmt.Sprintf("revocation of certificate %s by %s", e.Revocation.SerialNumber, e.Revocation.RevokedBy)
+	}
+	return "empty outbox entry"
+}
+
+// outboxBackoff returns the delay before the next attempt after attempts
+// failures
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxInitialBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+	return backoff
+}
+
+// certificateMetadata describes an issued certificate for the backend's
+// certificate inventory
+func certificateMetadata(certPEM, userID, username string) (*api.CertificateMetadata, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, fmt.Errorf("signer returned a certificate that is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse issued certificate: %v", err)
+	}
+
+	fingerprint := sha256.Sum256(cert.Raw)
+	email := ""
+	if len(cert.EmailAddresses) > 0 {
+		email = cert.EmailAddresses[0]
+	}
+	now := time.Now().UTC()
+	return &api.CertificateMetadata{
+		SerialNumber: serialUUID(cert.SerialNumber.Text(16)),
+		CodeVersion:  certificateCodeVersion,
+		Username:     username,
+		UserID:       userID,
+		CommonName:   cert.Subject.CommonName,
+		Email:        email,
+		Fingerprint:  hex.EncodeToString(fingerprint[:]),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		Status:       "active",
+		CreatedAt:    now,
+		CreatedBy:    username,
+		UpdatedAt:    now,
+		UpdatedBy:    username,
+	}, nil
+}
+
+// serialUUID formats a hexadecimal serial number the way the backend
+// stores it: as a UUID. The signer issues 128-bit serials, which fit
+// exactly; longer serials are returned unchanged.
+func serialUUID(serial string) string {
+	if len(serial) > 32 {
+		return serial
+	}
+	padded := strings.Repeat("0", 32-len(serial)) + serial
+	return padded[0:8] + "-" + padded[8:12] + "-" + padded[12:16] + "-" + padded[16:20] + "-" + padded[20:32]
+}
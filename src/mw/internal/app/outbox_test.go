@@ -0,0 +1,177 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/api"
+)
+
+// inventory is a backend certificate inventory failing the first failures
+// requests and answering later duplicates with a conflict
+type inventory struct {
+	mu       sync.Mutex
+	failures int
+	paths    []string
+	stored   map[string]bool
+}
+
+func (b *inventory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.paths = append(b.paths, r.URL.Path)
+	if b.failures > 0 {
+		b.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Path == "/certificates" {
+		var metadata api.CertificateMetadata
+		json.NewDecoder(r.Body).Decode(&metadata)
+		if b.stored[metadata.SerialNumber] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		b.stored[metadata.SerialNumber] = true
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (b *inventory) requests() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.paths...)
+}
+
+func TestCertificateMetadata(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(0xabc),
+		Subject:        pkix.Name{CommonName: "alice"},
+		NotBefore:      time.Now(),
+		NotAfter:       time.Now().Add(time.Hour),
+		EmailAddresses: []string{"alice@example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := certificateMetadata(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), "1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.SerialNumber != "00000000-0000-0000-0000-000000000abc" {
+		t.Errorf("serial = %s", metadata.SerialNumber)
+	}
+	if metadata.UserID != "1" || metadata.Username != "alice" || metadata.CommonName != "alice" || metadata.Email != "alice@example.com" || metadata.Status != "active" {
+		t.Errorf("metadata = %+v", metadata)
+	}
+	if _, err := certificateMetadata("not PEM", "1", "alice"); err == nil {
+		t.Error("described a certificate that is not PEM")
+	}
+}
+
+func TestSerialUUID(t *testing.T) {
+	tests := map[string]string{
+		"abc":                               "00000000-0000-0000-0000-000000000abc",
+		"0123456789abcdef0123456789abcdef":  "01234567-89ab-cdef-0123-456789abcdef",
+		"10123456789abcdef0123456789abcdef": "10123456789abcdef0123456789abcdef",
+	}
+	for serial, want := range tests {
+		if got := serialUUID(serial); got != want {
+			t.Errorf("serialUUID(%s) = %s, want %s", serial, got, want)
+		}
+	}
+}
+
+func TestOutboxRetriesUntilDelivered(t *testing.T) {
+	backend := &inventory{failures: 1, stored: make(map[string]bool)}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "outbox", "outbox.json")
+	logger := newTestLogger(t)
+
+	outbox, err := OpenCertificateOutbox(path, api.NewClient(server.URL), logger, testMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Enqueue(&api.CertificateMetadata{SerialNumber: "1", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.EnqueueRevocation(&api.CertificateRevocation{SerialNumber: "2", RevokedBy: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The backend fails the registration and the revocation goes through
+	next := outbox.deliverDue()
+	if len(outbox.entries) != 1 || outbox.entries[0].Metadata == nil || outbox.entries[0].Attempts != 1 {
+		t.Fatalf("entries after the first delivery = %+v", outbox.entries)
+	}
+	if wait := time.Until(next); wait < outboxInitialBackoff-time.Second || wait > outboxInitialBackoff {
+		t.Errorf("next attempt in %s, want %s", wait, outboxInitialBackoff)
+	}
+
+	// The failed registration survives a restart
+	reopened, err := OpenCertificateOutbox(path, api.NewClient(server.URL), logger, testMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.entries) != 1 || reopened.entries[0].LastError == "" {
+		t.Fatalf("entries after reopening = %+v", reopened.entries)
+	}
+	if !reopened.deliverDue().Equal(reopened.entries[0].NextAttempt) {
+		t.Error("delivered an entry before it was due")
+	}
+
+	reopened.entries[0].NextAttempt = time.Now()
+	if next := reopened.deliverDue(); !next.IsZero() || len(reopened.entries) != 0 {
+		t.Errorf("entries after the retry = %+v", reopened.entries)
+	}
+
+	// A registration the backend already has counts as delivered
+	if err := reopened.Enqueue(&api.CertificateMetadata{SerialNumber: "1", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if reopened.deliverDue(); len(reopened.entries) != 0 {
+		t.Errorf("a conflict was retried: %+v", reopened.entries)
+	}
+
+	want := []string{"/certificates", "/certificates/2/revoke", "/certificates", "/certificates"}
+	if got := backend.requests(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("backend requests = %v, want %v", got, want)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		8:  time.Hour,
+		50: time.Hour,
+	}
+	for attempts, want := range tests {
+		if got := outboxBackoff(attempts); got != want {
+			t.Errorf("outboxBackoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// authorizeProfile decides whether the user may request the named
+// certificate profile. It returns the resolved profile name, which is the
+// default profile when name is empty.
+func (h *Handler) authorizeProfile(userID, name string) (string, error) {
+	if name == "" {
+		name = h.config.Signer.DefaultProfile
+	}
+
+	// Without configured profiles only the implicit default exists
+	if len(h.config.Signer.Profiles) == 0 {
+		if name != h.config.Signer.DefaultProfile {
+			return "", fmt.Errorf("unknown certificate profile %q", name)
+		}
+		return name, nil
+	}
+
+	profile, ok := h.config.Signer.Profiles[name]
+	if !ok {
+		return "", fmt.Errorf("unknown certificate profile %q", name)
+	}
+	if len(profile.RequesterGroups) == 0 {
+		return name, nil
+	}
+
+	groups, err := h.fetchUserGroupsByID(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up groups for profile check: %v", err)
+	}
+	for _, group := range groups {
+		for _, allowed := range profile.RequesterGroups {
+			if group == allowed {
+				return name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("user is not allowed to request certificate profile %q", name)
+}
+
+// fetchUserGroupsByID retrieves the names of the groups a user belongs to
+// from the backend
+func (h *Handler) fetchUserGroupsByID(userID string) ([]string, error) {
+	start := time.Now()
+	req, err := http.NewRequest("GET", h.config.AppServer.BackendAPIURL+"/users/"+userID+"/groups", nil)
+	if err != nil {
+		h.metrics.RecordBackendRequest("GET", "/users/groups", "error", time.Since(start), err)
+		return nil, err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		h.metrics.RecordBackendRequest("GET", "/users/groups", "error", time.Since(start), err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	h.metrics.RecordBackendRequest("GET", "/users/groups", strconv.Itoa(resp.StatusCode), time.Since(start), nil)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("backend returned status %d", resp.StatusCode)
+	}
+
+	var groups []string
+	if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
+		return nil, fmt.Errorf("failed to decode groups: %v", err)
+	}
+	return groups, nil
+}
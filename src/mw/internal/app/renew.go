@@ -0,0 +1,243 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/api"
+	"github.com/ogt11/certm3/mw/internal/security"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+// RenewCertificate handles the renewal of a certificate by its holder,
+// without repeating the email challenge. The caller proves possession of a
+// still-valid certificate either as the TLS client certificate or by
+// sending the certificate with a signature over the new CSR made with its
+// key. The replacement has the same identity and freshly checked groups;
+// the signer can revoke the old certificate once the renewal overlap has
+// passed.
+func (h *Handler) RenewCertificate(w http.ResponseWriter, r *http.Request) {
+	if h.certAuth == nil {
+		http.Error(w, "Certificate renewal is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var req struct {
+		CSR       string   `json:"csr"`
+		Groups    []string `json:"groups"`    // empty requests the old certificate's groups
+		Profile   string   `json:"profile"`   // empty keeps the old certificate's profile
+		RevokeOld bool     `json:"revokeOld"` // revoke the old certificate after the overlap
+
+		// Proof of possession without a TLS client certificate: the PEM
+		// certificate being renewed and a base64 signature over the DER
+		// CSR made with its key (SHA-256 for RSA and ECDSA keys)
+		Certificate string `json:"certificate"`
+		Signature   string `json:"signature"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid request format: request must be JSON with a csr field", http.StatusBadRequest)
+		return
+	}
+	csrBlock, _ := pem.Decode([]byte(req.CSR))
+	if csrBlock == nil {
+		http.Error(w, "CSR is required", http.StatusBadRequest)
+		return
+	}
+
+	old, err := h.renewalCertificate(r, req.Certificate, req.Signature, csrBlock.Bytes)
+	if err != nil {
+		h.logger.LogSecurityEvent("renewal_proof_failed", map[string]interface{}{
+			"path":       r.URL.Path,
+			"remote_ip":  r.RemoteAddr,
+			"user_agent": r.UserAgent(),
+			"error":      err.Error(),
+		})
+		h.metrics.RecordSecurityEvent("renewal_proof_failed")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	username := old.Subject.CommonName
+	oldSerial := old.SerialNumber.Text(16)
+
+	// The user must still exist; this also gives the ID the signer records
+	userID, err := h.lookupUserID(username)
+	if errors.Is(err, errUnknownUser) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		h.logger.Errorf("Failed to look up user %s for renewal: %v", username, err)
+		http.Error(w, "Failed to look up user", http.StatusServiceUnavailable)
+		return
+	}
+	requestID := newRequestID("renew")
+
+	// Keeping the old certificate's profile still needs the user to be
+	// allowed it now
+	profile, err := h.renewalProfile(r.Context(), oldSerial, req.Profile)
+	if err != nil {
+		h.logger.Errorf("Failed to look up the profile of certificate %s for renewal: %v", oldSerial, err)
+		http.Error(w, "Failed to look up certificate", http.StatusServiceUnavailable)
+		return
+	}
+	if profile, err = h.authorizeProfile(userID, profile); err != nil {
+		h.logger.LogSecurityEvent("profile_denied", map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"request_id": requestID,
+			"profile":    req.Profile,
+			"error":      err.Error(),
+		})
+		h.metrics.RecordSecurityEvent("profile_denied")
+		http.Error(w, "Certificate profile not allowed", http.StatusForbidden)
+		return
+	}
+
+	if err := h.checkCSREmails(r.Context(), userID, req.CSR); err != nil {
+		h.logger.LogSecurityEvent("email_denied", map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"request_id": requestID,
+			"error":      err.Error(),
+		})
+		h.metrics.RecordSecurityEvent("email_denied")
+		http.Error(w, "Email address not allowed", http.StatusForbidden)
+		return
+	}
+
+	h.metrics.RecordCertificateRequest("renewal")
+	ticket, err := h.tickets.IssueTicket(userID, username, requestID, security.TicketActionRenew,
+		security.IssuancePayload(security.RenewalPayload(req.CSR, oldSerial), profile, req.Groups))
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"request_id": requestID,
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(r.Context(), signerRequestTimeout)
+	defer cancel()
+	result, err := h.signer.Sign(ctx, &signerproto.SignRequest{
+		UserID:        userID,
+		Username:      username,
+		RequestID:     requestID,
+		CSR:           req.CSR,
+		Groups:        req.Groups,
+		Token:         ticket,
+		Profile:       profile,
+		Renews:        oldSerial,
+		RevokeRenewed: req.RevokeOld,
+	})
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"request_id": requestID,
+			"renews":     oldSerial,
+		})
+		h.metrics.RecordSignerRequest("error", time.Since(start), err)
+		writeSignerError(w, err, "Failed to renew certificate")
+		return
+	}
+	h.metrics.RecordSignerRequest("success", time.Since(start), nil)
+
+	h.registerCertificate(result.Certificate, userID, username)
+	if result.RenewedRevokeAt != nil && h.outbox != nil {
+		revocation := &api.CertificateRevocation{
+			SerialNumber:     serialUUID(oldSerial),
+			RevokedBy:        username,
+			RevocationReason: "superseded",
+		}
+		if err := h.outbox.EnqueueRevocationAt(revocation, *result.RenewedRevokeAt); err != nil {
+			h.logger.Errorf("Failed to queue backend revocation of renewed certificate %s: %v", oldSerial, err)
+			h.metrics.RecordBackendRevocation("lost")
+		}
+	}
+
+	response := map[string]interface{}{
+		"certificate":   result.Certificate,
+		"caCertificate": result.CACertificate,
+		"renews":        oldSerial,
+	}
+	if result.RenewedRevokeAt != nil {
+		response["oldRevokedAt"] = result.RenewedRevokeAt
+	}
+	if result.AttributeCertificate != "" {
+		response["attributeCertificate"] = result.AttributeCertificate
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// renewalProfile returns the profile the renewal of the certificate with
+// serial is issued with: the one requested, or else the certificate's own
+func (h *Handler) renewalProfile(ctx context.Context, serial, requested string) (string, error) {
+	if requested != "" {
+		return requested, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, signerRequestTimeout)
+	defer cancel()
+	status, err := h.signer.Status(ctx, &signerproto.StatusRequest{Serial: serial})
+	if err != nil {
+		return "", err
+	}
+	return status.Profile, nil
+}
+
+// renewalCertificate returns the verified certificate a renewal request is
+// authenticated by: the TLS client certificate, or the certificate in the
+// request together with a signature over the CSR made with its key
+func (h *Handler) renewalCertificate(r *http.Request, certPEM, signature string, csrDER []byte) (*x509.Certificate, error) {
+	if h.certAuth.Present(r) {
+		return h.certAuth.Certificate(r)
+	}
+	if certPEM == "" || signature == "" {
+		return nil, fmt.Errorf("no client certificate or signed renewal request")
+	}
+	cert, err := h.certAuth.Parse(r.Context(), certPEM)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %v", err)
+	}
+
+	var algorithm x509.SignatureAlgorithm
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		algorithm = x509.SHA256WithRSA
+	case *ecdsa.PublicKey:
+		algorithm = x509.ECDSAWithSHA256
+	case ed25519.PublicKey:
+		algorithm = x509.PureEd25519
+	default:
+		return nil, fmt.Errorf("unsupported certificate key type %T", cert.PublicKey)
+	}
+	if err := cert.CheckSignature(algorithm, csrDER, sig); err != nil {
+		return nil, fmt.Errorf("renewal signature does not match certificate: %v", err)
+	}
+	return cert, nil
+}
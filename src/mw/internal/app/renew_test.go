@@ -0,0 +1,172 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/api"
+	"github.com/ogt11/certm3/mw/internal/config"
+	"github.com/ogt11/certm3/mw/internal/signer"
+)
+
+// renewalResponse is the app's answer to a renewal
+type renewalResponse struct {
+	Certificate  string     `json:"certificate"`
+	Renews       string     `json:"renews"`
+	OldRevokedAt *time.Time `json:"oldRevokedAt"`
+}
+
+// renew posts a renewal request and decodes a successful response
+func (env *testEnv) renew(t *testing.T, request map[string]interface{}, header map[string]string) (int, *renewalResponse) {
+	t.Helper()
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, data := env.post(t, "/app/renew", string(body), header)
+	if code != http.StatusOK {
+		t.Logf("renewal: %d %s", code, data)
+		return code, nil
+	}
+	var resp renewalResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return code, &resp
+}
+
+// signCSR returns the base64 signature over a PEM CSR that proves
+// possession of key in a renewal request
+func signCSR(t *testing.T, csr string, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	block, _ := pem.Decode([]byte(csr))
+	digest := sha256.Sum256(block.Bytes)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func TestRenewWithClientCertificate(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Signer.RenewalOverlap = 0
+	})
+	serial, certPEM, _ := env.issue(t, "alice")
+
+	csr, _ := csrPEM(t, "alice")
+	code, resp := env.renew(t, map[string]interface{}{"csr": csr, "revokeOld": true}, clientCert(certPEM))
+	if code != http.StatusOK {
+		t.Fatalf("renewal: %d", code)
+	}
+	renewed := parseCertPEM(t, resp.Certificate)
+	if resp.Renews != serial || renewed.SerialNumber.Text(16) == serial || renewed.Subject.CommonName != "alice" {
+		t.Errorf("renewal of %s issued %s to %q, renewing %s", serial, renewed.SerialNumber.Text(16), renewed.Subject.CommonName, resp.Renews)
+	}
+	if resp.OldRevokedAt == nil {
+		t.Fatal("revokeOld was set but the response has no oldRevokedAt")
+	}
+
+	// Without an overlap the old certificate is due for revocation at once
+	env.signer.RevokeSuperseded()
+	if reason, ok := env.revokedSerials(t)[serial]; !ok || reason != signer.ReasonSuperseded {
+		t.Errorf("CRL entry for %s: listed %v, reason %d", serial, ok, reason)
+	}
+	env.outbox.deliverDue()
+	want := []api.CertificateRevocation{{SerialNumber: serialUUID(serial), RevokedBy: "alice", RevocationReason: "superseded"}}
+	if got := env.backend.revoked(); !reflect.DeepEqual(got, want) {
+		t.Errorf("backend revocations = %+v, want %+v", got, want)
+	}
+
+	if code, _ := env.renew(t, map[string]interface{}{"csr": csr}, clientCert(certPEM)); code != http.StatusUnauthorized {
+		t.Errorf("renewing a revoked certificate: %d", code)
+	}
+	mallory, _ := csrPEM(t, "mallory")
+	if code, _ := env.renew(t, map[string]interface{}{"csr": mallory}, clientCert(resp.Certificate)); code != http.StatusForbidden {
+		t.Errorf("renewing to another identity: %d", code)
+	}
+	if code, _ := env.renew(t, map[string]interface{}{"csr": csr}, nil); code != http.StatusUnauthorized {
+		t.Errorf("renewing without a certificate: %d", code)
+	}
+}
+
+func TestRenewWithSignedRequest(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Signer.RenewalOverlap = 24 * time.Hour
+	})
+	serial, certPEM, key := env.issue(t, "erin")
+
+	csr, _ := csrPEM(t, "erin")
+	request := map[string]interface{}{
+		"csr":         csr,
+		"revokeOld":   true,
+		"certificate": certPEM,
+		"signature":   signCSR(t, csr, key),
+	}
+	code, resp := env.renew(t, request, nil)
+	if code != http.StatusOK {
+		t.Fatalf("renewal: %d", code)
+	}
+	if resp.Renews != serial {
+		t.Errorf("renews = %s, want %s", resp.Renews, serial)
+	}
+	if resp.OldRevokedAt == nil || time.Until(*resp.OldRevokedAt) < 23*time.Hour {
+		t.Errorf("oldRevokedAt = %v, want after the 24h overlap", resp.OldRevokedAt)
+	}
+	env.signer.RevokeSuperseded()
+	if _, ok := env.revokedSerials(t)[serial]; ok {
+		t.Error("the renewed certificate was revoked before the overlap passed")
+	}
+
+	// The signature must be over this CSR, made with the certificate's key
+	other, otherKey := csrPEM(t, "erin")
+	request["csr"] = other
+	if code, _ := env.renew(t, request, nil); code != http.StatusUnauthorized {
+		t.Errorf("signature over another CSR: %d", code)
+	}
+	request["signature"] = signCSR(t, other, otherKey)
+	if code, _ := env.renew(t, request, nil); code != http.StatusUnauthorized {
+		t.Errorf("signature with another key: %d", code)
+	}
+	request["certificate"] = "garbage"
+	if code, _ := env.renew(t, request, nil); code != http.StatusUnauthorized {
+		t.Errorf("unparseable certificate: %d", code)
+	}
+}
+
+func TestRenewRechecksProfile(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Signer.Profiles = map[string]config.ProfileConfig{
+			"default":    {},
+			"restricted": {RequesterGroups: []string{"admins"}},
+		}
+	})
+	env.backend.setGroups("alice", "users", "admins")
+	code, resp := env.submitCSR(t, "req-restricted", map[string]interface{}{"profile": "restricted"})
+	if code != http.StatusOK {
+		t.Fatalf("restricted profile: %d", code)
+	}
+	certPEM := resp["certificate"].(string)
+
+	csr, _ := csrPEM(t, "alice")
+	if code, _ := env.renew(t, map[string]interface{}{"csr": csr}, clientCert(certPEM)); code != http.StatusOK {
+		t.Errorf("renewal by an admin: %d", code)
+	}
+
+	// Keeping the profile needs the user to still be allowed it
+	env.backend.setGroups("alice", "users")
+	if code, _ := env.renew(t, map[string]interface{}{"csr": csr}, clientCert(certPEM)); code != http.StatusForbidden {
+		t.Errorf("renewal keeping a profile the user lost: %d, want 403", code)
+	}
+	if code, _ := env.renew(t, map[string]interface{}{"csr": csr, "profile": "default"}, clientCert(certPEM)); code != http.StatusOK {
+		t.Errorf("renewal into an allowed profile: %d", code)
+	}
+}
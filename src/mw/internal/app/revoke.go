@@ -0,0 +1,286 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ogt11/certm3/mw/internal/api"
+	"github.com/ogt11/certm3/mw/internal/security"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+// revocationReason is an RFC 5280 reason given either by name or by code
+type revocationReason string
+
+// UnmarshalJSON accepts a reason name ("keyCompromise") or code (1)
+func (r *revocationReason) UnmarshalJSON(data []byte) error {
+	var code int
+	if err := json.Unmarshal(data, &code); err == nil {
+		*r = revocationReason(strconv.Itoa(code))
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("reason must be an RFC 5280 reason name or code")
+	}
+	*r = revocationReason(name)
+	return nil
+}
+
+// RevokeCertificate handles a user's request to revoke one of their own
+// certificates, for example after losing the device holding its key
+func (h *Handler) RevokeCertificate(w http.ResponseWriter, r *http.Request) {
+	h.revokeCertificate(w, r, false)
+}
+
+// AdminRevokeCertificate handles an administrator's request to revoke any
+// certificate
+func (h *Handler) AdminRevokeCertificate(w http.ResponseWriter, r *http.Request) {
+	h.revokeCertificate(w, r, true)
+}
+
+// revokeCertificate revokes the certificate named in the URL. The signer
+// checks ownership against its issuance ledger unless admin is set, in
+// which case the caller must be in one of the configured admin groups.
+func (h *Handler) revokeCertificate(w http.ResponseWriter, r *http.Request, admin bool) {
+	kind := "owner"
+	if admin {
+		kind = "admin"
+	}
+
+	// The auth middleware establishes the user, from a JWT or a client
+	// certificate; only JWTs carry a user and request ID
+	username, _ := r.Context().Value("username").(string)
+	userID, _ := r.Context().Value("user_id").(string)
+	requestID, _ := r.Context().Value("request_id").(string)
+	if username == "" {
+		h.metrics.RecordRevocationRequest(kind, "unauthenticated")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if requestID == "" {
+		requestID = newRequestID("revoke")
+	}
+
+	serial, ok := parseSerial(mux.Vars(r)["serial"])
+	if !ok {
+		h.metrics.RecordRevocationRequest(kind, "bad_request")
+		http.Error(w, "Invalid serial number", http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional; without it the reason is unspecified
+	var req struct {
+		Reason revocationReason `json:"reason"`
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			h.metrics.RecordRevocationRequest(kind, "bad_request")
+			http.Error(w, "Invalid request format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	action := security.TicketActionRevoke
+	if admin {
+		isAdmin, err := h.isAdmin(userID, username)
+		if err != nil {
+			h.logger.Errorf("Failed to look up groups of %s for admin revocation: %v", username, err)
+			h.metrics.RecordRevocationRequest(kind, "error")
+			http.Error(w, "Failed to look up user groups", http.StatusServiceUnavailable)
+			return
+		}
+		if !isAdmin {
+			h.logger.LogSecurityEvent("admin_revoke_denied", map[string]interface{}{
+				"path":       r.URL.Path,
+				"remote_ip":  r.RemoteAddr,
+				"user_agent": r.UserAgent(),
+				"user_id":    userID,
+				"username":   username,
+				"serial":     serial,
+			})
+			h.metrics.RecordSecurityEvent("admin_revoke_denied")
+			h.metrics.RecordRevocationRequest(kind, "denied")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		action = security.TicketActionAdminRevoke
+	}
+
+	// The ticket binds the revocation to this user and exactly this serial
+	ticket, err := h.tickets.IssueTicket(userID, username, requestID, action, []byte(serial))
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"request_id": requestID,
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(r.Context(), signerRequestTimeout)
+	defer cancel()
+	result, err := h.signer.Revoke(ctx, &signerproto.RevokeRequest{
+		RequestID: requestID,
+		Serial:    serial,
+		Reason:    string(req.Reason),
+		Token:     ticket,
+		UserID:    userID,
+		Username:  username,
+		Admin:     admin,
+	})
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":       r.URL.Path,
+			"remote_ip":  r.RemoteAddr,
+			"user_agent": r.UserAgent(),
+			"user_id":    userID,
+			"username":   username,
+			"serial":     serial,
+		})
+		h.metrics.RecordSignerRequest("error", time.Since(start), err)
+		h.metrics.RecordRevocationRequest(kind, "error")
+		writeSignerError(w, err, "Failed to revoke certificate")
+		return
+	}
+	h.metrics.RecordSignerRequest("success", time.Since(start), nil)
+	h.metrics.RecordRevocationRequest(kind, "revoked")
+
+	h.logger.LogSecurityEvent("certificate_revoked", map[string]interface{}{
+		"serial":     result.Serial,
+		"reason":     result.Reason,
+		"user_id":    userID,
+		"username":   username,
+		"request_id": requestID,
+		"admin":      admin,
+	})
+
+	// Record the revocation in the backend's inventory
+	h.recordRevocation(result, username)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"serial": result.Serial,
+		"reason": result.Reason,
+		"status": "revoked",
+	})
+}
+
+// recordRevocation queues a revocation for the backend. The signer has
+// already revoked the certificate, so failures here are logged for
+// operators to act on.
+func (h *Handler) recordRevocation(result *signerproto.RevokeResult, revokedBy string) {
+	if h.outbox == nil {
+		return
+	}
+	revocation := &api.CertificateRevocation{
+		SerialNumber:     serialUUID(result.Serial),
+		RevokedBy:        revokedBy,
+		RevocationReason: result.Reason,
+	}
+	if err := h.outbox.EnqueueRevocation(revocation); err != nil {
+		h.logger.LogSecurityEvent("certificate_revocation_unrecorded", map[string]interface{}{
+			"serial":     revocation.SerialNumber,
+			"revoked_by": revokedBy,
+			"error":      err.Error(),
+		})
+		h.metrics.RecordBackendRevocation("lost")
+	}
+}
+
+// isAdmin reports whether the user is in one of the configured admin
+// groups
+func (h *Handler) isAdmin(userID, username string) (bool, error) {
+	if len(h.config.AppServer.AdminGroups) == 0 {
+		return false, nil
+	}
+	if userID == "" {
+		var err error
+		if userID, err = h.lookupUserID(username); err != nil {
+			return false, err
+		}
+	}
+	groups, err := h.fetchUserGroupsByID(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, group := range groups {
+		for _, adminGroup := range h.config.AppServer.AdminGroups {
+			if group == adminGroup {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// errUnknownUser is returned when the backend has no such user
+var errUnknownUser = errors.New("unknown user")
+
+// lookupUserID returns the backend ID of the named user
+func (h *Handler) lookupUserID(username string) (string, error) {
+	start := time.Now()
+	resp, err := h.client.Get(h.config.AppServer.BackendAPIURL + "/users/username/" + username)
+	if err != nil {
+		h.metrics.RecordBackendRequest("GET", "/users/username", "error", time.Since(start), err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	h.metrics.RecordBackendRequest("GET", "/users/username", strconv.Itoa(resp.StatusCode), time.Since(start), nil)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%s: %w", username, errUnknownUser)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("backend returned status %d", resp.StatusCode)
+	}
+	var user struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return "", fmt.Errorf("failed to decode user: %v", err)
+	}
+	if user.ID == "" {
+		return "", fmt.Errorf("user %s has no ID", username)
+	}
+	return user.ID, nil
+}
+
+// parseSerial normalizes a serial number given as hex, optionally with
+// colons, or in the UUID form the backend stores, to the signer's
+// lowercase hex form
+func parseSerial(s string) (string, bool) {
+	s = strings.NewReplacer(":", "", "-", "").Replace(s)
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok || n.Sign() <= 0 {
+		return "", false
+	}
+	return n.Text(16), true
+}
+
+// newRequestID returns a request ID for an operation that is not part of
+// an email-validated request, such as a revocation or renewal
+func newRequestID(kind string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return kind + "-" + hex.EncodeToString(b)
+}
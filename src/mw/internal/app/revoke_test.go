@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/ogt11/certm3/mw/internal/api"
+	"github.com/ogt11/certm3/mw/internal/signer"
+)
+
+func TestRevokeOwnCertificate(t *testing.T) {
+	env := newTestEnv(t, nil)
+	aliceSerial, aliceCert, _ := env.issue(t, "alice")
+	path := "/app/certificates/" + aliceSerial + "/revoke"
+
+	if code, body := env.post(t, path, `{"reason":"keyCompromise"}`, env.bearer(t, "bob")); code != http.StatusNotFound {
+		t.Errorf("bob revoking alice's certificate: %d %s", code, body)
+	}
+	if code, body := env.post(t, path, `{"reason":"lost"}`, env.bearer(t, "alice")); code != http.StatusBadRequest {
+		t.Errorf("unknown reason: %d %s", code, body)
+	}
+	if code, _ := env.post(t, path, "", map[string]string{testClientCertHeader: "garbage"}); code != http.StatusUnauthorized {
+		t.Errorf("unparseable client certificate: %d", code)
+	}
+	if code, _ := env.post(t, path, "", nil); code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated: %d", code)
+	}
+
+	// Authenticated by the certificate itself, with the serial in the
+	// backend's UUID form and the reason by code
+	code, body := env.post(t, "/app/certificates/"+serialUUID(aliceSerial)+"/revoke", `{"reason":1}`, clientCert(aliceCert))
+	if code != http.StatusOK {
+		t.Fatalf("alice revoking her certificate: %d %s", code, body)
+	}
+	var result struct{ Serial, Reason, Status string }
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Serial != aliceSerial || result.Reason != "keyCompromise" || result.Status != "revoked" {
+		t.Errorf("response = %+v", result)
+	}
+	if reason, ok := env.revokedSerials(t)[aliceSerial]; !ok || reason != signer.ReasonKeyCompromise {
+		t.Errorf("CRL entry for %s: listed %v, reason %d", aliceSerial, ok, reason)
+	}
+
+	env.outbox.deliverDue()
+	want := []api.CertificateRevocation{{SerialNumber: serialUUID(aliceSerial), RevokedBy: "alice", RevocationReason: "keyCompromise"}}
+	if got := env.backend.revoked(); !reflect.DeepEqual(got, want) {
+		t.Errorf("backend revocations = %+v, want %+v", got, want)
+	}
+}
+
+func TestAdminRevokeCertificate(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.backend.setGroups("carol", "admin")
+	bobSerial, _, _ := env.issue(t, "bob")
+	path := "/app/admin/certificates/" + bobSerial + "/revoke"
+
+	if code, body := env.post(t, path, "", env.bearer(t, "dave")); code != http.StatusForbidden {
+		t.Errorf("non-admin: %d %s", code, body)
+	}
+	if _, ok := env.revokedSerials(t)[bobSerial]; ok {
+		t.Fatal("a non-admin revoked another user's certificate")
+	}
+
+	if code, body := env.post(t, path, `{"reason":"affiliationChanged"}`, env.bearer(t, "carol")); code != http.StatusOK {
+		t.Fatalf("admin: %d %s", code, body)
+	}
+	if reason, ok := env.revokedSerials(t)[bobSerial]; !ok || reason != signer.ReasonAffiliationChanged {
+		t.Errorf("CRL entry for %s: listed %v, reason %d", bobSerial, ok, reason)
+	}
+
+	env.outbox.deliverDue()
+	want := []api.CertificateRevocation{{SerialNumber: serialUUID(bobSerial), RevokedBy: "carol", RevocationReason: "affiliationChanged"}}
+	if got := env.backend.revoked(); !reflect.DeepEqual(got, want) {
+		t.Errorf("backend revocations = %+v, want %+v", got, want)
+	}
+}
+
+func TestRevokedClientCertificateRejected(t *testing.T) {
+	env := newTestEnv(t, nil)
+	serial, certPEM, _ := env.issue(t, "alice")
+	path := "/app/certificates/" + serial + "/revoke"
+
+	if _, err := env.handler.certAuth.Parse(context.Background(), certPEM); err != nil {
+		t.Fatalf("good certificate: %v", err)
+	}
+	if _, err := env.signer.Revoke(parseCertPEM(t, certPEM).SerialNumber, signer.ReasonKeyCompromise); err != nil {
+		t.Fatal(err)
+	}
+
+	// The chain still verifies; the signer's records say it is revoked
+	if _, err := env.handler.certAuth.Parse(context.Background(), certPEM); err == nil {
+		t.Error("revoked certificate accepted")
+	}
+	if code, _ := env.post(t, path, `{"reason":1}`, clientCert(certPEM)); code != http.StatusUnauthorized {
+		t.Errorf("authenticating with a revoked certificate: %d", code)
+	}
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+	"google.golang.org/grpc/credentials"
+)
+
+// SignerClient is how the app server talks to the signer. Both the socket
+// protocol client and the gRPC client implement it.
+type SignerClient interface {
+	Sign(ctx context.Context, req *signerproto.SignRequest) (*signerproto.SignResult, error)
+	Revoke(ctx context.Context, req *signerproto.RevokeRequest) (*signerproto.RevokeResult, error)
+	SignSSH(ctx context.Context, req *signerproto.SignSSHRequest) (*signerproto.SignSSHResult, error)
+	SignAttributeCert(ctx context.Context, req *signerproto.SignAttributeCertRequest) (*signerproto.SignAttributeCertResult, error)
+	Status(ctx context.Context, req *signerproto.StatusRequest) (*signerproto.StatusResult, error)
+	Close() error
+}
+
+// NewSignerClient returns a signer client for the configured transport
+func NewSignerClient(cfg *config.Config) (SignerClient, error) {
+	switch cfg.AppServer.SignerTransport {
+	case "", "socket":
+		return signerproto.NewClient("unix", cfg.Signer.SocketPath, signerDialTimeout), nil
+	case "grpc":
+		var creds credentials.TransportCredentials
+		if cfg.AppServer.SignerGRPCCertPath != "" || cfg.AppServer.SignerGRPCCAPath != "" {
+			tlsConfig, err := signerTLSConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			creds = credentials.NewTLS(tlsConfig)
+		}
+		return signerproto.DialGRPC(cfg.AppServer.SignerGRPCAddr, creds)
+	default:
+		return nil, fmt.Errorf("unknown signer transport %q", cfg.AppServer.SignerTransport)
+	}
+}
+
+// signerTLSConfig returns the mTLS client configuration for a TCP gRPC
+// connection to the signer
+func signerTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.AppServer.SignerGRPCCertPath != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.AppServer.SignerGRPCCertPath, cfg.AppServer.SignerGRPCKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signer client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.AppServer.SignerGRPCCAPath != "" {
+		caPEM, err := os.ReadFile(cfg.AppServer.SignerGRPCCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signer CA: %v", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in signer CA file %s", cfg.AppServer.SignerGRPCCAPath)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	return tlsConfig, nil
+}
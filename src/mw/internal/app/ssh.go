@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/security"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+	"golang.org/x/crypto/ssh"
+)
+
+// SignSSHKey issues the authenticated user an OpenSSH user certificate for
+// their public key. The principals are the user's groups as the signer
+// authorizes them for the profile; without requested groups all of the
+// user's groups are asked for.
+func (h *Handler) SignSSHKey(w http.ResponseWriter, r *http.Request) {
+	username, _ := r.Context().Value("username").(string)
+	userID, _ := r.Context().Value("user_id").(string)
+	requestID, _ := r.Context().Value("request_id").(string)
+	if username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if userID == "" {
+		var err error
+		if userID, err = h.lookupUserID(username); err != nil {
+			h.logger.Errorf("Failed to look up user %s for an SSH certificate: %v", username, err)
+			http.Error(w, "Failed to look up user", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	if requestID == "" {
+		requestID = newRequestID("ssh")
+	}
+
+	var req struct {
+		PublicKey string   `json:"publicKey"`
+		Groups    []string `json:"groups"`
+		Profile   string   `json:"profile"`
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 16*1024))
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid request format: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.PublicKey = strings.TrimSpace(req.PublicKey)
+	if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey)); err != nil {
+		http.Error(w, "publicKey must be an OpenSSH public key", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := h.authorizeProfile(userID, req.Profile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	groups := req.Groups
+	if len(groups) == 0 {
+		if groups, err = h.fetchUserGroupsByID(userID); err != nil {
+			h.logger.Errorf("Failed to look up groups of %s for an SSH certificate: %v", username, err)
+			http.Error(w, "Failed to look up user groups", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	h.metrics.RecordCertificateRequest("ssh")
+	ticket, err := h.tickets.IssueTicket(userID, username, requestID, security.TicketActionSignSSH, security.IssuancePayload([]byte(req.PublicKey), profile, groups))
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"request_id": requestID,
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(r.Context(), signerRequestTimeout)
+	defer cancel()
+	result, err := h.signer.SignSSH(ctx, &signerproto.SignSSHRequest{
+		RequestID: requestID,
+		PublicKey: req.PublicKey,
+		Groups:    groups,
+		Token:     ticket,
+		Profile:   profile,
+		UserID:    userID,
+		Username:  username,
+	})
+	if err != nil {
+		h.logger.LogError(err, map[string]interface{}{
+			"path":       r.URL.Path,
+			"user_id":    userID,
+			"request_id": requestID,
+		})
+		h.metrics.RecordSignerRequest("error", time.Since(start), err)
+		writeSignerError(w, err, "Failed to sign SSH key")
+		return
+	}
+	h.metrics.RecordSignerRequest("success", time.Since(start), nil)
+
+	h.logger.LogSecurityEvent("ssh_certificate_issued", map[string]interface{}{
+		"user_id":    userID,
+		"username":   username,
+		"request_id": requestID,
+		"serial":     result.Serial,
+		"principals": result.Principals,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"certificate": result.Certificate,
+		"caPublicKey": result.CAPublicKey,
+		"serial":      result.Serial,
+		"principals":  result.Principals,
+		"validBefore": result.ValidBefore,
+	})
+}
@@ -0,0 +1,227 @@
+package app
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+	"golang.org/x/crypto/ssh"
+)
+
+// newSSHEnv returns a test environment whose signer has an SSH CA
+func newSSHEnv(t *testing.T) *testEnv {
+	t.Helper()
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(caKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestEnv(t, func(cfg *config.Config) {
+		cfg.Signer.SSHCAKeyPath = filepath.Join(filepath.Dir(cfg.Signer.CACertPath), "ssh_ca")
+		writeTestFile(t, cfg.Signer.SSHCAKeyPath, pem.EncodeToMemory(block))
+		cfg.Signer.SSHCertValidity = time.Hour
+		cfg.Signer.SSHExtensions = []string{"permit-pty"}
+		cfg.Signer.SSHCriticalOptions = map[string]string{"source-address": "10.0.0.0/8"}
+		cfg.Signer.SSHCAKeyURL = "http://ca.example.com/ssh/ca.pub"
+		cfg.Signer.SSHKRLURL = "http://ca.example.com/ssh/krl"
+	})
+}
+
+// sshResponse is the app's answer to an SSH certificate request
+type sshResponse struct {
+	Certificate string   `json:"certificate"`
+	CAPublicKey string   `json:"caPublicKey"`
+	Serial      string   `json:"serial"`
+	Principals  []string `json:"principals"`
+}
+
+// krlSerials returns the certificate serials an OpenSSH KRL revokes, by
+// the CA key that issued them
+func krlSerials(t *testing.T, krl []byte) map[string][]uint64 {
+	t.Helper()
+	r := bytes.NewReader(krl)
+	var header struct {
+		Magic                       uint64
+		Version                     uint32
+		KRLVersion, Generated, Flag uint64
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil || header.Magic != 0x5353484b524c0a00 || header.Version != 1 {
+		t.Fatalf("invalid KRL header %+v: %v", header, err)
+	}
+	readString := func(r *bytes.Reader) []byte {
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil || int(n) > r.Len() {
+			t.Fatalf("truncated KRL: %v", err)
+		}
+		b := make([]byte, n)
+		r.Read(b)
+		return b
+	}
+	readString(r) // reserved
+	readString(r) // comment
+
+	serials := make(map[string][]uint64)
+	for r.Len() > 0 {
+		sectionType, _ := r.ReadByte()
+		section := bytes.NewReader(readString(r))
+		if sectionType != 1 {
+			t.Fatalf("unexpected KRL section %d", sectionType)
+		}
+		caKey := string(readString(section))
+		readString(section) // reserved
+		for section.Len() > 0 {
+			subsectionType, _ := section.ReadByte()
+			data := readString(section)
+			if subsectionType != 0x20 || len(data)%8 != 0 {
+				t.Fatalf("unexpected KRL certificate subsection %d", subsectionType)
+			}
+			for i := 0; i < len(data); i += 8 {
+				serials[caKey] = append(serials[caKey], binary.BigEndian.Uint64(data[i:]))
+			}
+		}
+	}
+	return serials
+}
+
+func TestSSHCertificate(t *testing.T) {
+	env := newSSHEnv(t)
+	env.backend.setGroups("alice", "users", "eng-core", "ops")
+	signerMux := http.NewServeMux()
+	if err := env.signer.RegisterSSHRoutes(signerMux); err != nil {
+		t.Fatal(err)
+	}
+	signerServer := httptest.NewServer(signerMux)
+	defer signerServer.Close()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := json.Marshal(map[string]interface{}{
+		"publicKey": string(ssh.MarshalAuthorizedKey(userKey)),
+		"groups":    []string{"eng-core", "admins"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, body := env.post(t, "/app/ssh/certificate", string(request), env.bearer(t, "alice"))
+	if code != http.StatusOK {
+		t.Fatalf("requesting an SSH certificate: %d %s", code, body)
+	}
+	var resp sshResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(resp.Certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, ok := parsed.(*ssh.Certificate)
+	if !ok {
+		t.Fatalf("got a %T, want a certificate", parsed)
+	}
+	caKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(resp.CAPublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := ssh.CertChecker{IsUserAuthority: func(auth ssh.PublicKey) bool {
+		return bytes.Equal(auth.Marshal(), caKey.Marshal())
+	}}
+	// The principals are the requested groups the user is in, besides
+	// the mandatory groups of the default policy
+	if err := checker.CheckCert("eng-core", cert); err != nil {
+		t.Errorf("certificate for eng-core: %v", err)
+	}
+	for _, principal := range []string{"admins", "ops"} {
+		if err := checker.CheckCert(principal, cert); err == nil {
+			t.Errorf("certificate valid for %s", principal)
+		}
+	}
+	if want := []string{"alice", "eng-core", "users"}; !reflect.DeepEqual(resp.Principals, want) {
+		t.Errorf("principals = %v, want %v", resp.Principals, want)
+	}
+	if !bytes.Equal(cert.Key.Marshal(), userKey.Marshal()) || cert.CertType != ssh.UserCert {
+		t.Error("certificate does not certify the user's key as a user key")
+	}
+	if got := time.Duration(cert.ValidBefore-cert.ValidAfter) * time.Second; got != time.Hour {
+		t.Errorf("validity = %s, want 1h", got)
+	}
+	wantPermissions := ssh.Permissions{
+		CriticalOptions: map[string]string{"source-address": "10.0.0.0/8"},
+		Extensions:      map[string]string{"permit-pty": ""},
+	}
+	if !reflect.DeepEqual(cert.Permissions, wantPermissions) {
+		t.Errorf("permissions = %+v, want %+v", cert.Permissions, wantPermissions)
+	}
+	if serial := strconv.FormatUint(cert.Serial, 16); serial != resp.Serial {
+		t.Errorf("serial = %s, response says %s", serial, resp.Serial)
+	}
+
+	getSigner := func(path string) []byte {
+		resp, err := http.Get(signerServer.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", path, resp.StatusCode, buf.Bytes())
+		}
+		return buf.Bytes()
+	}
+	if got := getSigner("/ssh/ca.pub"); strings.TrimSpace(string(got)) != strings.TrimSpace(resp.CAPublicKey) {
+		t.Errorf("served CA key %q, want %q", got, resp.CAPublicKey)
+	}
+	if serials := krlSerials(t, getSigner("/ssh/krl")); len(serials) != 0 {
+		t.Errorf("KRL revokes %v before any revocation", serials)
+	}
+
+	// SSH certificates are revoked like X.509 ones, but listed in the KRL
+	code, body = env.post(t, "/app/certificates/"+resp.Serial+"/revoke", `{"reason":"keyCompromise"}`, env.bearer(t, "alice"))
+	if code != http.StatusOK {
+		t.Fatalf("revoking the SSH certificate: %d %s", code, body)
+	}
+	krl := getSigner("/ssh/krl")
+	want := map[string][]uint64{string(caKey.Marshal()): {cert.Serial}}
+	if got := krlSerials(t, krl); !reflect.DeepEqual(got, want) {
+		t.Errorf("KRL revokes %v, want serial %x", got, cert.Serial)
+	}
+	if serials := env.revokedSerials(t); len(serials) != 0 {
+		t.Errorf("X.509 CRL lists SSH certificates %v", serials)
+	}
+
+	// OpenSSH agrees, where it is installed
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found; not checking the KRL with OpenSSH")
+	}
+	certPath := filepath.Join(env.dir, "user-cert.pub")
+	krlPath := filepath.Join(env.dir, "krl")
+	writeTestFile(t, certPath, []byte(resp.Certificate))
+	writeTestFile(t, krlPath, krl)
+	out, err := exec.Command("ssh-keygen", "-Q", "-f", krlPath, certPath).CombinedOutput()
+	if !strings.Contains(string(out), "REVOKED") {
+		t.Errorf("ssh-keygen -Q does not find the certificate revoked: %v\n%s", err, out)
+	}
+}
@@ -11,7 +11,6 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
-	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -247,7 +246,8 @@ func RunTestAPI(h *Handler, log *logging.Logger) error {
 		return fmt.Errorf("failed to generate CSR: %v", err)
 	}
 
-	// Create request body for signer
+	// Submit it through the auth middleware, as the frontend would, so the
+	// app server issues a signing ticket for this user and request
 	reqBody, err = json.Marshal(struct {
 		CSR string `json:"csr"`
 	}{
@@ -257,41 +257,26 @@ func RunTestAPI(h *Handler, log *logging.Logger) error {
 		return fmt.Errorf("failed to marshal request: %v", err)
 	}
 
-	// Create Unix domain socket connection to signer
-	conn, err := net.Dial("unix", h.config.Signer.SocketPath)
-	if err != nil {
-		return fmt.Errorf("failed to connect to signer: %v", err)
-	}
-	defer conn.Close()
+	req = httptest.NewRequest("POST", "/app/submit-csr", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+validateResp.Token)
+	w = httptest.NewRecorder()
 
-	// Send request to signer
-	start := time.Now()
-	if err := json.NewEncoder(conn).Encode(reqBody); err != nil {
-		h.metrics.RecordSignerRequest("error", time.Since(start), err)
-		return fmt.Errorf("failed to send request to signer: %v", err)
+	AuthMiddleware(h.jwtManager, nil, "", h.logger, h.metrics)(http.HandlerFunc(h.SubmitCSR)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		return fmt.Errorf("submit CSR failed with status %d: %s", w.Code, w.Body.String())
 	}
 
-	// Read response from signer
-	var signerResp struct {
+	var submitResp struct {
 		Certificate string `json:"certificate"`
-		Error       string `json:"error,omitempty"`
 	}
-	if err := json.NewDecoder(conn).Decode(&signerResp); err != nil {
-		h.metrics.RecordSignerRequest("error", time.Since(start), err)
-		return fmt.Errorf("failed to read response from signer: %v", err)
-	}
-
-	// Check for signer error
-	if signerResp.Error != "" {
-		h.metrics.RecordSignerRequest("error", time.Since(start), fmt.Errorf(signerResp.Error))
-		return fmt.Errorf("signer error: %s", signerResp.Error)
+	if err := json.NewDecoder(w.Body).Decode(&submitResp); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
 	}
 
-	// Record successful signer request
-	h.metrics.RecordSignerRequest("success", time.Since(start), nil)
-
 	log.WithFields(map[string]interface{}{
-		"certificate": signerResp.Certificate,
+		"certificate": submitResp.Certificate,
 	}).Info("Submit CSR response")
 
 	return nil
@@ -0,0 +1,191 @@
+// Package cakey provides the CA private key as a crypto.Signer. The key can
+// be read from a PEM file, used in place on a PKCS#11 token, or held by a
+// remote signing service; the signer only ever sees the crypto.Signer.
+package cakey
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+)
+
+// CA is the CA certificate with its key
+type CA struct {
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate // issuers above Certificate, if any
+	Key         crypto.Signer
+}
+
+// Open loads the CA certificate from cfg.Signer.CACertPath and the key from
+// the backend selected by cfg.Signer.CAKeyBackend, and checks that they
+// belong together. The chain comes from cfg.Signer.CAChainPath, or
+// follows the certificate in its file; a PKCS#12 key file may supply the
+// certificate and chain instead. Call Close on the result at shutdown.
+func Open(cfg *config.Config) (*CA, error) {
+	return open(cfg, NewPasswordSource(cfg.Signer.CAKeyPasswordFile, cfg.Signer.CAKeyPasswordCredential, cfg.Signer.CAKeyPasswordVar))
+}
+
+// OpenAll opens the CA of Open followed by each of cfg.Signer.IssuingCAs,
+// with the same key backend. Encrypted key files share one passphrase,
+// read once. On error the CAs already opened are closed again.
+func OpenAll(cfg *config.Config) ([]*CA, error) {
+	password := onceSource(NewPasswordSource(cfg.Signer.CAKeyPasswordFile, cfg.Signer.CAKeyPasswordCredential, cfg.Signer.CAKeyPasswordVar))
+	primary, err := open(cfg, password)
+	if err != nil {
+		return nil, err
+	}
+	cas := []*CA{primary}
+	for i, issuing := range cfg.Signer.IssuingCAs {
+		issuingCfg := *cfg
+		issuingCfg.Signer.CACertPath = issuing.CertPath
+		issuingCfg.Signer.CAChainPath = issuing.ChainPath
+		issuingCfg.Signer.CAKeyPath = issuing.KeyPath
+		issuingCfg.Signer.PKCS11KeyLabel = issuing.PKCS11KeyLabel
+		issuingCfg.Signer.PKCS11KeyID = issuing.PKCS11KeyID
+		issuingCfg.Signer.RemoteSignerKeyID = issuing.RemoteSignerKeyID
+		ca, err := open(&issuingCfg, password)
+		if err != nil {
+			for _, opened := range cas {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("issuing CA %d (%s): %v", i, issuing.CertPath, err)
+		}
+		cas = append(cas, ca)
+	}
+	return cas, nil
+}
+
+// onceSource returns a PasswordSource that asks source at most once
+func onceSource(source PasswordSource) PasswordSource {
+	var password []byte
+	var err error
+	var done bool
+	return func() ([]byte, error) {
+		if !done {
+			password, err = source()
+			done = true
+		}
+		return password, err
+	}
+}
+
+// open is Open with the passphrase of an encrypted key file from password
+func open(cfg *config.Config, password PasswordSource) (*CA, error) {
+	ca := &CA{}
+	if cfg.Signer.CACertPath != "" {
+		certs, err := loadCertificates(cfg.Signer.CACertPath)
+		if err != nil {
+			return nil, err
+		}
+		ca.Certificate, ca.Chain = certs[0], certs[1:]
+	}
+
+	var err error
+	switch cfg.Signer.CAKeyBackend {
+	case "", "file":
+		var fileKey *FileKey
+		fileKey, err = LoadFile(cfg.Signer.CAKeyPath, password)
+		if err != nil {
+			return nil, err
+		}
+		ca.Key = fileKey.Key
+		if ca.Certificate == nil {
+			ca.Certificate = fileKey.Certificate
+		}
+		if len(ca.Chain) == 0 {
+			ca.Chain = fileKey.Chain
+		}
+	case "pkcs11":
+		var pin string
+		if pin, err = readSecret(cfg.Signer.PKCS11PIN, cfg.Signer.PKCS11PINPath); err != nil {
+			return nil, fmt.Errorf("failed to read PKCS#11 PIN: %v", err)
+		}
+		ca.Key, err = OpenPKCS11(PKCS11Config{
+			ModulePath:  cfg.Signer.PKCS11ModulePath,
+			TokenLabel:  cfg.Signer.PKCS11TokenLabel,
+			TokenSerial: cfg.Signer.PKCS11TokenSerial,
+			PIN:         pin,
+			KeyLabel:    cfg.Signer.PKCS11KeyLabel,
+			KeyID:       cfg.Signer.PKCS11KeyID,
+		})
+	case "remote":
+		if ca.Certificate == nil {
+			return nil, fmt.Errorf("the remote CA key backend needs ca_cert_path")
+		}
+		var token string
+		if token, err = readSecret("", cfg.Signer.RemoteSignerTokenPath); err != nil {
+			return nil, fmt.Errorf("failed to read remote signer token: %v", err)
+		}
+		ca.Key, err = NewRemoteSigner(RemoteConfig{
+			URL:       cfg.Signer.RemoteSignerURL,
+			KeyID:     cfg.Signer.RemoteSignerKeyID,
+			Token:     token,
+			CertPath:  cfg.Signer.RemoteSignerCertPath,
+			KeyPath:   cfg.Signer.RemoteSignerKeyPath,
+			CAPath:    cfg.Signer.RemoteSignerCAPath,
+			Timeout:   cfg.Signer.RemoteSignerTimeout,
+			PublicKey: ca.Certificate.PublicKey,
+		})
+	default:
+		return nil, fmt.Errorf("unknown CA key backend %q", cfg.Signer.CAKeyBackend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ca.Certificate == nil {
+		ca.Close()
+		return nil, fmt.Errorf("no CA certificate: set ca_cert_path or use a PKCS#12 key file that contains it")
+	}
+	if cfg.Signer.CAChainPath != "" {
+		if ca.Chain, err = loadCertificates(cfg.Signer.CAChainPath); err != nil {
+			ca.Close()
+			return nil, err
+		}
+	}
+	if err := CheckChain(ca.Certificate, ca.Chain); err != nil {
+		ca.Close()
+		return nil, err
+	}
+	if err := CheckKeyPair(ca.Certificate, ca.Key); err != nil {
+		ca.Close()
+		return nil, err
+	}
+	return ca, nil
+}
+
+// Close releases the resources held by the key, if any
+func (ca *CA) Close() error {
+	if closer, ok := ca.Key.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// readSecret returns value, or the trimmed contents of path if value is
+// empty and path is set
+func readSecret(value, path string) (string, error) {
+	if value != "" || path == "" {
+		return value, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// PKCS11Config identifies a CA key on a PKCS#11 token
+type PKCS11Config struct {
+	ModulePath  string // path of the PKCS#11 module, e.g. libsofthsm2.so
+	TokenLabel  string
+	TokenSerial string
+	PIN         string
+	KeyLabel    string
+	KeyID       string // hexadecimal CKA_ID
+}
@@ -0,0 +1,229 @@
+package cakey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+	"github.com/youmark/pkcs8"
+)
+
+// newCert returns a CA certificate for key's public half, issued by parent
+// with parentKey, or self-signed if parent is nil
+func newCert(t *testing.T, commonName string, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// newECKey returns a fresh P-256 key
+func newECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// writeFile writes data to name in dir and returns its path
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// certPEM encodes certs as PEM, one after the other
+func certPEM(certs ...*x509.Certificate) []byte {
+	var data []byte
+	for _, cert := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return data
+}
+
+// pkcs8PEM encodes key as a PEM PKCS#8 key
+func pkcs8PEM(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestOpenFileBackend(t *testing.T) {
+	dir := t.TempDir()
+	rootKey, caKey := newECKey(t), newECKey(t)
+	root := newCert(t, "Root CA", rootKey, nil, nil)
+	ca := newCert(t, "Issuing CA", caKey, root, rootKey)
+
+	cfg := &config.Config{}
+	cfg.Signer.CACertPath = writeFile(t, dir, "ca.pem", certPEM(ca, root))
+	cfg.Signer.CAKeyPath = writeFile(t, dir, "ca.key", pkcs8PEM(t, caKey))
+
+	opened, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer opened.Close()
+	if !opened.Certificate.Equal(ca) {
+		t.Errorf("certificate = %s, want the issuing CA", opened.Certificate.Subject)
+	}
+	if len(opened.Chain) != 1 || !opened.Chain[0].Equal(root) {
+		t.Errorf("chain = %v, want the root from the certificate file", opened.Chain)
+	}
+	if err := CheckKeyPair(opened.Certificate, opened.Key); err != nil {
+		t.Error(err)
+	}
+
+	// The chain file takes precedence over the certificates after the CA
+	cfg.Signer.CAChainPath = writeFile(t, dir, "chain.pem", certPEM(newCert(t, "Other Root", newECKey(t), nil, nil)))
+	if _, err := Open(cfg); err == nil || !strings.Contains(err.Error(), "chain is broken") {
+		t.Errorf("unrelated chain: err = %v", err)
+	}
+}
+
+func TestOpenRejectsMismatchedKey(t *testing.T) {
+	dir := t.TempDir()
+	caKey := newECKey(t)
+	cfg := &config.Config{}
+	cfg.Signer.CACertPath = writeFile(t, dir, "ca.pem", certPEM(newCert(t, "CA", caKey, nil, nil)))
+	cfg.Signer.CAKeyPath = writeFile(t, dir, "ca.key", pkcs8PEM(t, newECKey(t)))
+
+	if _, err := Open(cfg); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("mismatched key: err = %v", err)
+	}
+
+	cfg.Signer.CAKeyPath = filepath.Join(dir, "missing.key")
+	if _, err := Open(cfg); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing key file: err = %v", err)
+	}
+
+	cfg.Signer.CAKeyBackend = "vault"
+	if _, err := Open(cfg); err == nil {
+		t.Error("accepted an unknown key backend")
+	}
+}
+
+// lyingSigner claims a public key it cannot sign for
+type lyingSigner struct {
+	crypto.Signer
+	public crypto.PublicKey
+}
+
+func (s lyingSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+func TestCheckKeyPairSigns(t *testing.T) {
+	caKey := newECKey(t)
+	cert := newCert(t, "CA", caKey, nil, nil)
+	if err := CheckKeyPair(cert, caKey); err != nil {
+		t.Fatal(err)
+	}
+	// A backend reporting the right public key but signing with another
+	// is caught by the probe signature
+	if err := CheckKeyPair(cert, lyingSigner{Signer: newECKey(t), public: caKey.Public()}); err == nil {
+		t.Error("accepted a key that signs with another key")
+	}
+}
+
+func TestCheckChain(t *testing.T) {
+	rootKey, midKey := newECKey(t), newECKey(t)
+	root := newCert(t, "Root CA", rootKey, nil, nil)
+	mid := newCert(t, "Intermediate CA", midKey, root, rootKey)
+	ca := newCert(t, "Issuing CA", newECKey(t), mid, midKey)
+
+	if err := CheckChain(ca, []*x509.Certificate{mid, root}); err != nil {
+		t.Errorf("complete chain: %v", err)
+	}
+	if err := CheckChain(ca, nil); err != nil {
+		t.Errorf("no chain: %v", err)
+	}
+	if err := CheckChain(ca, []*x509.Certificate{root, mid}); err == nil {
+		t.Error("accepted a chain out of order")
+	}
+	if err := CheckChain(ca, []*x509.Certificate{root}); err == nil {
+		t.Error("accepted a chain missing the intermediate")
+	}
+}
+
+func TestOpenAllSharesPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	encryptedPEM := func(key *ecdsa.PrivateKey) []byte {
+		der, err := pkcs8.MarshalPrivateKey(key, []byte("hunter2"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der})
+	}
+	oldKey, newKey := newECKey(t), newECKey(t)
+	oldCA, newCA := newCert(t, "CA 2026", oldKey, nil, nil), newCert(t, "CA 2027", newKey, nil, nil)
+
+	cfg := &config.Config{}
+	cfg.Signer.CACertPath = writeFile(t, dir, "ca.pem", certPEM(oldCA))
+	cfg.Signer.CAKeyPath = writeFile(t, dir, "ca.key", encryptedPEM(oldKey))
+	cfg.Signer.IssuingCAs = []config.IssuingCAConfig{{
+		CertPath: writeFile(t, dir, "ca-2027.pem", certPEM(newCA)),
+		KeyPath:  writeFile(t, dir, "ca-2027.key", encryptedPEM(newKey)),
+	}}
+	// The variable is cleared once read, so a second read would fail
+	cfg.Signer.CAKeyPasswordVar = "CERTM3_TEST_CA_PASSWORD"
+	t.Setenv("CERTM3_TEST_CA_PASSWORD", "hunter2")
+
+	cas, err := OpenAll(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, ca := range cas {
+			ca.Close()
+		}
+	}()
+	if len(cas) != 2 || !cas[0].Certificate.Equal(oldCA) || !cas[1].Certificate.Equal(newCA) {
+		t.Fatalf("opened %d CAs, want the configured CA and then the issuing CA", len(cas))
+	}
+	if err := CheckKeyPair(cas[1].Certificate, cas[1].Key); err != nil {
+		t.Error(err)
+	}
+
+	cfg.Signer.IssuingCAs[0].KeyPath = cfg.Signer.CAKeyPath
+	t.Setenv("CERTM3_TEST_CA_PASSWORD", "hunter2")
+	if _, err := OpenAll(cfg); err == nil || !strings.Contains(err.Error(), "issuing CA 0") {
+		t.Errorf("issuing CA with another CA's key: err = %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package cakey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// probeMessage is signed at startup to check the CA key
+const probeMessage = "certM3 CA key check"
+
+// CheckKeyPair checks that key is the private key for cert. Besides
+// comparing public keys it signs a probe message and verifies the
+// signature with the certificate, so a token or remote service holding
+// the wrong key, or unable to sign at all, is caught at startup rather
+// than on the first certificate request.
+func CheckKeyPair(cert *x509.Certificate, key crypto.Signer) error {
+	if pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool }); ok && !pub.Equal(cert.PublicKey) {
+		return fmt.Errorf("CA key does not match the public key of CA certificate %q", cert.Subject.String())
+	}
+
+	digest := sha256.Sum256([]byte(probeMessage))
+	var err error
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		var sig []byte
+		if sig, err = key.Sign(rand.Reader, digest[:], crypto.SHA256); err == nil {
+			err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+		}
+	case *ecdsa.PublicKey:
+		var sig []byte
+		if sig, err = key.Sign(rand.Reader, digest[:], crypto.SHA256); err == nil && !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			err = fmt.Errorf("signature does not verify")
+		}
+	case ed25519.PublicKey:
+		var sig []byte
+		if sig, err = key.Sign(rand.Reader, []byte(probeMessage), crypto.Hash(0)); err == nil && !ed25519.Verify(pub, []byte(probeMessage), sig) {
+			err = fmt.Errorf("signature does not verify")
+		}
+	default:
+		return fmt.Errorf("unsupported CA public key type %T", cert.PublicKey)
+	}
+	if err != nil {
+		return fmt.Errorf("CA key failed the startup signing check against CA certificate %q: %v", cert.Subject.String(), err)
+	}
+	return nil
+}
+
+// CheckChain checks that each certificate of chain issued the one before
+// it, starting with cert, so clients given the chain can build a path to
+// the root
+func CheckChain(cert *x509.Certificate, chain []*x509.Certificate) error {
+	child := cert
+	for _, issuer := range chain {
+		if err := child.CheckSignatureFrom(issuer); err != nil {
+			return fmt.Errorf("CA chain is broken: %q was not issued by %q: %v", child.Subject.String(), issuer.Subject.String(), err)
+		}
+		child = issuer
+	}
+	return nil
+}
+
+// loadCertificates reads one or more PEM certificates from path, the CA
+// certificate first
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("CA certificate file not found at %s", path)
+		}
+		return nil, fmt.Errorf("failed to read CA certificate file: %v", err)
+	}
+
+	var certs []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CA certificate - file exists and is PEM encoded but not a valid X.509 certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("failed to decode CA certificate PEM block - file exists but is not in valid PEM format")
+	}
+	return certs, nil
+}
@@ -0,0 +1,220 @@
+package cakey
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/youmark/pkcs8"
+	"golang.org/x/crypto/ssh"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// PasswordSource supplies the passphrase of an encrypted key file. It is
+// only called if the key turns out to be encrypted.
+type PasswordSource func() ([]byte, error)
+
+// NewPasswordSource returns a PasswordSource that reads the passphrase from
+// the first configured of: a file, a systemd credential (passed to the
+// service with LoadCredential= or SetCredentialEncrypted=) and an
+// environment variable. The environment variable is cleared once read so
+// it is not inherited by anything the signer starts.
+func NewPasswordSource(file, credential, envVar string) PasswordSource {
+	return func() ([]byte, error) {
+		switch {
+		case file != "":
+			return readPasswordFile(file)
+		case credential != "":
+			dir := os.Getenv("CREDENTIALS_DIRECTORY")
+			if dir == "" {
+				return nil, fmt.Errorf("systemd credential %q requested but CREDENTIALS_DIRECTORY is not set", credential)
+			}
+			return readPasswordFile(filepath.Join(dir, credential))
+		case envVar != "":
+			password, ok := os.LookupEnv(envVar)
+			if !ok {
+				return nil, fmt.Errorf("environment variable %s is not set", envVar)
+			}
+			os.Unsetenv(envVar)
+			return []byte(password), nil
+		default:
+			return nil, fmt.Errorf("CA key is encrypted but no passphrase source is configured")
+		}
+	}
+}
+
+// readPasswordFile reads a passphrase, dropping the trailing newline
+func readPasswordFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key passphrase: %v", err)
+	}
+	return bytes.TrimRight(data, "\r\n"), nil
+}
+
+// FileKey is a key read from a file, with the certificates bundled with it
+type FileKey struct {
+	Key crypto.Signer
+
+	// Certificate and Chain are only set for PKCS#12 bundles
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate
+}
+
+// LoadFile reads a private key from path. See Parse for the formats
+// understood.
+func LoadFile(path string, password PasswordSource) (*FileKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("CA key file not found at %s", path)
+		}
+		return nil, fmt.Errorf("failed to read CA key file: %v", err)
+	}
+	return Parse(data, password)
+}
+
+// Parse parses a private key. Following Postel's Law, it accepts:
+//   - PEM encoded PKCS#1 RSA and SEC 1 EC keys, optionally with legacy
+//     OpenSSL encryption
+//   - PEM encoded PKCS#8 keys, plain or encrypted ("ENCRYPTED PRIVATE KEY")
+//   - OpenSSH private keys, optionally passphrase protected
+//   - PKCS#12 (.p12/.pfx) bundles, returning the certificate and chain too
+//   - DER encoded PKCS#8 and PKCS#1 keys
+//
+// Other PEM blocks before the key, such as certificates, are skipped.
+func Parse(data []byte, password PasswordSource) (*FileKey, error) {
+	if password == nil {
+		password = NewPasswordSource("", "", "")
+	}
+
+	rest := data
+	sawPEM := false
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		sawPEM = true
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+		key, err := parsePEMKey(block, password)
+		if err != nil {
+			return nil, err
+		}
+		return signerKey(key)
+	}
+	if sawPEM {
+		return nil, fmt.Errorf("no private key found in PEM data")
+	}
+
+	// Not PEM: DER PKCS#8 or PKCS#1, or a PKCS#12 bundle
+	if key, err := x509.ParsePKCS8PrivateKey(data); err == nil {
+		return signerKey(key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+		return signerKey(key)
+	}
+	return parsePKCS12(data, password)
+}
+
+// parsePEMKey parses a single PEM private key block
+func parsePEMKey(block *pem.Block, password PasswordSource) (interface{}, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY", "EC PRIVATE KEY":
+		// Legacy OpenSSL PEM encryption is weak and deprecated, but plenty
+		// of existing CA keys still use it
+		der := block.Bytes
+		if x509.IsEncryptedPEMBlock(block) {
+			pw, err := password()
+			if err != nil {
+				return nil, err
+			}
+			if der, err = x509.DecryptPEMBlock(block, pw); err != nil {
+				return nil, fmt.Errorf("failed to decrypt CA key: %v", err)
+			}
+		}
+		if block.Type == "RSA PRIVATE KEY" {
+			return wrapParseError(x509.ParsePKCS1PrivateKey(der))
+		}
+		return wrapParseError(x509.ParseECPrivateKey(der))
+	case "PRIVATE KEY":
+		return wrapParseError(x509.ParsePKCS8PrivateKey(block.Bytes))
+	case "ENCRYPTED PRIVATE KEY":
+		pw, err := password()
+		if err != nil {
+			return nil, err
+		}
+		key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, pw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt CA key (wrong passphrase?): %v", err)
+		}
+		return key, nil
+	case "OPENSSH PRIVATE KEY":
+		encoded := pem.EncodeToMemory(block)
+		key, err := ssh.ParseRawPrivateKey(encoded)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			pw, perr := password()
+			if perr != nil {
+				return nil, perr
+			}
+			key, err = ssh.ParseRawPrivateKeyWithPassphrase(encoded, pw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse OpenSSH CA key: %v", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("CA key is not in a supported format. Found format: %s, supported formats: RSA PRIVATE KEY, EC PRIVATE KEY, PRIVATE KEY, ENCRYPTED PRIVATE KEY, OPENSSH PRIVATE KEY", block.Type)
+	}
+}
+
+// parsePKCS12 decodes a PKCS#12 bundle. Bundles without a password are
+// tried first so the passphrase source is only needed when one is set.
+func parsePKCS12(data []byte, password PasswordSource) (*FileKey, error) {
+	key, cert, chain, err := pkcs12.DecodeChain(data, "")
+	if err == pkcs12.ErrIncorrectPassword {
+		pw, perr := password()
+		if perr != nil {
+			return nil, perr
+		}
+		key, cert, chain, err = pkcs12.DecodeChain(data, string(pw))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("CA key is neither PEM, DER nor a readable PKCS#12 bundle: %v", err)
+	}
+
+	fileKey, err := signerKey(key)
+	if err != nil {
+		return nil, err
+	}
+	fileKey.Certificate = cert
+	fileKey.Chain = chain
+	return fileKey, nil
+}
+
+// wrapParseError gives key parsing errors a common prefix
+func wrapParseError(key interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return nil, fmt.Errorf("CA key is PEM encoded but not a valid private key: %v", err)
+	}
+	return key, nil
+}
+
+// signerKey returns key as a FileKey, if it can sign
+func signerKey(key interface{}) (*FileKey, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("CA key of type %T cannot sign", key)
+	}
+	return &FileKey{Key: signer}, nil
+}
@@ -0,0 +1,186 @@
+package cakey
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+	"github.com/youmark/pkcs8"
+	"golang.org/x/crypto/ssh"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// staticPassword is a PasswordSource for password
+func staticPassword(password string) PasswordSource {
+	return func() ([]byte, error) { return []byte(password), nil }
+}
+
+func TestParseFormats(t *testing.T) {
+	ecKey := newECKey(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPKCS8, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedPKCS8, err := pkcs8.MarshalPrivateKey(ecKey, []byte("hunter2"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey), []byte("hunter2"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	openSSH, err := ssh.MarshalPrivateKey(ecKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	openSSHEncrypted, err := ssh.MarshalPrivateKeyWithPassphrase(edKey, "", []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := newCert(t, "CA", ecKey, nil, nil)
+
+	tests := []struct {
+		name string
+		data []byte
+		key  crypto.Signer
+	}{
+		{"PKCS #1", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), rsaKey},
+		{"SEC 1", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}), ecKey},
+		{"PKCS #8", pkcs8PEM(t, ecKey), ecKey},
+		{"PKCS #8 after the certificate", append(certPEM(cert), pkcs8PEM(t, ecKey)...), ecKey},
+		{"encrypted PKCS #8", pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encryptedPKCS8}), ecKey},
+		{"legacy encrypted PEM", pem.EncodeToMemory(legacy), rsaKey},
+		{"OpenSSH", pem.EncodeToMemory(openSSH), ecKey},
+		{"encrypted OpenSSH", pem.EncodeToMemory(openSSHEncrypted), edKey},
+		{"DER PKCS #8", rsaPKCS8, rsaKey},
+		{"DER PKCS #1", x509.MarshalPKCS1PrivateKey(rsaKey), rsaKey},
+	}
+	for _, tt := range tests {
+		fileKey, err := Parse(tt.data, staticPassword("hunter2"))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		want := tt.key.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if !want.Equal(fileKey.Key.Public()) {
+			t.Errorf("%s: parsed a different key", tt.name)
+		}
+	}
+}
+
+func TestParseEncryptedKeys(t *testing.T) {
+	encrypted, err := pkcs8.MarshalPrivateKey(newECKey(t), []byte("hunter2"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted})
+
+	if _, err := Parse(data, staticPassword("wrong")); err == nil {
+		t.Error("decrypted with the wrong passphrase")
+	}
+	if _, err := Parse(data, nil); err == nil {
+		t.Error("decrypted without a passphrase source")
+	}
+
+	// Unencrypted keys never ask for the passphrase
+	asked := false
+	ask := func() ([]byte, error) { asked = true; return nil, nil }
+	if _, err := Parse(pkcs8PEM(t, newECKey(t)), ask); err != nil {
+		t.Fatal(err)
+	}
+	if asked {
+		t.Error("asked for the passphrase of an unencrypted key")
+	}
+
+	if _, err := Parse(certPEM(newCert(t, "CA", newECKey(t), nil, nil)), nil); err == nil {
+		t.Error("found a key in a file with only a certificate")
+	}
+}
+
+func TestOpenPKCS12(t *testing.T) {
+	dir := t.TempDir()
+	rootKey, caKey := newECKey(t), newECKey(t)
+	root := newCert(t, "Root CA", rootKey, nil, nil)
+	ca := newCert(t, "Issuing CA", caKey, root, rootKey)
+	bundle, err := pkcs12.Modern.Encode(caKey, ca, []*x509.Certificate{root}, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Signer.CAKeyPath = writeFile(t, dir, "ca.p12", bundle)
+	cfg.Signer.CAKeyPasswordVar = "CERTM3_TEST_CA_PASSWORD"
+	t.Setenv("CERTM3_TEST_CA_PASSWORD", "hunter2")
+
+	opened, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opened.Certificate.Equal(ca) || len(opened.Chain) != 1 || !opened.Chain[0].Equal(root) {
+		t.Errorf("certificate %s with chain %v, want the bundled CA and root", opened.Certificate.Subject, opened.Chain)
+	}
+	if _, ok := os.LookupEnv("CERTM3_TEST_CA_PASSWORD"); ok {
+		t.Error("the passphrase is still in the environment")
+	}
+}
+
+func TestPasswordSources(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "passphrase", []byte("from-file\n"))
+	writeFile(t, dir, "ca-passphrase", []byte("from-credential\r\n"))
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+	t.Setenv("CERTM3_TEST_CA_PASSWORD", "from-env")
+
+	tests := []struct {
+		name   string
+		source PasswordSource
+		want   string
+	}{
+		{"file", NewPasswordSource(file, "ca-passphrase", "CERTM3_TEST_CA_PASSWORD"), "from-file"},
+		{"credential", NewPasswordSource("", "ca-passphrase", "CERTM3_TEST_CA_PASSWORD"), "from-credential"},
+		{"environment", NewPasswordSource("", "", "CERTM3_TEST_CA_PASSWORD"), "from-env"},
+	}
+	for _, tt := range tests {
+		got, err := tt.source()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: passphrase %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := NewPasswordSource("", "", "CERTM3_TEST_CA_PASSWORD")(); err == nil {
+		t.Error("read the environment variable twice")
+	}
+	if _, err := NewPasswordSource(filepath.Join(dir, "missing"), "", "")(); err == nil {
+		t.Error("read a missing passphrase file")
+	}
+	if _, err := NewPasswordSource("", "", "")(); err == nil {
+		t.Error("returned a passphrase without a source")
+	}
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+	if _, err := NewPasswordSource("", "ca-passphrase", "")(); err == nil {
+		t.Error("read a credential without CREDENTIALS_DIRECTORY")
+	}
+}
@@ -0,0 +1,59 @@
+//go:build pkcs11
+
+package cakey
+
+import (
+	"crypto"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ThalesIgnite/crypto11"
+)
+
+// pkcs11Key is a key on a PKCS#11 token together with the session context
+// it was found through
+type pkcs11Key struct {
+	crypto11.Signer
+	ctx *crypto11.Context
+}
+
+// Close logs out of the token
+func (k *pkcs11Key) Close() error {
+	return k.ctx.Close()
+}
+
+// OpenPKCS11 logs in to the token and finds the CA key on it. The private
+// key never leaves the token; signatures are computed by the token.
+func OpenPKCS11(cfg PKCS11Config) (crypto.Signer, error) {
+	var id, label []byte
+	if cfg.KeyID != "" {
+		var err error
+		if id, err = hex.DecodeString(cfg.KeyID); err != nil {
+			return nil, fmt.Errorf("invalid PKCS#11 key ID %q: %v", cfg.KeyID, err)
+		}
+	}
+	if cfg.KeyLabel != "" {
+		label = []byte(cfg.KeyLabel)
+	}
+
+	ctx, err := crypto11.Configure(&crypto11.Config{
+		Path:        cfg.ModulePath,
+		TokenLabel:  cfg.TokenLabel,
+		TokenSerial: cfg.TokenSerial,
+		Pin:         cfg.PIN,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PKCS#11 token: %v", err)
+	}
+
+	key, err := ctx.FindKeyPair(id, label)
+	if err != nil {
+		ctx.Close()
+		return nil, fmt.Errorf("failed to find CA key on PKCS#11 token: %v", err)
+	}
+	if key == nil {
+		ctx.Close()
+		return nil, fmt.Errorf("no key with label %q / ID %q on PKCS#11 token", cfg.KeyLabel, cfg.KeyID)
+	}
+	return &pkcs11Key{Signer: key, ctx: ctx}, nil
+}
@@ -0,0 +1,14 @@
+//go:build !pkcs11
+
+package cakey
+
+import (
+	"crypto"
+	"fmt"
+)
+
+// OpenPKCS11 is unavailable: PKCS#11 support needs cgo and is only built
+// with -tags pkcs11
+func OpenPKCS11(cfg PKCS11Config) (crypto.Signer, error) {
+	return nil, fmt.Errorf("this signer was built without PKCS#11 support; rebuild with -tags pkcs11")
+}
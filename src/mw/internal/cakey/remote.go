@@ -0,0 +1,151 @@
+package cakey
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// RemoteConfig describes a remote signing service holding the CA key
+type RemoteConfig struct {
+	URL      string
+	KeyID    string
+	Token    string // bearer token, optional
+	CertPath string // client certificate for mTLS, optional
+	KeyPath  string
+	CAPath   string // CA for the service's certificate, optional
+	Timeout  time.Duration
+
+	// PublicKey is the public half of the remote key, normally taken
+	// from the CA certificate
+	PublicKey crypto.PublicKey
+}
+
+// RemoteSignRequest is sent to the remote signing service. Digest is the
+// hash of the data to sign, computed with Hash; the service signs it as is.
+type RemoteSignRequest struct {
+	KeyID      string `json:"keyId,omitempty"`
+	Hash       string `json:"hash"`       // e.g. "SHA-256"
+	Padding    string `json:"padding"`    // "pkcs1v15", "pss" or "" for ECDSA/Ed25519
+	SaltLength int    `json:"saltLength"` // PSS only
+	Digest     []byte `json:"digest"`     // base64 in JSON
+}
+
+// RemoteSignResponse is the remote signing service's answer
+type RemoteSignResponse struct {
+	Signature []byte `json:"signature"` // base64 in JSON
+	Error     string `json:"error,omitempty"`
+}
+
+// remoteSigner is a crypto.Signer backed by a remote signing service
+type remoteSigner struct {
+	cfg    RemoteConfig
+	client *http.Client
+}
+
+// NewRemoteSigner returns a crypto.Signer that has the remote service sign
+func NewRemoteSigner(cfg RemoteConfig) (crypto.Signer, error) {
+	if cfg.PublicKey == nil {
+		return nil, fmt.Errorf("remote signer needs the CA public key")
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.CertPath != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertPath, cfg.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load remote signer client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CAPath != "" {
+		caPEM, err := os.ReadFile(cfg.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read remote signer CA: %v", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in remote signer CA file %s", cfg.CAPath)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	return &remoteSigner{
+		cfg: cfg,
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			Timeout:   cfg.Timeout,
+		},
+	}, nil
+}
+
+// Public returns the public key of the remote key
+func (r *remoteSigner) Public() crypto.PublicKey {
+	return r.cfg.PublicKey
+}
+
+// Sign asks the remote service to sign digest
+func (r *remoteSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	req := RemoteSignRequest{
+		KeyID:  r.cfg.KeyID,
+		Digest: digest,
+	}
+	if hash := opts.HashFunc(); hash != 0 {
+		req.Hash = hash.String()
+	}
+	if _, ok := r.cfg.PublicKey.(*rsa.PublicKey); ok {
+		req.Padding = "pkcs1v15"
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			req.Padding = "pss"
+			req.SaltLength = pss.SaltLength
+		}
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode remote sign request: %v", err)
+	}
+
+	ctx := context.Background()
+	if r.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.cfg.Timeout)
+		defer cancel()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote sign request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if r.cfg.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+r.cfg.Token)
+	}
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("remote signer unavailable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var signResp RemoteSignResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&signResp); err != nil {
+		return nil, fmt.Errorf("failed to decode remote signer response (status %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("remote signer failed with status %d: %s", resp.StatusCode, signResp.Error)
+	}
+	if len(signResp.Signature) == 0 {
+		return nil, fmt.Errorf("remote signer returned an empty signature")
+	}
+	return signResp.Signature, nil
+}
@@ -0,0 +1,135 @@
+package cakey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+)
+
+// newRemoteService returns a signing service holding keys by ID, which
+// wants the bearer token
+func newRemoteService(t *testing.T, token string, keys map[string]crypto.Signer) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(RemoteSignResponse{Error: "bad token"})
+			return
+		}
+		var req RemoteSignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		key, ok := keys[req.KeyID]
+		if !ok || req.Hash != crypto.SHA256.String() {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(RemoteSignResponse{Error: "no such key"})
+			return
+		}
+		var opts crypto.SignerOpts = crypto.SHA256
+		if req.Padding == "pss" {
+			opts = &rsa.PSSOptions{SaltLength: req.SaltLength, Hash: crypto.SHA256}
+		}
+		signature, err := key.Sign(rand.Reader, req.Digest, opts)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(RemoteSignResponse{Signature: signature})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRemoteSigner(t *testing.T) {
+	ecKey := newECKey(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newRemoteService(t, "token", map[string]crypto.Signer{"ec": ecKey, "rsa": rsaKey})
+	digest := sha256.Sum256([]byte("message"))
+
+	signer, err := NewRemoteSigner(RemoteConfig{URL: server.URL, KeyID: "ec", Token: "token", PublicKey: ecKey.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(&ecKey.PublicKey, digest[:], sig) {
+		t.Error("ECDSA signature does not verify")
+	}
+
+	signer, err = NewRemoteSigner(RemoteConfig{URL: server.URL, KeyID: "rsa", Token: "token", PublicKey: rsaKey.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("PKCS #1 v1.5 signature: %v", err)
+	}
+	pss := &rsa.PSSOptions{SaltLength: 32, Hash: crypto.SHA256}
+	if sig, err = signer.Sign(rand.Reader, digest[:], pss); err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPSS(&rsaKey.PublicKey, crypto.SHA256, digest[:], sig, pss); err != nil {
+		t.Errorf("PSS signature: %v", err)
+	}
+
+	signer, err = NewRemoteSigner(RemoteConfig{URL: server.URL, KeyID: "ec", PublicKey: ecKey.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); err == nil {
+		t.Error("signed without the token")
+	}
+
+	if _, err := NewRemoteSigner(RemoteConfig{URL: server.URL}); err == nil {
+		t.Error("created a remote signer without a public key")
+	}
+}
+
+func TestOpenRemoteBackend(t *testing.T) {
+	dir := t.TempDir()
+	caKey := newECKey(t)
+	server := newRemoteService(t, "token", map[string]crypto.Signer{"ca": caKey})
+
+	cfg := &config.Config{}
+	cfg.Signer.CAKeyBackend = "remote"
+	cfg.Signer.CACertPath = writeFile(t, dir, "ca.pem", certPEM(newCert(t, "CA", caKey, nil, nil)))
+	cfg.Signer.RemoteSignerURL = server.URL
+	cfg.Signer.RemoteSignerKeyID = "ca"
+	cfg.Signer.RemoteSignerTokenPath = writeFile(t, dir, "token", []byte("token\n"))
+
+	ca, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ca.Key.(*remoteSigner); !ok {
+		t.Errorf("key is %T, want the remote signer", ca.Key)
+	}
+
+	// Open signs a probe, so a service holding another key fails at once
+	cfg.Signer.RemoteSignerKeyID = "other"
+	if _, err := Open(cfg); err == nil {
+		t.Error("opened a remote key the service does not have")
+	}
+
+	cfg.Signer.CACertPath = ""
+	if _, err := Open(cfg); err == nil {
+		t.Error("opened a remote key without the CA certificate")
+	}
+}
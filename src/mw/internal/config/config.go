@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -33,12 +34,61 @@ type Config struct {
 		MetricsTimeout  time.Duration `yaml:"metrics_timeout"`
 		LogFile         string        `yaml:"log_file"`
 		TestEmailDir    string        `yaml:"test_email_dir"`
+
+		// How the app server reaches the signer: "socket" uses the framed
+		// protocol on the signer's Unix socket, "grpc" the gRPC service at
+		// SignerGRPCAddr (unix:///path or host:port, mTLS for TCP)
+		SignerTransport    string `yaml:"signer_transport"`
+		SignerGRPCAddr     string `yaml:"signer_grpc_addr"`
+		SignerGRPCCertPath string `yaml:"signer_grpc_cert_path"`
+		SignerGRPCKeyPath  string `yaml:"signer_grpc_key_path"`
+		SignerGRPCCAPath   string `yaml:"signer_grpc_ca_path"`
+
+		// Issued certificates are registered with the backend through this
+		// outbox file, retried until the backend accepts them
+		CertificateOutboxPath string `yaml:"certificate_outbox_path"`
+
+		// Client certificate authentication. The TLS terminator in front of
+		// the app server passes the verified client certificate, URL-escaped
+		// PEM, in ClientCertHeader (nginx: $ssl_client_escaped_cert); the
+		// app server checks it against ClientCAPath, defaulting to the
+		// signer's CA certificate. An unset header disables it; the CA is
+		// also used for certificates presented in renewal requests.
+		ClientCertHeader string `yaml:"client_cert_header"`
+		ClientCAPath     string `yaml:"client_ca_path"`
+
+		// Members of these backend groups may revoke any certificate
+		AdminGroups []string `yaml:"admin_groups"`
+
+		// ACME (RFC 8555) server for automated clients. Accounts are bound
+		// to certM3 users by external account binding keys the users create
+		// at /app/acme/eab. ACMEBaseURL is the public URL the directory
+		// lives under; its path is also the path the app server serves.
+		// Certificates are issued with ACMEProfile, or the default profile.
+		ACMEEnabled          bool          `yaml:"acme_enabled"`
+		ACMEBaseURL          string        `yaml:"acme_base_url"`
+		ACMEStatePath        string        `yaml:"acme_state_path"`
+		ACMEProfile          string        `yaml:"acme_profile"`
+		ACMEOrderTTL         time.Duration `yaml:"acme_order_ttl"`
+		ACMEAuthorizationTTL time.Duration `yaml:"acme_authorization_ttl"`
+		ACMEEABKeyTTL        time.Duration `yaml:"acme_eab_key_ttl"`
+
+		// EST (RFC 7030) enrollment under /.well-known/est for devices.
+		// Devices authenticate with HTTP basic auth as a certM3 user and a
+		// one-time enrollment code the user created at /app/est/codes, or
+		// with a client certificate. Certificates are issued with
+		// ESTProfile, or the default profile.
+		ESTEnabled   bool          `yaml:"est_enabled"`
+		ESTCodesPath string        `yaml:"est_codes_path"`
+		ESTCodeTTL   time.Duration `yaml:"est_code_ttl"`
+		ESTProfile   string        `yaml:"est_profile"`
 	} `yaml:"app_server"`
 
 	// Signer configuration
 	Signer struct {
 		SocketPath           string   `yaml:"socket_path"`
 		CACertPath           string   `yaml:"ca_cert_path"`
+		CAChainPath          string   `yaml:"ca_chain_path"` // issuers above the CA, nearest first, PEM
 		CAKeyPath            string   `yaml:"ca_key_path"`
 		SubjectOU            string   `yaml:"subject_ou"`
 		SubjectO             string   `yaml:"subject_o"`
@@ -55,9 +105,235 @@ type Config struct {
 		ExtendedKeyUsage     []string `yaml:"extended_key_usage"`
 		APIURL               string   `yaml:"api_url"`
 		LogFile              string   `yaml:"log_file"`
+
+		// Where the CA private key lives: "file" reads CAKeyPath, "pkcs11"
+		// uses a key on a PKCS#11 token and "remote" asks an HTTP signing
+		// service, so the key never enters the signer's memory
+		CAKeyBackend string `yaml:"ca_key_backend"`
+
+		// Passphrase for an encrypted CA key file, taken from the first of
+		// these that is set: a file, a systemd credential name (looked up
+		// in $CREDENTIALS_DIRECTORY) or an environment variable name
+		CAKeyPasswordFile       string `yaml:"private_key_password_file"`
+		CAKeyPasswordCredential string `yaml:"private_key_password_credential"`
+		CAKeyPasswordVar        string `yaml:"private_key_password_var"`
+
+		// PKCS#11 token holding the CA key (binaries built with -tags pkcs11)
+		PKCS11ModulePath  string `yaml:"pkcs11_module_path"`
+		PKCS11TokenLabel  string `yaml:"pkcs11_token_label"`
+		PKCS11TokenSerial string `yaml:"pkcs11_token_serial"`
+		PKCS11PIN         string `yaml:"pkcs11_pin"`
+		PKCS11PINPath     string `yaml:"pkcs11_pin_path"`
+		PKCS11KeyLabel    string `yaml:"pkcs11_key_label"`
+		PKCS11KeyID       string `yaml:"pkcs11_key_id"` // hexadecimal
+
+		// Remote signing service holding the CA key
+		RemoteSignerURL       string        `yaml:"remote_signer_url"`
+		RemoteSignerKeyID     string        `yaml:"remote_signer_key_id"`
+		RemoteSignerTokenPath string        `yaml:"remote_signer_token_path"`
+		RemoteSignerCertPath  string        `yaml:"remote_signer_cert_path"`
+		RemoteSignerKeyPath   string        `yaml:"remote_signer_key_path"`
+		RemoteSignerCAPath    string        `yaml:"remote_signer_ca_path"`
+		RemoteSignerTimeout   time.Duration `yaml:"remote_signer_timeout"`
+
+		// Revocation and CRL publication
+		HTTPListenAddr    string        `yaml:"http_listen_addr"`
+		RevocationDBPath  string        `yaml:"revocation_db_path"`
+		DeltaCRLURL       string        `yaml:"delta_crl_url"`
+		CRLUpdateInterval time.Duration `yaml:"crl_update_interval"`
+		CRLValidity       time.Duration `yaml:"crl_validity"`
+		DeltaCRLInterval  time.Duration `yaml:"delta_crl_interval"`
+
+		// OCSP responder
+		OCSPURL            string        `yaml:"ocsp_url"`
+		OCSPValidity       time.Duration `yaml:"ocsp_validity"`
+		OCSPDelegated      bool          `yaml:"ocsp_delegated"`
+		OCSPSignerValidity time.Duration `yaml:"ocsp_signer_validity"`
+		IssuedDBPath       string        `yaml:"issued_db_path"`
+
+		// How long a renewed certificate stays valid alongside its
+		// replacement when the renewal asks for it to be revoked
+		RenewalOverlap time.Duration `yaml:"renewal_overlap"`
+
+		// Unix socket access control. The socket is created with the given
+		// owner, group and octal mode, and only peers whose UID or primary
+		// GID is listed may talk to the signer; with neither list set, only
+		// the signer's own UID is accepted.
+		SocketOwner     string `yaml:"socket_owner"`
+		SocketGroup     string `yaml:"socket_group"`
+		SocketMode      string `yaml:"socket_mode"`
+		AllowedPeerUIDs []int  `yaml:"allowed_peer_uids"`
+		AllowedPeerGIDs []int  `yaml:"allowed_peer_gids"`
+
+		// Signing tickets: short-lived tokens the app server issues for each
+		// signer request, authenticated with a secret shared by both
+		TicketSecret     string        `yaml:"ticket_secret"`
+		TicketSecretPath string        `yaml:"ticket_secret_path"`
+		TicketTTL        time.Duration `yaml:"ticket_ttl"`
+
+		// gRPC service. It is always available on the Unix socket; setting
+		// GRPCListenAddr also serves it over TCP with mTLS, accepting
+		// clients whose certificate CommonName is in GRPCAllowedClients or
+		// GRPCAdminClients (none, if both are empty). Only admin clients
+		// may query the ledger with GetStatus and ListCertificates.
+		GRPCListenAddr     string   `yaml:"grpc_listen_addr"`
+		GRPCCertPath       string   `yaml:"grpc_cert_path"`
+		GRPCKeyPath        string   `yaml:"grpc_key_path"`
+		GRPCClientCAPath   string   `yaml:"grpc_client_ca_path"`
+		GRPCAllowedClients []string `yaml:"grpc_allowed_clients"`
+		GRPCAdminClients   []string `yaml:"grpc_admin_clients"`
+
+		// OpenSSH user certificates. With SSHCAKeyPath (an OpenSSH private
+		// key) set, the signer also signs users' SSH public keys, with their
+		// authorized groups as principals. Every certificate carries
+		// SSHCriticalOptions and SSHExtensions; without SSHExtensions the
+		// usual OpenSSH permit-* set is granted. The CA public key, for
+		// sshd's TrustedUserCAKeys, and the KRL, for RevokedKeys, are served
+		// on HTTPListenAddr at the paths of SSHCAKeyURL and SSHKRLURL.
+		SSHCAKeyPath       string            `yaml:"ssh_ca_key_path"`
+		SSHCertValidity    time.Duration     `yaml:"ssh_cert_validity"`
+		SSHCriticalOptions map[string]string `yaml:"ssh_critical_options"`
+		SSHExtensions      []string          `yaml:"ssh_extensions"`
+		SSHCAKeyURL        string            `yaml:"ssh_ca_key_url"`
+		SSHKRLURL          string            `yaml:"ssh_krl_url"`
+
+		// Further issuing CAs, for rotating the CA. Each is opened like the
+		// CA above, with the same key backend. The signer issues from the
+		// newest CA whose ActivateAt has passed and keeps publishing CRLs
+		// and answering OCSP for the others until the last certificate
+		// they issued expires. SIGHUP reloads the list.
+		IssuingCAs []IssuingCAConfig `yaml:"issuing_cas"`
+
+		// Group lookup in the backend API (backend_baseurl). Each attempt
+		// times out after GroupLookupTimeout and failed lookups are tried
+		// GroupLookupAttempts times in all; answers are cached for
+		// GroupCacheTTL. GroupLookupFailure says what to do when the
+		// backend cannot answer: "deny" the request, "degrade" to only the
+		// default groups, or serve "stale" cached groups no older than
+		// GroupCacheMaxStale, denying if there are none. Profiles may set
+		// their own.
+		GroupLookupTimeout   time.Duration `yaml:"group_lookup_timeout"`
+		GroupLookupAttempts  int           `yaml:"group_lookup_attempts"`
+		GroupLookupBackoff   time.Duration `yaml:"group_lookup_backoff"`
+		GroupLookupTokenPath string        `yaml:"group_lookup_token_path"`
+		GroupLookupCertPath  string        `yaml:"group_lookup_cert_path"`
+		GroupLookupKeyPath   string        `yaml:"group_lookup_key_path"`
+		GroupLookupCAPath    string        `yaml:"group_lookup_ca_path"`
+		GroupCacheTTL        time.Duration `yaml:"group_cache_ttl"`
+		GroupCacheMaxStale   time.Duration `yaml:"group_cache_max_stale"`
+		GroupLookupFailure   string        `yaml:"group_lookup_failure"`
+
+		// Where group membership comes from. Without any sources the
+		// backend API is asked. With several, GroupSourceMode says whether
+		// a user is in the groups any source lists ("union") or only in
+		// those every source lists ("intersection").
+		GroupSources    []GroupSourceConfig `yaml:"group_sources"`
+		GroupSourceMode string              `yaml:"group_source_mode"`
+
+		// Issuance policy file, evaluated for every request: mandatory,
+		// exclusive and approval groups, a group limit, and validity caps
+		// and allowed SANs per group. Without one, certificates carry the
+		// username and "users" besides the requested groups. SIGHUP
+		// reloads it.
+		PolicyPath string `yaml:"policy_path"`
+
+		// Roles put in the role extension (RoleExtensionOID) next to the
+		// groups: a certificate gets the role of each mapping with a
+		// pattern matching one of its groups
+		RoleMappings []RoleMappingConfig `yaml:"role_mappings"`
+
+		// Certificate profiles; when none are configured a single "default"
+		// profile is built from the settings above
+		DefaultProfile string                   `yaml:"default_profile"`
+		Profiles       map[string]ProfileConfig `yaml:"profiles"`
 	}
 }
 
+// ProfileConfig describes a named certificate profile
+type ProfileConfig struct {
+	// Validity overrides ValidityDays when set, for short-lived profiles
+	ValidityDays     int           `yaml:"validity_days"`
+	Validity         time.Duration `yaml:"validity"`
+	KeyUsage         []string      `yaml:"key_usage"`
+	ExtendedKeyUsage []string      `yaml:"extended_key_usage"`
+	// AllowedSANTypes lists the CSR SAN types copied into the certificate:
+	// dns, email, ip, uri. Empty allows none.
+	AllowedSANTypes []string `yaml:"allowed_san_types"`
+	// Extensions selects the optional extensions: crl, ocsp, aia, groups,
+	// roles. Empty includes all.
+	Extensions []string `yaml:"extensions"`
+	// AllowedGroups are glob patterns of the groups that may appear in the
+	// certificate. Empty allows all.
+	AllowedGroups []string `yaml:"allowed_groups"`
+	// GroupEncodings selects how the groups are carried: extension (the
+	// private group OID), subject_ou, san_uri (urn:certm3:group:<name>)
+	// and attribute_certificate (an RFC 5755 attribute certificate issued
+	// alongside, which can be reissued without a new certificate). Empty
+	// selects extension.
+	GroupEncodings []string `yaml:"group_encodings"`
+	// AttributeCertificateValidity bounds attribute certificates, which
+	// never outlive their certificate. Zero uses the certificate validity.
+	AttributeCertificateValidity time.Duration `yaml:"attribute_certificate_validity"`
+	// RequesterGroups lists the groups whose members may request this
+	// profile; the app server enforces it. Empty allows every user.
+	RequesterGroups []string `yaml:"requester_groups"`
+	// GroupLookupFailure overrides the signer's group_lookup_failure for
+	// this profile: deny, degrade or stale
+	GroupLookupFailure string `yaml:"group_lookup_failure"`
+}
+
+// RoleMappingConfig maps groups, by glob pattern, to a role
+type RoleMappingConfig struct {
+	Groups []string `yaml:"groups"`
+	Role   string   `yaml:"role"`
+}
+
+// GroupSourceConfig describes a source of group membership
+type GroupSourceConfig struct {
+	// Type is "backend", "ldap" or "static"
+	Type string `yaml:"type"`
+
+	// A static source reads a YAML file mapping usernames to their groups
+	Path string `yaml:"path"`
+
+	// An LDAP source finds the user under BaseDN with UserFilter. Their
+	// groups are the GroupAttribute values of the entries GroupFilter
+	// finds under GroupBaseDN or, without GroupFilter, the CNs of the DNs
+	// in the user's MemberOfAttribute. {username} and {dn} in the filters
+	// are replaced by the escaped username and user DN.
+	URL               string `yaml:"url"` // ldap:// or ldaps://
+	StartTLS          bool   `yaml:"start_tls"`
+	CAPath            string `yaml:"ca_path"`
+	BindDN            string `yaml:"bind_dn"`
+	BindPasswordPath  string `yaml:"bind_password_path"`
+	BaseDN            string `yaml:"base_dn"`
+	UserFilter        string `yaml:"user_filter"`
+	GroupBaseDN       string `yaml:"group_base_dn"`
+	GroupFilter       string `yaml:"group_filter"`
+	GroupAttribute    string `yaml:"group_attribute"`
+	MemberOfAttribute string `yaml:"member_of_attribute"`
+}
+
+// IssuingCAConfig describes an issuing CA besides the one configured by
+// ca_cert_path and ca_key_path
+type IssuingCAConfig struct {
+	CertPath  string `yaml:"cert_path"`
+	ChainPath string `yaml:"chain_path"`
+	// The key, per CA key backend: a file, a key on the PKCS#11 token or
+	// a key held by the remote signing service
+	KeyPath           string `yaml:"key_path"`
+	PKCS11KeyLabel    string `yaml:"pkcs11_key_label"`
+	PKCS11KeyID       string `yaml:"pkcs11_key_id"`
+	RemoteSignerKeyID string `yaml:"remote_signer_key_id"`
+	// ActivateAt is when issuance may switch to this CA; zero means at once
+	ActivateAt time.Time `yaml:"activate_at"`
+	// Where this CA's CRLs and certificate are published; each CA needs
+	// its own CRL URLs
+	CRLDistributionURL string `yaml:"crl_distribution_url"`
+	DeltaCRLURL        string `yaml:"delta_crl_url"`
+	AIAIssuerURL       string `yaml:"aia_issuer_url"`
+}
+
 // Load loads the configuration from the specified file
 func Load(configPath string) (*Config, error) {
 	data, err := os.ReadFile(configPath)
@@ -83,6 +359,145 @@ func Load(configPath string) (*Config, error) {
 	if config.Signer.LogFile == "" {
 		config.Signer.LogFile = "/var/spool/certM3/logs/signer/signer.log"
 	}
+	if config.Signer.CAKeyBackend == "" {
+		config.Signer.CAKeyBackend = "file"
+	}
+	if config.Signer.RemoteSignerTimeout == 0 {
+		config.Signer.RemoteSignerTimeout = 10 * time.Second
+	}
+	if config.Signer.GroupLookupTimeout == 0 {
+		config.Signer.GroupLookupTimeout = 5 * time.Second
+	}
+	if config.Signer.GroupLookupAttempts == 0 {
+		config.Signer.GroupLookupAttempts = 3
+	}
+	if config.Signer.GroupLookupBackoff == 0 {
+		config.Signer.GroupLookupBackoff = 200 * time.Millisecond
+	}
+	if config.Signer.GroupCacheTTL == 0 {
+		config.Signer.GroupCacheTTL = time.Minute
+	}
+	if config.Signer.GroupCacheMaxStale == 0 {
+		config.Signer.GroupCacheMaxStale = time.Hour
+	}
+	if config.Signer.GroupLookupFailure == "" {
+		config.Signer.GroupLookupFailure = "degrade"
+	}
+	if config.Signer.GroupSourceMode == "" {
+		config.Signer.GroupSourceMode = "union"
+	}
+	for i, src := range config.Signer.GroupSources {
+		if src.Type != "ldap" {
+			continue
+		}
+		if src.UserFilter == "" {
+			config.Signer.GroupSources[i].UserFilter = "(uid={username})"
+		}
+		if src.GroupBaseDN == "" {
+			config.Signer.GroupSources[i].GroupBaseDN = src.BaseDN
+		}
+		if src.GroupAttribute == "" {
+			config.Signer.GroupSources[i].GroupAttribute = "cn"
+		}
+		if src.MemberOfAttribute == "" {
+			config.Signer.GroupSources[i].MemberOfAttribute = "memberOf"
+		}
+	}
+	if config.Signer.HTTPListenAddr == "" {
+		config.Signer.HTTPListenAddr = ":8082"
+	}
+	if config.Signer.RevocationDBPath == "" {
+		config.Signer.RevocationDBPath = "/var/spool/certM3/signer/revocations.json"
+	}
+	if config.Signer.DeltaCRLURL == "" && config.Signer.CRLDistributionURL != "" {
+		config.Signer.DeltaCRLURL = strings.TrimSuffix(config.Signer.CRLDistributionURL, ".crl") + "-delta.crl"
+	}
+	for i, ca := range config.Signer.IssuingCAs {
+		if ca.DeltaCRLURL == "" && ca.CRLDistributionURL != "" {
+			config.Signer.IssuingCAs[i].DeltaCRLURL = strings.TrimSuffix(ca.CRLDistributionURL, ".crl") + "-delta.crl"
+		}
+	}
+	if config.Signer.CRLUpdateInterval == 0 {
+		config.Signer.CRLUpdateInterval = 24 * time.Hour
+	}
+	if config.Signer.CRLValidity == 0 {
+		config.Signer.CRLValidity = 48 * time.Hour
+	}
+	if config.Signer.DeltaCRLInterval == 0 {
+		config.Signer.DeltaCRLInterval = time.Hour
+	}
+	if config.Signer.OCSPValidity == 0 {
+		config.Signer.OCSPValidity = time.Hour
+	}
+	if config.Signer.OCSPSignerValidity == 0 {
+		config.Signer.OCSPSignerValidity = 7 * 24 * time.Hour
+	}
+	if config.Signer.IssuedDBPath == "" {
+		config.Signer.IssuedDBPath = "/var/spool/certM3/signer/issued.jsonl"
+	}
+	if config.Signer.RenewalOverlap == 0 {
+		config.Signer.RenewalOverlap = 24 * time.Hour
+	}
+	if config.Signer.SSHCertValidity == 0 {
+		config.Signer.SSHCertValidity = 16 * time.Hour
+	}
+	if len(config.Signer.SSHExtensions) == 0 {
+		config.Signer.SSHExtensions = []string{
+			"permit-X11-forwarding",
+			"permit-agent-forwarding",
+			"permit-port-forwarding",
+			"permit-pty",
+			"permit-user-rc",
+		}
+	}
+	if config.Signer.SocketMode == "" {
+		config.Signer.SocketMode = "0660"
+	}
+	if config.Signer.TicketSecretPath == "" {
+		config.Signer.TicketSecretPath = "/var/spool/certM3/mw/signer-ticket-secret"
+	}
+	if config.Signer.TicketTTL == 0 {
+		config.Signer.TicketTTL = time.Minute
+	}
+	if config.AppServer.CertificateOutboxPath == "" {
+		config.AppServer.CertificateOutboxPath = "/var/spool/certM3/mw/certificate-outbox.json"
+	}
+	if config.AppServer.ClientCAPath == "" {
+		config.AppServer.ClientCAPath = config.Signer.CACertPath
+	}
+	if config.AppServer.ACMEBaseURL == "" {
+		config.AppServer.ACMEBaseURL = "https://urp.ogt11.com/acme"
+	}
+	if config.AppServer.ACMEStatePath == "" {
+		config.AppServer.ACMEStatePath = "/var/spool/certM3/mw/acme.json"
+	}
+	if config.AppServer.ACMEOrderTTL == 0 {
+		config.AppServer.ACMEOrderTTL = 24 * time.Hour
+	}
+	if config.AppServer.ACMEAuthorizationTTL == 0 {
+		config.AppServer.ACMEAuthorizationTTL = 30 * 24 * time.Hour
+	}
+	if config.AppServer.ACMEEABKeyTTL == 0 {
+		config.AppServer.ACMEEABKeyTTL = 24 * time.Hour
+	}
+	if config.AppServer.ESTCodesPath == "" {
+		config.AppServer.ESTCodesPath = "/var/spool/certM3/mw/est-codes.json"
+	}
+	if config.AppServer.ESTCodeTTL == 0 {
+		config.AppServer.ESTCodeTTL = 7 * 24 * time.Hour
+	}
+	if config.AppServer.SignerTransport == "" {
+		config.AppServer.SignerTransport = "socket"
+	}
+	if config.AppServer.SignerGRPCAddr == "" {
+		config.AppServer.SignerGRPCAddr = "unix://" + config.Signer.SocketPath
+	}
+	if config.Signer.DefaultProfile == "" {
+		config.Signer.DefaultProfile = "user-client"
+		if len(config.Signer.Profiles) == 0 {
+			config.Signer.DefaultProfile = "default"
+		}
+	}
 	if config.AppServer.ListenAddr == "" {
 		config.AppServer.ListenAddr = ":8080"
 	}
@@ -110,6 +525,13 @@ func Load(configPath string) (*Config, error) {
 		}
 	}
 
+	// Load the signing ticket secret the same way
+	if config.Signer.TicketSecret == "" {
+		if ticketSecret, err := os.ReadFile(config.Signer.TicketSecretPath); err == nil {
+			config.Signer.TicketSecret = strings.TrimSpace(string(ticketSecret))
+		}
+	}
+
 	return &config, nil
 }
 
@@ -154,17 +576,47 @@ func (c *Config) Validate() error {
 	if c.Signer.SocketPath == "" {
 		return fmt.Errorf("SIGNER_SOCKET_PATH is required")
 	}
-	if c.Signer.CACertPath == "" {
+	// A PKCS#12 key file can carry the CA certificate instead
+	if c.Signer.CACertPath == "" && c.Signer.CAKeyBackend != "file" {
 		return fmt.Errorf("CA_CERT_PATH is required")
 	}
-	if c.Signer.CAKeyPath == "" {
-		return fmt.Errorf("CA_KEY_PATH is required")
+	if c.Signer.CACertPath != "" {
+		if _, err := os.Stat(c.Signer.CACertPath); err != nil {
+			return fmt.Errorf("CA certificate not found: %v", err)
+		}
 	}
-	if _, err := os.Stat(c.Signer.CACertPath); err != nil {
-		return fmt.Errorf("CA certificate not found: %v", err)
+	if c.Signer.CAChainPath != "" {
+		if _, err := os.Stat(c.Signer.CAChainPath); err != nil {
+			return fmt.Errorf("CA chain not found: %v", err)
+		}
+	}
+	switch c.Signer.CAKeyBackend {
+	case "file":
+		if c.Signer.CAKeyPath == "" {
+			return fmt.Errorf("CA_KEY_PATH is required")
+		}
+		if _, err := os.Stat(c.Signer.CAKeyPath); err != nil {
+			return fmt.Errorf("CA key not found: %v", err)
+		}
+	case "pkcs11":
+		if c.Signer.PKCS11ModulePath == "" {
+			return fmt.Errorf("pkcs11_module_path is required for the pkcs11 CA key backend")
+		}
+		if c.Signer.PKCS11TokenLabel == "" && c.Signer.PKCS11TokenSerial == "" {
+			return fmt.Errorf("pkcs11_token_label or pkcs11_token_serial is required for the pkcs11 CA key backend")
+		}
+		if c.Signer.PKCS11KeyLabel == "" && c.Signer.PKCS11KeyID == "" {
+			return fmt.Errorf("pkcs11_key_label or pkcs11_key_id is required for the pkcs11 CA key backend")
+		}
+	case "remote":
+		if c.Signer.RemoteSignerURL == "" {
+			return fmt.Errorf("remote_signer_url is required for the remote CA key backend")
+		}
+	default:
+		return fmt.Errorf("invalid ca_key_backend %q: expected file, pkcs11 or remote", c.Signer.CAKeyBackend)
 	}
-	if _, err := os.Stat(c.Signer.CAKeyPath); err != nil {
-		return fmt.Errorf("CA key not found: %v", err)
+	if err := c.validateIssuingCAs(); err != nil {
+		return err
 	}
 	if c.Signer.SubjectOU == "" {
 		return fmt.Errorf("SIGNER_SUBJECT_OU is required")
@@ -203,6 +655,109 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("SIGNER_EXTENDED_KEY_USAGE is required")
 	}
 
+	if c.Signer.CRLUpdateInterval < 0 || c.Signer.DeltaCRLInterval < 0 {
+		return fmt.Errorf("CRL update intervals must be non-negative")
+	}
+	if c.Signer.CRLValidity < c.Signer.CRLUpdateInterval {
+		return fmt.Errorf("crl_validity must be at least crl_update_interval")
+	}
+	if mode, err := strconv.ParseUint(c.Signer.SocketMode, 8, 32); err != nil || mode > 0777 {
+		return fmt.Errorf("invalid socket_mode %q: expected an octal permission such as 0660", c.Signer.SocketMode)
+	}
+	if c.Signer.TicketSecret == "" {
+		return fmt.Errorf("SIGNER_TICKET_SECRET is required")
+	}
+	if c.Signer.TicketTTL < 0 {
+		return fmt.Errorf("ticket_ttl must be non-negative")
+	}
+	if c.Signer.OCSPValidity < 0 || c.Signer.OCSPSignerValidity < 0 {
+		return fmt.Errorf("OCSP validity periods must be non-negative")
+	}
+	if c.Signer.RenewalOverlap < 0 {
+		return fmt.Errorf("renewal_overlap must be non-negative")
+	}
+
+	if c.Signer.SSHCertValidity < 0 {
+		return fmt.Errorf("ssh_cert_validity must be non-negative")
+	}
+	for option := range c.Signer.SSHCriticalOptions {
+		switch option {
+		case "force-command", "source-address", "verify-required":
+		default:
+			return fmt.Errorf("unknown SSH critical option %q", option)
+		}
+	}
+	if (c.Signer.SSHCAKeyURL != "" || c.Signer.SSHKRLURL != "") && c.Signer.SSHCAKeyPath == "" {
+		return fmt.Errorf("ssh_ca_key_url and ssh_krl_url require ssh_ca_key_path")
+	}
+
+	if c.Signer.GRPCListenAddr != "" && (c.Signer.GRPCCertPath == "" || c.Signer.GRPCKeyPath == "" || c.Signer.GRPCClientCAPath == "") {
+		return fmt.Errorf("grpc_listen_addr requires grpc_cert_path, grpc_key_path and grpc_client_ca_path")
+	}
+
+	if len(c.Signer.Profiles) > 0 {
+		if _, ok := c.Signer.Profiles[c.Signer.DefaultProfile]; !ok {
+			return fmt.Errorf("default_profile %q is not a configured profile", c.Signer.DefaultProfile)
+		}
+		for name, profile := range c.Signer.Profiles {
+			if profile.ValidityDays < 0 || profile.Validity < 0 {
+				return fmt.Errorf("profile %s: validity must be non-negative", name)
+			}
+			if profile.GroupLookupFailure != "" && !validGroupLookupFailure(profile.GroupLookupFailure) {
+				return fmt.Errorf("profile %s: invalid group_lookup_failure %q: expected deny, degrade or stale", name, profile.GroupLookupFailure)
+			}
+		}
+	}
+	if !validGroupLookupFailure(c.Signer.GroupLookupFailure) {
+		return fmt.Errorf("invalid group_lookup_failure %q: expected deny, degrade or stale", c.Signer.GroupLookupFailure)
+	}
+	if c.Signer.GroupLookupAttempts < 1 || c.Signer.GroupCacheTTL < 0 || c.Signer.GroupCacheMaxStale < 0 {
+		return fmt.Errorf("group_lookup_attempts must be positive and the group cache times non-negative")
+	}
+	if (c.Signer.GroupLookupCertPath == "") != (c.Signer.GroupLookupKeyPath == "") {
+		return fmt.Errorf("group_lookup_cert_path and group_lookup_key_path must be set together")
+	}
+	if err := c.validateGroupSources(); err != nil {
+		return err
+	}
+	if c.Signer.PolicyPath != "" {
+		if _, err := os.Stat(c.Signer.PolicyPath); err != nil {
+			return fmt.Errorf("policy_path: %v", err)
+		}
+	}
+	for i, mapping := range c.Signer.RoleMappings {
+		if mapping.Role == "" || len(mapping.Groups) == 0 {
+			return fmt.Errorf("role_mappings[%d]: groups and role are required", i)
+		}
+	}
+
+	switch c.AppServer.SignerTransport {
+	case "socket", "grpc":
+	default:
+		return fmt.Errorf("invalid signer_transport %q: expected socket or grpc", c.AppServer.SignerTransport)
+	}
+	if (c.AppServer.SignerGRPCCertPath == "") != (c.AppServer.SignerGRPCKeyPath == "") {
+		return fmt.Errorf("signer_grpc_cert_path and signer_grpc_key_path must be set together")
+	}
+
+	if c.AppServer.ClientCertHeader != "" && c.AppServer.ClientCAPath == "" {
+		return fmt.Errorf("client_ca_path is required with client_cert_header")
+	}
+
+	if c.AppServer.ACMEEnabled {
+		u, err := url.Parse(c.AppServer.ACMEBaseURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("acme_base_url must be an absolute URL")
+		}
+		if c.AppServer.ACMEOrderTTL < 0 || c.AppServer.ACMEAuthorizationTTL < 0 || c.AppServer.ACMEEABKeyTTL < 0 {
+			return fmt.Errorf("ACME lifetimes must be non-negative")
+		}
+	}
+
+	if c.AppServer.ESTCodeTTL < 0 {
+		return fmt.Errorf("est_code_ttl must be non-negative")
+	}
+
 	if c.AppServer.RateLimitPerIP < 0 {
 		return fmt.Errorf("rate limit per IP must be non-negative")
 	}
@@ -214,6 +769,99 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// validateIssuingCAs checks the additional issuing CAs. Every CA publishes
+// its own CRLs, so their URLs must differ from each other's.
+func (c *Config) validateIssuingCAs() error {
+	crlURLs := map[string]bool{c.Signer.CRLDistributionURL: true}
+	if c.Signer.DeltaCRLURL != "" {
+		crlURLs[c.Signer.DeltaCRLURL] = true
+	}
+	for i, ca := range c.Signer.IssuingCAs {
+		if ca.CertPath == "" {
+			return fmt.Errorf("issuing_cas[%d]: cert_path is required", i)
+		}
+		for _, path := range []string{ca.CertPath, ca.ChainPath} {
+			if path == "" {
+				continue
+			}
+			if _, err := os.Stat(path); err != nil {
+				return fmt.Errorf("issuing_cas[%d]: %v", i, err)
+			}
+		}
+		switch c.Signer.CAKeyBackend {
+		case "file":
+			if ca.KeyPath == "" {
+				return fmt.Errorf("issuing_cas[%d]: key_path is required", i)
+			}
+			if _, err := os.Stat(ca.KeyPath); err != nil {
+				return fmt.Errorf("issuing_cas[%d]: CA key not found: %v", i, err)
+			}
+		case "pkcs11":
+			if ca.PKCS11KeyLabel == "" && ca.PKCS11KeyID == "" {
+				return fmt.Errorf("issuing_cas[%d]: pkcs11_key_label or pkcs11_key_id is required", i)
+			}
+		case "remote":
+			if ca.RemoteSignerKeyID == "" {
+				return fmt.Errorf("issuing_cas[%d]: remote_signer_key_id is required", i)
+			}
+		}
+		if ca.CRLDistributionURL == "" {
+			return fmt.Errorf("issuing_cas[%d]: crl_distribution_url is required", i)
+		}
+		for _, u := range []string{ca.CRLDistributionURL, ca.DeltaCRLURL} {
+			if u == "" {
+				continue
+			}
+			if crlURLs[u] {
+				return fmt.Errorf("issuing_cas[%d]: CRL URL %s is already used by another CA", i, u)
+			}
+			crlURLs[u] = true
+		}
+	}
+	return nil
+}
+
+// validateGroupSources checks the sources of group membership
+func (c *Config) validateGroupSources() error {
+	switch c.Signer.GroupSourceMode {
+	case "union", "intersection":
+	default:
+		return fmt.Errorf("invalid group_source_mode %q: expected union or intersection", c.Signer.GroupSourceMode)
+	}
+	for i, src := range c.Signer.GroupSources {
+		switch src.Type {
+		case "backend":
+		case "static":
+			if src.Path == "" {
+				return fmt.Errorf("group_sources[%d]: path is required for a static source", i)
+			}
+			if _, err := os.Stat(src.Path); err != nil {
+				return fmt.Errorf("group_sources[%d]: %v", i, err)
+			}
+		case "ldap":
+			if src.URL == "" || src.BaseDN == "" {
+				return fmt.Errorf("group_sources[%d]: url and base_dn are required for an LDAP source", i)
+			}
+			if src.BindDN != "" && src.BindPasswordPath == "" {
+				return fmt.Errorf("group_sources[%d]: bind_dn requires bind_password_path", i)
+			}
+		default:
+			return fmt.Errorf("group_sources[%d]: invalid type %q: expected backend, ldap or static", i, src.Type)
+		}
+	}
+	return nil
+}
+
+// validGroupLookupFailure reports whether mode is a group lookup failure
+// mode
+func validGroupLookupFailure(mode string) bool {
+	switch mode {
+	case "deny", "degrade", "stale":
+		return true
+	}
+	return false
+}
+
 // GetEnvInt gets an integer value from environment variable with fallback
 func GetEnvInt(key string, fallback int) int {
 	if value, exists := os.LookupEnv(key); exists {
@@ -0,0 +1,78 @@
+// Package pkcs7 encodes and decodes the "certs-only" PKCS#7 (CMS) messages
+// EST and other enrollment protocols use to carry certificates: a SignedData
+// with no content and no signers (RFC 5652 section 5, RFC 8551 section
+// 3.2.2).
+package pkcs7
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+)
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // [0] EXPLICIT
+}
+
+type encapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue // empty SET
+	ContentInfo      encapsulatedContentInfo
+	Certificates     asn1.RawValue // [0] IMPLICIT SET OF Certificate
+	SignerInfos      asn1.RawValue // empty SET
+}
+
+// emptySet is an empty SET
+var emptySet = asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}
+
+// EncodeCertsOnly returns the DER certs-only message carrying the DER
+// certificates, in order
+func EncodeCertsOnly(certs [][]byte) ([]byte, error) {
+	var set []byte
+	for _, cert := range certs {
+		set = append(set, cert...)
+	}
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		ContentInfo:      encapsulatedContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: set},
+		SignerInfos:      emptySet,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SignedData: %v", err)
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
+
+// ParseCertsOnly returns the certificates in a DER certs-only message
+func ParseCertsOnly(der []byte) ([]*x509.Certificate, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("invalid PKCS#7 ContentInfo")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("PKCS#7 content is not SignedData")
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#7 SignedData: %v", err)
+	}
+	if sd.Certificates.Class != asn1.ClassContextSpecific || sd.Certificates.Tag != 0 {
+		return nil, fmt.Errorf("PKCS#7 SignedData has no certificates")
+	}
+	return x509.ParseCertificates(sd.Certificates.Bytes)
+}
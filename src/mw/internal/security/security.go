@@ -14,6 +14,7 @@ import (
 // JWTClaims represents the claims in a JWT token
 type JWTClaims struct {
 	UserID    string `json:"user_id"`
+	Username  string `json:"username,omitempty"`
 	RequestID string `json:"request_id"`
 	jwt.RegisteredClaims
 }
@@ -35,9 +36,10 @@ func NewJWTManager(secret, issuer, audience string) *JWTManager {
 }
 
 // GenerateToken generates a new JWT token
-func (m *JWTManager) GenerateToken(userID, requestID string) (string, error) {
+func (m *JWTManager) GenerateToken(userID, username, requestID string) (string, error) {
 	claims := JWTClaims{
 		UserID:    userID,
+		Username:  username,
 		RequestID: requestID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
@@ -0,0 +1,82 @@
+package security
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTicketRoundTrip(t *testing.T) {
+	m := NewTicketManager("secret", time.Minute)
+	payload := IssuancePayload([]byte("csr"), "user-client", []string{"developers"})
+	token, err := m.IssueTicket("1", "alice", "req-1", TicketActionSign, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := m.VerifyTicket(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != "1" || claims.Username != "alice" || claims.RequestID != "req-1" || claims.Action != TicketActionSign {
+		t.Errorf("claims = %+v", claims)
+	}
+	if claims.Digest != PayloadDigest(payload) {
+		t.Error("ticket digest does not match its payload")
+	}
+	if claims.ID == "" {
+		t.Error("ticket has no ID")
+	}
+
+	if _, err := NewTicketManager("other", time.Minute).VerifyTicket(token); err == nil {
+		t.Error("verified a ticket signed with another secret")
+	}
+}
+
+func TestVerifyTicketRejectsLongLivedTickets(t *testing.T) {
+	m := NewTicketManager("secret", time.Minute)
+	now := time.Now()
+	claims := TicketClaims{
+		UserID:    "1",
+		Username:  "alice",
+		RequestID: "req-1",
+		Action:    TicketActionSign,
+		Digest:    PayloadDigest([]byte("csr")),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti",
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    ticketIssuer,
+			Audience:  []string{ticketAudience},
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.VerifyTicket(token); err == nil {
+		t.Error("verified a ticket living longer than the TTL")
+	}
+}
+
+func TestIssuancePayload(t *testing.T) {
+	base := IssuancePayload([]byte("csr"), "user-client", []string{"developers"})
+	others := map[string][]byte{
+		"subject":     IssuancePayload([]byte("csr2"), "user-client", []string{"developers"}),
+		"profile":     IssuancePayload([]byte("csr"), "service", []string{"developers"}),
+		"no profile":  IssuancePayload([]byte("csr"), "", []string{"developers"}),
+		"groups":      IssuancePayload([]byte("csr"), "user-client", []string{"developers", "admins"}),
+		"no groups":   IssuancePayload([]byte("csr"), "user-client", nil),
+		"group split": IssuancePayload([]byte("csr"), "user-client", []string{"develop", "ers"}),
+	}
+	for name, payload := range others {
+		if bytes.Equal(payload, base) {
+			t.Errorf("changing the %s leaves the payload unchanged", name)
+		}
+	}
+	if !bytes.Equal(base, IssuancePayload([]byte("csr"), "user-client", []string{"developers"})) {
+		t.Error("payload is not deterministic")
+	}
+}
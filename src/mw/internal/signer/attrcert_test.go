@@ -0,0 +1,172 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+// parseAttributeCertificate decodes a PEM attribute certificate, checks ca
+// signed it and returns its contents
+func parseAttributeCertificate(t *testing.T, acPEM []byte, ca *ecdsa.PublicKey) *attributeCertificateInfo {
+	t.Helper()
+	block, _ := pem.Decode(acPEM)
+	if block == nil || block.Type != "ATTRIBUTE CERTIFICATE" {
+		t.Fatalf("no attribute certificate in %q", acPEM)
+	}
+	var ac attributeCertificate
+	if rest, err := asn1.Unmarshal(block.Bytes, &ac); err != nil || len(rest) > 0 {
+		t.Fatalf("invalid attribute certificate: %v", err)
+	}
+	var info attributeCertificateInfo
+	if rest, err := asn1.Unmarshal(ac.Info.FullBytes, &info); err != nil || len(rest) > 0 {
+		t.Fatalf("invalid attribute certificate info: %v", err)
+	}
+	if !ac.SignatureAlgorithm.Algorithm.Equal(oidSignatureECDSAWithSHA256) || !info.SignatureAlgorithm.Algorithm.Equal(oidSignatureECDSAWithSHA256) {
+		t.Errorf("signature algorithm = %v, want ECDSA with SHA-256", ac.SignatureAlgorithm.Algorithm)
+	}
+	digest := sha256.Sum256(ac.Info.FullBytes)
+	if !ecdsa.VerifyASN1(ca, digest[:], ac.Signature.Bytes) {
+		t.Error("attribute certificate not signed by the CA")
+	}
+	return &info
+}
+
+// attributeValues returns the group names or role URIs of an attribute
+func attributeValues(t *testing.T, attr acAttribute) []string {
+	t.Helper()
+	var values []string
+	switch {
+	case attr.Type.Equal(oidAttributeGroup):
+		var groups ietfAttrSyntax
+		if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &groups); err != nil {
+			t.Fatal(err)
+		}
+		for _, value := range groups.Values {
+			values = append(values, string(value.Bytes))
+		}
+	case attr.Type.Equal(oidAttributeRole):
+		for _, value := range attr.Values {
+			var role roleSyntax
+			if _, err := asn1.Unmarshal(value.FullBytes, &role); err != nil {
+				t.Fatal(err)
+			}
+			var uri asn1.RawValue
+			if _, err := asn1.Unmarshal(role.RoleName.Bytes, &uri); err != nil {
+				t.Fatal(err)
+			}
+			values = append(values, string(uri.Bytes))
+		}
+	default:
+		t.Fatalf("unexpected attribute %v", attr.Type)
+	}
+	return values
+}
+
+func TestIssueAttributeCertificate(t *testing.T) {
+	s, _ := newConfiguredSigner(t, func(cfg *config.Config) {
+		cfg.Signer.RoleExtensionOID = testRoleOID
+		cfg.Signer.RoleMappings = []config.RoleMappingConfig{{Groups: []string{"eng-*"}, Role: "developer"}}
+		cfg.Signer.Profiles = map[string]config.ProfileConfig{
+			"default": {},
+			"ac": {
+				GroupEncodings:               []string{GroupEncodingAttrCert},
+				AttributeCertificateValidity: time.Hour,
+			},
+		}
+	})
+	s.SetGroupSource(staticGroups{"alice": {"eng-core", "ops"}, "bob": {"ops"}})
+	caKey := &s.cas[0].Key.(*ecdsa.PrivateKey).PublicKey
+
+	certPEM, err := s.SignCSR(makeCSR(t, "alice"), []string{"eng-core", "ops"}, "ac", Identity{Username: "alice", RequestID: "req-ac"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := parseCertificate(t, certPEM)
+	if hasGroupExtension(cert) {
+		t.Error("attribute certificate profile put the groups in the certificate")
+	}
+	if !s.issuesAttributeCertificate(cert.SerialNumber) {
+		t.Error("certificate not marked as holding attribute certificates")
+	}
+
+	acPEM, err := s.IssueAttributeCertificate(cert.SerialNumber, nil, Identity{Username: "alice", RequestID: "req-ac-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := parseAttributeCertificate(t, acPEM, caKey)
+	if info.Holder.BaseCertificateID.Serial.Cmp(cert.SerialNumber) != 0 {
+		t.Errorf("holder serial = %s, want %s", info.Holder.BaseCertificateID.Serial.Text(16), cert.SerialNumber.Text(16))
+	}
+	if got := info.Validity.NotAfter.Sub(info.Validity.NotBefore); got != time.Hour {
+		t.Errorf("validity = %s, want the profile's 1h", got)
+	}
+	if len(info.Attributes) != 2 {
+		t.Fatalf("%d attributes, want groups and roles", len(info.Attributes))
+	}
+	if groups := attributeValues(t, info.Attributes[0]); !reflect.DeepEqual(groups, []string{"alice", "eng-core", "ops", "users"}) {
+		t.Errorf("groups = %v", groups)
+	}
+	if roles := attributeValues(t, info.Attributes[1]); !reflect.DeepEqual(roles, []string{roleURIPrefix + "developer"}) {
+		t.Errorf("roles = %v", roles)
+	}
+
+	// Groups asked for are authorized afresh
+	acPEM, err = s.IssueAttributeCertificate(cert.SerialNumber, []string{"ops", "admins"}, Identity{Username: "alice", RequestID: "req-ac-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info = parseAttributeCertificate(t, acPEM, caKey)
+	if len(info.Attributes) != 1 || !reflect.DeepEqual(attributeValues(t, info.Attributes[0]), []string{"alice", "ops", "users"}) {
+		t.Errorf("attribute certificate for ops has %d attributes", len(info.Attributes))
+	}
+
+	// Another user's certificate is unknown to the caller
+	_, err = s.IssueAttributeCertificate(cert.SerialNumber, nil, Identity{Username: "bob", RequestID: "req-ac-3"})
+	if !errors.Is(err, ErrUnknownCertificate) {
+		t.Errorf("holder of another user: %v, want ErrUnknownCertificate", err)
+	}
+	if code := signError(err).Code; code != signerproto.CodeNotFound {
+		t.Errorf("code = %v, want CodeNotFound", code)
+	}
+
+	plain := issue(t, s, "alice", []string{"ops"})
+	if _, err := s.IssueAttributeCertificate(plain.SerialNumber, nil, Identity{Username: "alice", RequestID: "req-ac-4"}); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("holder under a profile without attribute certificates: %v, want ErrPolicyDenied", err)
+	}
+	if _, err := s.Revoke(cert.SerialNumber, ReasonKeyCompromise); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.IssueAttributeCertificate(cert.SerialNumber, nil, Identity{Username: "alice", RequestID: "req-ac-5"}); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("revoked holder: %v, want ErrPolicyDenied", err)
+	}
+}
+
+func TestAttributeCertificateFailureRecordsNothing(t *testing.T) {
+	s, _ := newConfiguredSigner(t, func(cfg *config.Config) {
+		cfg.Signer.Profiles = map[string]config.ProfileConfig{
+			"default": {},
+			"ac":      {GroupEncodings: []string{GroupEncodingAttrCert}},
+		}
+	})
+	s.SetPolicy(loadTestPolicy(t, "mandatory_groups: []\n"))
+	s.SetGroupSource(staticGroups{"alice": {}})
+
+	// Without groups there is no attribute certificate to issue, so the
+	// certificate it would go with must not be issued either
+	certPEM, acPEM, err := s.signCSR(makeCSR(t, "alice"), nil, "ac", Identity{Username: "alice", RequestID: "req-ac"}, "")
+	if !errors.Is(err, ErrPolicyDenied) || certPEM != nil || acPEM != nil {
+		t.Errorf("attribute certificate without groups: err = %v, want ErrPolicyDenied and nothing issued", err)
+	}
+	if records := s.issued.ByUser("alice"); len(records) != 0 {
+		t.Errorf("ledger records %d certificates, want none", len(records))
+	}
+}
@@ -0,0 +1,345 @@
+package signer
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// OIDs for CRL related extensions
+var (
+	oidExtensionDeltaCRLIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+	oidExtensionFreshestCRL       = asn1.ObjectIdentifier{2, 5, 29, 46}
+)
+
+// distributionPoint mirrors the RFC 5280 DistributionPoint structure used by
+// both the CRL Distribution Points and Freshest CRL extensions
+type distributionPoint struct {
+	DistributionPoint distributionPointName `asn1:"optional,tag:0"`
+}
+
+type distributionPointName struct {
+	FullName []asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// marshalDistributionPoints encodes urls as a CRLDistributionPoints syntax
+// value with one distribution point per URL
+func marshalDistributionPoints(urls []string) ([]byte, error) {
+	var points []distributionPoint
+	for _, u := range urls {
+		points = append(points, distributionPoint{
+			DistributionPoint: distributionPointName{
+				FullName: []asn1.RawValue{{Tag: 6, Class: asn1.ClassContextSpecific, Bytes: []byte(u)}},
+			},
+		})
+	}
+	return asn1.Marshal(points)
+}
+
+// crlCache holds the most recently generated CRLs in DER form, by the
+// fingerprint of the issuing CA certificate. The CRLs of all CAs are
+// generated together from one revocation snapshot, so they share numbers
+// and delta CRL bases.
+type crlCache struct {
+	gen             sync.Mutex // serializes generation
+	mu              sync.RWMutex
+	full            map[string][]byte
+	fullNextUpdate  time.Time
+	delta           map[string][]byte
+	deltaNextUpdate time.Time
+}
+
+// Revoke marks the certificate with the given serial as revoked and
+// regenerates the delta CRL so the change is published immediately. SSH
+// certificates go on the KRL instead.
+func (s *Signer) Revoke(serial *big.Int, reason int) (RevocationEntry, error) {
+	if record, ok := s.issued.Lookup(serial); ok && record.Type == RecordTypeSSH {
+		return s.revokeSSH(serial, record, reason)
+	}
+
+	entry, err := s.revocations.Revoke(serial, reason)
+	if err != nil {
+		return RevocationEntry{}, fmt.Errorf("failed to record revocation: %v", err)
+	}
+	if err := s.issued.MarkRevoked(serial, entry.RevokedAt, entry.Reason); err != nil {
+		s.logger.Errorf("Failed to record revocation of %s in the issued index: %v", entry.Serial, err)
+	}
+	s.logger.Infof("Revoked certificate serial %s with reason %d", entry.Serial, entry.Reason)
+	s.metrics.RecordRevocation(reason)
+
+	if _, err := s.GenerateDeltaCRL(); err != nil {
+		s.logger.Errorf("Failed to regenerate delta CRL after revoking %s: %v", entry.Serial, err)
+	}
+	return entry, nil
+}
+
+// GenerateCRL creates and caches a new full CRL for each CA still
+// publishing, listing every certificate it issued that was revoked, and
+// returns that of the current CA. The CRLs become the base for subsequent
+// delta CRLs.
+func (s *Signer) GenerateCRL() ([]byte, error) {
+	s.crls.gen.Lock()
+	defer s.crls.gen.Unlock()
+	return s.generateFullCRL()
+}
+
+// GenerateDeltaCRL creates and caches a new delta CRL for each CA still
+// publishing, listing the certificates revoked since the current base CRL,
+// and returns that of the current CA. Full CRLs are generated first if a
+// CA has none yet.
+func (s *Signer) GenerateDeltaCRL() ([]byte, error) {
+	s.crls.gen.Lock()
+	defer s.crls.gen.Unlock()
+
+	s.caMu.RLock()
+	haveBase := true
+	s.crls.mu.RLock()
+	for _, iss := range s.liveIssuersLocked() {
+		if s.crls.full[iss.fingerprint] == nil {
+			haveBase = false
+		}
+	}
+	s.crls.mu.RUnlock()
+	s.caMu.RUnlock()
+	if !haveBase {
+		if _, err := s.generateFullCRL(); err != nil {
+			return nil, err
+		}
+	}
+	return s.generateDeltaCRL()
+}
+
+// generateFullCRL builds the full CRLs; callers must hold crls.gen
+func (s *Signer) generateFullCRL() ([]byte, error) {
+	s.caMu.RLock()
+	defer s.caMu.RUnlock()
+
+	snap, err := s.revocations.snapshot(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot revocation store: %v", err)
+	}
+
+	nextUpdate := snap.ThisUpdate.Add(s.config.Signer.CRLValidity)
+	crls := make(map[string][]byte)
+	for _, iss := range s.liveIssuersLocked() {
+		template := &x509.RevocationList{
+			Number:     big.NewInt(snap.Number),
+			ThisUpdate: snap.ThisUpdate,
+			NextUpdate: nextUpdate,
+		}
+		if iss.DeltaCRLURL != "" {
+			freshest, err := marshalDistributionPoints([]string{iss.DeltaCRLURL})
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode freshest CRL extension: %v", err)
+			}
+			template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+				Id:    oidExtensionFreshestCRL,
+				Value: freshest,
+			})
+		}
+
+		entries := s.issuerEntries(iss, snap.Entries)
+		der, err := s.createCRL(template, entries, iss)
+		if err != nil {
+			return nil, err
+		}
+		crls[iss.fingerprint] = der
+		s.logger.Infof("Generated full CRL number %d for %s with %d entries", snap.Number, iss.Certificate.Subject.String(), len(entries))
+		s.metrics.RecordCRLGeneration("full", len(entries))
+	}
+
+	s.crls.mu.Lock()
+	s.crls.full = crls
+	s.crls.fullNextUpdate = nextUpdate
+	s.crls.delta = nil
+	s.crls.mu.Unlock()
+	return s.currentCRLLocked(crls), nil
+}
+
+// generateDeltaCRL builds the delta CRLs; callers must hold crls.gen
+func (s *Signer) generateDeltaCRL() ([]byte, error) {
+	s.caMu.RLock()
+	defer s.caMu.RUnlock()
+
+	snap, err := s.revocations.snapshot(false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot revocation store: %v", err)
+	}
+
+	// The delta indicator is critical and carries the base CRL number
+	baseNumber, err := asn1.Marshal(big.NewInt(snap.BaseNumber))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode delta CRL indicator: %v", err)
+	}
+
+	nextUpdate := snap.ThisUpdate.Add(2 * s.config.Signer.DeltaCRLInterval)
+	crls := make(map[string][]byte)
+	for _, iss := range s.liveIssuersLocked() {
+		template := &x509.RevocationList{
+			Number:     big.NewInt(snap.Number),
+			ThisUpdate: snap.ThisUpdate,
+			NextUpdate: nextUpdate,
+			ExtraExtensions: []pkix.Extension{{
+				Id:       oidExtensionDeltaCRLIndicator,
+				Critical: true,
+				Value:    baseNumber,
+			}},
+		}
+
+		entries := s.issuerEntries(iss, snap.Entries)
+		der, err := s.createCRL(template, entries, iss)
+		if err != nil {
+			return nil, err
+		}
+		crls[iss.fingerprint] = der
+		s.logger.Infof("Generated delta CRL number %d (base %d) for %s with %d entries", snap.Number, snap.BaseNumber, iss.Certificate.Subject.String(), len(entries))
+		s.metrics.RecordCRLGeneration("delta", len(entries))
+	}
+
+	s.crls.mu.Lock()
+	s.crls.delta = crls
+	s.crls.deltaNextUpdate = nextUpdate
+	s.crls.mu.Unlock()
+	return s.currentCRLLocked(crls), nil
+}
+
+// currentCRLLocked returns the current CA's CRL from crls; callers must
+// hold caMu
+func (s *Signer) currentCRLLocked(crls map[string][]byte) []byte {
+	if current := newestActive(s.cas, time.Now()); current != nil {
+		return crls[current.fingerprint]
+	}
+	return nil
+}
+
+// issuerEntries returns the entries for certificates iss issued. Serials
+// the ledger does not know, revoked before it tracked issuers, are listed
+// by every CA.
+func (s *Signer) issuerEntries(iss *issuer, entries []RevocationEntry) []RevocationEntry {
+	var own []RevocationEntry
+	for _, entry := range entries {
+		if record, ok := s.issued.Lookup(entry.SerialNumber()); ok && record.Issuer != "" && record.Issuer != iss.id {
+			continue
+		}
+		own = append(own, entry)
+	}
+	return own
+}
+
+// createCRL signs template with the CA key after filling in entries
+func (s *Signer) createCRL(template *x509.RevocationList, entries []RevocationEntry, iss *issuer) ([]byte, error) {
+	for _, entry := range entries {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   entry.SerialNumber(),
+			RevocationTime: entry.RevokedAt,
+			ReasonCode:     entry.Reason,
+		})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, iss.Certificate, iss.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CRL for %s: %v", iss.Certificate.Subject.String(), err)
+	}
+	return der, nil
+}
+
+// currentCRL returns the cached CRL of the requested kind for iss,
+// regenerating the CRLs on demand when it is missing or past its next
+// update time
+func (s *Signer) currentCRL(iss *issuer, delta bool) ([]byte, error) {
+	s.crls.mu.RLock()
+	der, nextUpdate := s.crls.full[iss.fingerprint], s.crls.fullNextUpdate
+	if delta {
+		der, nextUpdate = s.crls.delta[iss.fingerprint], s.crls.deltaNextUpdate
+	}
+	s.crls.mu.RUnlock()
+
+	if der != nil && time.Now().Before(nextUpdate) {
+		return der, nil
+	}
+	var err error
+	if delta {
+		_, err = s.GenerateDeltaCRL()
+	} else {
+		_, err = s.GenerateCRL()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.crls.mu.RLock()
+	defer s.crls.mu.RUnlock()
+	if delta {
+		der = s.crls.delta[iss.fingerprint]
+	} else {
+		der = s.crls.full[iss.fingerprint]
+	}
+	if der == nil {
+		return nil, fmt.Errorf("CA %s no longer publishes CRLs", iss.Certificate.Subject.String())
+	}
+	return der, nil
+}
+
+// RunCRLScheduler regenerates the full and delta CRLs at the configured
+// intervals until stop is closed. Renewed certificates whose overlap has
+// passed are revoked on the delta schedule.
+func (s *Signer) RunCRLScheduler(stop <-chan struct{}) {
+	s.RevokeSuperseded()
+	if _, err := s.GenerateCRL(); err != nil {
+		s.logger.Errorf("Failed to generate initial CRL: %v", err)
+	}
+
+	fullTicker := time.NewTicker(s.config.Signer.CRLUpdateInterval)
+	defer fullTicker.Stop()
+	deltaTicker := time.NewTicker(s.config.Signer.DeltaCRLInterval)
+	defer deltaTicker.Stop()
+
+	for {
+		select {
+		case <-fullTicker.C:
+			if _, err := s.GenerateCRL(); err != nil {
+				s.logger.Errorf("Scheduled full CRL generation failed: %v", err)
+			}
+		case <-deltaTicker.C:
+			s.RevokeSuperseded()
+			if _, err := s.GenerateDeltaCRL(); err != nil {
+				s.logger.Errorf("Scheduled delta CRL generation failed: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// serveCRL returns a handler writing the current full or delta CRL of the
+// CA publishing at path
+func (s *Signer) serveCRL(path string, delta bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		iss := s.crlIssuer(path, delta)
+		if iss == nil {
+			http.NotFound(w, r)
+			return
+		}
+		der, err := s.currentCRL(iss, delta)
+		if err != nil {
+			s.logger.Errorf("Failed to serve CRL: %v", err)
+			http.Error(w, "CRL unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pkix-crl")
+		w.Header().Set("Cache-Control", "max-age=300")
+		w.Write(der)
+	}
+}
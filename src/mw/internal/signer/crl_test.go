@@ -0,0 +1,118 @@
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+)
+
+func parseCRL(t *testing.T, der []byte, ca *x509.Certificate) *x509.RevocationList {
+	t.Helper()
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(ca); err != nil {
+		t.Fatalf("CRL not signed by the CA: %v", err)
+	}
+	return crl
+}
+
+func revokedSerials(crl *x509.RevocationList) map[string]int {
+	serials := make(map[string]int)
+	for _, entry := range crl.RevokedCertificateEntries {
+		serials[entry.SerialNumber.Text(16)] = entry.ReasonCode
+	}
+	return serials
+}
+
+func TestCertificatesPointToCRLs(t *testing.T) {
+	s, cfg := newTestSigner(t)
+	cert := issue(t, s, "alice", nil)
+
+	if len(cert.CRLDistributionPoints) != 1 || cert.CRLDistributionPoints[0] != cfg.Signer.CRLDistributionURL {
+		t.Errorf("CRL distribution points = %v, want %s", cert.CRLDistributionPoints, cfg.Signer.CRLDistributionURL)
+	}
+	freshest := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtensionFreshestCRL) {
+			freshest = true
+		}
+	}
+	if !freshest {
+		t.Error("certificate has no freshest CRL extension pointing to the delta CRL")
+	}
+}
+
+func TestFullAndDeltaCRLs(t *testing.T) {
+	s, _ := newTestSigner(t)
+	ca := s.cas[0].Certificate
+	kept := issue(t, s, "alice", nil)
+	revoked := issue(t, s, "bob", nil)
+
+	baseDER, err := s.GenerateCRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := parseCRL(t, baseDER, ca)
+	if len(base.RevokedCertificateEntries) != 0 {
+		t.Fatalf("new CRL lists %d certificates", len(base.RevokedCertificateEntries))
+	}
+
+	if _, err := s.Revoke(revoked.SerialNumber, ReasonKeyCompromise); err != nil {
+		t.Fatal(err)
+	}
+	deltaDER, err := s.GenerateDeltaCRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta := parseCRL(t, deltaDER, ca)
+	if got := revokedSerials(delta); len(got) != 1 || got[revoked.SerialNumber.Text(16)] != ReasonKeyCompromise {
+		t.Errorf("delta CRL entries = %v, want only %s with reason keyCompromise", got, revoked.SerialNumber.Text(16))
+	}
+	var baseNumber *big.Int
+	for _, ext := range delta.Extensions {
+		if ext.Id.Equal(oidExtensionDeltaCRLIndicator) {
+			if _, err := asn1.Unmarshal(ext.Value, &baseNumber); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if baseNumber == nil || baseNumber.Cmp(base.Number) != 0 {
+		t.Errorf("delta CRL indicator = %v, want base CRL number %v", baseNumber, base.Number)
+	}
+	if delta.Number.Cmp(base.Number) <= 0 {
+		t.Errorf("delta CRL number %v does not follow base CRL number %v", delta.Number, base.Number)
+	}
+
+	fullDER, err := s.GenerateCRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := parseCRL(t, fullDER, ca)
+	got := revokedSerials(full)
+	if _, ok := got[revoked.SerialNumber.Text(16)]; !ok || len(got) != 1 {
+		t.Errorf("full CRL entries = %v, want only %s", got, revoked.SerialNumber.Text(16))
+	}
+	if _, ok := got[kept.SerialNumber.Text(16)]; ok {
+		t.Error("full CRL lists a certificate that was not revoked")
+	}
+}
+
+func TestRevokeIsIdempotent(t *testing.T) {
+	s, _ := newTestSigner(t)
+	cert := issue(t, s, "alice", nil)
+
+	first, err := s.Revoke(cert.SerialNumber, ReasonKeyCompromise)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Revoke(cert.SerialNumber, ReasonSuperseded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Reason != first.Reason || !second.RevokedAt.Equal(first.RevokedAt) {
+		t.Errorf("revoking again changed the entry from %+v to %+v", first, second)
+	}
+}
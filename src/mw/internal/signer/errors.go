@@ -0,0 +1,52 @@
+package signer
+
+import (
+	"errors"
+
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+// Errors that SignCSR wraps so callers can tell why a request failed
+var (
+	ErrBadCSR        = errors.New("invalid CSR")
+	ErrPolicyDenied  = errors.New("denied by policy")
+	ErrGroupLookup   = errors.New("group lookup failed")
+	ErrCAUnavailable = errors.New("CA unavailable")
+	ErrRenewalDenied = errors.New("renewal denied")
+
+	// ErrUnknownCertificate is returned for certificates the signer did
+	// not issue to the user
+	ErrUnknownCertificate = errors.New("unknown certificate")
+)
+
+// signError converts an error from SignCSR into a protocol error. Messages
+// about the request itself are passed on; internal details are not.
+func signError(err error) *signerproto.Error {
+	var policyErr *PolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		perr := signerproto.Errorf(signerproto.CodePolicyDenied, "%s", err.Error())
+		for _, reason := range policyErr.Reasons {
+			perr.Reasons = append(perr.Reasons, signerproto.DenyReason{
+				Rule:    reason.Rule,
+				Subject: reason.Subject,
+				Message: reason.Message,
+			})
+		}
+		return perr
+	case errors.Is(err, ErrSubjectMismatch):
+		return signerproto.Errorf(signerproto.CodePolicyDenied, "%s", ErrSubjectMismatch.Error())
+	case errors.Is(err, ErrPolicyDenied), errors.Is(err, ErrRenewalDenied):
+		return signerproto.Errorf(signerproto.CodePolicyDenied, "%s", err.Error())
+	case errors.Is(err, ErrUnknownCertificate):
+		return signerproto.Errorf(signerproto.CodeNotFound, "No such certificate")
+	case errors.Is(err, ErrBadCSR):
+		return signerproto.Errorf(signerproto.CodeBadCSR, "%s", err.Error())
+	case errors.Is(err, ErrGroupLookup):
+		return signerproto.Errorf(signerproto.CodeGroupLookupFailed, "Group lookup failed")
+	case errors.Is(err, ErrCAUnavailable):
+		return signerproto.Errorf(signerproto.CodeCAUnavailable, "CA unavailable")
+	default:
+		return signerproto.Errorf(signerproto.CodeInternal, "Failed to sign CSR")
+	}
+}
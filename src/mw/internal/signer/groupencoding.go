@@ -0,0 +1,26 @@
+package signer
+
+import (
+	"net/url"
+	"strings"
+)
+
+// groupURIPrefix starts the URI SANs of the san_uri group encoding
+const groupURIPrefix = "urn:certm3:group:"
+
+// groupURIs returns the san_uri encoding of groups
+func groupURIs(groups []string) []*url.URL {
+	uris := make([]*url.URL, 0, len(groups))
+	for _, group := range groups {
+		uris = append(uris, &url.URL{
+			Scheme: "urn",
+			Opaque: strings.TrimPrefix(groupURIPrefix, "urn:") + url.PathEscape(group),
+		})
+	}
+	return uris
+}
+
+// isGroupURI reports whether uri is in the namespace of group URIs
+func isGroupURI(uri *url.URL) bool {
+	return strings.HasPrefix(strings.ToLower(uri.String()), groupURIPrefix)
+}
@@ -0,0 +1,133 @@
+package signer
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+)
+
+// newEncodingSigner returns a signer whose "default" profile uses the
+// extension, "ou" the subject OU and "uri" the SAN URI group encoding
+func newEncodingSigner(t *testing.T) *Signer {
+	t.Helper()
+	s, _ := newConfiguredSigner(t, func(cfg *config.Config) {
+		cfg.Signer.Profiles = map[string]config.ProfileConfig{
+			"default": {AllowedSANTypes: []string{SANTypeURI}},
+			"ou":      {AllowedSANTypes: []string{SANTypeURI}, GroupEncodings: []string{GroupEncodingSubjectOU}},
+			"uri":     {AllowedSANTypes: []string{SANTypeURI}, GroupEncodings: []string{GroupEncodingSANURI}},
+		}
+	})
+	s.SetGroupSource(staticGroups{"alice": {"eng-core", "ops team"}})
+	return s
+}
+
+// signWithProfile has s sign csr for alice with the groups under profile
+func signWithProfile(t *testing.T, s *Signer, csr *x509.CertificateRequest, groups []string, profile string) (*x509.Certificate, error) {
+	t.Helper()
+	certPEM, err := s.SignCSR(newCSR(t, csr), groups, profile, Identity{Username: "alice", RequestID: "req-" + profile})
+	if err != nil {
+		return nil, err
+	}
+	return parseCertificate(t, certPEM), nil
+}
+
+// hasGroupExtension reports whether cert carries the group extension
+func hasGroupExtension(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.String() == testGroupOID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGroupEncodings(t *testing.T) {
+	s := newEncodingSigner(t)
+	website, err := url.Parse("https://alice.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"admins"}},
+		URIs:    []*url.URL{website},
+	}
+	groups := []string{"eng-core", "ops team"}
+	want := []string{"alice", "eng-core", "ops team", "users"}
+
+	cert, err := signWithProfile(t, s, csr, groups, "ou")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The OUs form one RDN, whose values DER sorts by encoding
+	ous := append([]string(nil), cert.Subject.OrganizationalUnit...)
+	sort.Strings(ous)
+	if !reflect.DeepEqual(ous, want) {
+		t.Errorf("OUs = %v, want the groups %v", ous, want)
+	}
+	if hasGroupExtension(cert) {
+		t.Error("subject OU profile added the group extension")
+	}
+
+	cert, err = signWithProfile(t, s, csr, groups, "uri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uris []string
+	for _, uri := range cert.URIs {
+		uris = append(uris, uri.String())
+	}
+	wantURIs := []string{website.String(), "urn:certm3:group:alice", "urn:certm3:group:eng-core", "urn:certm3:group:ops%20team", "urn:certm3:group:users"}
+	if !reflect.DeepEqual(uris, wantURIs) {
+		t.Errorf("URIs = %v, want %v", uris, wantURIs)
+	}
+
+	// Once any profile encodes groups as OUs, no certificate carries OUs
+	// the CSR asked for
+	for _, profile := range []string{"default", "uri"} {
+		cert, err := signWithProfile(t, s, csr, groups, profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cert.Subject.OrganizationalUnit) != 0 {
+			t.Errorf("%s profile kept the OUs %v", profile, cert.Subject.OrganizationalUnit)
+		}
+	}
+	if cert, err := signWithProfile(t, s, csr, groups, "default"); err != nil || !hasGroupExtension(cert) {
+		t.Errorf("default profile: %v, want the group extension", err)
+	}
+}
+
+func TestCSRGroupURIsRejected(t *testing.T) {
+	s := newEncodingSigner(t)
+	groupURI, err := url.Parse("urn:CERTM3:group:admins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "alice"}, URIs: []*url.URL{groupURI}}
+	for _, profile := range []string{"default", "uri"} {
+		if _, err := signWithProfile(t, s, csr, nil, profile); !errors.Is(err, ErrPolicyDenied) {
+			t.Errorf("%s profile: %v, want ErrPolicyDenied", profile, err)
+		}
+	}
+}
+
+func TestProfileGroupEncodings(t *testing.T) {
+	p, err := newProfile("p", config.ProfileConfig{}, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, encoding := range allGroupEncodings {
+		if got, want := p.encodesGroupsAs(encoding), encoding == GroupEncodingExtension; got != want {
+			t.Errorf("default profile encodes groups as %s: %v, want %v", encoding, got, want)
+		}
+	}
+	if _, err := newProfile("p", config.ProfileConfig{GroupEncodings: []string{"ldap"}}, 30); err == nil {
+		t.Error("accepted an unknown group encoding")
+	}
+}
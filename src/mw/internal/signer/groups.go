@@ -0,0 +1,124 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// What a profile does when the group source cannot say which groups a user
+// is in
+const (
+	GroupLookupDeny    = "deny"    // refuse the request
+	GroupLookupDegrade = "degrade" // issue with only the default groups
+	GroupLookupStale   = "stale"   // use cached groups, denying without any
+)
+
+// groupCacheSweepSize is how many cached users prompt dropping entries too
+// old to be served even as stale
+const groupCacheSweepSize = 1024
+
+// groupCache holds users' groups as last fetched from the group source
+type groupCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedGroups
+}
+
+// cachedGroups is one user's groups and when they were fetched
+type cachedGroups struct {
+	groups  []string
+	fetched time.Time
+}
+
+// get returns the cached groups of username and their age
+func (c *groupCache) get(username string) ([]string, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[username]
+	if !ok {
+		return nil, 0, false
+	}
+	return entry.groups, time.Since(entry.fetched), true
+}
+
+// put caches the groups of username, dropping entries older than maxAge
+// once the cache grows large
+func (c *groupCache) put(username string, groups []string, maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedGroups)
+	}
+	now := time.Now()
+	if len(c.entries) >= groupCacheSweepSize {
+		for name, entry := range c.entries {
+			if now.Sub(entry.fetched) > maxAge {
+				delete(c.entries, name)
+			}
+		}
+	}
+	c.entries[username] = cachedGroups{groups: groups, fetched: now}
+}
+
+// forget drops the cached groups of username
+func (c *groupCache) forget(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, username)
+}
+
+// userGroups returns the groups the group source has username in, from the
+// cache while it is fresh. When the source cannot answer, the profile's
+// failure mode decides between an ErrGroupLookup error, no groups and stale
+// cached groups. A user the source does not know is always denied.
+func (s *Signer) userGroups(username string, profile *Profile) ([]string, error) {
+	cached, age, ok := s.groupCache.get(username)
+	if ok && age < s.config.Signer.GroupCacheTTL {
+		return cached, nil
+	}
+
+	groups, err := s.groupSource.UserGroups(username)
+	if err == nil {
+		s.groupCache.put(username, groups, maxDuration(s.config.Signer.GroupCacheTTL, s.config.Signer.GroupCacheMaxStale))
+		return groups, nil
+	}
+	if errors.Is(err, ErrUnknownUser) {
+		s.groupCache.forget(username)
+		return nil, fmt.Errorf("%w: user %s is unknown to the group source", ErrGroupLookup, username)
+	}
+
+	event := map[string]interface{}{
+		"username": username,
+		"profile":  profile.Name,
+		"mode":     profile.groupFailure,
+		"error":    err.Error(),
+	}
+	switch profile.groupFailure {
+	case GroupLookupDegrade:
+		s.logger.LogSecurityEvent("group_lookup_degraded", event)
+		return nil, nil
+	case GroupLookupStale:
+		if ok && age <= s.config.Signer.GroupCacheMaxStale {
+			event["age"] = age.String()
+			s.logger.LogSecurityEvent("group_lookup_stale", event)
+			return cached, nil
+		}
+	}
+	s.logger.LogSecurityEvent("group_lookup_denied", event)
+	return nil, fmt.Errorf("%w: failed to look up groups of user %s: %v", ErrGroupLookup, username, err)
+}
+
+// maxDuration returns the longer of a and b
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// SetGroupSource replaces where the signer looks up group membership. It
+// must be called before the signer serves requests.
+func (s *Signer) SetGroupSource(src GroupSource) {
+	s.groupSource = src
+}
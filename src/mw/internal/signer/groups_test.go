@@ -0,0 +1,172 @@
+package signer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+)
+
+// staticGroups is a group source answering from a map
+type staticGroups map[string][]string
+
+func (g staticGroups) UserGroups(username string) ([]string, error) {
+	groups, ok := g[username]
+	if !ok {
+		return nil, ErrUnknownUser
+	}
+	return groups, nil
+}
+
+// groupBackend stands in for the backend API's user and group routes, and
+// can be made to fail
+type groupBackend struct {
+	mu    sync.Mutex
+	down  bool
+	calls int
+}
+
+func (b *groupBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls++
+	if b.down {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	switch r.URL.Path {
+	case "/users/username/alice":
+		w.Write([]byte(`{"id":"id-alice"}`))
+	case "/users/id-alice/groups":
+		w.Write([]byte(`["eng","ops"]`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// set makes the backend fail or not, and resets its call count
+func (b *groupBackend) set(down bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.down = down
+	b.calls = 0
+}
+
+func (b *groupBackend) callCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls
+}
+
+func TestGroupLookupFailureModes(t *testing.T) {
+	backend := &groupBackend{}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	s, cfg := newTestSigner(t)
+	cfg.AppServer.BackendAPIURL = server.URL
+	cfg.Signer.GroupLookupAttempts = 2
+	cfg.Signer.GroupLookupBackoff = time.Millisecond
+	cfg.Signer.GroupCacheMaxStale = time.Hour
+	src, err := newGroupSource(cfg, testMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetGroupSource(src)
+	profiles := make(map[string]*Profile)
+	for _, mode := range []string{GroupLookupDeny, GroupLookupDegrade, GroupLookupStale} {
+		if profiles[mode], err = newProfile(mode, config.ProfileConfig{GroupLookupFailure: mode}, 30); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groups, err := s.userGroups("alice", profiles[GroupLookupDeny])
+	if err != nil || !reflect.DeepEqual(groups, []string{"eng", "ops"}) {
+		t.Fatalf("groups = %v, %v", groups, err)
+	}
+
+	backend.set(true)
+	if _, err := s.userGroups("alice", profiles[GroupLookupDeny]); !errors.Is(err, ErrGroupLookup) {
+		t.Errorf("deny: %v, want ErrGroupLookup", err)
+	}
+	if calls := backend.callCount(); calls != 2 {
+		t.Errorf("backend called %d times, want 2 attempts", calls)
+	}
+	if groups, err := s.userGroups("alice", profiles[GroupLookupDegrade]); err != nil || len(groups) != 0 {
+		t.Errorf("degrade: %v, %v, want no groups", groups, err)
+	}
+	if groups, err := s.userGroups("alice", profiles[GroupLookupStale]); err != nil || !reflect.DeepEqual(groups, []string{"eng", "ops"}) {
+		t.Errorf("stale: %v, %v, want the cached groups", groups, err)
+	}
+	if _, err := s.userGroups("bob", profiles[GroupLookupStale]); !errors.Is(err, ErrGroupLookup) {
+		t.Errorf("stale without cached groups: %v, want ErrGroupLookup", err)
+	}
+	cfg.Signer.GroupCacheMaxStale = 0
+	if _, err := s.userGroups("alice", profiles[GroupLookupStale]); !errors.Is(err, ErrGroupLookup) {
+		t.Errorf("stale beyond the maximum age: %v, want ErrGroupLookup", err)
+	}
+
+	// Whatever the mode, a user the backend does not know is denied
+	backend.set(false)
+	if _, err := s.userGroups("bob", profiles[GroupLookupDegrade]); !errors.Is(err, ErrGroupLookup) {
+		t.Errorf("unknown user: %v, want ErrGroupLookup", err)
+	}
+}
+
+func TestGroupCache(t *testing.T) {
+	backend := &groupBackend{}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	s, cfg := newTestSigner(t)
+	cfg.AppServer.BackendAPIURL = server.URL
+	cfg.Signer.GroupCacheTTL = time.Minute
+	src, err := newGroupSource(cfg, testMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetGroupSource(src)
+	profile := s.profiles[cfg.Signer.DefaultProfile]
+
+	if _, err := s.userGroups("alice", profile); err != nil {
+		t.Fatal(err)
+	}
+	backend.set(false)
+	if groups, err := s.userGroups("alice", profile); err != nil || len(groups) != 2 {
+		t.Fatalf("cached groups = %v, %v", groups, err)
+	}
+	if calls := backend.callCount(); calls != 0 {
+		t.Errorf("backend called %d times while the cache was fresh", calls)
+	}
+
+	cfg.Signer.GroupCacheTTL = 0
+	if _, err := s.userGroups("alice", profile); err != nil {
+		t.Fatal(err)
+	}
+	if calls := backend.callCount(); calls == 0 {
+		t.Error("backend not called once the cache expired")
+	}
+}
+
+func TestIssuanceDeniedWhenGroupLookupFails(t *testing.T) {
+	s, cfg := newConfiguredSigner(t, func(cfg *config.Config) {
+		cfg.Signer.GroupLookupFailure = GroupLookupDeny
+	})
+	cfg.Signer.GroupLookupAttempts = 1
+	src, err := newGroupSource(cfg, testMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetGroupSource(src)
+
+	// The test signer's backend is unreachable
+	_, err = s.SignCSR(makeCSR(t, "alice"), []string{"eng"}, "", Identity{Username: "alice", RequestID: "req-alice"})
+	if !errors.Is(err, ErrGroupLookup) {
+		t.Errorf("signing: %v, want ErrGroupLookup", err)
+	}
+}
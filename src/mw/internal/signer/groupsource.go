@@ -0,0 +1,199 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/api"
+	"github.com/ogt11/certm3/mw/internal/config"
+	"github.com/ogt11/certm3/mw/pkg/metrics"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrUnknownUser is returned by a GroupSource that has no record of the
+// user
+var ErrUnknownUser = errors.New("unknown user")
+
+// GroupSource says which groups a user belongs to
+type GroupSource interface {
+	// UserGroups returns the groups of username, or ErrUnknownUser if the
+	// source does not know the user
+	UserGroups(username string) ([]string, error)
+}
+
+// Ways a chain of group sources combines their answers
+const (
+	GroupSourceUnion        = "union"        // groups any source lists
+	GroupSourceIntersection = "intersection" // groups every source lists
+)
+
+// newGroupSource builds the group source the configuration describes: the
+// backend API unless other sources are listed
+func newGroupSource(cfg *config.Config, m *metrics.Metrics) (GroupSource, error) {
+	if len(cfg.Signer.GroupSources) == 0 {
+		return newBackendSource(cfg, m)
+	}
+	var sources []GroupSource
+	for i, sc := range cfg.Signer.GroupSources {
+		var (
+			src GroupSource
+			err error
+		)
+		switch sc.Type {
+		case "backend":
+			src, err = newBackendSource(cfg, m)
+		case "ldap":
+			src, err = NewLDAPSource(sc, cfg.Signer.GroupLookupTimeout, cfg.Signer.GroupLookupAttempts)
+		case "static":
+			src, err = NewStaticSource(sc.Path)
+		default:
+			err = fmt.Errorf("unknown type %q", sc.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("group source %d: %v", i, err)
+		}
+		sources = append(sources, src)
+	}
+	if len(sources) == 1 {
+		return sources[0], nil
+	}
+	return NewGroupChain(cfg.Signer.GroupSourceMode, sources...)
+}
+
+// backendSource looks groups up in the backend API
+type backendSource struct {
+	client  *api.Client
+	metrics *metrics.Metrics
+}
+
+// newBackendSource returns a source asking the backend API, with the
+// signer's timeouts, retries and credentials for it
+func newBackendSource(cfg *config.Config, m *metrics.Metrics) (*backendSource, error) {
+	var token string
+	if cfg.Signer.GroupLookupTokenPath != "" {
+		raw, err := os.ReadFile(cfg.Signer.GroupLookupTokenPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read group lookup token: %v", err)
+		}
+		token = strings.TrimSpace(string(raw))
+	}
+	client, err := api.NewClientWithConfig(api.ClientConfig{
+		BaseURL:      cfg.AppServer.BackendAPIURL,
+		Timeout:      cfg.Signer.GroupLookupTimeout,
+		Attempts:     cfg.Signer.GroupLookupAttempts,
+		RetryBackoff: cfg.Signer.GroupLookupBackoff,
+		Token:        token,
+		CertPath:     cfg.Signer.GroupLookupCertPath,
+		KeyPath:      cfg.Signer.GroupLookupKeyPath,
+		CAPath:       cfg.Signer.GroupLookupCAPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &backendSource{client: client, metrics: m}, nil
+}
+
+// UserGroups asks the backend for the groups of username
+func (b *backendSource) UserGroups(username string) ([]string, error) {
+	start := time.Now()
+	groups, err := b.client.GetUserGroups(username)
+	if err != nil {
+		b.metrics.RecordBackendRequest("GET", "/users/groups", "error", time.Since(start), err)
+		if errors.Is(err, api.ErrNotFound) {
+			return nil, fmt.Errorf("%s: %w", username, ErrUnknownUser)
+		}
+		return nil, err
+	}
+	b.metrics.RecordBackendRequest("GET", "/users/groups", "200", time.Since(start), nil)
+	return groups, nil
+}
+
+// staticSource answers from a fixed mapping of usernames to groups, for
+// deployments without a directory to ask
+type staticSource struct {
+	groups map[string][]string
+}
+
+// NewStaticSource reads a YAML file mapping each username to a list of
+// groups
+func NewStaticSource(path string) (GroupSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static groups: %v", err)
+	}
+	var groups map[string][]string
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("failed to parse static groups %s: %v", path, err)
+	}
+	return &staticSource{groups: groups}, nil
+}
+
+// UserGroups returns the groups listed for username
+func (s *staticSource) UserGroups(username string) ([]string, error) {
+	groups, ok := s.groups[username]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", username, ErrUnknownUser)
+	}
+	return append([]string(nil), groups...), nil
+}
+
+// groupChain combines several group sources
+type groupChain struct {
+	mode    string
+	sources []GroupSource
+}
+
+// NewGroupChain returns a source combining sources by mode. Every source
+// is asked and any failure fails the lookup. In a union a user is known if
+// any source knows them; in an intersection every source must.
+func NewGroupChain(mode string, sources ...GroupSource) (GroupSource, error) {
+	if mode != GroupSourceUnion && mode != GroupSourceIntersection {
+		return nil, fmt.Errorf("invalid group source mode %q", mode)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no group sources to chain")
+	}
+	return &groupChain{mode: mode, sources: sources}, nil
+}
+
+// UserGroups asks each source and combines their answers
+func (c *groupChain) UserGroups(username string) ([]string, error) {
+	counts := make(map[string]int)
+	known := 0
+	for _, src := range c.sources {
+		groups, err := src.UserGroups(username)
+		if errors.Is(err, ErrUnknownUser) {
+			if c.mode == GroupSourceIntersection {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		known++
+		seen := make(map[string]bool, len(groups))
+		for _, group := range groups {
+			if !seen[group] {
+				seen[group] = true
+				counts[group]++
+			}
+		}
+	}
+	if known == 0 {
+		return nil, fmt.Errorf("%s: %w", username, ErrUnknownUser)
+	}
+
+	var groups []string
+	for group, n := range counts {
+		if c.mode == GroupSourceUnion || n == known {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
@@ -0,0 +1,238 @@
+package signer
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/ogt11/certm3/mw/internal/config"
+)
+
+// stubLDAP is a directory holding alice, a member of eng and ops by her
+// memberOf attribute and of eng and db by the groups' member attributes
+type stubLDAP struct {
+	bound   string
+	filters []string
+}
+
+func (c *stubLDAP) Bind(username, password string) error {
+	if password != "secret" {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	c.bound = username
+	return nil
+}
+
+func (c *stubLDAP) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	c.filters = append(c.filters, req.Filter)
+	switch req.Filter {
+	case "(uid=alice)":
+		return &ldap.SearchResult{Entries: []*ldap.Entry{
+			ldap.NewEntry("uid=alice,ou=people,dc=example,dc=com", map[string][]string{
+				"memberOf": {"cn=eng,ou=groups,dc=example,dc=com", "cn=ops,ou=groups,dc=example,dc=com", "ou=contractors,dc=example,dc=com"},
+			}),
+		}}, nil
+	case "(member=uid=alice,ou=people,dc=example,dc=com)":
+		return &ldap.SearchResult{Entries: []*ldap.Entry{
+			ldap.NewEntry("cn=eng,ou=groups,dc=example,dc=com", map[string][]string{"cn": {"eng"}}),
+			ldap.NewEntry("cn=db,ou=groups,dc=example,dc=com", map[string][]string{"cn": {"db"}}),
+		}}, nil
+	}
+	return &ldap.SearchResult{}, nil
+}
+
+func (c *stubLDAP) Close() {}
+
+// newStubLDAPSource returns an LDAP source configured by configure, if not
+// nil, that talks to stub
+func newStubLDAPSource(t *testing.T, stub *stubLDAP, configure func(*config.GroupSourceConfig)) *LDAPSource {
+	t.Helper()
+	cfg := config.GroupSourceConfig{
+		Type:              "ldap",
+		URL:               "ldap://ldap.example.com",
+		BaseDN:            "dc=example,dc=com",
+		BindDN:            "cn=reader,dc=example,dc=com",
+		BindPasswordPath:  filepath.Join(t.TempDir(), "password"),
+		UserFilter:        "(uid={username})",
+		GroupAttribute:    "cn",
+		MemberOfAttribute: "memberOf",
+	}
+	writeFile(t, cfg.BindPasswordPath, "secret\n")
+	if configure != nil {
+		configure(&cfg)
+	}
+	src, err := NewLDAPSource(cfg, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Dial = func() (LDAPConn, error) { return stub, nil }
+	return src
+}
+
+func TestLDAPSourceMemberOf(t *testing.T) {
+	stub := &stubLDAP{}
+	src := newStubLDAPSource(t, stub, nil)
+
+	groups, err := src.UserGroups("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"eng", "ops"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("groups = %v, want %v", groups, want)
+	}
+	if stub.bound != "cn=reader,dc=example,dc=com" {
+		t.Errorf("bound as %q, want the bind DN", stub.bound)
+	}
+
+	if _, err := src.UserGroups("bob)(uid=*"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("unknown user: %v, want ErrUnknownUser", err)
+	}
+	if got := stub.filters[len(stub.filters)-1]; got != `(uid=bob\29\28uid=\2a)` {
+		t.Errorf("filter = %s, want the username escaped", got)
+	}
+}
+
+func TestLDAPSourceGroupSearch(t *testing.T) {
+	stub := &stubLDAP{}
+	src := newStubLDAPSource(t, stub, func(cfg *config.GroupSourceConfig) {
+		cfg.GroupBaseDN = "ou=groups,dc=example,dc=com"
+		cfg.GroupFilter = "(member={dn})"
+	})
+
+	groups, err := src.UserGroups("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"eng", "db"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("groups = %v, want %v", groups, want)
+	}
+}
+
+func TestLDAPSourceConnectionFailures(t *testing.T) {
+	stub := &stubLDAP{}
+	src := newStubLDAPSource(t, stub, nil)
+	dials := 0
+	src.Dial = func() (LDAPConn, error) {
+		dials++
+		return nil, errors.New("connection refused")
+	}
+	if _, err := src.UserGroups("alice"); err == nil || errors.Is(err, ErrUnknownUser) {
+		t.Errorf("unreachable directory: %v, want a lookup failure", err)
+	}
+	if dials != 2 {
+		t.Errorf("dialed %d times, want 2 attempts", dials)
+	}
+
+	// Wrong credentials are not worth retrying
+	writeFile(t, src.cfg.BindPasswordPath, "wrong")
+	src, err := NewLDAPSource(src.cfg, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dials = 0
+	src.Dial = func() (LDAPConn, error) {
+		dials++
+		return stub, nil
+	}
+	if _, err := src.UserGroups("alice"); err == nil {
+		t.Error("bound with the wrong password")
+	}
+	if dials != 1 {
+		t.Errorf("dialed %d times after a failed bind, want 1", dials)
+	}
+}
+
+func TestStaticSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "groups.yaml")
+	writeFile(t, path, "alice: [eng, web]\ncarol: [ops]\n")
+	src, err := NewStaticSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups, err := src.UserGroups("alice"); err != nil || !reflect.DeepEqual(groups, []string{"eng", "web"}) {
+		t.Errorf("alice's groups = %v, %v", groups, err)
+	}
+	if _, err := src.UserGroups("dave"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("unknown user: %v, want ErrUnknownUser", err)
+	}
+
+	writeFile(t, path, "alice: eng\n")
+	if _, err := NewStaticSource(path); err == nil {
+		t.Error("accepted groups that are not a list")
+	}
+}
+
+func TestGroupChain(t *testing.T) {
+	directory := staticGroups{"alice": {"eng", "ops"}, "bob": {"eng"}}
+	local := staticGroups{"alice": {"eng", "web", "web"}, "carol": {"ops"}}
+
+	union, err := NewGroupChain(GroupSourceUnion, directory, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intersection, err := NewGroupChain(GroupSourceIntersection, directory, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		chain    GroupSource
+		username string
+		want     []string
+	}{
+		{union, "alice", []string{"eng", "ops", "web"}},
+		{union, "carol", []string{"ops"}},
+		{intersection, "alice", []string{"eng"}},
+	}
+	for _, tt := range tests {
+		groups, err := tt.chain.UserGroups(tt.username)
+		if err != nil || !reflect.DeepEqual(groups, tt.want) {
+			t.Errorf("%s: groups = %v, %v, want %v", tt.username, groups, err, tt.want)
+		}
+	}
+	if _, err := intersection.UserGroups("carol"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("intersection with a source not knowing carol: %v, want ErrUnknownUser", err)
+	}
+	if _, err := union.UserGroups("dave"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("union with no source knowing dave: %v, want ErrUnknownUser", err)
+	}
+
+	// A source failing fails the lookup, rather than dropping its groups
+	unreachable := newStubLDAPSource(t, &stubLDAP{}, nil)
+	unreachable.Dial = func() (LDAPConn, error) { return nil, errors.New("connection refused") }
+	chain, err := NewGroupChain(GroupSourceUnion, unreachable, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.UserGroups("carol"); err == nil || errors.Is(err, ErrUnknownUser) {
+		t.Errorf("chain with a failing source: %v, want a lookup failure", err)
+	}
+
+	if _, err := NewGroupChain("first", directory); err == nil {
+		t.Error("accepted an unknown mode")
+	}
+	if _, err := NewGroupChain(GroupSourceUnion); err == nil {
+		t.Error("accepted a chain of no sources")
+	}
+}
+
+func TestNewGroupSourceFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "groups.yaml")
+	writeFile(t, path, "alice: [eng]\n")
+	cfg := &config.Config{}
+	cfg.Signer.GroupSources = []config.GroupSourceConfig{{Type: "static", Path: path}}
+	src, err := newGroupSource(cfg, testMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups, err := src.UserGroups("alice"); err != nil || !reflect.DeepEqual(groups, []string{"eng"}) {
+		t.Errorf("groups = %v, %v", groups, err)
+	}
+
+	cfg.Signer.GroupSources = append(cfg.Signer.GroupSources, config.GroupSourceConfig{Type: "nis"})
+	cfg.Signer.GroupSourceMode = GroupSourceUnion
+	if _, err := newGroupSource(cfg, testMetrics); err == nil {
+		t.Error("accepted an unknown source type")
+	}
+}
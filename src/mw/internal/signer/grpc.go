@@ -0,0 +1,351 @@
+package signer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+	"github.com/ogt11/certm3/mw/pkg/signerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcService implements the gRPC signer service on top of the same
+// request handling as the socket protocol
+type grpcService struct {
+	signerpb.UnimplementedSignerServiceServer
+	h *Handler
+}
+
+// NewGRPCServer returns a gRPC server with the signer service registered
+func NewGRPCServer(h *Handler, opts ...grpc.ServerOption) *grpc.Server {
+	srv := grpc.NewServer(opts...)
+	signerpb.RegisterSignerServiceServer(srv, &grpcService{h: h})
+	return srv
+}
+
+// Sign signs a CSR
+func (g *grpcService) Sign(ctx context.Context, req *signerpb.SignRequest) (*signerpb.SignResponse, error) {
+	result, perr := g.h.sign(&signerproto.SignRequest{
+		RequestID:     req.GetRequestId(),
+		CSR:           req.GetCsr(),
+		Groups:        req.GetGroups(),
+		Token:         req.GetToken(),
+		Profile:       req.GetProfile(),
+		UserID:        req.GetUserId(),
+		Username:      req.GetUsername(),
+		Renews:        req.GetRenews(),
+		RevokeRenewed: req.GetRevokeRenewed(),
+	})
+	if perr != nil {
+		return nil, perr
+	}
+	resp := &signerpb.SignResponse{
+		Certificate:          result.Certificate,
+		CaCertificate:        result.CACertificate,
+		Serial:               result.Serial,
+		Chain:                result.Chain,
+		AttributeCertificate: result.AttributeCertificate,
+	}
+	if result.RenewedRevokeAt != nil {
+		resp.RenewedRevokeAt = timestamppb.New(*result.RenewedRevokeAt)
+	}
+	return resp, nil
+}
+
+// SignSSH signs an SSH public key
+func (g *grpcService) SignSSH(ctx context.Context, req *signerpb.SignSSHRequest) (*signerpb.SignSSHResponse, error) {
+	result, perr := g.h.signSSH(&signerproto.SignSSHRequest{
+		RequestID: req.GetRequestId(),
+		PublicKey: req.GetPublicKey(),
+		Groups:    req.GetGroups(),
+		Token:     req.GetToken(),
+		Profile:   req.GetProfile(),
+		UserID:    req.GetUserId(),
+		Username:  req.GetUsername(),
+	})
+	if perr != nil {
+		return nil, perr
+	}
+	return &signerpb.SignSSHResponse{
+		Certificate: result.Certificate,
+		CaPublicKey: result.CAPublicKey,
+		Serial:      result.Serial,
+		Principals:  result.Principals,
+		ValidBefore: timestamppb.New(result.ValidBefore),
+	}, nil
+}
+
+// SignAttributeCertificate issues a fresh attribute certificate
+func (g *grpcService) SignAttributeCertificate(ctx context.Context, req *signerpb.SignAttributeCertificateRequest) (*signerpb.SignAttributeCertificateResponse, error) {
+	result, perr := g.h.signAttributeCert(&signerproto.SignAttributeCertRequest{
+		RequestID: req.GetRequestId(),
+		Serial:    req.GetSerial(),
+		Groups:    req.GetGroups(),
+		Token:     req.GetToken(),
+		UserID:    req.GetUserId(),
+		Username:  req.GetUsername(),
+	})
+	if perr != nil {
+		return nil, perr
+	}
+	return &signerpb.SignAttributeCertificateResponse{
+		AttributeCertificate: result.AttributeCertificate,
+	}, nil
+}
+
+// GetCACertificates returns the CA certificate followed by its chain
+func (g *grpcService) GetCACertificates(ctx context.Context, req *signerpb.GetCACertificatesRequest) (*signerpb.GetCACertificatesResponse, error) {
+	certs, err := g.h.signer.GetCACertificates()
+	if err != nil {
+		g.h.logger.Errorf("Failed to get CA certificates: %v", err)
+		return nil, signerproto.Errorf(signerproto.CodeCAUnavailable, "Failed to get CA certificate")
+	}
+	resp := &signerpb.GetCACertificatesResponse{}
+	for _, certPEM := range certs {
+		resp.Certificates = append(resp.Certificates, string(certPEM))
+	}
+	return resp, nil
+}
+
+// Revoke revokes a certificate
+func (g *grpcService) Revoke(ctx context.Context, req *signerpb.RevokeRequest) (*signerpb.RevokeResponse, error) {
+	result, perr := g.h.revoke(&signerproto.RevokeRequest{
+		RequestID:   req.GetRequestId(),
+		Serial:      req.GetSerial(),
+		Reason:      req.GetReason(),
+		Token:       req.GetToken(),
+		UserID:      req.GetUserId(),
+		Username:    req.GetUsername(),
+		Admin:       req.GetAdmin(),
+		Fingerprint: req.GetFingerprint(),
+	})
+	if perr != nil {
+		return nil, perr
+	}
+	return &signerpb.RevokeResponse{Serial: result.Serial, Reason: result.Reason}, nil
+}
+
+// GetStatus reports the status of a certificate from the issuance and
+// revocation records, as the OCSP responder does
+func (g *grpcService) GetStatus(ctx context.Context, req *signerpb.GetStatusRequest) (*signerpb.GetStatusResponse, error) {
+	serial, ok := new(big.Int).SetString(req.GetSerial(), 16)
+	if !ok {
+		return nil, signerproto.Errorf(signerproto.CodeBadRequest, "Invalid serial number")
+	}
+
+	resp := &signerpb.GetStatusResponse{
+		Status: signerpb.GetStatusResponse_STATUS_UNKNOWN,
+	}
+	if record, issued := g.h.signer.issued.Lookup(serial); issued {
+		resp.Status = signerpb.GetStatusResponse_STATUS_GOOD
+		resp.Subject = record.Subject
+		resp.NotAfter = timestamppb.New(record.NotAfter)
+		if record.Type == RecordTypeSSH && record.Status == StatusRevoked {
+			// SSH revocations are only recorded in the ledger
+			resp.Status = signerpb.GetStatusResponse_STATUS_REVOKED
+			resp.RevokedAt = timestamppb.New(record.RevokedAt)
+			resp.RevocationReason = int32(record.RevocationReason)
+		}
+	}
+	if entry, revoked := g.h.signer.revocations.Lookup(serial); revoked {
+		resp.Status = signerpb.GetStatusResponse_STATUS_REVOKED
+		resp.RevokedAt = timestamppb.New(entry.RevokedAt)
+		resp.RevocationReason = int32(entry.Reason)
+	}
+	return resp, nil
+}
+
+// ListCertificates queries the issuance ledger
+func (g *grpcService) ListCertificates(ctx context.Context, req *signerpb.ListCertificatesRequest) (*signerpb.ListCertificatesResponse, error) {
+	var records []IssuedRecord
+	switch query := req.GetQuery().(type) {
+	case *signerpb.ListCertificatesRequest_Serial:
+		serial, ok := new(big.Int).SetString(query.Serial, 16)
+		if !ok {
+			return nil, signerproto.Errorf(signerproto.CodeBadRequest, "Invalid serial number")
+		}
+		if record, issued := g.h.signer.issued.Lookup(serial); issued {
+			records = append(records, record)
+		}
+	case *signerpb.ListCertificatesRequest_Username:
+		records = g.h.signer.issued.ByUser(query.Username)
+	case *signerpb.ListCertificatesRequest_PublicKeyFingerprint:
+		records = g.h.signer.issued.ByFingerprint(query.PublicKeyFingerprint)
+	default:
+		return nil, signerproto.Errorf(signerproto.CodeBadRequest, "A serial, username or fingerprint is required")
+	}
+
+	resp := &signerpb.ListCertificatesResponse{}
+	now := time.Now()
+	for _, record := range records {
+		resp.Certificates = append(resp.Certificates, certificateRecord(record, now))
+	}
+	return resp, nil
+}
+
+// certificateRecord converts a ledger record to its protobuf form
+func certificateRecord(record IssuedRecord, now time.Time) *signerpb.CertificateRecord {
+	return &signerpb.CertificateRecord{
+		Serial:               record.Serial,
+		Subject:              record.Subject,
+		NotBefore:            optionalTimestamp(record.NotBefore),
+		NotAfter:             optionalTimestamp(record.NotAfter),
+		UserId:               record.UserID,
+		Username:             record.Username,
+		RequestId:            record.RequestID,
+		Profile:              record.Profile,
+		Groups:               record.Groups,
+		PublicKeyFingerprint: record.PublicKeyFingerprint,
+		Fingerprint:          record.Fingerprint,
+		IssuedAt:             optionalTimestamp(record.IssuedAt),
+		Status:               record.StatusAt(now),
+		RevokedAt:            optionalTimestamp(record.RevokedAt),
+		RevocationReason:     int32(record.RevocationReason),
+	}
+}
+
+// optionalTimestamp converts t, leaving zero times unset
+func optionalTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// GRPCServerCredentials returns mTLS credentials for the TCP gRPC listener:
+// the server presents certPath/keyPath and requires client certificates
+// issued by the CAs in clientCAPath
+func GRPCServerCredentials(certPath, keyPath, clientCAPath string) (credentials.TransportCredentials, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gRPC server certificate: %v", err)
+	}
+	caPEM, err := os.ReadFile(clientCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gRPC client CA: %v", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in gRPC client CA file %s", clientCAPath)
+	}
+
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}), nil
+}
+
+// ledgerQueries are the methods that read the issuance and revocation
+// records without a ticket
+var ledgerQueries = map[string]bool{
+	signerpb.SignerService_GetStatus_FullMethodName:        true,
+	signerpb.SignerService_ListCertificates_FullMethodName: true,
+}
+
+// AllowedClientsInterceptor rejects calls from mTLS clients whose
+// certificate CommonName is in neither allowed nor admins; with both lists
+// empty every call is rejected. Ledger queries carry no ticket, so only
+// admins may make them.
+func (h *Handler) AllowedClientsInterceptor(allowed, admins []string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		commonName := ""
+		if p, ok := peer.FromContext(ctx); ok {
+			if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+				commonName = tlsInfo.State.PeerCertificates[0].Subject.CommonName
+			}
+		}
+		admin := commonName != "" && contains(admins, commonName)
+		permitted := admin || (commonName != "" && contains(allowed, commonName))
+		if !permitted || (ledgerQueries[info.FullMethod] && !admin) {
+			h.logger.LogSecurityEvent("grpc_client_rejected", map[string]interface{}{
+				"component":   "signer",
+				"method":      info.FullMethod,
+				"common_name": commonName,
+			})
+			h.metrics.RecordSecurityEvent("grpc_client_rejected")
+			return nil, status.Error(codes.PermissionDenied, "client not allowed")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// http2Preface starts every HTTP/2, and so every gRPC, connection
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// ServeGRPC makes HandleConnection pass gRPC connections on the Unix socket
+// to srv, which serves them until it is stopped
+func (h *Handler) ServeGRPC(srv *grpc.Server, addr net.Addr) {
+	l := &connListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+		addr:  addr,
+	}
+	h.grpcConns = l
+	go srv.Serve(l)
+}
+
+// connListener is a net.Listener fed with connections accepted elsewhere
+type connListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+	addr  net.Addr
+}
+
+// Accept waits for the next handed over connection
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops Accept
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+// Addr returns the address of the socket the connections arrive on
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+// push hands conn over, reporting false if the listener is closed
+func (l *connListener) push(conn net.Conn) bool {
+	select {
+	case l.conns <- conn:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+// bufferedConn is a connection whose first bytes were already read into a
+// bufio.Reader while detecting the protocol
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+// Read reads from the buffer first, then the connection
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
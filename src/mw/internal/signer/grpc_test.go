@@ -0,0 +1,141 @@
+package signer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/security"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+	"github.com/ogt11/certm3/mw/pkg/signerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCOnUnixSocket(t *testing.T) {
+	h, tickets := newTestHandler(t)
+	srv := NewGRPCServer(h)
+	defer srv.Stop()
+	path := serveUnix(t, h)
+	h.ServeGRPC(srv, &net.UnixAddr{Name: path, Net: "unix"})
+
+	client, err := signerproto.DialGRPC("unix://"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := signRequest(t, tickets, "alice", "req-1", nil)
+	res, err := client.Sign(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Sign(ctx, req); errorCode(err) != signerproto.CodeUnauthenticated {
+		t.Errorf("replayed ticket: err = %v, want %s", err, signerproto.CodeUnauthenticated)
+	}
+
+	conn, err := grpc.Dial("unix://"+path, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	raw := signerpb.NewSignerServiceClient(conn)
+	cas, err := raw.GetCACertificates(ctx, &signerpb.GetCACertificatesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cas.Certificates) != 1 {
+		t.Errorf("%d CA certificates, want 1", len(cas.Certificates))
+	}
+	st, err := raw.GetStatus(ctx, &signerpb.GetStatusRequest{Serial: res.Serial})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != signerpb.GetStatusResponse_STATUS_GOOD || st.Subject == "" {
+		t.Errorf("status = %v", st)
+	}
+
+	token, _ := tickets.IssueTicket("id-alice", "alice", "req-2", security.TicketActionRevoke, []byte(res.Serial))
+	if _, err := client.Revoke(ctx, &signerproto.RevokeRequest{RequestID: "req-2", Serial: res.Serial, Token: token, UserID: "id-alice", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if st, err = raw.GetStatus(ctx, &signerpb.GetStatusRequest{Serial: res.Serial}); err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != signerpb.GetStatusResponse_STATUS_REVOKED {
+		t.Errorf("status after revocation = %v", st.Status)
+	}
+	list, err := raw.ListCertificates(ctx, &signerpb.ListCertificatesRequest{Query: &signerpb.ListCertificatesRequest_Username{Username: "alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Certificates) != 1 || list.Certificates[0].Serial != res.Serial {
+		t.Errorf("ledger lists %v", list.Certificates)
+	}
+
+	// The framed protocol still works on the same socket
+	framed := signerproto.NewClient("unix", path, time.Second)
+	defer framed.Close()
+	if _, err := framed.Sign(ctx, signRequest(t, tickets, "alice", "req-3", nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// clientContext returns a context as gRPC passes it for a TLS client
+// presenting a certificate for commonName, or for a client without TLS
+// if commonName is empty
+func clientContext(commonName string) context.Context {
+	p := &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+	if commonName != "" {
+		p.AuthInfo = credentials.TLSInfo{State: tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: commonName}}},
+		}}
+	}
+	return peer.NewContext(context.Background(), p)
+}
+
+func TestAllowedClientsInterceptor(t *testing.T) {
+	h, _ := newTestHandler(t)
+	sign := &grpc.UnaryServerInfo{FullMethod: signerpb.SignerService_Sign_FullMethodName}
+	getStatus := &grpc.UnaryServerInfo{FullMethod: signerpb.SignerService_GetStatus_FullMethodName}
+	listCertificates := &grpc.UnaryServerInfo{FullMethod: signerpb.SignerService_ListCertificates_FullMethodName}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+	tests := []struct {
+		name            string
+		allowed, admins []string
+		commonName      string
+		info            *grpc.UnaryServerInfo
+		want            bool
+	}{
+		{"no lists", nil, nil, "app", sign, false},
+		{"no client certificate", []string{"app"}, []string{"ops"}, "", sign, false},
+		{"allowed client", []string{"app"}, []string{"ops"}, "app", sign, true},
+		{"unknown client", []string{"app"}, []string{"ops"}, "mallory", sign, false},
+		{"allowed client querying status", []string{"app"}, []string{"ops"}, "app", getStatus, false},
+		{"allowed client listing certificates", []string{"app"}, []string{"ops"}, "app", listCertificates, false},
+		{"admin signing", []string{"app"}, []string{"ops"}, "ops", sign, true},
+		{"admin querying status", []string{"app"}, []string{"ops"}, "ops", getStatus, true},
+		{"admin listing certificates", nil, []string{"ops"}, "ops", listCertificates, true},
+	}
+	for _, tt := range tests {
+		interceptor := h.AllowedClientsInterceptor(tt.allowed, tt.admins)
+		_, err := interceptor(clientContext(tt.commonName), nil, tt.info, handler)
+		if tt.want && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.want && status.Code(err) != codes.PermissionDenied {
+			t.Errorf("%s: err = %v, want permission denied", tt.name, err)
+		}
+	}
+}
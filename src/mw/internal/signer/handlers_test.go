@@ -0,0 +1,150 @@
+package signer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/security"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+// errorCode returns the signer error code of err, or "" if it has none
+func errorCode(err error) signerproto.Code {
+	var perr *signerproto.Error
+	if errors.As(err, &perr) {
+		return perr.Code
+	}
+	return ""
+}
+
+func TestFramedProtocol(t *testing.T) {
+	h, tickets := newTestHandler(t)
+	client := signerproto.NewClient("unix", serveUnix(t, h), time.Second)
+	defer client.Close()
+	ctx := context.Background()
+
+	// Requests share the connection and may complete in any order
+	results := make([]*signerproto.SignResult, 10)
+	var wg sync.WaitGroup
+	for i := range results {
+		req := signRequest(t, tickets, "alice", "req-1", nil)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := client.Sign(ctx, req)
+			if err != nil {
+				t.Errorf("sign: %v", err)
+			}
+			results[i] = res
+		}(i)
+	}
+	wg.Wait()
+	for _, res := range results {
+		if res == nil {
+			continue
+		}
+		if cert := parseCertificate(t, []byte(res.Certificate)); cert.SerialNumber.Text(16) != res.Serial {
+			t.Errorf("result serial %s does not match certificate serial %s", res.Serial, cert.SerialNumber.Text(16))
+		}
+	}
+
+	req := signRequest(t, tickets, "alice", "req-2", nil)
+	req.CSR = string(makeCSR(t, "mallory"))
+	req.Token, _ = tickets.IssueTicket(req.UserID, req.Username, req.RequestID, security.TicketActionSign,
+		security.IssuancePayload([]byte(req.CSR), "", nil))
+	if _, err := client.Sign(ctx, req); errorCode(err) != signerproto.CodePolicyDenied {
+		t.Errorf("CSR for someone else: err = %v, want %s", err, signerproto.CodePolicyDenied)
+	}
+	if _, err := client.Sign(ctx, req); errorCode(err) != signerproto.CodeUnauthenticated {
+		t.Errorf("replayed ticket: err = %v, want %s", err, signerproto.CodeUnauthenticated)
+	}
+	if err := client.Call(ctx, "bogus", req, nil); errorCode(err) != signerproto.CodeUnsupportedMethod {
+		t.Errorf("unknown method: err = %v, want %s", err, signerproto.CodeUnsupportedMethod)
+	}
+
+	res, err := client.Sign(ctx, signRequest(t, tickets, "alice", "req-3", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := client.Status(ctx, &signerproto.StatusRequest{Serial: res.Serial}); err != nil || status.Status != signerproto.StatusGood {
+		t.Errorf("status of a new certificate = %+v, %v", status, err)
+	}
+	token, _ := tickets.IssueTicket("id-alice", "alice", "req-4", security.TicketActionRevoke, []byte(res.Serial))
+	revoked, err := client.Revoke(ctx, &signerproto.RevokeRequest{
+		RequestID: "req-4",
+		Serial:    res.Serial,
+		Reason:    "keyCompromise",
+		Token:     token,
+		UserID:    "id-alice",
+		Username:  "alice",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.Serial != res.Serial || revoked.Reason != "keyCompromise" {
+		t.Errorf("revoke result = %+v", revoked)
+	}
+	if status, err := client.Status(ctx, &signerproto.StatusRequest{Serial: res.Serial}); err != nil || status.Status != signerproto.StatusRevoked {
+		t.Errorf("status of a revoked certificate = %+v, %v", status, err)
+	}
+	if status, err := client.Status(ctx, &signerproto.StatusRequest{Serial: "abc123"}); err != nil || status.Status != signerproto.StatusUnknown {
+		t.Errorf("status of an unknown serial = %+v, %v", status, err)
+	}
+}
+
+func TestV0Protocol(t *testing.T) {
+	h, tickets := newTestHandler(t)
+	path := serveUnix(t, h)
+
+	call := func(req interface{}) SignResponse {
+		t.Helper()
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if err := json.NewEncoder(conn).Encode(req); err != nil {
+			t.Fatal(err)
+		}
+		var resp SignResponse
+		if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	signReq := signRequest(t, tickets, "alice", "req-1", nil)
+	resp := call(SignRequest{
+		RequestID: signReq.RequestID,
+		CSR:       signReq.CSR,
+		Token:     signReq.Token,
+		UserID:    signReq.UserID,
+		Username:  signReq.Username,
+	})
+	if !resp.Success || resp.Data.Certificate == "" || resp.Data.CACertificate == "" {
+		t.Fatalf("v0 sign response = %+v", resp)
+	}
+
+	token, _ := tickets.IssueTicket("id-alice", "alice", "req-2", security.TicketActionRevoke, []byte(resp.Data.Serial))
+	resp = call(SignRequest{
+		RequestID: "req-2",
+		Token:     token,
+		UserID:    "id-alice",
+		Username:  "alice",
+		Action:    signerproto.MethodRevoke,
+		Serial:    resp.Data.Serial,
+	})
+	if !resp.Success {
+		t.Errorf("v0 revoke failed: %s", resp.Error)
+	}
+
+	resp = call(SignRequest{RequestID: "req-3", Username: "alice"})
+	if resp.Success || resp.Code != signerproto.CodeBadRequest {
+		t.Errorf("v0 request without a CSR: %+v, want %s", resp, signerproto.CodeBadRequest)
+	}
+}
@@ -0,0 +1,115 @@
+package signer
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+)
+
+// ErrSubjectMismatch is returned when a CSR names someone other than the
+// authenticated user
+var ErrSubjectMismatch = errors.New("CSR subject does not match authenticated user")
+
+// Identity is the authenticated identity a signing request was made for, as
+// established by the app server from the user's JWT
+type Identity struct {
+	UserID    string
+	Username  string
+	RequestID string
+}
+
+// subjectError reports a CSR subject that does not name the authenticated
+// user, and only them
+type subjectError struct {
+	commonName string // the first CommonName of the CSR
+	reason     string
+}
+
+// Error implements the error interface
+func (e *subjectError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrSubjectMismatch, e.reason)
+}
+
+// Unwrap makes errors.Is(err, ErrSubjectMismatch) hold
+func (e *subjectError) Unwrap() error {
+	return ErrSubjectMismatch
+}
+
+// checkSubject returns a *subjectError unless the subject of csr names
+// username, and only them
+func checkSubject(csr *x509.CertificateRequest, username string) error {
+	commonName := ""
+	commonNames := 0
+	for _, name := range csr.Subject.Names {
+		if name.Type.Equal(oidCommonName) {
+			commonNames++
+			if str, ok := name.Value.(string); ok && commonName == "" {
+				commonName = str
+			}
+		}
+	}
+
+	var reason string
+	switch {
+	case username == "":
+		reason = "missing_identity"
+	case commonNames > 1:
+		// pkix.Name keeps the last CommonName, so a second one could
+		// name someone else in the certificate
+		reason = "multiple_common_names"
+	case commonName == "":
+		reason = "missing_common_name"
+	case commonName != username:
+		reason = "common_name_mismatch"
+	default:
+		return nil
+	}
+	return &subjectError{commonName: commonName, reason: reason}
+}
+
+// verifyCSR makes the checks of a parsed CSR for username that do not
+// depend on the user's groups: its signature, its subject and the SANs the
+// profile allows. Issuance and "policy test" both rely on it.
+func verifyCSR(csr *x509.CertificateRequest, profile *Profile, username string) error {
+	if err := csr.CheckSignature(); err != nil {
+		return fmt.Errorf("%w: invalid CSR signature: %v", ErrBadCSR, err)
+	}
+	if err := checkSubject(csr, username); err != nil {
+		return err
+	}
+	if err := profile.checkSANs(csr); err != nil {
+		return fmt.Errorf("%w: %v", ErrPolicyDenied, err)
+	}
+	return nil
+}
+
+// logSubjectMismatch records a CSR subject naming someone other than the
+// authenticated user as a security event
+func (s *Signer) logSubjectMismatch(identity Identity, err *subjectError) {
+	s.logger.LogSecurityEvent("csr_subject_mismatch", map[string]interface{}{
+		"reason":     err.reason,
+		"user_id":    identity.UserID,
+		"username":   identity.Username,
+		"request_id": identity.RequestID,
+		"csr_cn":     err.commonName,
+	})
+	s.metrics.RecordSecurityEvent("csr_subject_mismatch")
+	s.metrics.RecordCSRSubjectMismatch(err.reason)
+}
+
+// certificateSubject returns the subject of a certificate issued to
+// username for csr: the CSR's subject attributes, with the CommonName
+// always the verified username
+func certificateSubject(csr *x509.CertificateRequest, username string) pkix.Name {
+	return pkix.Name{
+		CommonName:         username,
+		Country:            csr.Subject.Country,
+		Organization:       csr.Subject.Organization,
+		OrganizationalUnit: csr.Subject.OrganizationalUnit,
+		Locality:           csr.Subject.Locality,
+		Province:           csr.Subject.Province,
+		StreetAddress:      csr.Subject.StreetAddress,
+		PostalCode:         csr.Subject.PostalCode,
+	}
+}
@@ -0,0 +1,98 @@
+package signer
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+// parseTestCSR parses a PEM CSR
+func parseTestCSR(t *testing.T, csrPEM []byte) *x509.CertificateRequest {
+	t.Helper()
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+func TestCheckSubject(t *testing.T) {
+	commonName := func(value string) pkix.AttributeTypeAndValue {
+		return pkix.AttributeTypeAndValue{Type: oidCommonName, Value: value}
+	}
+	tests := []struct {
+		name     string
+		subject  pkix.Name
+		username string
+		reason   string
+	}{
+		{"match", pkix.Name{CommonName: "alice"}, "alice", ""},
+		{"no identity", pkix.Name{CommonName: "alice"}, "", "missing_identity"},
+		{"no common name", pkix.Name{Organization: []string{"Example"}}, "alice", "missing_common_name"},
+		{"someone else", pkix.Name{CommonName: "bob"}, "alice", "common_name_mismatch"},
+		{"case differs", pkix.Name{CommonName: "Alice"}, "alice", "common_name_mismatch"},
+		{"two common names", pkix.Name{ExtraNames: []pkix.AttributeTypeAndValue{commonName("alice"), commonName("admin")}}, "alice", "multiple_common_names"},
+	}
+	for _, tt := range tests {
+		csr := parseTestCSR(t, newCSR(t, &x509.CertificateRequest{Subject: tt.subject}))
+		err := checkSubject(csr, tt.username)
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		var subjErr *subjectError
+		if !errors.As(err, &subjErr) || subjErr.reason != tt.reason {
+			t.Errorf("%s: err = %v, want reason %s", tt.name, err, tt.reason)
+		}
+		if !errors.Is(err, ErrSubjectMismatch) {
+			t.Errorf("%s: %v is not ErrSubjectMismatch", tt.name, err)
+		}
+	}
+}
+
+func TestSignCSRRejectsOtherSubjects(t *testing.T) {
+	s, _ := newTestSigner(t)
+	identity := Identity{UserID: "1", Username: "alice", RequestID: "req-alice"}
+
+	if _, err := s.SignCSR(makeCSR(t, "bob"), nil, "", identity); !errors.Is(err, ErrSubjectMismatch) {
+		t.Errorf("CSR for bob: err = %v, want ErrSubjectMismatch", err)
+	}
+
+	// pkix.Name would keep the second CommonName
+	csr := newCSR(t, &x509.CertificateRequest{Subject: pkix.Name{ExtraNames: []pkix.AttributeTypeAndValue{
+		{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: "alice"},
+		{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: "admin"},
+	}}})
+	if _, err := s.SignCSR(csr, nil, "", identity); !errors.Is(err, ErrSubjectMismatch) {
+		t.Errorf("CSR with two CommonNames: err = %v, want ErrSubjectMismatch", err)
+	}
+	if len(s.issued.ByUser("alice")) != 0 {
+		t.Error("a rejected CSR was recorded as issued")
+	}
+}
+
+func TestCertificateSubject(t *testing.T) {
+	s, _ := newTestSigner(t)
+	csr := newCSR(t, &x509.CertificateRequest{Subject: pkix.Name{
+		CommonName:   "alice",
+		Organization: []string{"Example"},
+		Country:      []string{"NL"},
+	}})
+	certPEM, err := s.SignCSR(csr, nil, "", Identity{Username: "alice", RequestID: "req-alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := parseCertificate(t, certPEM)
+	if cert.Subject.CommonName != "alice" {
+		t.Errorf("CommonName = %q, want alice", cert.Subject.CommonName)
+	}
+	if len(cert.Subject.Organization) != 1 || cert.Subject.Organization[0] != "Example" || len(cert.Subject.Country) != 1 {
+		t.Errorf("subject %v lost the CSR's attributes", cert.Subject)
+	}
+}
@@ -0,0 +1,313 @@
+package signer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Certificate statuses recorded in the issuance ledger
+const (
+	StatusGood    = "good"
+	StatusRevoked = "revoked"
+
+	// StatusExpired is never stored; StatusAt reports it for good
+	// certificates past their NotAfter
+	StatusExpired = "expired"
+)
+
+// Types of ledger records. X.509 records have no type, which keeps the
+// ledgers written before OpenSSH certificates valid.
+const (
+	RecordTypeX509 = ""
+	RecordTypeSSH  = "ssh"
+)
+
+// IssuedRecord records a certificate issued by the signer
+type IssuedRecord struct {
+	Serial    string    `json:"serial"` // hexadecimal
+	Type      string    `json:"type,omitempty"`
+	Issuer    string    `json:"issuer,omitempty"` // see issuerID; X.509 only
+	Subject   string    `json:"subject"`
+	NotBefore time.Time `json:"notBefore,omitempty"`
+	NotAfter  time.Time `json:"notAfter"`
+
+	// Who the certificate was issued to and how
+	UserID    string   `json:"userId,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	RequestID string   `json:"requestId,omitempty"`
+	Profile   string   `json:"profile,omitempty"`
+	Groups    []string `json:"groups,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+
+	// Hex SHA-256 fingerprints of the subject public key info and of the
+	// whole certificate
+	PublicKeyFingerprint string `json:"publicKeyFingerprint,omitempty"`
+	Fingerprint          string `json:"fingerprint,omitempty"`
+
+	IssuedAt         time.Time `json:"issuedAt,omitempty"`
+	Status           string    `json:"status,omitempty"`
+	RevokedAt        time.Time `json:"revokedAt,omitempty"`
+	RevocationReason int       `json:"revocationReason,omitempty"`
+
+	// Renewal: the serial of the certificate this one replaced, and when a
+	// replaced certificate is due to be revoked as superseded
+	Supersedes  string    `json:"supersedes,omitempty"`
+	RevokeAfter time.Time `json:"revokeAfter,omitempty"`
+}
+
+// StatusAt returns the status of the certificate at t
+func (r IssuedRecord) StatusAt(t time.Time) string {
+	if r.Status == StatusRevoked {
+		return StatusRevoked
+	}
+	if !r.NotAfter.IsZero() && t.After(r.NotAfter) {
+		return StatusExpired
+	}
+	return StatusGood
+}
+
+// Fingerprint returns the hex SHA-256 fingerprint of DER data, as stored in
+// the ledger
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// IssuedIndex is the issuance ledger: an append-only record of every
+// certificate the signer issued and of later changes to its status. Each
+// line of the file is a complete record; when a serial appears more than
+// once the last line wins. Records can be looked up by serial, user and
+// public key fingerprint.
+type IssuedIndex struct {
+	mu            sync.RWMutex
+	file          *os.File
+	records       map[string]IssuedRecord
+	byUser        map[string][]string
+	byFingerprint map[string][]string
+	scheduled     map[string]time.Time // serial -> RevokeAfter
+	lastExpiry    map[string]time.Time // issuer -> latest X.509 NotAfter
+}
+
+// OpenIssuedIndex loads the ledger at path, creating it if needed
+func OpenIssuedIndex(path string) (*IssuedIndex, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create issued index directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open issued index: %v", err)
+	}
+
+	index := &IssuedIndex{
+		file:          file,
+		records:       make(map[string]IssuedRecord),
+		byUser:        make(map[string][]string),
+		byFingerprint: make(map[string][]string),
+		scheduled:     make(map[string]time.Time),
+		lastExpiry:    make(map[string]time.Time),
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var record IssuedRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to parse issued index: %v", err)
+		}
+		index.put(record)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read issued index: %v", err)
+	}
+	return index, nil
+}
+
+// put stores record in memory; callers must hold mu or own the index
+func (ix *IssuedIndex) put(record IssuedRecord) {
+	if record.Status == "" {
+		record.Status = StatusGood
+	}
+	if _, seen := ix.records[record.Serial]; !seen {
+		if record.Username != "" {
+			ix.byUser[record.Username] = append(ix.byUser[record.Username], record.Serial)
+		}
+		if record.PublicKeyFingerprint != "" {
+			fp := strings.ToLower(record.PublicKeyFingerprint)
+			ix.byFingerprint[fp] = append(ix.byFingerprint[fp], record.Serial)
+		}
+	}
+	ix.records[record.Serial] = record
+	if record.Type == RecordTypeX509 && record.NotAfter.After(ix.lastExpiry[record.Issuer]) {
+		ix.lastExpiry[record.Issuer] = record.NotAfter
+	}
+	if record.Status == StatusGood && !record.RevokeAfter.IsZero() {
+		ix.scheduled[record.Serial] = record.RevokeAfter
+	} else {
+		delete(ix.scheduled, record.Serial)
+	}
+}
+
+// append writes record to the ledger file and stores it; callers must hold
+// mu
+func (ix *IssuedIndex) append(record IssuedRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal issued record: %v", err)
+	}
+	if _, err := ix.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append issued record: %v", err)
+	}
+	if err := ix.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync issued index: %v", err)
+	}
+	ix.put(record)
+	return nil
+}
+
+// Add appends record to the ledger
+func (ix *IssuedIndex) Add(record IssuedRecord) error {
+	if record.Status == "" {
+		record.Status = StatusGood
+	}
+	if record.IssuedAt.IsZero() {
+		record.IssuedAt = time.Now().UTC()
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if _, exists := ix.records[record.Serial]; exists {
+		return fmt.Errorf("serial %s is already in the issued index", record.Serial)
+	}
+	return ix.append(record)
+}
+
+// MarkRevoked records the revocation of serial, or a new reason for it.
+// Serials the ledger does not know, such as certificates issued before it
+// existed, are ignored.
+func (ix *IssuedIndex) MarkRevoked(serial *big.Int, revokedAt time.Time, reason int) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	record, ok := ix.records[serial.Text(16)]
+	if !ok || (record.Status == StatusRevoked && record.RevocationReason == reason && record.RevokedAt.Equal(revokedAt)) {
+		return nil
+	}
+	record.Status = StatusRevoked
+	record.RevokedAt = revokedAt
+	record.RevocationReason = reason
+	return ix.append(record)
+}
+
+// ScheduleRevocation records that serial is to be revoked as superseded at
+// revokeAfter. Unknown or already revoked serials are ignored.
+func (ix *IssuedIndex) ScheduleRevocation(serial *big.Int, revokeAfter time.Time) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	record, ok := ix.records[serial.Text(16)]
+	if !ok || record.Status == StatusRevoked {
+		return nil
+	}
+	if !record.RevokeAfter.IsZero() && record.RevokeAfter.Before(revokeAfter) {
+		// An earlier renewal already scheduled it sooner
+		return nil
+	}
+	record.RevokeAfter = revokeAfter
+	return ix.append(record)
+}
+
+// DueRevocations returns the serials whose scheduled revocation is due at t
+func (ix *IssuedIndex) DueRevocations(t time.Time) []string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	var due []string
+	for serial, revokeAfter := range ix.scheduled {
+		if !revokeAfter.After(t) {
+			due = append(due, serial)
+		}
+	}
+	sort.Strings(due)
+	return due
+}
+
+// Revoked returns the revoked certificates of the given record type,
+// oldest first
+func (ix *IssuedIndex) Revoked(recordType string) []IssuedRecord {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	var records []IssuedRecord
+	for _, record := range ix.records {
+		if record.Type == recordType && record.Status == StatusRevoked {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].IssuedAt.Before(records[j].IssuedAt)
+	})
+	return records
+}
+
+// LastExpiry returns when the last X.509 certificate issued by the CA with
+// the given issuer ID expires. Records from before the ledger tracked
+// issuers count for every CA.
+func (ix *IssuedIndex) LastExpiry(issuer string) time.Time {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	last := ix.lastExpiry[issuer]
+	if legacy := ix.lastExpiry[""]; legacy.After(last) {
+		last = legacy
+	}
+	return last
+}
+
+// Lookup returns the record for serial, if the signer issued it
+func (ix *IssuedIndex) Lookup(serial *big.Int) (IssuedRecord, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	record, ok := ix.records[serial.Text(16)]
+	return record, ok
+}
+
+// ByUser returns the certificates issued to username, oldest first
+func (ix *IssuedIndex) ByUser(username string) []IssuedRecord {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.collect(ix.byUser[username])
+}
+
+// ByFingerprint returns the certificates issued for the public key with the
+// given hex SHA-256 fingerprint, oldest first
+func (ix *IssuedIndex) ByFingerprint(fingerprint string) []IssuedRecord {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.collect(ix.byFingerprint[strings.ToLower(fingerprint)])
+}
+
+// collect returns the records for serials ordered by issue time; callers
+// must hold mu
+func (ix *IssuedIndex) collect(serials []string) []IssuedRecord {
+	records := make([]IssuedRecord, 0, len(serials))
+	for _, serial := range serials {
+		records = append(records, ix.records[serial])
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].IssuedAt.Before(records[j].IssuedAt)
+	})
+	return records
+}
+
+// Close closes the underlying file
+func (ix *IssuedIndex) Close() error {
+	return ix.file.Close()
+}
@@ -0,0 +1,98 @@
+package signer
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignerRecordsIssuedCertificates(t *testing.T) {
+	s, _ := newTestSigner(t)
+	certPEM, err := s.SignCSR(makeCSR(t, "alice"), []string{"developers"}, "", Identity{UserID: "1", Username: "alice", RequestID: "req-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := parseCertificate(t, certPEM)
+
+	records := s.issued.ByUser("alice")
+	if len(records) != 1 {
+		t.Fatalf("%d records for alice, want 1", len(records))
+	}
+	record := records[0]
+	if record.Serial != cert.SerialNumber.Text(16) || record.UserID != "1" || record.RequestID != "req-1" || record.Profile != "default" {
+		t.Errorf("record = %+v", record)
+	}
+	if record.Fingerprint != Fingerprint(cert.Raw) || !record.NotAfter.Truncate(time.Second).Equal(cert.NotAfter) {
+		t.Errorf("record does not describe the certificate: %+v", record)
+	}
+	if got := s.issued.ByFingerprint(strings.ToUpper(Fingerprint(cert.RawSubjectPublicKeyInfo))); len(got) != 1 || got[0].Serial != record.Serial {
+		t.Errorf("lookup by public key fingerprint = %v", got)
+	}
+
+	if _, err := s.Revoke(cert.SerialNumber, ReasonKeyCompromise); err != nil {
+		t.Fatal(err)
+	}
+	record, _ = s.issued.Lookup(cert.SerialNumber)
+	if record.Status != StatusRevoked || record.RevocationReason != ReasonKeyCompromise {
+		t.Errorf("record after revocation = %+v", record)
+	}
+}
+
+func TestIssuedIndexPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger", "issued.jsonl")
+	ix, err := OpenIssuedIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	expired := IssuedRecord{Serial: "1", Subject: "CN=alice", Username: "alice", NotAfter: now.Add(-time.Hour)}
+	valid := IssuedRecord{Serial: "2", Subject: "CN=alice", Username: "alice", NotAfter: now.Add(time.Hour)}
+	for _, record := range []IssuedRecord{expired, valid} {
+		if err := ix.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ix.Add(valid); err == nil {
+		t.Error("added a serial twice")
+	}
+	if err := ix.MarkRevoked(big.NewInt(2), now, ReasonSuperseded); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.MarkRevoked(big.NewInt(3), now, ReasonSuperseded); err != nil {
+		t.Errorf("revoking a serial the ledger does not know: %v", err)
+	}
+	ix.Close()
+
+	// The revocation is a second line for serial 2, which wins on reload
+	if ix, err = OpenIssuedIndex(path); err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	records := ix.ByUser("alice")
+	if len(records) != 2 {
+		t.Fatalf("%d records after reopening, want 2", len(records))
+	}
+	statuses := map[string]string{}
+	for _, record := range records {
+		statuses[record.Serial] = record.StatusAt(now)
+	}
+	if statuses["1"] != StatusExpired || statuses["2"] != StatusRevoked {
+		t.Errorf("statuses = %v, want 1 expired and 2 revoked", statuses)
+	}
+	if revoked := ix.Revoked(RecordTypeX509); len(revoked) != 1 || revoked[0].RevocationReason != ReasonSuperseded {
+		t.Errorf("revoked records = %+v", revoked)
+	}
+}
+
+func TestOpenIssuedIndexRejectsCorruptLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "issued.jsonl")
+	if err := os.WriteFile(path, []byte("{\"serial\":\"1\"}\nnot json\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenIssuedIndex(path); err == nil {
+		t.Error("opened a corrupt ledger")
+	}
+}
@@ -0,0 +1,206 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// IssuingCA is a CA the signer can issue from, with where its CRLs and
+// certificate are published
+type IssuingCA struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+	Chain       []*x509.Certificate // issuers above Certificate, nearest first
+
+	// ActivateAt is when issuance may switch to this CA; zero means at once
+	ActivateAt time.Time
+
+	CRLDistributionURL string
+	DeltaCRLURL        string
+	AIAIssuerURL       string
+}
+
+// issuer is an IssuingCA held by the signer
+type issuer struct {
+	IssuingCA
+	id          string // issuerID of the certificate
+	fingerprint string // Fingerprint of the certificate
+	ocsp        *ocspResponder
+}
+
+// issuerID identifies the CA that issued a certificate by its name and key,
+// as relying parties do. A CA certificate renewed with the same name and
+// key (CA-mgmt's renew-ca.sh) keeps its ID and its CRL scope.
+func issuerID(cert *x509.Certificate) string {
+	return Fingerprint(append(append([]byte{}, cert.RawSubject...), cert.RawSubjectPublicKeyInfo...))
+}
+
+// SetIssuingCAs replaces the CAs the signer holds. Issuance switches to the
+// newest CA, by certificate date, whose ActivateAt has passed; the others
+// keep their CRLs and OCSP responses until the last certificate they issued
+// expires. It waits for signatures in progress with the old CAs, so they
+// can be closed once it returns.
+func (s *Signer) SetIssuingCAs(cas []IssuingCA) error {
+	previous := make(map[string]*ocspResponder)
+	s.caMu.RLock()
+	for _, iss := range s.cas {
+		previous[iss.fingerprint] = iss.ocsp
+	}
+	s.caMu.RUnlock()
+
+	issuers := make([]*issuer, 0, len(cas))
+	crlURLs := make(map[string]bool)
+	for _, ca := range cas {
+		if ca.Certificate == nil || ca.Key == nil {
+			return fmt.Errorf("issuing CA without certificate or key")
+		}
+		for _, u := range []string{ca.CRLDistributionURL, ca.DeltaCRLURL} {
+			if u != "" && crlURLs[u] {
+				return fmt.Errorf("CRL URL %s is used by more than one issuing CA", u)
+			}
+			crlURLs[u] = true
+		}
+		iss := &issuer{
+			IssuingCA:   ca,
+			id:          issuerID(ca.Certificate),
+			fingerprint: Fingerprint(ca.Certificate.Raw),
+			ocsp:        previous[Fingerprint(ca.Certificate.Raw)],
+		}
+		if iss.ocsp == nil {
+			iss.ocsp = &ocspResponder{}
+		}
+		issuers = append(issuers, iss)
+	}
+	current := newestActive(issuers, time.Now())
+	if current == nil {
+		return fmt.Errorf("none of the issuing CAs is active and unexpired")
+	}
+
+	s.caMu.Lock()
+	s.cas = issuers
+	err := s.registerCRLRoutesLocked()
+	s.caMu.Unlock()
+
+	s.noteIssuer(current)
+	return err
+}
+
+// newestActive returns the CA to issue from at now: the one with the most
+// recent certificate among those activated and not expired
+func newestActive(cas []*issuer, now time.Time) *issuer {
+	var newest *issuer
+	for _, iss := range cas {
+		if iss.ActivateAt.After(now) || !now.Before(iss.Certificate.NotAfter) {
+			continue
+		}
+		if newest == nil || iss.Certificate.NotBefore.After(newest.Certificate.NotBefore) {
+			newest = iss
+		}
+	}
+	return newest
+}
+
+// currentIssuerLocked returns the CA to issue from, or nil if there is
+// none; callers must hold caMu
+func (s *Signer) currentIssuerLocked() *issuer {
+	current := newestActive(s.cas, time.Now())
+	if current != nil {
+		s.noteIssuer(current)
+	}
+	return current
+}
+
+// liveIssuersLocked returns the CAs that still publish CRLs and answer
+// OCSP: the current one, those not yet activated and those with
+// certificates that have not expired; callers must hold caMu
+func (s *Signer) liveIssuersLocked() []*issuer {
+	now := time.Now()
+	current := newestActive(s.cas, now)
+	var live []*issuer
+	for _, iss := range s.cas {
+		if iss == current || iss.ActivateAt.After(now) || s.issued.LastExpiry(iss.id).After(now) {
+			live = append(live, iss)
+		}
+	}
+	return live
+}
+
+// noteIssuer logs when issuance switches to another CA
+func (s *Signer) noteIssuer(current *issuer) {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	if s.activeCA == current.fingerprint {
+		return
+	}
+	previous := s.activeCA
+	s.activeCA = current.fingerprint
+	if previous == "" {
+		s.logger.Infof("Issuing from CA %s (expires %s)", current.Certificate.Subject.String(), current.Certificate.NotAfter.Format(time.RFC3339))
+		return
+	}
+	s.logger.LogSecurityEvent("issuing_ca_switched", map[string]interface{}{
+		"subject":     current.Certificate.Subject.String(),
+		"fingerprint": current.fingerprint,
+		"previous":    previous,
+		"not_after":   current.Certificate.NotAfter,
+	})
+}
+
+// registerCRLRoutesLocked serves the CRLs of any CA whose URLs are not yet
+// registered on the CRL mux; callers must hold caMu for writing
+func (s *Signer) registerCRLRoutesLocked() error {
+	if s.crlMux == nil {
+		return nil
+	}
+	for _, iss := range s.cas {
+		for _, u := range []struct {
+			raw   string
+			delta bool
+		}{{iss.CRLDistributionURL, false}, {iss.DeltaCRLURL, true}} {
+			if u.raw == "" {
+				continue
+			}
+			parsed, err := url.Parse(u.raw)
+			if err != nil || parsed.Path == "" {
+				return fmt.Errorf("invalid CRL URL %q", u.raw)
+			}
+			if s.crlPaths[parsed.Path] {
+				continue
+			}
+			s.crlMux.HandleFunc(parsed.Path, s.serveCRL(parsed.Path, u.delta))
+			s.crlPaths[parsed.Path] = true
+		}
+	}
+	return nil
+}
+
+// RegisterCRLRoutes serves the full and delta CRLs of each CA at the paths
+// of its distribution URLs. CAs added later by SetIssuingCAs are served too.
+func (s *Signer) RegisterCRLRoutes(mux *http.ServeMux) error {
+	s.caMu.Lock()
+	defer s.caMu.Unlock()
+	s.crlMux = mux
+	s.crlPaths = make(map[string]bool)
+	return s.registerCRLRoutesLocked()
+}
+
+// crlIssuer returns the live CA whose full or delta CRL is published at
+// path
+func (s *Signer) crlIssuer(path string, delta bool) *issuer {
+	s.caMu.RLock()
+	defer s.caMu.RUnlock()
+	for _, iss := range s.liveIssuersLocked() {
+		raw := iss.CRLDistributionURL
+		if delta {
+			raw = iss.DeltaCRLURL
+		}
+		if parsed, err := url.Parse(raw); err == nil && raw != "" && parsed.Path == path {
+			return iss
+		}
+	}
+	return nil
+}
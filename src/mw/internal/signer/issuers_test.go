@@ -0,0 +1,177 @@
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// fetchCRL gets the CRL at path from server and checks ca signed it
+func fetchCRL(t *testing.T, server *httptest.Server, path string, ca *x509.Certificate) *x509.RevocationList {
+	t.Helper()
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	der, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %d %s", path, resp.StatusCode, der)
+	}
+	return parseCRL(t, der, ca)
+}
+
+func TestIssuingCARotation(t *testing.T) {
+	s, _ := newTestSigner(t)
+	old := s.cas[0].IssuingCA
+	newCA, newKey := newTestCA(t, "Test CA 2", time.Now().Add(-time.Minute))
+	next := IssuingCA{
+		Certificate:        newCA,
+		Key:                newKey,
+		ActivateAt:         time.Now().Add(time.Hour),
+		CRLDistributionURL: "http://crl.example.com/ca2.crl",
+		DeltaCRLURL:        "http://crl.example.com/ca2-delta.crl",
+	}
+
+	mux := http.NewServeMux()
+	if err := s.RegisterCRLRoutes(mux); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	before := issue(t, s, "alice", nil)
+	if err := before.CheckSignatureFrom(old.Certificate); err != nil {
+		t.Fatalf("issued before rotation: %v", err)
+	}
+
+	// A CA not yet activated publishes its (empty) CRL, so relying parties
+	// have it by the time certificates appear
+	if err := s.SetIssuingCAs([]IssuingCA{old, next}); err != nil {
+		t.Fatal(err)
+	}
+	if err := issue(t, s, "alice", nil).CheckSignatureFrom(old.Certificate); err != nil {
+		t.Errorf("issued before activation: %v", err)
+	}
+	if crl := fetchCRL(t, server, "/ca2.crl", newCA); len(crl.RevokedCertificateEntries) != 0 {
+		t.Errorf("pending CA's CRL lists %d certificates", len(crl.RevokedCertificateEntries))
+	}
+
+	next.ActivateAt = time.Now()
+	if err := s.SetIssuingCAs([]IssuingCA{old, next}); err != nil {
+		t.Fatal(err)
+	}
+	after := issue(t, s, "alice", nil)
+	if err := after.CheckSignatureFrom(newCA); err != nil {
+		t.Fatalf("issued after activation: %v", err)
+	}
+	if len(after.CRLDistributionPoints) != 1 || after.CRLDistributionPoints[0] != next.CRLDistributionURL {
+		t.Errorf("CRL distribution points = %v, want the new CA's", after.CRLDistributionPoints)
+	}
+	caCerts, err := s.GetCACertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block, _ := pem.Decode(caCerts[0]); block == nil || string(block.Bytes) != string(newCA.Raw) {
+		t.Error("the first CA certificate is not the new CA")
+	}
+
+	// Each CA lists its own certificates, and keeps answering for them
+	for _, cert := range []*x509.Certificate{before, after} {
+		if _, err := s.Revoke(cert.SerialNumber, ReasonKeyCompromise); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.GenerateCRL(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		path string
+		ca   *x509.Certificate
+		want *x509.Certificate
+	}{
+		{"/ca.crl", old.Certificate, before},
+		{"/ca2.crl", newCA, after},
+	} {
+		got := revokedSerials(fetchCRL(t, server, tt.path, tt.ca))
+		if _, ok := got[tt.want.SerialNumber.Text(16)]; !ok || len(got) != 1 {
+			t.Errorf("%s lists %v, want only %s", tt.path, got, tt.want.SerialNumber.Text(16))
+		}
+	}
+	for _, tt := range []struct {
+		path string
+		ca   *x509.Certificate
+	}{
+		{"/ca-delta.crl", old.Certificate},
+		{"/ca2-delta.crl", newCA},
+	} {
+		if crl := fetchCRL(t, server, tt.path, tt.ca); len(crl.RevokedCertificateEntries) != 0 {
+			t.Errorf("%s lists %d certificates after the base CRL", tt.path, len(crl.RevokedCertificateEntries))
+		}
+	}
+	for _, tt := range []struct {
+		cert, ca *x509.Certificate
+	}{
+		{before, old.Certificate},
+		{after, newCA},
+	} {
+		req, err := ocsp.CreateRequest(tt.cert, tt.ca, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := s.CreateOCSPResponse(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := ocsp.ParseResponseForCert(der, tt.cert, tt.ca)
+		if err != nil {
+			t.Fatalf("OCSP for %s: %v", tt.ca.Subject.CommonName, err)
+		}
+		if resp.Status != ocsp.Revoked {
+			t.Errorf("OCSP for %s: status %d, want revoked", tt.ca.Subject.CommonName, resp.Status)
+		}
+	}
+}
+
+func TestRetiredIssuingCA(t *testing.T) {
+	s, _ := newTestSigner(t)
+	current := s.cas[0].IssuingCA
+	mux := http.NewServeMux()
+	if err := s.RegisterCRLRoutes(mux); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// An older CA that never issued anything has nothing to publish
+	retiredCA, retiredKey := newTestCA(t, "Retired CA", time.Now().Add(-48*time.Hour))
+	retired := IssuingCA{Certificate: retiredCA, Key: retiredKey, CRLDistributionURL: "http://crl.example.com/retired.crl"}
+	if err := s.SetIssuingCAs([]IssuingCA{current, retired}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(server.URL + "/retired.crl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("retired CA's CRL: %d, want 404", resp.StatusCode)
+	}
+
+	retired.CRLDistributionURL = current.CRLDistributionURL
+	if err := s.SetIssuingCAs([]IssuingCA{current, retired}); err == nil {
+		t.Error("accepted two CAs publishing at one CRL URL")
+	}
+	if err := s.SetIssuingCAs([]IssuingCA{{Certificate: retiredCA}}); err == nil {
+		t.Error("accepted a CA without a key")
+	}
+}
@@ -0,0 +1,186 @@
+package signer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/ogt11/certm3/mw/internal/config"
+)
+
+// LDAPConn is the part of an LDAP connection the LDAP source uses, so a
+// stub directory can stand in through LDAPSource.Dial
+type LDAPConn interface {
+	Bind(username, password string) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close()
+}
+
+// LDAPSource looks groups up in an LDAP directory
+type LDAPSource struct {
+	cfg          config.GroupSourceConfig
+	bindPassword string
+	attempts     int
+
+	// Dial opens a connection to the directory
+	Dial func() (LDAPConn, error)
+}
+
+// NewLDAPSource returns a source searching the directory cfg describes.
+// Connecting and each operation time out after timeout; failed connections
+// are tried attempts times in all.
+func NewLDAPSource(cfg config.GroupSourceConfig, timeout time.Duration, attempts int) (*LDAPSource, error) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	src := &LDAPSource{cfg: cfg, attempts: attempts}
+	if cfg.BindPasswordPath != "" {
+		raw, err := os.ReadFile(cfg.BindPasswordPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LDAP bind password: %v", err)
+		}
+		src.bindPassword = strings.TrimSpace(string(raw))
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAPath != "" {
+		caPEM, err := os.ReadFile(cfg.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LDAP CA: %v", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in LDAP CA file %s", cfg.CAPath)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if u, err := url.Parse(cfg.URL); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	src.Dial = func() (LDAPConn, error) {
+		conn, err := ldap.DialURL(cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+		if err != nil {
+			return nil, err
+		}
+		if timeout > 0 {
+			conn.SetTimeout(timeout)
+		}
+		if cfg.StartTLS {
+			if err := conn.StartTLS(tlsConfig); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("StartTLS failed: %v", err)
+			}
+		}
+		return conn, nil
+	}
+	return src, nil
+}
+
+// UserGroups searches the directory for the user and their groups
+func (l *LDAPSource) UserGroups(username string) ([]string, error) {
+	conn, err := l.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	memberOf := l.cfg.MemberOfAttribute
+	attributes := []string{"dn"}
+	if l.cfg.GroupFilter == "" {
+		attributes = append(attributes, memberOf)
+	}
+	users, err := conn.Search(ldap.NewSearchRequest(
+		l.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		expandLDAPFilter(l.cfg.UserFilter, username, ""),
+		attributes, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return nil, fmt.Errorf("LDAP user search failed: %v", err)
+	}
+	if users == nil || len(users.Entries) == 0 {
+		return nil, fmt.Errorf("%s: %w", username, ErrUnknownUser)
+	}
+	if len(users.Entries) > 1 {
+		return nil, fmt.Errorf("LDAP user filter matches more than one entry for %s", username)
+	}
+	user := users.Entries[0]
+
+	var groups []string
+	if l.cfg.GroupFilter == "" {
+		for _, dn := range user.GetAttributeValues(memberOf) {
+			if cn := firstCN(dn); cn != "" {
+				groups = append(groups, cn)
+			}
+		}
+		return groups, nil
+	}
+
+	found, err := conn.Search(ldap.NewSearchRequest(
+		l.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		expandLDAPFilter(l.cfg.GroupFilter, username, user.DN),
+		[]string{l.cfg.GroupAttribute}, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return nil, fmt.Errorf("LDAP group search failed: %v", err)
+	}
+	if found != nil {
+		for _, entry := range found.Entries {
+			groups = append(groups, entry.GetAttributeValues(l.cfg.GroupAttribute)...)
+		}
+	}
+	return groups, nil
+}
+
+// connect dials the directory and binds, retrying connections that fail
+func (l *LDAPSource) connect() (LDAPConn, error) {
+	var lastErr error
+	for attempt := 0; attempt < l.attempts; attempt++ {
+		conn, err := l.Dial()
+		if err != nil {
+			lastErr = fmt.Errorf("failed to connect to LDAP server: %v", err)
+			continue
+		}
+		if l.cfg.BindDN != "" {
+			if err := conn.Bind(l.cfg.BindDN, l.bindPassword); err != nil {
+				conn.Close()
+				if ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+					lastErr = fmt.Errorf("LDAP bind failed: %v", err)
+					continue
+				}
+				return nil, fmt.Errorf("LDAP bind as %s failed: %v", l.cfg.BindDN, err)
+			}
+		}
+		return conn, nil
+	}
+	return nil, lastErr
+}
+
+// expandLDAPFilter replaces {username} and {dn} in filter with the escaped
+// values
+func expandLDAPFilter(filter, username, dn string) string {
+	return strings.NewReplacer(
+		"{username}", ldap.EscapeFilter(username),
+		"{dn}", ldap.EscapeFilter(dn),
+	).Replace(filter)
+}
+
+// firstCN returns the value of the leading CN of a DN, or "" if the DN
+// does not start with one
+func firstCN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return ""
+	}
+	for _, attr := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") {
+			return attr.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,285 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// OIDs used by the OCSP responder
+var (
+	oidOCSPNonce   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+	oidOCSPNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+)
+
+// maxOCSPRequestSize bounds the size of POSTed OCSP requests
+const maxOCSPRequestSize = 10 * 1024
+
+// ocspRequestEnvelope is enough of the RFC 6960 OCSPRequest structure to get
+// at the request extensions, which x/crypto/ocsp does not expose
+type ocspRequestEnvelope struct {
+	TBSRequest struct {
+		Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+		RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+		RequestList   []asn1.RawValue
+		Extensions    []pkix.Extension `asn1:"explicit,tag:2,optional"`
+	}
+	Signature asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// ocspResponder holds the state of the built-in OCSP responder
+type ocspResponder struct {
+	mu sync.Mutex
+	// Delegated responder certificate and key, renewed before they expire
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// ocspSigner returns the certificate and key used to sign OCSP responses
+// for iss: either the CA itself or a delegated OCSP-signing certificate
+// issued by it
+func (s *Signer) ocspSigner(iss *issuer) (*x509.Certificate, crypto.Signer, error) {
+	if !s.config.Signer.OCSPDelegated {
+		return iss.Certificate, iss.Key, nil
+	}
+
+	iss.ocsp.mu.Lock()
+	defer iss.ocsp.mu.Unlock()
+
+	// Renew once half of the delegated certificate's lifetime has passed
+	if iss.ocsp.cert != nil {
+		lifetime := iss.ocsp.cert.NotAfter.Sub(iss.ocsp.cert.NotBefore)
+		if time.Now().Before(iss.ocsp.cert.NotBefore.Add(lifetime / 2)) {
+			return iss.ocsp.cert, iss.ocsp.key, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate OCSP signing key: %v", err)
+	}
+	serialNumber, err := generateSerialNumber()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+	// id-pkix-ocsp-nocheck tells clients not to check the responder's own status
+	noCheck, err := asn1.Marshal(asn1.NullRawValue)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode OCSP no-check extension: %v", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: iss.Certificate.Subject.CommonName + " OCSP Responder"},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(s.config.Signer.OCSPSignerValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		ExtraExtensions:       []pkix.Extension{{Id: oidOCSPNoCheck, Value: noCheck}},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, iss.Certificate, &key.PublicKey, iss.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to issue OCSP signing certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse OCSP signing certificate: %v", err)
+	}
+
+	s.logger.Infof("Issued delegated OCSP signing certificate serial %s valid until %s", cert.SerialNumber.Text(16), cert.NotAfter.Format(time.RFC3339))
+	iss.ocsp.cert = cert
+	iss.ocsp.key = key
+	return cert, key, nil
+}
+
+// CreateOCSPResponse answers a DER encoded OCSP request from the signer's
+// issuance and revocation records
+func (s *Signer) CreateOCSPResponse(der []byte) ([]byte, error) {
+	req, err := ocsp.ParseRequest(der)
+	if err != nil {
+		s.metrics.RecordOCSPResponse("malformed")
+		return ocsp.MalformedRequestErrorResponse, nil
+	}
+
+	// Only answer for certificates issued by one of our CAs
+	s.caMu.RLock()
+	defer s.caMu.RUnlock()
+	iss := s.ocspIssuerLocked(req)
+	if iss == nil {
+		s.metrics.RecordOCSPResponse("unauthorized")
+		return ocsp.UnauthorizedErrorResponse, nil
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	template := ocsp.Response{
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(s.config.Signer.OCSPValidity),
+		Status:       ocsp.Unknown,
+	}
+
+	// Serials another of our CAs issued are unknown to this one
+	record, issued := s.issued.Lookup(req.SerialNumber)
+	if !issued || record.Issuer == "" || record.Issuer == iss.id {
+		if entry, revoked := s.revocations.Lookup(req.SerialNumber); revoked {
+			template.Status = ocsp.Revoked
+			template.RevokedAt = entry.RevokedAt
+			template.RevocationReason = entry.Reason
+		} else if issued {
+			template.Status = ocsp.Good
+		}
+	}
+
+	// Echo the nonce, if the client sent one
+	var envelope ocspRequestEnvelope
+	if _, err := asn1.Unmarshal(der, &envelope); err == nil {
+		for _, ext := range envelope.TBSRequest.Extensions {
+			if ext.Id.Equal(oidOCSPNonce) {
+				template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: oidOCSPNonce, Value: ext.Value})
+			}
+		}
+	}
+
+	responderCert, responderKey, err := s.ocspSigner(iss)
+	if err != nil {
+		return nil, err
+	}
+	if responderCert != iss.Certificate {
+		template.Certificate = responderCert
+	}
+
+	resp, err := ocsp.CreateResponse(iss.Certificate, responderCert, template, responderKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCSP response: %v", err)
+	}
+	s.metrics.RecordOCSPResponse(ocspStatusName(template.Status))
+	return resp, nil
+}
+
+// ocspIssuerLocked returns the live CA whose name and key hashes match the
+// request's, or nil; callers must hold caMu
+func (s *Signer) ocspIssuerLocked(req *ocsp.Request) *issuer {
+	if !req.HashAlgorithm.Available() {
+		return nil
+	}
+	for _, iss := range s.liveIssuersLocked() {
+		if matchesIssuer(req, iss.Certificate) {
+			return iss
+		}
+	}
+	return nil
+}
+
+// matchesIssuer reports whether the request's issuer hashes match ca
+func matchesIssuer(req *ocsp.Request, ca *x509.Certificate) bool {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(ca.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+
+	h := req.HashAlgorithm.New()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+
+	h = req.HashAlgorithm.New()
+	h.Write(ca.RawSubject)
+	nameHash := h.Sum(nil)
+
+	return string(keyHash) == string(req.IssuerKeyHash) && string(nameHash) == string(req.IssuerNameHash)
+}
+
+// ocspStatusName returns a metrics label for an OCSP certificate status
+func ocspStatusName(status int) string {
+	switch status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	default:
+		return "unknown"
+	}
+}
+
+// RegisterOCSPRoutes serves the OCSP responder at the path of the configured
+// OCSP URL, accepting both the GET and the POST forms of RFC 6960 appendix A
+func (s *Signer) RegisterOCSPRoutes(mux *http.ServeMux) error {
+	ocspURL, err := url.Parse(s.config.Signer.OCSPURL)
+	if err != nil {
+		return fmt.Errorf("invalid OCSP URL %q", s.config.Signer.OCSPURL)
+	}
+	prefix := strings.TrimSuffix(ocspURL.Path, "/") + "/"
+	mux.HandleFunc(prefix, s.serveOCSP(prefix))
+	// POSTs go to the URL itself, which the mux would otherwise redirect
+	if prefix != "/" {
+		mux.HandleFunc(strings.TrimSuffix(prefix, "/"), s.serveOCSP(prefix))
+	}
+	return nil
+}
+
+// serveOCSP returns a handler for OCSP requests below prefix
+func (s *Signer) serveOCSP(prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var der []byte
+		var err error
+
+		switch r.Method {
+		case http.MethodGet:
+			// The request is base64 encoded, then URL encoded, in the path
+			encoded := strings.TrimPrefix(r.URL.EscapedPath(), strings.TrimSuffix(prefix, "/"))
+			encoded = strings.TrimPrefix(encoded, "/")
+			if encoded, err = url.PathUnescape(encoded); err == nil {
+				der, err = base64.StdEncoding.DecodeString(encoded)
+			}
+		case http.MethodPost:
+			if r.Header.Get("Content-Type") != "application/ocsp-request" {
+				http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+				return
+			}
+			der, err = io.ReadAll(io.LimitReader(r.Body, maxOCSPRequestSize))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			s.metrics.RecordOCSPResponse("malformed")
+			w.Header().Set("Content-Type", "application/ocsp-response")
+			w.Write(ocsp.MalformedRequestErrorResponse)
+			return
+		}
+
+		resp, err := s.CreateOCSPResponse(der)
+		if err != nil {
+			s.logger.Errorf("Failed to answer OCSP request: %v", err)
+			w.Header().Set("Content-Type", "application/ocsp-response")
+			w.Write(ocsp.InternalErrorErrorResponse)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		if r.Method == http.MethodGet {
+			w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(s.config.Signer.OCSPValidity.Seconds()/2)))
+		}
+		w.Write(resp)
+	}
+}
@@ -0,0 +1,169 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspStatus asks s about cert and returns the verified response
+func ocspStatus(t *testing.T, s *Signer, cert *x509.Certificate) *ocsp.Response {
+	t.Helper()
+	ca := s.cas[0].Certificate
+	req, err := ocsp.CreateRequest(cert, ca, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := s.CreateOCSPResponse(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ocsp.ParseResponseForCert(der, cert, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestOCSPStatus(t *testing.T) {
+	s, cfg := newTestSigner(t)
+	cfg.Signer.OCSPValidity = time.Hour
+	cert := issue(t, s, "alice", nil)
+
+	resp := ocspStatus(t, s, cert)
+	if resp.Status != ocsp.Good {
+		t.Errorf("status = %d, want good", resp.Status)
+	}
+	if resp.Certificate != nil {
+		t.Error("the CA signed the response but it embeds a responder certificate")
+	}
+	if got := resp.NextUpdate.Sub(resp.ThisUpdate); got != cfg.Signer.OCSPValidity {
+		t.Errorf("validity = %s, want %s", got, cfg.Signer.OCSPValidity)
+	}
+
+	if _, err := s.Revoke(cert.SerialNumber, ReasonKeyCompromise); err != nil {
+		t.Fatal(err)
+	}
+	resp = ocspStatus(t, s, cert)
+	if resp.Status != ocsp.Revoked || resp.RevocationReason != ReasonKeyCompromise {
+		t.Errorf("status = %d reason %d, want revoked for keyCompromise", resp.Status, resp.RevocationReason)
+	}
+
+	// A serial the signer never issued
+	unknown := *cert
+	unknown.SerialNumber = s.cas[0].Certificate.SerialNumber
+	if resp := ocspStatus(t, s, &unknown); resp.Status != ocsp.Unknown {
+		t.Errorf("status of an unknown serial = %d, want unknown", resp.Status)
+	}
+}
+
+func TestOCSPRejectsOtherIssuers(t *testing.T) {
+	s, _ := newTestSigner(t)
+	other, _ := newTestSigner(t)
+	cert := issue(t, other, "alice", nil)
+
+	req, err := ocsp.CreateRequest(cert, other.cas[0].Certificate, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := s.CreateOCSPResponse(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(der, ocsp.UnauthorizedErrorResponse) {
+		t.Error("answered for a certificate another CA issued")
+	}
+}
+
+func TestOCSPDelegatedResponder(t *testing.T) {
+	s, cfg := newTestSigner(t)
+	cfg.Signer.OCSPValidity = time.Hour
+	cfg.Signer.OCSPDelegated = true
+	cfg.Signer.OCSPSignerValidity = 24 * time.Hour
+	cert := issue(t, s, "alice", nil)
+
+	resp := ocspStatus(t, s, cert)
+	if resp.Status != ocsp.Good {
+		t.Errorf("status = %d, want good", resp.Status)
+	}
+	responder := resp.Certificate
+	if responder == nil {
+		t.Fatal("delegated response carries no responder certificate")
+	}
+	if err := responder.CheckSignatureFrom(s.cas[0].Certificate); err != nil {
+		t.Errorf("responder certificate not issued by the CA: %v", err)
+	}
+	if len(responder.ExtKeyUsage) != 1 || responder.ExtKeyUsage[0] != x509.ExtKeyUsageOCSPSigning {
+		t.Errorf("responder extended key usage = %v, want OCSP signing only", responder.ExtKeyUsage)
+	}
+	noCheck := false
+	for _, ext := range responder.Extensions {
+		if ext.Id.Equal(oidOCSPNoCheck) {
+			noCheck = true
+		}
+	}
+	if !noCheck {
+		t.Error("responder certificate lacks id-pkix-ocsp-nocheck")
+	}
+
+	// The responder certificate is reused until it nears expiry
+	if again := ocspStatus(t, s, cert); !again.Certificate.Equal(responder) {
+		t.Error("a new responder certificate was issued for the second response")
+	}
+}
+
+func TestOCSPOverHTTP(t *testing.T) {
+	s, cfg := newTestSigner(t)
+	cfg.Signer.OCSPURL = "http://ocsp.example.com/ocsp"
+	cfg.Signer.OCSPValidity = time.Hour
+	cert := issue(t, s, "alice", nil)
+	ca := s.cas[0].Certificate
+
+	mux := http.NewServeMux()
+	if err := s.RegisterOCSPRoutes(mux); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, err := ocsp.CreateRequest(cert, ca, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := server.URL + "/ocsp/" + url.PathEscape(base64.StdEncoding.EncodeToString(req))
+	post := func() (*http.Response, error) {
+		return http.Post(server.URL+"/ocsp", "application/ocsp-request", bytes.NewReader(req))
+	}
+	for name, do := range map[string]func() (*http.Response, error){
+		"GET":  func() (*http.Response, error) { return http.Get(get) },
+		"POST": post,
+	} {
+		httpResp, err := do()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := httpResp.Header.Get("Content-Type"); ct != "application/ocsp-response" {
+			t.Errorf("%s: content type = %q", name, ct)
+		}
+		resp, err := ocsp.ParseResponseForCert(body, cert, ca)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if resp.Status != ocsp.Good {
+			t.Errorf("%s: status = %d, want good", name, resp.Status)
+		}
+	}
+}
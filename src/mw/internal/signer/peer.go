@@ -0,0 +1,72 @@
+package signer
+
+import (
+	"net"
+	"os"
+)
+
+// PeerCred identifies the process connected to the signer's socket
+type PeerCred struct {
+	PID int
+	UID int
+	GID int
+}
+
+// peerPolicy lists the UIDs and primary GIDs allowed to use the socket
+type peerPolicy struct {
+	uids map[int]bool
+	gids map[int]bool
+}
+
+// newPeerPolicy builds a policy from the configured IDs. Without any, only
+// processes running as the signer's own UID are allowed.
+func newPeerPolicy(uids, gids []int) peerPolicy {
+	policy := peerPolicy{
+		uids: make(map[int]bool),
+		gids: make(map[int]bool),
+	}
+	if len(uids) == 0 && len(gids) == 0 {
+		policy.uids[os.Geteuid()] = true
+		return policy
+	}
+	for _, uid := range uids {
+		policy.uids[uid] = true
+	}
+	for _, gid := range gids {
+		policy.gids[gid] = true
+	}
+	return policy
+}
+
+// allows reports whether the peer may submit requests
+func (p peerPolicy) allows(cred PeerCred) bool {
+	return p.uids[cred.UID] || p.gids[cred.GID]
+}
+
+// authorizePeer checks the credentials of the process behind conn against
+// the configured policy, logging and counting rejected peers
+func (h *Handler) authorizePeer(conn net.Conn) bool {
+	cred, err := peerCredentials(conn)
+	if err != nil {
+		h.logger.LogSecurityEvent("peer_credentials_unavailable", map[string]interface{}{
+			"component": "signer",
+			"error":     err.Error(),
+		})
+		h.metrics.RecordSecurityEvent("peer_credentials_unavailable")
+		h.metrics.RecordPeerRejection("no_credentials")
+		return false
+	}
+
+	if !h.peers.allows(cred) {
+		h.logger.LogSecurityEvent("peer_rejected", map[string]interface{}{
+			"component": "signer",
+			"pid":       cred.PID,
+			"uid":       cred.UID,
+			"gid":       cred.GID,
+		})
+		h.metrics.RecordSecurityEvent("peer_rejected")
+		h.metrics.RecordPeerRejection("not_allowed")
+		return false
+	}
+	return true
+}
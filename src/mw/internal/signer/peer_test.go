@@ -0,0 +1,62 @@
+package signer
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestPeerPolicy(t *testing.T) {
+	self := PeerCred{PID: os.Getpid(), UID: os.Geteuid(), GID: os.Getegid()}
+	if !newPeerPolicy(nil, nil).allows(self) {
+		t.Error("default policy rejects the signer's own UID")
+	}
+	if newPeerPolicy(nil, nil).allows(PeerCred{UID: self.UID + 1, GID: self.GID}) {
+		t.Error("default policy allows another UID")
+	}
+
+	policy := newPeerPolicy([]int{1001}, []int{2002})
+	tests := []struct {
+		cred PeerCred
+		want bool
+	}{
+		{PeerCred{UID: 1001, GID: 1}, true},
+		{PeerCred{UID: 1, GID: 2002}, true},
+		{PeerCred{UID: 1, GID: 1001}, false},
+		{self, self.UID == 1001 || self.GID == 2002},
+	}
+	for _, tt := range tests {
+		if got := policy.allows(tt.cred); got != tt.want {
+			t.Errorf("allows(%+v) = %v, want %v", tt.cred, got, tt.want)
+		}
+	}
+}
+
+func TestConfigureSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signer.sock")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	gid := strconv.Itoa(os.Getegid())
+	if err := ConfigureSocket(path, "", gid, "0660"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0660 {
+		t.Errorf("mode = %v, want 0660", info.Mode().Perm())
+	}
+
+	for _, mode := range []string{"rw", "0999", "01777"} {
+		if err := ConfigureSocket(path, "", "", mode); err == nil {
+			t.Errorf("accepted socket mode %q", mode)
+		}
+	}
+	if err := ConfigureSocket(path, "no-such-user-certm3", "", "0660"); err == nil {
+		t.Error("accepted an unknown owner")
+	}
+}
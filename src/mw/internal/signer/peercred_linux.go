@@ -0,0 +1,35 @@
+//go:build linux
+
+package signer
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredentials returns the credentials of the process on the other end
+// of a Unix socket connection, as recorded by the kernel at connect time
+func peerCredentials(conn net.Conn) (PeerCred, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return PeerCred{}, fmt.Errorf("not a Unix socket connection")
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return PeerCred{}, fmt.Errorf("failed to access socket: %v", err)
+	}
+
+	var ucred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return PeerCred{}, fmt.Errorf("failed to access socket: %v", err)
+	}
+	if credErr != nil {
+		return PeerCred{}, fmt.Errorf("failed to read SO_PEERCRED: %v", credErr)
+	}
+	return PeerCred{PID: int(ucred.Pid), UID: int(ucred.Uid), GID: int(ucred.Gid)}, nil
+}
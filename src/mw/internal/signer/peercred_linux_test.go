@@ -0,0 +1,55 @@
+//go:build linux
+
+package signer
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+func TestPeerCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signer.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cred, err := peerCredentials(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.PID != os.Getpid() || cred.UID != os.Geteuid() || cred.GID != os.Getegid() {
+		t.Errorf("credentials = %+v, want this process", cred)
+	}
+}
+
+func TestHandlerRejectsPeers(t *testing.T) {
+	h, tickets := newTestHandler(t)
+	h.peers = newPeerPolicy([]int{os.Geteuid() + 1}, nil)
+
+	client := signerproto.NewClient("unix", serveUnix(t, h), time.Second)
+	if _, err := client.Sign(context.Background(), signRequest(t, tickets, "alice", "req-1", nil)); err == nil {
+		t.Fatal("signed for a peer the policy does not allow")
+	}
+	if len(h.signer.issued.ByUser("alice")) != 0 {
+		t.Error("a certificate was issued for a rejected peer")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package signer
+
+import (
+	"fmt"
+	"net"
+)
+
+// peerCredentials is only implemented on Linux; elsewhere every peer is
+// rejected rather than trusted
+func peerCredentials(conn net.Conn) (PeerCred, error) {
+	return PeerCred{}, fmt.Errorf("peer credentials are not supported on this platform")
+}
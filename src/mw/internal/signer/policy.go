@@ -0,0 +1,422 @@
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+	"gopkg.in/yaml.v2"
+)
+
+// Rules a request can be denied by
+const (
+	RuleMaxGroups        = "max_groups"
+	RuleExclusiveGroups  = "exclusive_groups"
+	RuleApprovalRequired = "approval_required"
+	RuleSANNotAllowed    = "san_not_allowed"
+)
+
+// DenyReason is one reason the issuance policy denies a request
+type DenyReason struct {
+	Rule    string `json:"rule"`              // one of the Rule constants
+	Subject string `json:"subject,omitempty"` // the group or SAN concerned
+	Message string `json:"message"`
+}
+
+// PolicyError is returned when the issuance policy denies a request. It
+// wraps ErrPolicyDenied.
+type PolicyError struct {
+	Reasons []DenyReason
+}
+
+// Error lists the reasons
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Reasons))
+	for i, reason := range e.Reasons {
+		messages[i] = reason.Message
+	}
+	return fmt.Sprintf("%s: %s", ErrPolicyDenied, strings.Join(messages, "; "))
+}
+
+// Unwrap returns ErrPolicyDenied
+func (e *PolicyError) Unwrap() error {
+	return ErrPolicyDenied
+}
+
+// policyFile is the YAML form of an issuance policy. Group names in it are
+// glob patterns, as in a profile's allowed_groups.
+type policyFile struct {
+	// MandatoryGroups are put in every certificate; {username} stands for
+	// the user's name
+	MandatoryGroups []string `yaml:"mandatory_groups"`
+	// MaxGroups caps the groups in a certificate, mandatory ones included;
+	// zero means no limit
+	MaxGroups int `yaml:"max_groups"`
+	// ExclusiveGroups lists sets of groups no certificate may carry more
+	// than one of
+	ExclusiveGroups [][]string `yaml:"exclusive_groups"`
+	// ApprovalGroups are only issued to users with a current approval
+	ApprovalGroups []string         `yaml:"approval_groups"`
+	Approvals      []policyApproval `yaml:"approvals"`
+	// GroupRules apply to certificates carrying any of their groups
+	GroupRules []policyGroupRule `yaml:"group_rules"`
+}
+
+// policyApproval lets user have group until the given time (forever if
+// zero)
+type policyApproval struct {
+	Group string    `yaml:"group"`
+	User  string    `yaml:"user"`
+	Until time.Time `yaml:"until"`
+}
+
+// policyGroupRule caps the validity of certificates carrying the groups and
+// says which SANs they may have. A SAN type listed by any rule is only
+// allowed with a value matching a rule of one of the certificate's groups;
+// DNS, email and URI values are glob patterns and IPs CIDR ranges.
+type policyGroupRule struct {
+	Groups      []string            `yaml:"groups"`
+	MaxValidity time.Duration       `yaml:"max_validity"`
+	SANs        map[string][]string `yaml:"sans"`
+}
+
+// Policy is a parsed issuance policy
+type Policy struct {
+	file policyFile
+}
+
+// DefaultPolicy is the policy without a policy file: every certificate
+// carries the username and "users", with no further rules
+func DefaultPolicy() *Policy {
+	return &Policy{file: policyFile{MandatoryGroups: []string{"{username}", "users"}}}
+}
+
+// LoadPolicy reads an issuance policy file; an empty path gives
+// DefaultPolicy
+func LoadPolicy(policyPath string) (*Policy, error) {
+	if policyPath == "" {
+		return DefaultPolicy(), nil
+	}
+	data, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %v", err)
+	}
+	var file policyFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %v", policyPath, err)
+	}
+	if err := file.check(); err != nil {
+		return nil, fmt.Errorf("policy %s: %v", policyPath, err)
+	}
+	return &Policy{file: file}, nil
+}
+
+// check rejects patterns and rules the policy could not apply
+func (f *policyFile) check() error {
+	if f.MaxGroups < 0 {
+		return fmt.Errorf("max_groups must not be negative")
+	}
+	patterns := append([]string{}, f.ApprovalGroups...)
+	for _, set := range f.ExclusiveGroups {
+		if len(set) < 2 {
+			return fmt.Errorf("exclusive_groups sets need at least two groups")
+		}
+		patterns = append(patterns, set...)
+	}
+	for i, rule := range f.GroupRules {
+		if len(rule.Groups) == 0 {
+			return fmt.Errorf("group_rules[%d]: no groups", i)
+		}
+		if rule.MaxValidity < 0 {
+			return fmt.Errorf("group_rules[%d]: max_validity must not be negative", i)
+		}
+		patterns = append(patterns, rule.Groups...)
+		for sanType, values := range rule.SANs {
+			if !contains(allSANTypes, sanType) {
+				return fmt.Errorf("group_rules[%d]: unknown SAN type %q", i, sanType)
+			}
+			for _, value := range values {
+				if sanType == SANTypeIP {
+					if _, _, err := net.ParseCIDR(value); err != nil {
+						return fmt.Errorf("group_rules[%d]: invalid IP range %q", i, value)
+					}
+				} else if _, err := path.Match(value, ""); err != nil {
+					return fmt.Errorf("group_rules[%d]: invalid %s pattern %q", i, sanType, value)
+				}
+			}
+		}
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid group pattern %q: %v", pattern, err)
+		}
+	}
+	for i, approval := range f.Approvals {
+		if approval.Group == "" || approval.User == "" {
+			return fmt.Errorf("approvals[%d]: group and user are required", i)
+		}
+	}
+	return nil
+}
+
+// PolicyInput is a request as the policy sees it
+type PolicyInput struct {
+	Username  string
+	Requested []string // groups asked for
+	Member    []string // groups the group source has the user in
+	Profile   *Profile
+	CSR       *x509.CertificateRequest // nil for SSH keys
+	Validity  time.Duration            // before any group caps
+	Now       time.Time
+}
+
+// Decision is the outcome of evaluating a request against the policy
+type Decision struct {
+	Groups   []string // the groups the certificate carries, sorted
+	Roles    []string // the roles the groups map to, sorted
+	Validity time.Duration
+	Reasons  []DenyReason // empty if the request is allowed
+}
+
+// Err returns a PolicyError if the decision denies the request
+func (d *Decision) Err() error {
+	if len(d.Reasons) == 0 {
+		return nil
+	}
+	return &PolicyError{Reasons: d.Reasons}
+}
+
+// Evaluate decides which groups a certificate for the request carries and
+// whether it may be issued. The groups are those requested that the user
+// is a member of and the profile allows, plus the mandatory groups; every
+// rule broken is reported, not just the first.
+func (p *Policy) Evaluate(in PolicyInput) *Decision {
+	groupSet := make(map[string]bool)
+	for _, group := range in.Profile.filterGroups(intersectGroups(in.Requested, in.Member)) {
+		groupSet[group] = true
+	}
+	for _, group := range p.file.MandatoryGroups {
+		groupSet[strings.ReplaceAll(group, "{username}", in.Username)] = true
+	}
+	d := &Decision{Validity: in.Validity}
+	for group := range groupSet {
+		d.Groups = append(d.Groups, group)
+	}
+	sort.Strings(d.Groups)
+
+	if p.file.MaxGroups > 0 && len(d.Groups) > p.file.MaxGroups {
+		d.deny(RuleMaxGroups, "", "certificate would carry %d groups, at most %d are allowed", len(d.Groups), p.file.MaxGroups)
+	}
+	for _, set := range p.file.ExclusiveGroups {
+		if present, conflict := exclusiveConflict(d.Groups, set); conflict {
+			d.deny(RuleExclusiveGroups, strings.Join(present, ","), "groups %s may not appear together", strings.Join(present, ", "))
+		}
+	}
+	for _, group := range matchingGroups(d.Groups, p.file.ApprovalGroups) {
+		if !p.approved(in.Username, group, in.Now) {
+			d.deny(RuleApprovalRequired, group, "group %s needs approval for user %s", group, in.Username)
+		}
+	}
+
+	var rules []policyGroupRule
+	for _, rule := range p.file.GroupRules {
+		if len(matchingGroups(d.Groups, rule.Groups)) > 0 {
+			rules = append(rules, rule)
+			if rule.MaxValidity > 0 && rule.MaxValidity < d.Validity {
+				d.Validity = rule.MaxValidity
+			}
+		}
+	}
+	if in.CSR != nil {
+		for _, san := range csrSANs(in.CSR) {
+			if p.restrictsSANType(san.sanType) && !sanAllowed(rules, san.sanType, san.value) {
+				d.deny(RuleSANNotAllowed, san.value, "%s %s is not allowed for the certificate's groups", san.sanType, san.value)
+			}
+		}
+	}
+	return d
+}
+
+// deny records a reason the request is denied
+func (d *Decision) deny(rule, subject, format string, args ...interface{}) {
+	d.Reasons = append(d.Reasons, DenyReason{Rule: rule, Subject: subject, Message: fmt.Sprintf(format, args...)})
+}
+
+// approved reports whether username has a current approval for group
+func (p *Policy) approved(username, group string, now time.Time) bool {
+	for _, approval := range p.file.Approvals {
+		if approval.User != username {
+			continue
+		}
+		if ok, _ := path.Match(approval.Group, group); ok && (approval.Until.IsZero() || now.Before(approval.Until)) {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictsSANType reports whether any group rule lists SANs of sanType
+func (p *Policy) restrictsSANType(sanType string) bool {
+	for _, rule := range p.file.GroupRules {
+		if _, ok := rule.SANs[sanType]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sanAllowed reports whether one of rules allows the SAN
+func sanAllowed(rules []policyGroupRule, sanType, value string) bool {
+	for _, rule := range rules {
+		for _, pattern := range rule.SANs[sanType] {
+			if sanType == SANTypeIP {
+				_, network, err := net.ParseCIDR(pattern)
+				if err == nil && network.Contains(net.ParseIP(value)) {
+					return true
+				}
+			} else if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(value)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// csrSAN is a subject alternative name in a CSR
+type csrSAN struct {
+	sanType string
+	value   string
+}
+
+// csrSANs returns the subject alternative names in csr
+func csrSANs(csr *x509.CertificateRequest) []csrSAN {
+	var sans []csrSAN
+	for _, name := range csr.DNSNames {
+		sans = append(sans, csrSAN{SANTypeDNS, name})
+	}
+	for _, email := range csr.EmailAddresses {
+		sans = append(sans, csrSAN{SANTypeEmail, email})
+	}
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, csrSAN{SANTypeIP, ip.String()})
+	}
+	for _, uri := range csr.URIs {
+		sans = append(sans, csrSAN{SANTypeURI, uri.String()})
+	}
+	return sans
+}
+
+// exclusiveConflict returns the groups matching the patterns of an
+// exclusive set, and whether two different groups among them match
+// different patterns. A group matching several patterns alone is no
+// conflict.
+func exclusiveConflict(groups, set []string) ([]string, bool) {
+	var present []string
+	var patterns [][]int // indexes into set of the patterns each present group matches
+	for _, group := range groups {
+		var matched []int
+		for i, pattern := range set {
+			if ok, _ := path.Match(pattern, group); ok {
+				matched = append(matched, i)
+			}
+		}
+		if len(matched) > 0 {
+			present = append(present, group)
+			patterns = append(patterns, matched)
+		}
+	}
+	for a := range patterns {
+		for b := a + 1; b < len(patterns); b++ {
+			// Two groups conflict unless both match one and the same pattern
+			if len(patterns[a]) > 1 || len(patterns[b]) > 1 || patterns[a][0] != patterns[b][0] {
+				return present, true
+			}
+		}
+	}
+	return present, false
+}
+
+// matchingGroups returns the groups matching any of patterns
+func matchingGroups(groups, patterns []string) []string {
+	var matched []string
+	for _, group := range groups {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, group); ok {
+				matched = append(matched, group)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// currentPolicy returns the issuance policy in force
+func (s *Signer) currentPolicy() *Policy {
+	s.policyMu.RLock()
+	defer s.policyMu.RUnlock()
+	return s.policy
+}
+
+// SetPolicy replaces the issuance policy; requests already being evaluated
+// finish under the old one
+func (s *Signer) SetPolicy(p *Policy) {
+	s.policyMu.Lock()
+	defer s.policyMu.Unlock()
+	s.policy = p
+}
+
+// EvaluateOffline checks a CSR for username as SignCSR would, taking member
+// as the user's groups instead of asking the group source: the CSR, its
+// subject and the profile's SAN types are checked, then the policy decides.
+// Denials by the policy are in the decision's Reasons; other failures are
+// returned as errors.
+func EvaluateOffline(cfg *config.Config, policy *Policy, csrPEM []byte, username string, requested, member []string, profileName string) (*Decision, error) {
+	profiles, err := loadProfiles(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if profileName == "" {
+		profileName = cfg.Signer.DefaultProfile
+	}
+	profile, ok := profiles[profileName]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown certificate profile %q", ErrPolicyDenied, profileName)
+	}
+	roles, err := loadRoleMappings(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("%w: no PEM certificate request found", ErrBadCSR)
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse CSR: %v", ErrBadCSR, err)
+	}
+	if err := verifyCSR(csr, profile, username); err != nil {
+		return nil, err
+	}
+
+	decision := policy.Evaluate(PolicyInput{
+		Username:  username,
+		Requested: requested,
+		Member:    member,
+		Profile:   profile,
+		CSR:       csr,
+		Validity:  profile.Validity,
+		Now:       time.Now(),
+	})
+	if len(decision.Reasons) == 0 {
+		decision.Roles = mapRoles(roles, decision.Groups)
+	}
+	return decision, nil
+}
@@ -0,0 +1,250 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+const testPolicy = `
+mandatory_groups: ["{username}", users]
+max_groups: 5
+exclusive_groups:
+  - [prod-*, auditor]
+approval_groups: [root-*]
+approvals:
+  - {group: root-db, user: alice, until: 2099-01-01T00:00:00Z}
+  - {group: root-web, user: alice, until: 2001-01-01T00:00:00Z}
+group_rules:
+  - groups: [svc-*]
+    max_validity: 24h
+    sans:
+      dns: ["*.svc.example.com"]
+      ip: ["10.0.0.0/8"]
+`
+
+// loadTestPolicy loads policy from a file
+func loadTestPolicy(t *testing.T, policy string) *Policy {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeFile(t, path, policy)
+	p, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// sanCSR returns a parsed CSR for commonName with the given SANs
+func sanCSR(t *testing.T, commonName string, dnsNames []string, ips []net.IP) *x509.CertificateRequest {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: commonName},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+// denyRules returns the rules a decision denies by, with their subjects
+func denyRules(d *Decision) map[string]string {
+	rules := make(map[string]string)
+	for _, reason := range d.Reasons {
+		rules[reason.Rule] = reason.Subject
+	}
+	return rules
+}
+
+func TestPolicyGroupRules(t *testing.T) {
+	p := loadTestPolicy(t, testPolicy)
+	profile, err := newProfile("p", config.ProfileConfig{}, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := PolicyInput{
+		Username:  "alice",
+		Requested: []string{"svc-a", "eng"},
+		Member:    []string{"svc-a", "eng"},
+		Profile:   profile,
+		CSR:       sanCSR(t, "alice", []string{"api.svc.example.com"}, []net.IP{net.ParseIP("10.1.2.3")}),
+		Validity:  30 * 24 * time.Hour,
+		Now:       time.Now(),
+	}
+	d := p.Evaluate(in)
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"alice", "eng", "svc-a", "users"}; !reflect.DeepEqual(d.Groups, want) {
+		t.Errorf("groups = %v, want %v", d.Groups, want)
+	}
+	if d.Validity != 24*time.Hour {
+		t.Errorf("validity = %s, want the svc-* cap of 24h", d.Validity)
+	}
+
+	// Every SAN outside the group's rules is reported
+	in.CSR = sanCSR(t, "alice", []string{"www.example.com"}, []net.IP{net.ParseIP("192.168.1.1")})
+	d = p.Evaluate(in)
+	if len(d.Reasons) != 2 || d.Reasons[0].Rule != RuleSANNotAllowed || d.Reasons[0].Subject != "www.example.com" {
+		t.Errorf("reasons = %+v, want both SANs not allowed", d.Reasons)
+	}
+	in.Requested, in.Member = []string{"eng"}, []string{"eng"}
+	in.CSR = sanCSR(t, "alice", []string{"api.svc.example.com"}, nil)
+	if d = p.Evaluate(in); denyRules(d)[RuleSANNotAllowed] != "api.svc.example.com" {
+		t.Errorf("reasons = %+v, want the SAN not allowed without an svc-* group", d.Reasons)
+	}
+}
+
+func TestPolicyDeniesEveryBrokenRule(t *testing.T) {
+	p := loadTestPolicy(t, testPolicy)
+	profile, err := newProfile("p", config.ProfileConfig{}, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := []string{"prod-a", "prod-b", "auditor", "root-db", "root-web"}
+	d := p.Evaluate(PolicyInput{Username: "alice", Requested: groups, Member: groups, Profile: profile, Now: time.Now()})
+	rules := denyRules(d)
+	if len(d.Reasons) != 3 {
+		t.Errorf("reasons = %+v, want 3", d.Reasons)
+	}
+	if _, ok := rules[RuleMaxGroups]; !ok {
+		t.Error("7 groups not denied by max_groups")
+	}
+	if _, ok := rules[RuleExclusiveGroups]; !ok {
+		t.Error("prod-* with auditor not denied")
+	}
+	if rules[RuleApprovalRequired] != "root-web" {
+		t.Errorf("approval required for %q, want only root-web, whose approval expired", rules[RuleApprovalRequired])
+	}
+
+	// Groups matching one pattern do not exclude each other
+	groups = []string{"prod-a", "prod-b"}
+	if err := p.Evaluate(PolicyInput{Username: "alice", Requested: groups, Member: groups, Profile: profile, Now: time.Now()}).Err(); err != nil {
+		t.Errorf("prod-a with prod-b: %v", err)
+	}
+}
+
+func TestLoadPolicyRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeFile(t, path, "max_groupz: 3\n")
+	if _, err := LoadPolicy(path); err == nil {
+		t.Error("accepted a misspelt key")
+	}
+	writeFile(t, path, "approvals:\n  - {group: root-db}\n")
+	if _, err := LoadPolicy(path); err == nil {
+		t.Error("accepted an approval without a user")
+	}
+}
+
+func TestSignerAppliesPolicy(t *testing.T) {
+	s, _ := newTestSigner(t)
+	s.SetGroupSource(staticGroups{"alice": {"prod-a", "auditor"}})
+	s.SetPolicy(loadTestPolicy(t, testPolicy))
+
+	_, err := s.SignCSR(makeCSR(t, "alice"), []string{"prod-a", "auditor"}, "", Identity{Username: "alice", RequestID: "req-1"})
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || !errors.Is(err, ErrPolicyDenied) {
+		t.Fatalf("signing prod-a with auditor: %v, want a PolicyError", err)
+	}
+	if len(policyErr.Reasons) != 1 || policyErr.Reasons[0].Rule != RuleExclusiveGroups {
+		t.Errorf("reasons = %+v", policyErr.Reasons)
+	}
+
+	// The reasons survive the trip to the app
+	perr := signError(err)
+	if perr.Code != signerproto.CodePolicyDenied {
+		t.Errorf("code = %v, want CodePolicyDenied", perr.Code)
+	}
+	back, ok := signerproto.FromGRPCError(perr.GRPCStatus().Err()).(*signerproto.Error)
+	if !ok || back.Code != signerproto.CodePolicyDenied || len(back.Reasons) != 1 || back.Reasons[0].Rule != RuleExclusiveGroups {
+		t.Errorf("over gRPC: %+v", back)
+	}
+
+	if _, err := s.SignCSR(makeCSR(t, "alice"), []string{"prod-a"}, "", Identity{Username: "alice", RequestID: "req-2"}); err != nil {
+		t.Errorf("signing prod-a alone: %v", err)
+	}
+}
+
+func TestExclusiveConflict(t *testing.T) {
+	set := []string{"payments-*", "payments-audit"}
+	tests := []struct {
+		groups   []string
+		present  []string
+		conflict bool
+	}{
+		// One group matching both patterns conflicts with nothing
+		{[]string{"alice", "payments-audit", "users"}, []string{"payments-audit"}, false},
+		{[]string{"payments-eu", "payments-us"}, []string{"payments-eu", "payments-us"}, false},
+		{[]string{"payments-audit", "payments-eu"}, []string{"payments-audit", "payments-eu"}, true},
+		{[]string{"eng"}, nil, false},
+	}
+	for _, tt := range tests {
+		present, conflict := exclusiveConflict(tt.groups, set)
+		if conflict != tt.conflict || !reflect.DeepEqual(present, tt.present) {
+			t.Errorf("%v: present %v, conflict %v; want %v, %v", tt.groups, present, conflict, tt.present, tt.conflict)
+		}
+	}
+
+	p := loadTestPolicy(t, "exclusive_groups:\n  - [payments-*, payments-audit]\n")
+	profile, err := newProfile("p", config.ProfileConfig{}, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := []string{"payments-audit"}
+	if d := p.Evaluate(PolicyInput{Username: "alice", Requested: groups, Member: groups, Profile: profile, Now: time.Now()}); len(d.Reasons) != 0 {
+		t.Errorf("payments-audit alone denied: %+v", d.Reasons)
+	}
+}
+
+func TestEvaluateOffline(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Signer.DefaultProfile = "default"
+	cfg.Signer.CertValidityDays = 30
+	p := loadTestPolicy(t, testPolicy)
+
+	d, err := EvaluateOffline(cfg, p, makeCSR(t, "alice"), "alice", []string{"prod-a", "auditor"}, []string{"prod-a", "auditor"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if denyRules(d)[RuleExclusiveGroups] == "" {
+		t.Errorf("reasons = %+v, want prod-* with auditor denied", d.Reasons)
+	}
+	d, err = EvaluateOffline(cfg, p, makeCSR(t, "alice"), "alice", []string{"prod-a", "ops"}, []string{"prod-a"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Err(); err != nil {
+		t.Errorf("evaluating prod-a: %v", err)
+	}
+	if want := []string{"alice", "prod-a", "users"}; !reflect.DeepEqual(d.Groups, want) {
+		t.Errorf("groups = %v, want %v", d.Groups, want)
+	}
+
+	if _, err := EvaluateOffline(cfg, p, makeCSR(t, "mallory"), "alice", nil, nil, ""); err == nil {
+		t.Error("accepted a CSR for another user")
+	}
+	if _, err := EvaluateOffline(cfg, p, makeCSR(t, "alice"), "alice", nil, nil, "missing"); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("unknown profile: %v, want ErrPolicyDenied", err)
+	}
+}
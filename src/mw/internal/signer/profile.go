@@ -0,0 +1,259 @@
+package signer
+
+import (
+	"crypto/x509"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+)
+
+// SAN types a profile can allow
+const (
+	SANTypeDNS   = "dns"
+	SANTypeEmail = "email"
+	SANTypeIP    = "ip"
+	SANTypeURI   = "uri"
+)
+
+// Optional extensions a profile can include
+const (
+	ExtensionCRL    = "crl"
+	ExtensionOCSP   = "ocsp"
+	ExtensionAIA    = "aia"
+	ExtensionGroups = "groups"
+	ExtensionRoles  = "roles"
+)
+
+// How a profile can carry the groups
+const (
+	GroupEncodingExtension = "extension"
+	GroupEncodingSubjectOU = "subject_ou"
+	GroupEncodingSANURI    = "san_uri"
+	GroupEncodingAttrCert  = "attribute_certificate"
+)
+
+var (
+	allSANTypes       = []string{SANTypeDNS, SANTypeEmail, SANTypeIP, SANTypeURI}
+	allExtensions     = []string{ExtensionCRL, ExtensionOCSP, ExtensionAIA, ExtensionGroups, ExtensionRoles}
+	allGroupEncodings = []string{GroupEncodingExtension, GroupEncodingSubjectOU, GroupEncodingSANURI, GroupEncodingAttrCert}
+)
+
+// Profile is a parsed certificate profile
+type Profile struct {
+	Name          string
+	Validity      time.Duration
+	usage         certUsage
+	sanTypes      map[string]bool
+	extensions    map[string]bool
+	allowedGroups []string
+	groupFailure  string // what to do when the group lookup fails
+	encodings     map[string]bool
+	acValidity    time.Duration // of attribute certificates
+
+	// stripSubjectOUs drops the OUs of CSRs; set on every profile once
+	// any profile carries groups as OUs, so no certificate of the CA has
+	// an OU the requester chose
+	stripSubjectOUs bool
+}
+
+// newProfile parses a profile from its configuration. defaultValidityDays is
+// used when the profile does not set its own validity.
+func newProfile(name string, pc config.ProfileConfig, defaultValidityDays int) (*Profile, error) {
+	usage, err := parseCertUsage(pc.KeyUsage, pc.ExtendedKeyUsage)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %v", name, err)
+	}
+
+	validity := pc.Validity
+	if validity == 0 {
+		days := pc.ValidityDays
+		if days == 0 {
+			days = defaultValidityDays
+		}
+		validity = time.Duration(days) * 24 * time.Hour
+	}
+	if validity <= 0 {
+		return nil, fmt.Errorf("profile %s: no validity configured", name)
+	}
+
+	// SANs are claims the signer cannot check in general, so each type
+	// must be allowed by name
+	sanTypes := make(map[string]bool)
+	if len(pc.AllowedSANTypes) > 0 {
+		sanTypes, err = stringSet(pc.AllowedSANTypes, allSANTypes)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: invalid SAN type: %v", name, err)
+		}
+	}
+	extensions, err := stringSet(pc.Extensions, allExtensions)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: invalid extension: %v", name, err)
+	}
+	if len(pc.GroupEncodings) == 0 {
+		pc.GroupEncodings = []string{GroupEncodingExtension}
+	}
+	encodings, err := stringSet(pc.GroupEncodings, allGroupEncodings)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: invalid group encoding: %v", name, err)
+	}
+	acValidity := pc.AttributeCertificateValidity
+	if acValidity < 0 {
+		return nil, fmt.Errorf("profile %s: negative attribute certificate validity", name)
+	}
+	if acValidity == 0 || acValidity > validity {
+		acValidity = validity
+	}
+	for _, pattern := range pc.AllowedGroups {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("profile %s: invalid group pattern %q: %v", name, pattern, err)
+		}
+	}
+	switch pc.GroupLookupFailure {
+	case "":
+		pc.GroupLookupFailure = GroupLookupDegrade
+	case GroupLookupDeny, GroupLookupDegrade, GroupLookupStale:
+	default:
+		return nil, fmt.Errorf("profile %s: invalid group lookup failure mode %q", name, pc.GroupLookupFailure)
+	}
+
+	return &Profile{
+		Name:          name,
+		Validity:      validity,
+		usage:         usage,
+		sanTypes:      sanTypes,
+		extensions:    extensions,
+		allowedGroups: pc.AllowedGroups,
+		groupFailure:  pc.GroupLookupFailure,
+		encodings:     encodings,
+		acValidity:    acValidity,
+	}, nil
+}
+
+// stringSet turns values into a set, checking each against known. An empty
+// list selects every known value.
+func stringSet(values, known []string) (map[string]bool, error) {
+	if len(values) == 0 {
+		values = known
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if !contains(known, v) {
+			return nil, fmt.Errorf("%q (expected one of %s)", v, strings.Join(known, ", "))
+		}
+		set[v] = true
+	}
+	return set, nil
+}
+
+// loadProfiles parses the configured profiles. Without any configured
+// profiles a single default profile is built from the top-level signer
+// settings, allowing only email SANs.
+func loadProfiles(cfg *config.Config) (map[string]*Profile, error) {
+	profiles := make(map[string]*Profile)
+	if len(cfg.Signer.Profiles) == 0 {
+		p, err := newProfile(cfg.Signer.DefaultProfile, config.ProfileConfig{
+			KeyUsage:           cfg.Signer.KeyUsage,
+			ExtendedKeyUsage:   cfg.Signer.ExtendedKeyUsage,
+			AllowedSANTypes:    []string{SANTypeEmail},
+			GroupLookupFailure: cfg.Signer.GroupLookupFailure,
+		}, cfg.Signer.CertValidityDays)
+		if err != nil {
+			return nil, err
+		}
+		profiles[p.Name] = p
+		return profiles, nil
+	}
+
+	for name, pc := range cfg.Signer.Profiles {
+		if pc.GroupLookupFailure == "" {
+			pc.GroupLookupFailure = cfg.Signer.GroupLookupFailure
+		}
+		p, err := newProfile(name, pc, cfg.Signer.CertValidityDays)
+		if err != nil {
+			return nil, err
+		}
+		profiles[name] = p
+	}
+	if _, ok := profiles[cfg.Signer.DefaultProfile]; !ok {
+		return nil, fmt.Errorf("default profile %q is not configured", cfg.Signer.DefaultProfile)
+	}
+
+	// Relying parties reading groups from OUs cannot tell which profile a
+	// certificate was issued under
+	for _, p := range profiles {
+		if p.encodesGroupsAs(GroupEncodingSubjectOU) {
+			for _, q := range profiles {
+				q.stripSubjectOUs = true
+			}
+			break
+		}
+	}
+	return profiles, nil
+}
+
+// Profile returns the named profile, or the default profile if name is empty
+func (s *Signer) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = s.config.Signer.DefaultProfile
+	}
+	p, ok := s.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown certificate profile %q", name)
+	}
+	return p, nil
+}
+
+// hasExtension reports whether the profile includes the optional extension
+func (p *Profile) hasExtension(name string) bool {
+	return p.extensions[name]
+}
+
+// encodesGroupsAs reports whether the profile carries the groups with the
+// named encoding
+func (p *Profile) encodesGroupsAs(encoding string) bool {
+	return p.encodings[encoding]
+}
+
+// checkSANs rejects CSRs carrying SAN types the profile does not allow
+func (p *Profile) checkSANs(csr *x509.CertificateRequest) error {
+	present := map[string]bool{
+		SANTypeDNS:   len(csr.DNSNames) > 0,
+		SANTypeEmail: len(csr.EmailAddresses) > 0,
+		SANTypeIP:    len(csr.IPAddresses) > 0,
+		SANTypeURI:   len(csr.URIs) > 0,
+	}
+	for sanType, found := range present {
+		if found && !p.sanTypes[sanType] {
+			return fmt.Errorf("profile %s does not allow %s subject alternative names", p.Name, sanType)
+		}
+	}
+	// Group URIs are ours to assert, whatever the profile's encodings
+	for _, uri := range csr.URIs {
+		if isGroupURI(uri) {
+			return fmt.Errorf("URI %s claims a group", uri)
+		}
+	}
+	return nil
+}
+
+// filterGroups returns the groups the profile allows to appear in a
+// certificate
+func (p *Profile) filterGroups(groups []string) []string {
+	if len(p.allowedGroups) == 0 {
+		return groups
+	}
+	var allowed []string
+	for _, group := range groups {
+		for _, pattern := range p.allowedGroups {
+			if ok, _ := path.Match(pattern, group); ok {
+				allowed = append(allowed, group)
+				break
+			}
+		}
+	}
+	return allowed
+}
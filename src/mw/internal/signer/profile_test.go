@@ -0,0 +1,139 @@
+package signer
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+)
+
+func TestLoadProfilesDefault(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Signer.DefaultProfile = "default"
+	cfg.Signer.CertValidityDays = 7
+	cfg.Signer.ExtendedKeyUsage = []string{"serverAuth"}
+
+	profiles, err := loadProfiles(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := profiles["default"]
+	if !ok || len(profiles) != 1 {
+		t.Fatalf("profiles = %v, want only the default profile", profiles)
+	}
+	if p.Validity != 7*24*time.Hour {
+		t.Errorf("validity = %s, want 7 days", p.Validity)
+	}
+	if !reflect.DeepEqual(p.usage.extKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}) {
+		t.Errorf("extended key usage = %v, want the top-level serverAuth", p.usage.extKeyUsage)
+	}
+	for _, ext := range allExtensions {
+		if !p.hasExtension(ext) {
+			t.Errorf("default profile lacks the %s extension", ext)
+		}
+	}
+}
+
+func TestNewProfileRejectsInvalidConfig(t *testing.T) {
+	tests := map[string]config.ProfileConfig{
+		"SAN type":        {AllowedSANTypes: []string{"dns", "x400"}},
+		"extension":       {Extensions: []string{"crl", "bogus"}},
+		"group encoding":  {GroupEncodings: []string{"cn"}},
+		"group pattern":   {AllowedGroups: []string{"eng-["}},
+		"failure mode":    {GroupLookupFailure: "ignore"},
+		"key usage":       {KeyUsage: []string{"keyCertSign"}},
+		"no validity":     {Validity: -time.Hour},
+		"negative AC ttl": {AttributeCertificateValidity: -time.Hour},
+	}
+	for name, pc := range tests {
+		if _, err := newProfile("p", pc, 30); err == nil {
+			t.Errorf("%s: invalid profile accepted", name)
+		}
+	}
+
+	cfg := &config.Config{}
+	cfg.Signer.DefaultProfile = "missing"
+	cfg.Signer.Profiles = map[string]config.ProfileConfig{"service": {}}
+	if _, err := loadProfiles(cfg); err == nil {
+		t.Error("accepted a default profile that is not configured")
+	}
+}
+
+func TestFilterGroups(t *testing.T) {
+	p, err := newProfile("p", config.ProfileConfig{AllowedGroups: []string{"eng-*", "ops"}}, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := p.filterGroups([]string{"eng-web", "ops", "ops-admin", "finance"})
+	if want := []string{"eng-web", "ops"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("filterGroups = %v, want %v", got, want)
+	}
+
+	open, err := newProfile("open", config.ProfileConfig{}, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := open.filterGroups([]string{"finance"}); !reflect.DeepEqual(got, []string{"finance"}) {
+		t.Errorf("a profile without allowed groups filtered to %v", got)
+	}
+}
+
+func TestSignWithProfile(t *testing.T) {
+	s, _ := newConfiguredSigner(t, func(cfg *config.Config) {
+		cfg.Signer.DefaultProfile = "user-client"
+		cfg.Signer.Profiles = map[string]config.ProfileConfig{
+			"user-client": {AllowedSANTypes: []string{SANTypeEmail}},
+			"no-sans":     {},
+			"short-lived": {
+				Validity:         time.Hour,
+				ExtendedKeyUsage: []string{"serverAuth"},
+				AllowedSANTypes:  []string{SANTypeDNS},
+				Extensions:       []string{ExtensionAIA},
+			},
+		}
+	})
+	identity := Identity{Username: "alice", RequestID: "req-alice"}
+
+	csr := newCSR(t, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "alice"},
+		DNSNames: []string{"alice.example.com"},
+	})
+	certPEM, err := s.SignCSR(csr, nil, "short-lived", identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := parseCertificate(t, certPEM)
+	if got := cert.NotAfter.Sub(cert.NotBefore); got != time.Hour {
+		t.Errorf("validity = %s, want 1h", got)
+	}
+	if !reflect.DeepEqual(cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}) {
+		t.Errorf("extended key usage = %v, want serverAuth", cert.ExtKeyUsage)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "alice.example.com" {
+		t.Errorf("DNS names = %v", cert.DNSNames)
+	}
+	if len(cert.CRLDistributionPoints) != 0 {
+		t.Errorf("profile without the crl extension has CRL distribution points %v", cert.CRLDistributionPoints)
+	}
+
+	csr = newCSR(t, &x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "alice"},
+		EmailAddresses: []string{"alice@example.com"},
+	})
+	if _, err := s.SignCSR(csr, nil, "short-lived", identity); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("email SAN on a DNS-only profile: err = %v, want ErrPolicyDenied", err)
+	}
+	if _, err := s.SignCSR(csr, nil, "", identity); err != nil {
+		t.Errorf("email SAN on the default profile: %v", err)
+	}
+	if _, err := s.SignCSR(csr, nil, "no-sans", identity); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("email SAN on a profile allowing no SAN types: err = %v, want ErrPolicyDenied", err)
+	}
+	if _, err := s.SignCSR(makeCSR(t, "alice"), nil, "smime", identity); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("unknown profile: err = %v, want ErrPolicyDenied", err)
+	}
+}
@@ -0,0 +1,149 @@
+package signer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+// maxInflightPerConn bounds the requests served concurrently on one framed
+// connection
+const maxInflightPerConn = 32
+
+// Protocols a client can speak on the Unix socket
+const (
+	protocolV0 = iota
+	protocolFramed
+	protocolGRPC
+)
+
+// detectProtocol works out which protocol the client opened the
+// connection with, consuming the version 1 preamble if there is one.
+// Version 0 requests are bare JSON objects, so anything starting with '{'
+// or whitespace is left alone; gRPC connections start with the HTTP/2
+// connection preface.
+func detectProtocol(r *bufio.Reader) int {
+	first, err := r.Peek(1)
+	if err != nil {
+		return protocolV0
+	}
+	switch first[0] {
+	case signerproto.Preamble[0]:
+		preamble, err := r.Peek(len(signerproto.Preamble))
+		if err == nil && string(preamble) == signerproto.Preamble {
+			r.Discard(len(preamble))
+			return protocolFramed
+		}
+	case http2Preface[0]:
+		preface, err := r.Peek(len(http2Preface))
+		if err == nil && string(preface) == http2Preface {
+			return protocolGRPC
+		}
+	}
+	return protocolV0
+}
+
+// serveFramed serves protocol version 1 requests on conn until the client
+// disconnects. Requests are handled concurrently and answered as they
+// complete; the frame ID ties each response to its request.
+func (h *Handler) serveFramed(conn net.Conn, r *bufio.Reader) {
+	if _, err := io.WriteString(conn, signerproto.Preamble); err != nil {
+		h.logger.Errorf("Failed to acknowledge protocol version: %v", err)
+		return
+	}
+
+	var writeMu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	inflight := make(chan struct{}, maxInflightPerConn)
+
+	for {
+		var frame signerproto.Frame
+		if err := signerproto.ReadFrame(r, &frame); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				h.logger.Errorf("Failed to read request frame: %v", err)
+			}
+			return
+		}
+
+		inflight <- struct{}{}
+		wg.Add(1)
+		go func(req signerproto.Frame) {
+			defer func() {
+				<-inflight
+				wg.Done()
+			}()
+
+			resp := h.dispatch(&req)
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if err := signerproto.WriteFrame(conn, resp); err != nil {
+				h.logger.Errorf("Failed to write response frame %d: %v", req.ID, err)
+			}
+		}(frame)
+	}
+}
+
+// dispatch handles one request frame and returns the response frame
+func (h *Handler) dispatch(req *signerproto.Frame) *signerproto.Frame {
+	resp := &signerproto.Frame{ID: req.ID}
+
+	var result interface{}
+	var perr *signerproto.Error
+	switch req.Method {
+	case signerproto.MethodSign:
+		var signReq signerproto.SignRequest
+		if err := json.Unmarshal(req.Body, &signReq); err != nil {
+			perr = signerproto.Errorf(signerproto.CodeBadRequest, "Invalid request format")
+			break
+		}
+		result, perr = h.sign(&signReq)
+	case signerproto.MethodRevoke:
+		var revokeReq signerproto.RevokeRequest
+		if err := json.Unmarshal(req.Body, &revokeReq); err != nil {
+			perr = signerproto.Errorf(signerproto.CodeBadRequest, "Invalid request format")
+			break
+		}
+		result, perr = h.revoke(&revokeReq)
+	case signerproto.MethodSignSSH:
+		var sshReq signerproto.SignSSHRequest
+		if err := json.Unmarshal(req.Body, &sshReq); err != nil {
+			perr = signerproto.Errorf(signerproto.CodeBadRequest, "Invalid request format")
+			break
+		}
+		result, perr = h.signSSH(&sshReq)
+	case signerproto.MethodSignAttributeCert:
+		var acReq signerproto.SignAttributeCertRequest
+		if err := json.Unmarshal(req.Body, &acReq); err != nil {
+			perr = signerproto.Errorf(signerproto.CodeBadRequest, "Invalid request format")
+			break
+		}
+		result, perr = h.signAttributeCert(&acReq)
+	case signerproto.MethodStatus:
+		var statusReq signerproto.StatusRequest
+		if err := json.Unmarshal(req.Body, &statusReq); err != nil {
+			perr = signerproto.Errorf(signerproto.CodeBadRequest, "Invalid request format")
+			break
+		}
+		result, perr = h.status(&statusReq)
+	default:
+		perr = signerproto.Errorf(signerproto.CodeUnsupportedMethod, "Unsupported method %q", req.Method)
+	}
+
+	if perr != nil {
+		resp.Error = perr
+		return resp
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		resp.Error = signerproto.Errorf(signerproto.CodeInternal, "Failed to encode response")
+		return resp
+	}
+	resp.Body = body
+	return resp
+}
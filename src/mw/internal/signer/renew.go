@@ -0,0 +1,77 @@
+package signer
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// RenewCSR signs a CSR as the replacement for the user's certificate with
+// serial old, which must still be valid. Without requested groups or a
+// profile those of the old certificate are used; the groups are checked
+// against the backend again either way. With revokeOld the old certificate
+// is revoked as superseded once the renewal overlap has passed, and the
+// time it will be revoked is returned.
+func (s *Signer) RenewCSR(csrPEM []byte, old *big.Int, revokeOld bool, requestedGroups []string, profileName string, identity Identity) ([]byte, time.Time, error) {
+	certPEM, _, revokeAt, err := s.renewCSR(csrPEM, old, revokeOld, requestedGroups, profileName, identity)
+	return certPEM, revokeAt, err
+}
+
+// renewCSR renews like RenewCSR, also returning the attribute certificate
+// issued with the new certificate, if its profile has one
+func (s *Signer) renewCSR(csrPEM []byte, old *big.Int, revokeOld bool, requestedGroups []string, profileName string, identity Identity) ([]byte, []byte, time.Time, error) {
+	record, ok := s.issued.Lookup(old)
+	switch {
+	case !ok:
+		return nil, nil, time.Time{}, fmt.Errorf("%w: certificate %s was not issued by this signer", ErrRenewalDenied, old.Text(16))
+	case record.Username != identity.Username:
+		s.logger.LogSecurityEvent("renewal_not_owner", map[string]interface{}{
+			"serial":     record.Serial,
+			"owner":      record.Username,
+			"user_id":    identity.UserID,
+			"username":   identity.Username,
+			"request_id": identity.RequestID,
+		})
+		s.metrics.RecordSecurityEvent("renewal_not_owner")
+		return nil, nil, time.Time{}, fmt.Errorf("%w: certificate %s was not issued to %s", ErrRenewalDenied, record.Serial, identity.Username)
+	}
+	if status := record.StatusAt(time.Now()); status != StatusGood {
+		return nil, nil, time.Time{}, fmt.Errorf("%w: certificate %s is %s", ErrRenewalDenied, record.Serial, status)
+	}
+
+	if len(requestedGroups) == 0 {
+		requestedGroups = record.Groups
+	}
+	if profileName == "" {
+		profileName = record.Profile
+	}
+	certPEM, acPEM, err := s.signCSR(csrPEM, requestedGroups, profileName, identity, record.Serial)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	s.logger.Infof("Renewed certificate %s for user %s", record.Serial, identity.Username)
+
+	if !revokeOld {
+		return certPEM, acPEM, time.Time{}, nil
+	}
+	revokeAt := time.Now().Add(s.config.Signer.RenewalOverlap).UTC()
+	if err := s.issued.ScheduleRevocation(old, revokeAt); err != nil {
+		// The new certificate is issued; the old one simply stays valid
+		s.logger.Errorf("Failed to schedule revocation of renewed certificate %s: %v", record.Serial, err)
+		return certPEM, acPEM, time.Time{}, nil
+	}
+	return certPEM, acPEM, revokeAt, nil
+}
+
+// RevokeSuperseded revokes renewed certificates whose overlap has passed
+func (s *Signer) RevokeSuperseded() {
+	for _, hexSerial := range s.issued.DueRevocations(time.Now()) {
+		serial, ok := new(big.Int).SetString(hexSerial, 16)
+		if !ok {
+			continue
+		}
+		if _, err := s.Revoke(serial, ReasonSuperseded); err != nil {
+			s.logger.Errorf("Failed to revoke superseded certificate %s: %v", hexSerial, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package signer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RFC 5280 CRLReason codes
+const (
+	ReasonUnspecified          = 0
+	ReasonKeyCompromise        = 1
+	ReasonCACompromise         = 2
+	ReasonAffiliationChanged   = 3
+	ReasonSuperseded           = 4
+	ReasonCessationOfOperation = 5
+	ReasonCertificateHold      = 6
+	ReasonRemoveFromCRL        = 8
+	ReasonPrivilegeWithdrawn   = 9
+	ReasonAACompromise         = 10
+)
+
+var reasonNames = map[string]int{
+	"unspecified":          ReasonUnspecified,
+	"keycompromise":        ReasonKeyCompromise,
+	"cacompromise":         ReasonCACompromise,
+	"affiliationchanged":   ReasonAffiliationChanged,
+	"superseded":           ReasonSuperseded,
+	"cessationofoperation": ReasonCessationOfOperation,
+	"certificatehold":      ReasonCertificateHold,
+	"removefromcrl":        ReasonRemoveFromCRL,
+	"privilegewithdrawn":   ReasonPrivilegeWithdrawn,
+	"aacompromise":         ReasonAACompromise,
+}
+
+// RevocationReasonName returns the RFC 5280 name of a reason code, such as
+// "keyCompromise"
+func RevocationReasonName(code int) string {
+	switch code {
+	case ReasonUnspecified:
+		return "unspecified"
+	case ReasonKeyCompromise:
+		return "keyCompromise"
+	case ReasonCACompromise:
+		return "cACompromise"
+	case ReasonAffiliationChanged:
+		return "affiliationChanged"
+	case ReasonSuperseded:
+		return "superseded"
+	case ReasonCessationOfOperation:
+		return "cessationOfOperation"
+	case ReasonCertificateHold:
+		return "certificateHold"
+	case ReasonRemoveFromCRL:
+		return "removeFromCRL"
+	case ReasonPrivilegeWithdrawn:
+		return "privilegeWithdrawn"
+	case ReasonAACompromise:
+		return "aACompromise"
+	}
+	return fmt.Sprintf("reason%d", code)
+}
+
+// ParseRevocationReason parses an RFC 5280 reason code given either as its
+// name (e.g. "keyCompromise") or as its numeric value
+func ParseRevocationReason(reason string) (int, error) {
+	if reason == "" {
+		return ReasonUnspecified, nil
+	}
+	if code, err := strconv.Atoi(reason); err == nil {
+		for _, known := range reasonNames {
+			if known == code {
+				return code, nil
+			}
+		}
+		return 0, fmt.Errorf("unknown revocation reason code %d", code)
+	}
+	code, ok := reasonNames[strings.ToLower(reason)]
+	if !ok {
+		return 0, fmt.Errorf("unknown revocation reason %q", reason)
+	}
+	return code, nil
+}
+
+// RevocationEntry records a single revoked certificate
+type RevocationEntry struct {
+	Serial    string    `json:"serial"` // hexadecimal
+	RevokedAt time.Time `json:"revokedAt"`
+	Reason    int       `json:"reason"`
+}
+
+// SerialNumber returns the entry's serial as a big.Int
+func (e RevocationEntry) SerialNumber() *big.Int {
+	n, _ := new(big.Int).SetString(e.Serial, 16)
+	return n
+}
+
+// revocationState is the on-disk representation of the revocation store
+type revocationState struct {
+	// NextCRLNumber is shared by full and delta CRLs as RFC 5280 requires
+	NextCRLNumber  int64             `json:"nextCrlNumber"`
+	BaseCRLNumber  int64             `json:"baseCrlNumber"`
+	BaseThisUpdate time.Time         `json:"baseThisUpdate"`
+	Entries        []RevocationEntry `json:"entries"`
+}
+
+// RevocationStore keeps the list of revoked certificates and the CRL
+// numbering state, persisted as a JSON file
+type RevocationStore struct {
+	mu    sync.Mutex
+	path  string
+	state revocationState
+}
+
+// OpenRevocationStore loads the revocation store at path, creating an empty
+// one if the file does not exist yet
+func OpenRevocationStore(path string) (*RevocationStore, error) {
+	store := &RevocationStore{
+		path:  path,
+		state: revocationState{NextCRLNumber: 1},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				return nil, fmt.Errorf("failed to create revocation store directory: %v", err)
+			}
+			return store, store.save()
+		}
+		return nil, fmt.Errorf("failed to read revocation store: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &store.state); err != nil {
+		return nil, fmt.Errorf("failed to parse revocation store: %v", err)
+	}
+	if store.state.NextCRLNumber < 1 {
+		store.state.NextCRLNumber = 1
+	}
+	return store, nil
+}
+
+// save writes the store atomically; callers must hold mu
+func (rs *RevocationStore) save() error {
+	data, err := json.MarshalIndent(rs.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal revocation store: %v", err)
+	}
+	tmp := rs.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write revocation store: %v", err)
+	}
+	if err := os.Rename(tmp, rs.path); err != nil {
+		return fmt.Errorf("failed to replace revocation store: %v", err)
+	}
+	return nil
+}
+
+// Revoke adds serial to the revocation list. Revoking an already revoked
+// certificate is not an error; the original entry is kept unless it was on
+// hold, in which case the new reason replaces it.
+func (rs *RevocationStore) Revoke(serial *big.Int, reason int) (RevocationEntry, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	hexSerial := serial.Text(16)
+	for i, entry := range rs.state.Entries {
+		if entry.Serial != hexSerial {
+			continue
+		}
+		if entry.Reason != ReasonCertificateHold || reason == ReasonCertificateHold {
+			return entry, nil
+		}
+		rs.state.Entries[i].Reason = reason
+		rs.state.Entries[i].RevokedAt = time.Now().UTC()
+		return rs.state.Entries[i], rs.save()
+	}
+
+	entry := RevocationEntry{Serial: hexSerial, RevokedAt: time.Now().UTC(), Reason: reason}
+	rs.state.Entries = append(rs.state.Entries, entry)
+	return entry, rs.save()
+}
+
+// Lookup returns the revocation entry for serial, if any
+func (rs *RevocationStore) Lookup(serial *big.Int) (RevocationEntry, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	hexSerial := serial.Text(16)
+	for _, entry := range rs.state.Entries {
+		if entry.Serial == hexSerial {
+			return entry, true
+		}
+	}
+	return RevocationEntry{}, false
+}
+
+// crlSnapshot is the input for one CRL: its number, the base it refers to
+// (for delta CRLs) and the entries it lists
+type crlSnapshot struct {
+	Number     int64
+	BaseNumber int64
+	ThisUpdate time.Time
+	Entries    []RevocationEntry
+}
+
+// snapshot reserves the next CRL number and collects the entries to list.
+// A full snapshot lists every entry and becomes the new base; a delta
+// snapshot lists only the entries revoked since the current base. Both are
+// taken under the store lock so no revocation can fall between a base and
+// its deltas.
+func (rs *RevocationStore) snapshot(full bool) (crlSnapshot, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	snap := crlSnapshot{
+		Number:     rs.state.NextCRLNumber,
+		ThisUpdate: time.Now().UTC(),
+	}
+	rs.state.NextCRLNumber++
+
+	if full {
+		rs.state.BaseCRLNumber = snap.Number
+		rs.state.BaseThisUpdate = snap.ThisUpdate
+	}
+	snap.BaseNumber = rs.state.BaseCRLNumber
+
+	for _, entry := range rs.state.Entries {
+		if full || entry.RevokedAt.After(rs.state.BaseThisUpdate) {
+			snap.Entries = append(snap.Entries, entry)
+		}
+	}
+	sort.Slice(snap.Entries, func(i, j int) bool {
+		return snap.Entries[i].RevokedAt.Before(snap.Entries[j].RevokedAt)
+	})
+
+	return snap, rs.save()
+}
@@ -0,0 +1,65 @@
+package signer
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+)
+
+// roleMapping gives a role to members of the groups matching its patterns
+type roleMapping struct {
+	groups []string
+	role   string
+}
+
+// loadRoleMappings parses the configured role mappings
+func loadRoleMappings(cfg *config.Config) ([]roleMapping, error) {
+	mappings := make([]roleMapping, 0, len(cfg.Signer.RoleMappings))
+	for i, rm := range cfg.Signer.RoleMappings {
+		if rm.Role == "" || len(rm.Groups) == 0 {
+			return nil, fmt.Errorf("role mapping %d: groups and role are required", i)
+		}
+		for _, pattern := range rm.Groups {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("role mapping %d: invalid group pattern %q: %v", i, pattern, err)
+			}
+		}
+		mappings = append(mappings, roleMapping{groups: rm.Groups, role: rm.Role})
+	}
+	return mappings, nil
+}
+
+// mapRoles returns the roles groups map to, sorted
+func mapRoles(mappings []roleMapping, groups []string) []string {
+	roleSet := make(map[string]bool)
+	for _, m := range mappings {
+		if len(matchingGroups(groups, m.groups)) > 0 {
+			roleSet[m.role] = true
+		}
+	}
+	roles := make([]string, 0, len(roleSet))
+	for role := range roleSet {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// createRoleExtension creates the role extension, encoded like the group
+// extension
+func (s *Signer) createRoleExtension(roles []string) (pkix.Extension, error) {
+	sequenceBytes, err := asn1.Marshal(roles)
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("failed to marshal role sequence: %v", err)
+	}
+	s.logger.Infof("Created role extension with OID %v and roles %v", s.roleOID, roles)
+	return pkix.Extension{
+		Id:       s.roleOID,
+		Critical: false,
+		Value:    sequenceBytes,
+	}, nil
+}
@@ -0,0 +1,111 @@
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"reflect"
+	"testing"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+)
+
+// testRoleOID is the role extension OID of signers mapping roles
+const testRoleOID = "1.3.6.1.4.1.10049.3"
+
+// extensionRoles returns the roles in cert's role extension, or nil if it
+// has none
+func extensionRoles(t *testing.T, cert *x509.Certificate) []string {
+	t.Helper()
+	oid, err := parseOID(testRoleOID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oid) {
+			continue
+		}
+		var roles []string
+		if _, err := asn1.Unmarshal(ext.Value, &roles); err != nil {
+			t.Fatalf("invalid role extension: %v", err)
+		}
+		return roles
+	}
+	return nil
+}
+
+func TestMapRoles(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Signer.RoleMappings = []config.RoleMappingConfig{
+		{Groups: []string{"eng-*"}, Role: "developer"},
+		{Groups: []string{"ops", "sre"}, Role: "operator"},
+		{Groups: []string{"eng-core"}, Role: "developer"},
+	}
+	mappings, err := loadRoleMappings(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		groups []string
+		want   []string
+	}{
+		{[]string{"eng-core", "ops", "users"}, []string{"developer", "operator"}},
+		{[]string{"sre"}, []string{"operator"}},
+		{[]string{"users"}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := mapRoles(mappings, tt.groups); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("roles of %v = %v, want %v", tt.groups, got, tt.want)
+		}
+	}
+
+	for name, rm := range map[string]config.RoleMappingConfig{
+		"bad pattern": {Groups: []string{"eng-["}, Role: "developer"},
+		"no role":     {Groups: []string{"eng-*"}},
+		"no groups":   {Role: "developer"},
+	} {
+		cfg.Signer.RoleMappings = []config.RoleMappingConfig{rm}
+		if _, err := loadRoleMappings(cfg); err == nil {
+			t.Errorf("%s: invalid mapping accepted", name)
+		}
+	}
+}
+
+func TestRoleExtension(t *testing.T) {
+	s, _ := newConfiguredSigner(t, func(cfg *config.Config) {
+		cfg.Signer.RoleExtensionOID = testRoleOID
+		cfg.Signer.RoleMappings = []config.RoleMappingConfig{
+			{Groups: []string{"eng-*"}, Role: "developer"},
+			{Groups: []string{"ops"}, Role: "operator"},
+		}
+		cfg.Signer.Profiles = map[string]config.ProfileConfig{
+			"default": {},
+			"plain":   {Extensions: []string{ExtensionGroups}},
+		}
+	})
+	s.SetGroupSource(staticGroups{"alice": {"eng-core", "ops"}})
+
+	cert := issue(t, s, "alice", []string{"eng-core", "ops"})
+	if roles := extensionRoles(t, cert); !reflect.DeepEqual(roles, []string{"developer", "operator"}) {
+		t.Errorf("roles = %v, want developer and operator", roles)
+	}
+	records := s.issued.ByUser("alice")
+	if len(records) != 1 || !reflect.DeepEqual(records[0].Roles, []string{"developer", "operator"}) {
+		t.Errorf("issued records = %+v, want one with the roles", records)
+	}
+
+	// Roles follow the groups granted, not those asked for
+	if roles := extensionRoles(t, issue(t, s, "alice", []string{"eng-core", "admins"})); !reflect.DeepEqual(roles, []string{"developer"}) {
+		t.Errorf("roles = %v, want only developer", roles)
+	}
+	if roles := extensionRoles(t, issue(t, s, "alice", nil)); roles != nil {
+		t.Errorf("certificate without mapped groups has roles %v", roles)
+	}
+
+	certPEM, err := s.SignCSR(makeCSR(t, "alice"), []string{"eng-core"}, "plain", Identity{Username: "alice", RequestID: "req-plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles := extensionRoles(t, parseCertificate(t, certPEM)); roles != nil {
+		t.Errorf("profile without the roles extension issued roles %v", roles)
+	}
+}
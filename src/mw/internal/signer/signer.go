@@ -1,22 +1,26 @@
 package signer
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
-	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ogt11/certm3/mw/internal/config"
 	"github.com/ogt11/certm3/mw/internal/logging"
 	"github.com/ogt11/certm3/mw/pkg/metrics"
+	"golang.org/x/crypto/ssh"
 )
 
 // OIDs for public key algorithms
@@ -46,29 +50,116 @@ var UsernameOID asn1.ObjectIdentifier
 
 // Signer represents a certificate signer
 type Signer struct {
-	config   *config.Config
-	logger   *logging.Logger
-	metrics  *metrics.Metrics
-	caCert   *x509.Certificate
-	caKey    interface{}
-	groupOID asn1.ObjectIdentifier
+	config      *config.Config
+	logger      *logging.Logger
+	metrics     *metrics.Metrics
+	groupOID    asn1.ObjectIdentifier
+	roleOID     asn1.ObjectIdentifier // nil unless a role extension OID is configured
+	roles       []roleMapping
+	profiles    map[string]*Profile
+	revocations *RevocationStore
+	issued      *IssuedIndex
+	crls        crlCache
+	sshCA       ssh.Signer // nil unless SSH certificates are enabled
+	groupSource GroupSource
+	groupCache  groupCache
+
+	policyMu sync.RWMutex
+	policy   *Policy
+
+	// The issuing CAs. caMu is held for reading while a CA key is in use,
+	// so SetIssuingCAs can swap the set without interrupting signatures.
+	caMu     sync.RWMutex
+	cas      []*issuer
+	crlMux   *http.ServeMux
+	crlPaths map[string]bool // CRL paths registered on crlMux
+
+	activeMu sync.Mutex
+	activeCA string // fingerprint of the CA last issued from
 }
 
-func New(cfg *config.Config, logger *logging.Logger, metrics *metrics.Metrics, caCert *x509.Certificate, caKey interface{}, groupOID string) *Signer {
+func New(cfg *config.Config, logger *logging.Logger, metrics *metrics.Metrics, caCert *x509.Certificate, caKey crypto.Signer, caChain []*x509.Certificate, groupOID string) *Signer {
 	// Parse OID
 	groupOIDParsed, err := parseOID(groupOID)
 	if err != nil {
-		logger.Fatal("invalid group OID: %v", err)
+		logger.Fatalf("invalid group OID: %v", err)
 	}
 
-	return &Signer{
-		config:   cfg,
-		logger:   logger,
-		metrics:  metrics,
-		caCert:   caCert,
-		caKey:    caKey,
-		groupOID: groupOIDParsed,
+	// Refuse to start with profiles or key usages we do not understand
+	profiles, err := loadProfiles(cfg)
+	if err != nil {
+		logger.Fatalf("invalid certificate profile configuration: %v", err)
+	}
+
+	revocations, err := OpenRevocationStore(cfg.Signer.RevocationDBPath)
+	if err != nil {
+		logger.Fatalf("failed to open revocation store: %v", err)
+	}
+	issued, err := OpenIssuedIndex(cfg.Signer.IssuedDBPath)
+	if err != nil {
+		logger.Fatalf("failed to open issued certificate index: %v", err)
 	}
+
+	var sshCA ssh.Signer
+	if cfg.Signer.SSHCAKeyPath != "" {
+		sshCA, err = loadSSHCAKey(cfg.Signer.SSHCAKeyPath)
+		if err != nil {
+			logger.Fatalf("failed to load SSH CA key: %v", err)
+		}
+	}
+
+	groupSource, err := newGroupSource(cfg, metrics)
+	if err != nil {
+		logger.Fatalf("failed to set up the group source: %v", err)
+	}
+	policy, err := LoadPolicy(cfg.Signer.PolicyPath)
+	if err != nil {
+		logger.Fatalf("invalid issuance policy: %v", err)
+	}
+
+	var roleOIDParsed asn1.ObjectIdentifier
+	if cfg.Signer.RoleExtensionOID != "" {
+		roleOIDParsed, err = parseOID(cfg.Signer.RoleExtensionOID)
+		if err != nil {
+			logger.Fatalf("invalid role extension OID: %v", err)
+		}
+		if roleOIDParsed.Equal(groupOIDParsed) {
+			logger.Fatalf("the role extension OID must differ from the group OID")
+		}
+	}
+	roles, err := loadRoleMappings(cfg)
+	if err != nil {
+		logger.Fatalf("invalid role mappings: %v", err)
+	}
+
+	s := &Signer{
+		config:      cfg,
+		logger:      logger,
+		metrics:     metrics,
+		groupOID:    groupOIDParsed,
+		roleOID:     roleOIDParsed,
+		roles:       roles,
+		profiles:    profiles,
+		revocations: revocations,
+		issued:      issued,
+		sshCA:       sshCA,
+		groupSource: groupSource,
+		policy:      policy,
+	}
+	s.cas = []*issuer{{
+		IssuingCA: IssuingCA{
+			Certificate:        caCert,
+			Key:                caKey,
+			Chain:              caChain,
+			CRLDistributionURL: cfg.Signer.CRLDistributionURL,
+			DeltaCRLURL:        cfg.Signer.DeltaCRLURL,
+			AIAIssuerURL:       cfg.Signer.AIAIssuerURL,
+		},
+		id:          issuerID(caCert),
+		fingerprint: Fingerprint(caCert.Raw),
+		ocsp:        &ocspResponder{},
+	}}
+	return s
 }
 
 // parseOID parses a string OID into an ObjectIdentifier
@@ -196,7 +287,7 @@ func (s *Signer) parseCSR(csrPEM string) (*x509.CertificateRequest, error) {
 	// Parse the raw CSR to extract extensions from attributes
 	var pkcs10Req pkcs10
 	if _, err := asn1.Unmarshal(block.Bytes, &pkcs10Req); err != nil {
-		s.logger.Warn("Failed to parse CSR attributes, using standard extensions only: %v", err)
+		s.logger.Warnf("Failed to parse CSR attributes, using standard extensions only: %v", err)
 		return csr, nil
 	}
 
@@ -204,43 +295,43 @@ func (s *Signer) parseCSR(csrPEM string) (*x509.CertificateRequest, error) {
 	var extensions []pkix.Extension
 	for _, attr := range pkcs10Req.CertificationRequestInfo.Attributes {
 		if attr.Type.Equal(oidExtensionRequest) {
-			s.logger.Info("Found extension request attribute, value tag: %v, length: %d", attr.Value.Tag, len(attr.Value.Bytes))
-			s.logger.Info("Extension request attribute value bytes: %x", attr.Value.Bytes)
+			s.logger.Infof("Found extension request attribute, value tag: %v, length: %d", attr.Value.Tag, len(attr.Value.Bytes))
+			s.logger.Infof("Extension request attribute value bytes: %x", attr.Value.Bytes)
 
 			// Try to parse as a raw ASN.1 structure first to understand the format
 			var rawValue asn1.RawValue
 			if _, err := asn1.Unmarshal(attr.Value.FullBytes, &rawValue); err != nil {
-				s.logger.Warn("Failed to parse extension request attribute as raw value: %v", err)
+				s.logger.Warnf("Failed to parse extension request attribute as raw value: %v", err)
 				continue
 			}
-			s.logger.Info("Raw value tag: %v, length: %d, isCompound: %v", rawValue.Tag, len(rawValue.Bytes), rawValue.IsCompound)
+			s.logger.Infof("Raw value tag: %v, length: %d, isCompound: %v", rawValue.Tag, len(rawValue.Bytes), rawValue.IsCompound)
 
 			// The extension request attribute value is a SET containing SEQUENCE-wrapped extensions
 			// Parse as a SET of SEQUENCE structures
 			var extReqSet []asn1.RawValue
 			if _, err := asn1.Unmarshal(rawValue.FullBytes, &extReqSet); err != nil {
-				s.logger.Warn("Failed to parse extension request attribute SET: %v", err)
+				s.logger.Warnf("Failed to parse extension request attribute SET: %v", err)
 				continue
 			}
 
-			s.logger.Info("Successfully parsed extension request as SET with %d items", len(extReqSet))
+			s.logger.Infof("Successfully parsed extension request as SET with %d items", len(extReqSet))
 
 			// Parse each extension in the SET
 			for i, extRaw := range extReqSet {
 				// Node-forge adds an extra SEQUENCE wrapper, so we need to parse it as a SEQUENCE first
 				var extSeq asn1.RawValue
 				if _, err := asn1.Unmarshal(extRaw.FullBytes, &extSeq); err != nil {
-					s.logger.Warn("Failed to parse extension %d SEQUENCE wrapper: %v", i, err)
+					s.logger.Warnf("Failed to parse extension %d SEQUENCE wrapper: %v", i, err)
 					continue
 				}
 
 				var ext pkix.Extension
 				if _, err := asn1.Unmarshal(extSeq.FullBytes, &ext); err != nil {
-					s.logger.Warn("Failed to parse extension %d: %v", i, err)
+					s.logger.Warnf("Failed to parse extension %d: %v", i, err)
 					continue
 				}
 				extensions = append(extensions, ext)
-				s.logger.Info("Successfully parsed extension %d: %v", i, ext.Id)
+				s.logger.Infof("Successfully parsed extension %d: %v", i, ext.Id)
 			}
 		}
 	}
@@ -253,91 +344,67 @@ func (s *Signer) parseCSR(csrPEM string) (*x509.CertificateRequest, error) {
 		allExtensions = append(allExtensions, extensions...)
 		csr.Extensions = allExtensions
 
-		s.logger.Info("Added %d extensions from CSR attributes", len(extensions))
+		s.logger.Infof("Added %d extensions from CSR attributes", len(extensions))
 	}
 
 	return csr, nil
 }
 
-// SignCSR signs a certificate signing request with group validation
-func (s *Signer) SignCSR(csrPEM []byte, requestedGroups []string) ([]byte, error) {
-	// Parse the CSR using our flexible parser
-	csr, err := s.parseCSR(string(csrPEM))
+// SignCSR signs a certificate signing request with group validation, using
+// the named profile or the default profile if profileName is empty
+func (s *Signer) SignCSR(csrPEM []byte, requestedGroups []string, profileName string, identity Identity) ([]byte, error) {
+	certPEM, _, err := s.signCSR(csrPEM, requestedGroups, profileName, identity, "")
+	return certPEM, err
+}
+
+// signCSR signs a CSR; supersedes is the hex serial of the certificate the
+// new one replaces, if it is a renewal. For profiles with the
+// attribute_certificate group encoding it also returns the attribute
+// certificate issued with it.
+func (s *Signer) signCSR(csrPEM []byte, requestedGroups []string, profileName string, identity Identity, supersedes string) ([]byte, []byte, error) {
+	profile, err := s.Profile(profileName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse CSR: %v", err)
+		return nil, nil, fmt.Errorf("%w: %v", ErrPolicyDenied, err)
 	}
 
-	// Verify the CSR signature
-	if err := csr.CheckSignature(); err != nil {
-		return nil, fmt.Errorf("invalid CSR signature: %v", err)
+	// Parse the CSR using our flexible parser
+	csr, err := s.parseCSR(string(csrPEM))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to parse CSR: %v", ErrBadCSR, err)
 	}
 
-	// Extract username from CN
-	username := ""
-	for _, name := range csr.Subject.Names {
-		if name.Type.Equal(oidCommonName) {
-			if str, ok := name.Value.(string); ok {
-				username = str
-				break
-			}
+	// The signature must verify, the subject must name the user the
+	// request was authenticated for and the profile must allow the SANs
+	if err := verifyCSR(csr, profile, identity.Username); err != nil {
+		var subjErr *subjectError
+		if errors.As(err, &subjErr) {
+			s.logSubjectMismatch(identity, subjErr)
 		}
+		return nil, nil, err
 	}
-	if username == "" {
-		return nil, fmt.Errorf("no CommonName found in CSR")
-	}
+	username := identity.Username
 
-	// Get user's actual groups from backend API
-	actualGroups, err := s.getUserGroups(username)
+	decision, err := s.authorize(username, requestedGroups, profile, csr, profile.Validity)
 	if err != nil {
-		// Log the error but proceed with actualGroups as empty.
-		// The intersection will be empty, but default groups (username, 'users') will still be added.
-		s.logger.Error("Failed to get user groups from backend for user %s: %v. Proceeding with only default groups and any valid requested groups if backend check was intended to be non-critical for subset requests.", username, err)
-		actualGroups = []string{} // Ensure actualGroups is empty if lookup fails, to prevent partial/stale data issues.
+		return nil, nil, err
 	}
-
-	// Log the groups as requested by the client and as known by the backend
-	s.logger.Info("User %s requested groups: %v", username, requestedGroups)
-	s.logger.Info("User %s actual groups from backend: %v", username, actualGroups)
-
-	// Intersect requestedGroups with actualGroups from the backend.
-	// This gives the set of groups that the user both requested and is legitimately a member of.
-	intersectedGroups := s.intersectGroups(requestedGroups, actualGroups)
-	s.logger.Info("Intersection of requested and actual groups for %s: %v", username, intersectedGroups)
-
-	// Use a set to ensure uniqueness and easily add default groups.
-	finalAuthorizedGroupsSet := make(map[string]struct{})
-	for _, group := range intersectedGroups {
-		finalAuthorizedGroupsSet[group] = struct{}{}
-	}
-
-	// Ensure the user's own username and the "users" group are always included.
-	// This is a policy decision. If these should *only* be included if requested AND valid,
-	// then this addition step should be conditional or removed.
-	// Current interpretation: these are mandatory baseline groups.
-	finalAuthorizedGroupsSet[username] = struct{}{}
-	finalAuthorizedGroupsSet["users"] = struct{}{}
-
-	finalAuthorizedGroups := make([]string, 0, len(finalAuthorizedGroupsSet))
-	for groupName := range finalAuthorizedGroupsSet {
-		finalAuthorizedGroups = append(finalAuthorizedGroups, groupName)
-	}
-
-	s.logger.Info("Final authorized groups for user %s to be included in certificate: %v", username, finalAuthorizedGroups)
+	finalAuthorizedGroups := decision.Groups
 
 	// Generate a random serial number
 	serialNumber, err := generateSerialNumber()
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+		return nil, nil, fmt.Errorf("failed to generate serial number: %v", err)
 	}
 
 	// Create certificate template
 	template := &x509.Certificate{
 		SerialNumber:          serialNumber,
-		Subject:               csr.Subject, // Preserved from CSR
+		Subject:               certificateSubject(csr, username),
 		NotBefore:             time.Now(),
-		NotAfter:              time.Now().Add(time.Duration(s.config.Signer.CertValidityDays) * 24 * time.Hour),
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment, // Consider making this configurable via s.config
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},               // Consider making this configurable via s.config
+		NotAfter:              time.Now().Add(decision.Validity),
+		KeyUsage:              profile.usage.keyUsage,
+		ExtKeyUsage:           profile.usage.extKeyUsage,
+		UnknownExtKeyUsage:    profile.usage.unknownExtUsage,
 		BasicConstraintsValid: true,
 		IsCA:                  false,
 
@@ -353,37 +420,130 @@ func (s *Signer) SignCSR(csrPEM []byte, requestedGroups []string) ([]byte, error
 		Extensions: []pkix.Extension{},
 	}
 
-	// Add group extension using the finalAuthorizedGroups
-	if len(finalAuthorizedGroups) > 0 {
-		groupExt, errGroupExt := s.createGroupExtension(finalAuthorizedGroups)
-		if errGroupExt != nil {
-			return nil, fmt.Errorf("failed to create group extension: %v", errGroupExt)
+	// Issue from the current CA, holding it until the certificate is
+	// recorded
+	s.caMu.RLock()
+	defer s.caMu.RUnlock()
+	ca := s.currentIssuerLocked()
+	if ca == nil {
+		return nil, nil, fmt.Errorf("%w: no active issuing CA", ErrCAUnavailable)
+	}
+
+	// Point relying parties at the CRLs we publish
+	if ca.CRLDistributionURL != "" && profile.hasExtension(ExtensionCRL) {
+		template.CRLDistributionPoints = []string{ca.CRLDistributionURL}
+	}
+	if ca.DeltaCRLURL != "" && profile.hasExtension(ExtensionCRL) {
+		freshest, errFreshest := marshalDistributionPoints([]string{ca.DeltaCRLURL})
+		if errFreshest != nil {
+			return nil, nil, fmt.Errorf("failed to encode freshest CRL extension: %v", errFreshest)
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+			Id:    oidExtensionFreshestCRL,
+			Value: freshest,
+		})
+	}
+	if s.config.Signer.OCSPURL != "" && profile.hasExtension(ExtensionOCSP) {
+		template.OCSPServer = []string{s.config.Signer.OCSPURL}
+	}
+	if ca.AIAIssuerURL != "" && profile.hasExtension(ExtensionAIA) {
+		template.IssuingCertificateURL = []string{ca.AIAIssuerURL}
+	}
+
+	// Carry the finalAuthorizedGroups in each of the profile's encodings;
+	// attribute certificates are issued separately. Once any profile uses
+	// the subject OU encoding, the OUs are the groups and nothing else.
+	if profile.stripSubjectOUs {
+		template.Subject.OrganizationalUnit = nil
+	}
+	if !profile.hasExtension(ExtensionGroups) {
+		s.logger.Infof("Profile %s excludes the group extension for user %s", profile.Name, username)
+	} else if len(finalAuthorizedGroups) > 0 {
+		if profile.encodesGroupsAs(GroupEncodingExtension) {
+			groupExt, errGroupExt := s.createGroupExtension(finalAuthorizedGroups)
+			if errGroupExt != nil {
+				return nil, nil, fmt.Errorf("failed to create group extension: %v", errGroupExt)
+			}
+			template.ExtraExtensions = append(template.ExtraExtensions, groupExt)
+			s.logger.Infof("Appended group extension to template.ExtraExtensions for user %s. OID: %v", username, groupExt.Id)
+		}
+		if profile.encodesGroupsAs(GroupEncodingSubjectOU) {
+			template.Subject.OrganizationalUnit = finalAuthorizedGroups
+		}
+		if profile.encodesGroupsAs(GroupEncodingSANURI) {
+			template.URIs = append(append([]*url.URL{}, csr.URIs...), groupURIs(finalAuthorizedGroups)...)
 		}
-		template.ExtraExtensions = append(template.ExtraExtensions, groupExt)
-		s.logger.Info("Appended group extension to template.ExtraExtensions for user %s. OID: %v", username, groupExt.Id)
 	} else {
-		s.logger.Warn("No authorized groups for user %s after intersection and addition of defaults; group extension will be omitted.", username)
+		s.logger.Warnf("No authorized groups for user %s after intersection and addition of defaults; group extension will be omitted.", username)
+	}
+
+	// Add the roles the groups map to next to them
+	if s.roleOID != nil && profile.hasExtension(ExtensionRoles) && len(decision.Roles) > 0 {
+		roleExt, errRoleExt := s.createRoleExtension(decision.Roles)
+		if errRoleExt != nil {
+			return nil, nil, fmt.Errorf("failed to create role extension: %v", errRoleExt)
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, roleExt)
 	}
 
-	s.logger.Info("Certificate template for user %s prepared with %d extensions.", username, len(template.Extensions))
+	s.logger.Infof("Certificate template for user %s prepared with %d extensions.", username, len(template.Extensions))
 	for i, ext := range template.Extensions {
-		s.logger.Info("Template Extension %d for %s: OID=%v, Critical=%v, Value length=%d", i, username, ext.Id, ext.Critical, len(ext.Value))
+		s.logger.Infof("Template Extension %d for %s: OID=%v, Critical=%v, Value length=%d", i, username, ext.Id, ext.Critical, len(ext.Value))
 	}
 
 	// Create the certificate using CA cert & key, template, and crucially the CSR's Public Key
-	certDER, err := x509.CreateCertificate(rand.Reader, template, s.caCert, csr.PublicKey, s.caKey)
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, csr.PublicKey, ca.Key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create certificate for user %s: %v", username, err)
+		return nil, nil, fmt.Errorf("%w: failed to create certificate for user %s: %v", ErrCAUnavailable, username, err)
+	}
+
+	// Issue the attribute certificate before recording the certificate, so
+	// a failure leaves no recorded certificate the user never received
+	var acPEM []byte
+	if profile.encodesGroupsAs(GroupEncodingAttrCert) {
+		var roles []string
+		if profile.hasExtension(ExtensionRoles) {
+			roles = decision.Roles
+		}
+		acValidity := profile.acValidity
+		if acValidity > decision.Validity {
+			acValidity = decision.Validity
+		}
+		acPEM, err = s.issueAttributeCertificateLocked(ca, ca.Certificate.RawSubject, serialNumber, finalAuthorizedGroups, roles, template.NotBefore, template.NotBefore.Add(acValidity), identity)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to issue attribute certificate for user %s: %w", username, err)
+		}
+	}
+
+	// Record the issuance in the ledger; status queries, revocation and
+	// audits all rely on it
+	if err := s.issued.Add(IssuedRecord{
+		Serial:               serialNumber.Text(16),
+		Issuer:               ca.id,
+		Subject:              template.Subject.String(),
+		NotBefore:            template.NotBefore,
+		NotAfter:             template.NotAfter,
+		UserID:               identity.UserID,
+		Username:             username,
+		RequestID:            identity.RequestID,
+		Profile:              profile.Name,
+		Groups:               finalAuthorizedGroups,
+		Roles:                decision.Roles,
+		PublicKeyFingerprint: Fingerprint(csr.RawSubjectPublicKeyInfo),
+		Fingerprint:          Fingerprint(certDER),
+		Supersedes:           supersedes,
+	}); err != nil {
+		return nil, nil, fmt.Errorf("failed to record issued certificate for user %s: %v", username, err)
 	}
 
 	// For verification and logging, parse the created certificate
 	createdCert, parseErr := x509.ParseCertificate(certDER)
 	if parseErr != nil {
-		s.logger.Error("Failed to parse the newly created certificate for verification logging (user %s): %v", username, parseErr)
+		s.logger.Errorf("Failed to parse the newly created certificate for verification logging (user %s): %v", username, parseErr)
 	} else {
-		s.logger.Info("Final created certificate for user %s has %d extensions.", username, len(createdCert.Extensions))
+		s.logger.Infof("Final created certificate for user %s has %d extensions.", username, len(createdCert.Extensions))
 		for i, ext := range createdCert.Extensions {
-			s.logger.Info("Final cert extension %d for %s: OID=%v, Critical=%v, Value length=%d, Value (hex): %x", i, username, ext.Id, ext.Critical, len(ext.Value), ext.Value)
+			s.logger.Infof("Final cert extension %d for %s: OID=%v, Critical=%v, Value length=%d, Value (hex): %x", i, username, ext.Id, ext.Critical, len(ext.Value), ext.Value)
 		}
 	}
 
@@ -393,7 +553,52 @@ func (s *Signer) SignCSR(csrPEM []byte, requestedGroups []string) ([]byte, error
 		Bytes: certDER,
 	})
 
-	return certPEM, nil
+	return certPEM, acPEM, nil
+}
+
+// authorize decides by the issuance policy which groups a certificate for
+// username carries and how long it is valid for, at most validity. It fails
+// with ErrGroupLookup when the group source cannot answer and the profile
+// does not allow going without it, and with a PolicyError when the policy
+// denies the request.
+func (s *Signer) authorize(username string, requestedGroups []string, profile *Profile, csr *x509.CertificateRequest, validity time.Duration) (*Decision, error) {
+	// Get user's actual groups from the group source
+	actualGroups, err := s.userGroups(username, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Log the groups as requested by the client and as known by the backend
+	s.logger.Infof("User %s requested groups: %v", username, requestedGroups)
+	s.logger.Infof("User %s actual groups from backend: %v", username, actualGroups)
+
+	decision := s.currentPolicy().Evaluate(PolicyInput{
+		Username:  username,
+		Requested: requestedGroups,
+		Member:    actualGroups,
+		Profile:   profile,
+		CSR:       csr,
+		Validity:  validity,
+		Now:       time.Now(),
+	})
+	if err := decision.Err(); err != nil {
+		rules := make([]string, len(decision.Reasons))
+		for i, reason := range decision.Reasons {
+			rules[i] = reason.Rule
+		}
+		s.logger.LogSecurityEvent("policy_denied", map[string]interface{}{
+			"username": username,
+			"profile":  profile.Name,
+			"rules":    rules,
+			"reason":   err.Error(),
+		})
+		s.metrics.RecordSecurityEvent("policy_denied")
+		return nil, err
+	}
+	decision.Roles = mapRoles(s.roles, decision.Groups)
+
+	s.logger.Infof("Final authorized groups for user %s to be included in certificate: %v", username, decision.Groups)
+	return decision, nil
 }
 
 // generateSerialNumber generates a random serial number for the certificate
@@ -406,64 +611,28 @@ func generateSerialNumber() (*big.Int, error) {
 	return new(big.Int).SetBytes(serialBytes), nil
 }
 
-// GetCACertificate returns the CA certificate in PEM format
-func (s *Signer) GetCACertificate() ([]byte, error) {
-	if s.caCert == nil {
-		return nil, fmt.Errorf("CA certificate not initialized")
-	}
-
-	// Convert CA certificate to PEM
-	caCertPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: s.caCert.Raw,
-	})
-
-	return caCertPEM, nil
-}
-
-// getUserGroups retrieves the user's groups from the backend API
-func (s *Signer) getUserGroups(username string) ([]string, error) {
-	// First, get the user info from backend
-	userURL := fmt.Sprintf("%s/users/username/%s", s.config.AppServer.BackendAPIURL, username)
-	userResp, err := http.Get(userURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to call backend API for user: %v", err)
-	}
-	defer userResp.Body.Close()
-
-	if userResp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("backend API returned status %d for user lookup", userResp.StatusCode)
-	}
-
-	var userData struct {
-		ID string `json:"id"`
-	}
-	if err := json.NewDecoder(userResp.Body).Decode(&userData); err != nil {
-		return nil, fmt.Errorf("failed to decode user response: %v", err)
-	}
-
-	// Now get the groups for this user
-	groupsURL := fmt.Sprintf("%s/users/%s/groups", s.config.AppServer.BackendAPIURL, userData.ID)
-	groupsResp, err := http.Get(groupsURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to call backend API for groups: %v", err)
-	}
-	defer groupsResp.Body.Close()
-
-	if groupsResp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("backend API returned status %d for groups lookup", groupsResp.StatusCode)
-	}
-
-	var groups []string
-	if err := json.NewDecoder(groupsResp.Body).Decode(&groups); err != nil {
-		return nil, fmt.Errorf("failed to decode groups response: %v", err)
-	}
-
-	return groups, nil
+// GetCACertificates returns the PEM encoded certificate of the CA currently
+// issuing followed by the issuers above it, nearest first, up to the root
+// if the chain is configured
+func (s *Signer) GetCACertificates() ([][]byte, error) {
+	s.caMu.RLock()
+	ca := newestActive(s.cas, time.Now())
+	s.caMu.RUnlock()
+	if ca == nil {
+		return nil, fmt.Errorf("no active issuing CA")
+	}
+	certs := make([][]byte, 0, 1+len(ca.Chain))
+	for _, cert := range append([]*x509.Certificate{ca.Certificate}, ca.Chain...) {
+		certs = append(certs, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		}))
+	}
+	return certs, nil
 }
 
 // intersectGroups returns the intersection of two string slices
-func (s *Signer) intersectGroups(requested, actual []string) []string {
+func intersectGroups(requested, actual []string) []string {
 	actualSet := make(map[string]bool)
 	for _, group := range actual {
 		actualSet[group] = true
@@ -498,7 +667,7 @@ func (s *Signer) createGroupExtension(groups []string) (pkix.Extension, error) {
 		return pkix.Extension{}, fmt.Errorf("failed to marshal group sequence: %v", err)
 	}
 
-	s.logger.Info("Created group extension with OID %v and %d groups: %v", s.groupOID, len(groups), groups)
+	s.logger.Infof("Created group extension with OID %v and %d groups: %v", s.groupOID, len(groups), groups)
 
 	return pkix.Extension{
 		Id:       s.groupOID,
@@ -0,0 +1,195 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+	"github.com/ogt11/certm3/mw/internal/logging"
+	"github.com/ogt11/certm3/mw/internal/security"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+	"github.com/ogt11/certm3/mw/pkg/metrics"
+)
+
+// testMetrics is shared, as metrics register with the default registry
+var testMetrics = metrics.New()
+
+// testGroupOID is the group extension OID of test signers
+const testGroupOID = "1.3.6.1.4.1.10049.2"
+
+// newTestCA returns a self-signed CA certificate and its key
+func newTestCA(t *testing.T, commonName string, notBefore time.Time) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             notBefore,
+		NotAfter:              time.Now().Add(48 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// newTestSigner returns a signer with a fresh CA, its databases in a
+// temporary directory and an unreachable backend. Tests may adjust the
+// returned configuration, which the signer reads as it goes.
+func newTestSigner(t *testing.T) (*Signer, *config.Config) {
+	t.Helper()
+	return newConfiguredSigner(t, nil)
+}
+
+// newConfiguredSigner is newTestSigner for settings read only by New:
+// configure, if not nil, adjusts the configuration first
+func newConfiguredSigner(t *testing.T, configure func(*config.Config)) (*Signer, *config.Config) {
+	t.Helper()
+	ca, key := newTestCA(t, "Test CA", time.Now().Add(-time.Hour))
+
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Signer.DefaultProfile = "default"
+	cfg.Signer.RevocationDBPath = filepath.Join(dir, "revocations.json")
+	cfg.Signer.IssuedDBPath = filepath.Join(dir, "issued.jsonl")
+	cfg.Signer.CRLDistributionURL = "http://crl.example.com/ca.crl"
+	cfg.Signer.DeltaCRLURL = "http://crl.example.com/ca-delta.crl"
+	cfg.Signer.CRLValidity = 48 * time.Hour
+	cfg.Signer.DeltaCRLInterval = time.Hour
+	cfg.Signer.CertValidityDays = 30
+	cfg.AppServer.BackendAPIURL = "http://127.0.0.1:1"
+	if configure != nil {
+		configure(cfg)
+	}
+
+	logger, err := logging.New("error", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(cfg, logger, testMetrics, ca, key, nil, testGroupOID)
+	t.Cleanup(func() { s.issued.Close() })
+	return s, cfg
+}
+
+// newCSR returns a PEM CSR for template, signed with a fresh key
+func newCSR(t *testing.T, template *x509.CertificateRequest) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+// makeCSR returns a PEM CSR with the given CommonName
+func makeCSR(t *testing.T, commonName string) []byte {
+	t.Helper()
+	return newCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}})
+}
+
+// parseCertificate parses a PEM certificate
+func parseCertificate(t *testing.T, certPEM []byte) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatalf("no PEM block in %q", certPEM)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writeFile writes content to path, readable only by the owner
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// issue has s sign a CSR for username and returns the certificate
+func issue(t *testing.T, s *Signer, username string, groups []string) *x509.Certificate {
+	t.Helper()
+	certPEM, err := s.SignCSR(makeCSR(t, username), groups, "", Identity{Username: username, RequestID: "req-" + username})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseCertificate(t, certPEM)
+}
+
+// newTestHandler returns a handler for a test signer and the ticket manager
+// its tickets come from
+func newTestHandler(t *testing.T) (*Handler, *security.TicketManager) {
+	t.Helper()
+	s, _ := newTestSigner(t)
+	tickets := security.NewTicketManager("test-secret", time.Minute)
+	return NewHandler(s.logger, testMetrics, s, tickets), tickets
+}
+
+// signRequest returns a request to sign a fresh CSR for username in request
+// requestID, with a ticket for it
+func signRequest(t *testing.T, tickets *security.TicketManager, username, requestID string, groups []string) *signerproto.SignRequest {
+	t.Helper()
+	csr := string(makeCSR(t, username))
+	token, err := tickets.IssueTicket("id-"+username, username, requestID, security.TicketActionSign, security.IssuancePayload([]byte(csr), "", groups))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &signerproto.SignRequest{
+		RequestID: requestID,
+		CSR:       csr,
+		Groups:    groups,
+		Token:     token,
+		UserID:    "id-" + username,
+		Username:  username,
+	}
+}
+
+// serveUnix serves h on a Unix socket until the test ends, returning the
+// socket's path
+func serveUnix(t *testing.T, h *Handler) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "signer.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go h.HandleConnection(conn)
+		}
+	}()
+	return path
+}
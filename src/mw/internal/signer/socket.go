@@ -0,0 +1,64 @@
+package signer
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// ConfigureSocket sets the owner, group and mode of the signer's Unix
+// socket. owner and group may be names or numeric IDs; empty leaves them
+// unchanged. mode is an octal permission string such as "0660".
+func ConfigureSocket(path, owner, group, mode string) error {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0777 {
+		return fmt.Errorf("invalid socket mode %q", mode)
+	}
+
+	uid, gid := -1, -1
+	if owner != "" {
+		if uid, err = lookupUID(owner); err != nil {
+			return err
+		}
+	}
+	if group != "" {
+		if gid, err = lookupGID(group); err != nil {
+			return err
+		}
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(path, uid, gid); err != nil {
+			return fmt.Errorf("failed to set socket owner: %v", err)
+		}
+	}
+
+	if err := os.Chmod(path, os.FileMode(perm)); err != nil {
+		return fmt.Errorf("failed to set socket permissions: %v", err)
+	}
+	return nil
+}
+
+// lookupUID resolves a user name or numeric UID
+func lookupUID(name string) (int, error) {
+	if uid, err := strconv.Atoi(name); err == nil {
+		return uid, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, fmt.Errorf("unknown socket owner %q: %v", name, err)
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGID resolves a group name or numeric GID
+func lookupGID(name string) (int, error) {
+	if gid, err := strconv.Atoi(name); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, fmt.Errorf("unknown socket group %q: %v", name, err)
+	}
+	return strconv.Atoi(g.Gid)
+}
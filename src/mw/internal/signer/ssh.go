@@ -0,0 +1,261 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KRL format constants (OpenSSH PROTOCOL.krl)
+const (
+	krlMagic                 = 0x5353484b524c0a00 // "SSHKRL\n\0"
+	krlFormatVersion         = 1
+	krlSectionCertificates   = 1
+	krlSectionCertSerialList = 0x20
+)
+
+// minSSHRSABits is the smallest RSA key the signer certifies
+const minSSHRSABits = 2048
+
+// loadSSHCAKey reads the SSH CA private key, in OpenSSH or PEM format
+func loadSSHCAKey(path string) (ssh.Signer, error) {
+	keyPEM, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	signer, err := ssh.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return signer, nil
+}
+
+// SignSSHKey issues an OpenSSH user certificate for publicKey, given in
+// authorized_keys format, to the user the request was authenticated for.
+// The principals are the user's authorized groups, worked out with the
+// named profile exactly as for X.509 certificates.
+func (s *Signer) SignSSHKey(publicKey []byte, requestedGroups []string, profileName string, identity Identity) (*ssh.Certificate, error) {
+	if s.sshCA == nil {
+		return nil, fmt.Errorf("%w: no SSH CA key configured", ErrCAUnavailable)
+	}
+	profile, err := s.Profile(profileName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPolicyDenied, err)
+	}
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid SSH public key: %v", ErrBadCSR, err)
+	}
+	if _, isCert := key.(*ssh.Certificate); isCert {
+		return nil, fmt.Errorf("%w: expected a public key, not a certificate", ErrBadCSR)
+	}
+	if cryptoKey, ok := key.(ssh.CryptoPublicKey); ok {
+		if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minSSHRSABits {
+			return nil, fmt.Errorf("%w: RSA keys must have at least %d bits", ErrBadCSR, minSSHRSABits)
+		}
+	}
+
+	username := identity.Username
+	decision, err := s.authorize(username, requestedGroups, profile, nil, s.config.Signer.SSHCertValidity)
+	if err != nil {
+		return nil, err
+	}
+	principals := decision.Groups
+
+	serial, err := generateSSHSerial()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+	now := time.Now()
+	extensions := make(map[string]string, len(s.config.Signer.SSHExtensions))
+	for _, name := range s.config.Signer.SSHExtensions {
+		extensions[name] = ""
+	}
+	cert := &ssh.Certificate{
+		Key:             key,
+		Serial:          serial,
+		CertType:        ssh.UserCert,
+		KeyId:           fmt.Sprintf("certM3 %s %s", username, identity.RequestID),
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(now.Unix()),
+		ValidBefore:     uint64(now.Add(decision.Validity).Unix()),
+		Permissions: ssh.Permissions{
+			CriticalOptions: s.config.Signer.SSHCriticalOptions,
+			Extensions:      extensions,
+		},
+	}
+	if err := cert.SignCert(rand.Reader, s.sshCA); err != nil {
+		return nil, fmt.Errorf("%w: failed to sign SSH certificate for user %s: %v", ErrCAUnavailable, username, err)
+	}
+
+	// SSH certificates share the ledger, so they can be listed, audited and
+	// revoked like X.509 ones
+	if err := s.issued.Add(IssuedRecord{
+		Serial:               strconv.FormatUint(serial, 16),
+		Type:                 RecordTypeSSH,
+		Subject:              cert.KeyId,
+		NotBefore:            now,
+		NotAfter:             time.Unix(int64(cert.ValidBefore), 0),
+		UserID:               identity.UserID,
+		Username:             username,
+		RequestID:            identity.RequestID,
+		Profile:              profile.Name,
+		Groups:               principals,
+		PublicKeyFingerprint: Fingerprint(key.Marshal()),
+		Fingerprint:          Fingerprint(cert.Marshal()),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record issued SSH certificate for user %s: %v", username, err)
+	}
+	s.logger.Infof("Issued SSH certificate %x for user %s with principals %v", serial, username, principals)
+	return cert, nil
+}
+
+// generateSSHSerial returns a random nonzero 64-bit serial number
+func generateSSHSerial() (uint64, error) {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		if serial := binary.BigEndian.Uint64(b[:]); serial != 0 {
+			return serial, nil
+		}
+	}
+}
+
+// SSHCAPublicKey returns the SSH CA public key in authorized_keys format,
+// as sshd's TrustedUserCAKeys takes it, or nil if SSH certificates are not
+// enabled
+func (s *Signer) SSHCAPublicKey() []byte {
+	if s.sshCA == nil {
+		return nil
+	}
+	return ssh.MarshalAuthorizedKey(s.sshCA.PublicKey())
+}
+
+// revokeSSH records the revocation of an SSH certificate. They are listed
+// in the KRL rather than in CRLs, which only name X.509 certificates.
+func (s *Signer) revokeSSH(serial *big.Int, record IssuedRecord, reason int) (RevocationEntry, error) {
+	if record.Status == StatusRevoked && (record.RevocationReason != ReasonCertificateHold || reason == ReasonCertificateHold) {
+		return RevocationEntry{Serial: record.Serial, RevokedAt: record.RevokedAt, Reason: record.RevocationReason}, nil
+	}
+	entry := RevocationEntry{Serial: record.Serial, RevokedAt: time.Now().UTC(), Reason: reason}
+	if err := s.issued.MarkRevoked(serial, entry.RevokedAt, reason); err != nil {
+		return RevocationEntry{}, fmt.Errorf("failed to record revocation: %v", err)
+	}
+	s.logger.Infof("Revoked SSH certificate serial %s with reason %d", entry.Serial, entry.Reason)
+	s.metrics.RecordRevocation(reason)
+	return entry, nil
+}
+
+// GenerateKRL returns an OpenSSH key revocation list naming the revoked
+// SSH certificates by serial, for sshd's RevokedKeys
+func (s *Signer) GenerateKRL() ([]byte, error) {
+	if s.sshCA == nil {
+		return nil, fmt.Errorf("no SSH CA key configured")
+	}
+
+	var serials []uint64
+	for _, record := range s.issued.Revoked(RecordTypeSSH) {
+		serial, err := strconv.ParseUint(record.Serial, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH certificate serial %s in issued index", record.Serial)
+		}
+		serials = append(serials, serial)
+	}
+	sort.Slice(serials, func(i, j int) bool { return serials[i] < serials[j] })
+
+	now := uint64(time.Now().Unix())
+	var krl bytes.Buffer
+	binary.Write(&krl, binary.BigEndian, uint64(krlMagic))
+	binary.Write(&krl, binary.BigEndian, uint32(krlFormatVersion))
+	binary.Write(&krl, binary.BigEndian, now) // krl_version
+	binary.Write(&krl, binary.BigEndian, now) // generated_date
+	binary.Write(&krl, binary.BigEndian, uint64(0))
+	writeSSHString(&krl, nil) // reserved
+	writeSSHString(&krl, []byte("certM3"))
+
+	if len(serials) > 0 {
+		var serialList bytes.Buffer
+		for _, serial := range serials {
+			binary.Write(&serialList, binary.BigEndian, serial)
+		}
+		var section bytes.Buffer
+		writeSSHString(&section, s.sshCA.PublicKey().Marshal())
+		writeSSHString(&section, nil) // reserved
+		section.WriteByte(krlSectionCertSerialList)
+		writeSSHString(&section, serialList.Bytes())
+
+		krl.WriteByte(krlSectionCertificates)
+		writeSSHString(&krl, section.Bytes())
+	}
+	return krl.Bytes(), nil
+}
+
+// writeSSHString writes b as an SSH wire format string
+func writeSSHString(buf *bytes.Buffer, b []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(b)))
+	buf.Write(b)
+}
+
+// RegisterSSHRoutes serves the SSH CA public key and the KRL at the paths
+// of the configured URLs
+func (s *Signer) RegisterSSHRoutes(mux *http.ServeMux) error {
+	if s.sshCA == nil {
+		return fmt.Errorf("no SSH CA key configured")
+	}
+	if s.config.Signer.SSHCAKeyURL != "" {
+		caURL, err := url.Parse(s.config.Signer.SSHCAKeyURL)
+		if err != nil || caURL.Path == "" {
+			return fmt.Errorf("invalid SSH CA key URL %q", s.config.Signer.SSHCAKeyURL)
+		}
+		mux.HandleFunc(caURL.Path, s.serveSSHCAKey)
+	}
+	if s.config.Signer.SSHKRLURL != "" {
+		krlURL, err := url.Parse(s.config.Signer.SSHKRLURL)
+		if err != nil || krlURL.Path == "" {
+			return fmt.Errorf("invalid SSH KRL URL %q", s.config.Signer.SSHKRLURL)
+		}
+		mux.HandleFunc(krlURL.Path, s.serveKRL)
+	}
+	return nil
+}
+
+// serveSSHCAKey writes the SSH CA public key
+func (s *Signer) serveSSHCAKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(s.SSHCAPublicKey())
+}
+
+// serveKRL writes a freshly generated KRL
+func (s *Signer) serveKRL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	krl, err := s.GenerateKRL()
+	if err != nil {
+		s.logger.Errorf("Failed to serve KRL: %v", err)
+		http.Error(w, "KRL unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "max-age=300")
+	w.Write(krl)
+}
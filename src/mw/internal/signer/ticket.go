@@ -0,0 +1,65 @@
+package signer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/security"
+)
+
+// ticketReplayCache remembers the IDs of tickets already used until they
+// expire. It lives in memory only: tickets are short-lived, so after a
+// restart only tickets issued within the last TTL could be presented again,
+// and those are still bound to their request and payload.
+type ticketReplayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// use marks the ticket ID as used, reporting false if it already was
+func (c *ticketReplayCache) use(id string, expires time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.seen == nil {
+		c.seen = make(map[string]time.Time)
+	}
+	for seenID, exp := range c.seen {
+		if now.After(exp) {
+			delete(c.seen, seenID)
+		}
+	}
+
+	if _, ok := c.seen[id]; ok {
+		return false
+	}
+	c.seen[id] = expires
+	return true
+}
+
+// verifyTicket checks that token authorizes action on payload for the
+// given request identity, and consumes it
+func (h *Handler) verifyTicket(token string, identity Identity, action string, payload []byte) error {
+	claims, err := h.tickets.VerifyTicket(token)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case claims.Action != action:
+		return fmt.Errorf("ticket is for %q, not %q", claims.Action, action)
+	case claims.RequestID != identity.RequestID:
+		return fmt.Errorf("ticket is bound to request %s, not %s", claims.RequestID, identity.RequestID)
+	case claims.UserID != identity.UserID || claims.Username != identity.Username:
+		return fmt.Errorf("ticket is bound to a different user")
+	case claims.Digest != security.PayloadDigest(payload):
+		return fmt.Errorf("ticket does not match the request payload")
+	}
+
+	if !h.replays.use(claims.ID, claims.ExpiresAt.Time) {
+		return fmt.Errorf("ticket %s has already been used", claims.ID)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package signer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ogt11/certm3/mw/internal/security"
+	"github.com/ogt11/certm3/mw/internal/signerproto"
+)
+
+func TestSignChecksTicketBindings(t *testing.T) {
+	h, tickets := newTestHandler(t)
+	tests := map[string]func(req *signerproto.SignRequest){
+		"other groups":  func(req *signerproto.SignRequest) { req.Groups = append(req.Groups, "admins") },
+		"other profile": func(req *signerproto.SignRequest) { req.Profile = "service" },
+		"other CSR":     func(req *signerproto.SignRequest) { req.CSR = string(makeCSR(t, "alice")) },
+		"other request": func(req *signerproto.SignRequest) { req.RequestID = "req-2" },
+		"other user":    func(req *signerproto.SignRequest) { req.UserID = "id-bob" },
+		"renewal": func(req *signerproto.SignRequest) {
+			req.Renews = issue(t, h.signer, "alice", nil).SerialNumber.Text(16)
+		},
+		"other action": func(req *signerproto.SignRequest) {
+			req.Token, _ = tickets.IssueTicket(req.UserID, req.Username, req.RequestID, security.TicketActionSignSSH,
+				security.IssuancePayload([]byte(req.CSR), "", req.Groups))
+		},
+		"other secret": func(req *signerproto.SignRequest) {
+			req.Token, _ = security.NewTicketManager("other-secret", time.Minute).IssueTicket(req.UserID, req.Username, req.RequestID,
+				security.TicketActionSign, security.IssuancePayload([]byte(req.CSR), "", req.Groups))
+		},
+	}
+	for name, alter := range tests {
+		req := signRequest(t, tickets, "alice", "req-1", []string{"developers"})
+		alter(req)
+		if _, perr := h.sign(req); perr == nil || perr.Code != signerproto.CodeUnauthenticated {
+			t.Errorf("%s: err = %v, want unauthenticated", name, perr)
+		}
+	}
+
+	req := signRequest(t, tickets, "alice", "req-1", []string{"developers"})
+	if _, perr := h.sign(req); perr != nil {
+		t.Fatal(perr)
+	}
+	if _, perr := h.sign(req); perr == nil || perr.Code != signerproto.CodeUnauthenticated {
+		t.Errorf("replayed ticket: err = %v, want unauthenticated", perr)
+	}
+}
@@ -0,0 +1,171 @@
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+)
+
+// Default usages for issued certificates when none are configured
+var (
+	defaultKeyUsage         = []string{"digitalSignature", "keyEncipherment"}
+	defaultExtendedKeyUsage = []string{"clientAuth"}
+)
+
+// keyUsageNames maps normalized key usage names to x509 key usages. Both the
+// RFC 5280 names and the OpenSSL display names are accepted.
+var keyUsageNames = map[string]x509.KeyUsage{
+	"digitalsignature":  x509.KeyUsageDigitalSignature,
+	"contentcommitment": x509.KeyUsageContentCommitment,
+	"nonrepudiation":    x509.KeyUsageContentCommitment,
+	"keyencipherment":   x509.KeyUsageKeyEncipherment,
+	"dataencipherment":  x509.KeyUsageDataEncipherment,
+	"keyagreement":      x509.KeyUsageKeyAgreement,
+	"keycertsign":       x509.KeyUsageCertSign,
+	"certificatesign":   x509.KeyUsageCertSign,
+	"crlsign":           x509.KeyUsageCRLSign,
+	"encipheronly":      x509.KeyUsageEncipherOnly,
+	"decipheronly":      x509.KeyUsageDecipherOnly,
+}
+
+// extKeyUsageNames maps normalized extended key usage names to x509 extended
+// key usages, again accepting RFC 5280 and OpenSSL display names
+var extKeyUsageNames = map[string]x509.ExtKeyUsage{
+	"any":                            x509.ExtKeyUsageAny,
+	"anyextendedkeyusage":            x509.ExtKeyUsageAny,
+	"serverauth":                     x509.ExtKeyUsageServerAuth,
+	"tlswebserverauthentication":     x509.ExtKeyUsageServerAuth,
+	"clientauth":                     x509.ExtKeyUsageClientAuth,
+	"tlswebclientauthentication":     x509.ExtKeyUsageClientAuth,
+	"codesigning":                    x509.ExtKeyUsageCodeSigning,
+	"emailprotection":                x509.ExtKeyUsageEmailProtection,
+	"timestamping":                   x509.ExtKeyUsageTimeStamping,
+	"ocspsigning":                    x509.ExtKeyUsageOCSPSigning,
+	"ipsecendsystem":                 x509.ExtKeyUsageIPSECEndSystem,
+	"ipsectunnel":                    x509.ExtKeyUsageIPSECTunnel,
+	"ipsecuser":                      x509.ExtKeyUsageIPSECUser,
+	"microsoftservergatedcrypto":     x509.ExtKeyUsageMicrosoftServerGatedCrypto,
+	"netscapeservergatedcrypto":      x509.ExtKeyUsageNetscapeServerGatedCrypto,
+	"microsoftcommercialcodesigning": x509.ExtKeyUsageMicrosoftCommercialCodeSigning,
+	"microsoftkernelcodesigning":     x509.ExtKeyUsageMicrosoftKernelCodeSigning,
+}
+
+// extKeyUsageOIDs maps the dotted OIDs of the extended key usages Go knows
+// about, so that configuring an OID yields the same certificate as its name
+var extKeyUsageOIDs = map[string]x509.ExtKeyUsage{
+	"2.5.29.37.0":            x509.ExtKeyUsageAny,
+	"1.3.6.1.5.5.7.3.1":      x509.ExtKeyUsageServerAuth,
+	"1.3.6.1.5.5.7.3.2":      x509.ExtKeyUsageClientAuth,
+	"1.3.6.1.5.5.7.3.3":      x509.ExtKeyUsageCodeSigning,
+	"1.3.6.1.5.5.7.3.4":      x509.ExtKeyUsageEmailProtection,
+	"1.3.6.1.5.5.7.3.5":      x509.ExtKeyUsageIPSECEndSystem,
+	"1.3.6.1.5.5.7.3.6":      x509.ExtKeyUsageIPSECTunnel,
+	"1.3.6.1.5.5.7.3.7":      x509.ExtKeyUsageIPSECUser,
+	"1.3.6.1.5.5.7.3.8":      x509.ExtKeyUsageTimeStamping,
+	"1.3.6.1.5.5.7.3.9":      x509.ExtKeyUsageOCSPSigning,
+	"1.3.6.1.4.1.311.10.3.3": x509.ExtKeyUsageMicrosoftServerGatedCrypto,
+	"2.16.840.1.113730.4.1":  x509.ExtKeyUsageNetscapeServerGatedCrypto,
+	"1.3.6.1.4.1.311.2.1.22": x509.ExtKeyUsageMicrosoftCommercialCodeSigning,
+	"1.3.6.1.4.1.311.61.1.1": x509.ExtKeyUsageMicrosoftKernelCodeSigning,
+}
+
+// normalizeUsageName lowercases name and strips spaces, dashes, underscores
+// and parentheses, so "Digital Signature", "digital_signature" and
+// "digitalSignature" are the same usage
+func normalizeUsageName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(name)))
+}
+
+// isDottedOID reports whether s looks like a dotted decimal OID
+func isDottedOID(s string) bool {
+	if !strings.Contains(s, ".") {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseKeyUsage converts key usage names to an x509.KeyUsage bit set
+func ParseKeyUsage(names []string) (x509.KeyUsage, error) {
+	var usage x509.KeyUsage
+	for _, name := range names {
+		bit, ok := keyUsageNames[normalizeUsageName(name)]
+		if !ok {
+			return 0, fmt.Errorf("unknown key usage %q", name)
+		}
+		usage |= bit
+	}
+	return usage, nil
+}
+
+// ParseExtKeyUsage converts extended key usage names or dotted OIDs to the
+// x509 representation. OIDs that Go has no constant for are returned as
+// unknown usages, which x509.CreateCertificate encodes verbatim.
+func ParseExtKeyUsage(names []string) ([]x509.ExtKeyUsage, []asn1.ObjectIdentifier, error) {
+	var known []x509.ExtKeyUsage
+	var unknown []asn1.ObjectIdentifier
+	for _, name := range names {
+		trimmed := strings.TrimSpace(name)
+		if isDottedOID(trimmed) {
+			if usage, ok := extKeyUsageOIDs[trimmed]; ok {
+				known = append(known, usage)
+				continue
+			}
+			oid, err := parseOID(trimmed)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid extended key usage OID %q: %v", name, err)
+			}
+			unknown = append(unknown, oid)
+			continue
+		}
+
+		usage, ok := extKeyUsageNames[normalizeUsageName(trimmed)]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown extended key usage %q", name)
+		}
+		known = append(known, usage)
+	}
+	return known, unknown, nil
+}
+
+// certUsage is the parsed key usage configuration for issued certificates
+type certUsage struct {
+	keyUsage        x509.KeyUsage
+	extKeyUsage     []x509.ExtKeyUsage
+	unknownExtUsage []asn1.ObjectIdentifier
+}
+
+// parseCertUsage parses configured key usages and extended key usages,
+// falling back to the defaults for lists that are empty
+func parseCertUsage(keyUsage, extKeyUsage []string) (certUsage, error) {
+	if len(keyUsage) == 0 {
+		keyUsage = defaultKeyUsage
+	}
+	if len(extKeyUsage) == 0 {
+		extKeyUsage = defaultExtendedKeyUsage
+	}
+
+	var usage certUsage
+	var err error
+	if usage.keyUsage, err = ParseKeyUsage(keyUsage); err != nil {
+		return certUsage{}, err
+	}
+	if usage.keyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+		return certUsage{}, fmt.Errorf("keyCertSign and cRLSign are not allowed for end-entity certificates")
+	}
+	if usage.extKeyUsage, usage.unknownExtUsage, err = ParseExtKeyUsage(extKeyUsage); err != nil {
+		return certUsage{}, err
+	}
+	return usage, nil
+}
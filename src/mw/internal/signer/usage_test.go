@@ -0,0 +1,98 @@
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"reflect"
+	"testing"
+
+	"github.com/ogt11/certm3/mw/internal/config"
+)
+
+func TestParseKeyUsage(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  x509.KeyUsage
+	}{
+		{[]string{"digitalSignature"}, x509.KeyUsageDigitalSignature},
+		{[]string{"Digital Signature", "key_encipherment"}, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment},
+		{[]string{"Non Repudiation"}, x509.KeyUsageContentCommitment},
+		{[]string{" keyAgreement ", "Decipher Only"}, x509.KeyUsageKeyAgreement | x509.KeyUsageDecipherOnly},
+	}
+	for _, tt := range tests {
+		got, err := ParseKeyUsage(tt.names)
+		if err != nil {
+			t.Errorf("ParseKeyUsage(%q): %v", tt.names, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseKeyUsage(%q) = %b, want %b", tt.names, got, tt.want)
+		}
+	}
+
+	if _, err := ParseKeyUsage([]string{"digitalSignature", "bogus"}); err == nil {
+		t.Error("accepted an unknown key usage")
+	}
+}
+
+func TestParseExtKeyUsage(t *testing.T) {
+	known, unknown, err := ParseExtKeyUsage([]string{
+		"clientAuth",
+		"TLS Web Server Authentication",
+		"1.3.6.1.5.5.7.3.4",
+		"1.2.3.4",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKnown := []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageEmailProtection}
+	if !reflect.DeepEqual(known, wantKnown) {
+		t.Errorf("known usages = %v, want %v", known, wantKnown)
+	}
+	if len(unknown) != 1 || !unknown[0].Equal(asn1.ObjectIdentifier{1, 2, 3, 4}) {
+		t.Errorf("unknown usages = %v, want [1.2.3.4]", unknown)
+	}
+
+	for _, name := range []string{"bogus", "1.2.x"} {
+		if _, _, err := ParseExtKeyUsage([]string{name}); err == nil {
+			t.Errorf("accepted extended key usage %q", name)
+		}
+	}
+}
+
+func TestParseCertUsage(t *testing.T) {
+	usage, err := parseCertUsage(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.keyUsage != x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment {
+		t.Errorf("default key usage = %b", usage.keyUsage)
+	}
+	if !reflect.DeepEqual(usage.extKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}) {
+		t.Errorf("default extended key usage = %v, want clientAuth", usage.extKeyUsage)
+	}
+
+	for _, name := range []string{"keyCertSign", "Certificate Sign", "cRLSign"} {
+		if _, err := parseCertUsage([]string{"digitalSignature", name}, nil); err == nil {
+			t.Errorf("accepted %s for end-entity certificates", name)
+		}
+	}
+}
+
+func TestIssuedCertificateUsage(t *testing.T) {
+	s, _ := newConfiguredSigner(t, func(cfg *config.Config) {
+		cfg.Signer.KeyUsage = []string{"Digital Signature"}
+		cfg.Signer.ExtendedKeyUsage = []string{"serverAuth", "1.2.3.4"}
+	})
+	cert := issue(t, s, "alice", nil)
+
+	if cert.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Errorf("key usage = %b, want digitalSignature only", cert.KeyUsage)
+	}
+	if !reflect.DeepEqual(cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}) {
+		t.Errorf("extended key usage = %v, want serverAuth", cert.ExtKeyUsage)
+	}
+	if len(cert.UnknownExtKeyUsage) != 1 || !cert.UnknownExtKeyUsage[0].Equal(asn1.ObjectIdentifier{1, 2, 3, 4}) {
+		t.Errorf("unknown extended key usage = %v, want [1.2.3.4]", cert.UnknownExtKeyUsage)
+	}
+}
@@ -0,0 +1,374 @@
+package signerproto
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// errLegacyPeer is returned while connecting to a signer that only speaks v0
+var errLegacyPeer = errors.New("signer only supports protocol version 0")
+
+// legacyReprobeInterval is how long a client sticks to v0 before checking
+// whether the signer has been upgraded
+const legacyReprobeInterval = time.Minute
+
+// Client is a signer client. It keeps one persistent connection open and
+// multiplexes concurrent requests over it, reconnecting as needed. Against
+// a signer that predates version 1 it falls back to one v0 connection per
+// request, probing for version 1 again every legacyReprobeInterval.
+type Client struct {
+	network string
+	addr    string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn *clientConn
+	// legacyUntil is when to stop assuming the signer only speaks v0
+	legacyUntil time.Time
+}
+
+// NewClient returns a client for the signer listening at addr. timeout
+// bounds connecting and writing; waiting for a response is bounded by the
+// context passed to each call.
+func NewClient(network, addr string, timeout time.Duration) *Client {
+	return &Client{
+		network: network,
+		addr:    addr,
+		timeout: timeout,
+	}
+}
+
+// Sign asks the signer to sign a CSR
+func (c *Client) Sign(ctx context.Context, req *SignRequest) (*SignResult, error) {
+	var result SignResult
+	if err := c.Call(ctx, MethodSign, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Revoke asks the signer to revoke a certificate
+func (c *Client) Revoke(ctx context.Context, req *RevokeRequest) (*RevokeResult, error) {
+	var result RevokeResult
+	if err := c.Call(ctx, MethodRevoke, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SignSSH asks the signer for an OpenSSH user certificate
+func (c *Client) SignSSH(ctx context.Context, req *SignSSHRequest) (*SignSSHResult, error) {
+	var result SignSSHResult
+	if err := c.Call(ctx, MethodSignSSH, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SignAttributeCert asks the signer for a fresh attribute certificate
+func (c *Client) SignAttributeCert(ctx context.Context, req *SignAttributeCertRequest) (*SignAttributeCertResult, error) {
+	var result SignAttributeCertResult
+	if err := c.Call(ctx, MethodSignAttributeCert, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Status asks the signer for the status of a certificate
+func (c *Client) Status(ctx context.Context, req *StatusRequest) (*StatusResult, error) {
+	var result StatusResult
+	if err := c.Call(ctx, MethodStatus, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Call sends a request and decodes the result into resp. Errors reported by
+// the signer are returned as *Error; anything else is a transport failure.
+func (c *Client) Call(ctx context.Context, method string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %v", err)
+	}
+
+	// A connection the signer closed, by restarting for instance, is
+	// replaced and the request sent again, as long as it never reached
+	// the signer
+	var frame *Frame
+	for attempt := 0; ; attempt++ {
+		cc, err := c.connection(ctx)
+		if errors.Is(err, errLegacyPeer) {
+			return c.callV0(ctx, method, body, resp)
+		}
+		if err != nil {
+			return err
+		}
+
+		frame, err = cc.roundTrip(ctx, method, body, c.timeout)
+		if err == nil {
+			break
+		}
+		// A caller giving up does not mean the connection is broken
+		if ctx.Err() != nil {
+			return err
+		}
+		c.drop(cc)
+		var unsent *unsentError
+		if attempt > 0 || !errors.As(err, &unsent) {
+			return err
+		}
+	}
+	if frame.Error != nil {
+		return frame.Error
+	}
+	if resp != nil {
+		if err := json.Unmarshal(frame.Body, resp); err != nil {
+			return fmt.Errorf("failed to decode %s response: %v", method, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the persistent connection, if any
+func (c *Client) Close() error {
+	c.mu.Lock()
+	cc := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+	if cc == nil {
+		return nil
+	}
+	return cc.conn.Close()
+}
+
+// connection returns the persistent connection, dialing and negotiating
+// the protocol version if there is none
+func (c *Client) connection(ctx context.Context) (*clientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.legacyUntil) {
+		return nil, errLegacyPeer
+	}
+	if c.conn != nil {
+		if c.conn.failure() == nil {
+			return c.conn, nil
+		}
+		c.conn.conn.Close()
+		c.conn = nil
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// A v1 signer echoes the preamble; a v0 signer fails to parse it as a
+	// request and answers with a JSON error object
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := io.WriteString(conn, Preamble); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send protocol preamble: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	reply, err := reader.Peek(1)
+	if err == nil && reply[0] == '{' {
+		conn.Close()
+		c.legacyUntil = time.Now().Add(legacyReprobeInterval)
+		return nil, errLegacyPeer
+	}
+	echo := make([]byte, len(Preamble))
+	if err == nil {
+		_, err = io.ReadFull(reader, echo)
+	}
+	if err != nil || string(echo) != Preamble {
+		conn.Close()
+		return nil, fmt.Errorf("signer protocol negotiation failed: %v", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.conn = &clientConn{
+		conn:    conn,
+		reader:  reader,
+		pending: make(map[uint64]chan *Frame),
+	}
+	go c.conn.readLoop()
+	return c.conn, nil
+}
+
+// dial opens a new connection to the signer
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, c.network, c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to signer: %v", err)
+	}
+	return conn, nil
+}
+
+// drop forgets cc after a transport failure so the next call reconnects
+func (c *Client) drop(cc *clientConn) {
+	c.mu.Lock()
+	if c.conn == cc {
+		c.conn = nil
+	}
+	c.mu.Unlock()
+	cc.conn.Close()
+}
+
+// v0Response is the response format of protocol version 0
+type v0Response struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Code    Code            `json:"code,omitempty"`
+}
+
+// callV0 performs a request over a fresh connection using protocol
+// version 0, where the method is selected by the request's "action" field
+func (c *Client) callV0(ctx context.Context, method string, body []byte, resp interface{}) error {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return fmt.Errorf("failed to encode request: %v", err)
+	}
+	if method != MethodSign {
+		fields["action"] = method
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(conn).Encode(fields); err != nil {
+		return fmt.Errorf("failed to send request to signer: %v", err)
+	}
+	var v0 v0Response
+	if err := json.NewDecoder(conn).Decode(&v0); err != nil {
+		return fmt.Errorf("failed to read response from signer: %v", err)
+	}
+	if !v0.Success {
+		code := v0.Code
+		if code == "" {
+			code = CodeInternal
+		}
+		return &Error{Code: code, Message: v0.Error}
+	}
+	if resp != nil && len(v0.Data) > 0 {
+		if err := json.Unmarshal(v0.Data, resp); err != nil {
+			return fmt.Errorf("failed to decode %s response: %v", method, err)
+		}
+	}
+	return nil
+}
+
+// unsentError is a transport failure that kept a request from being sent,
+// so it is safe to send again
+type unsentError struct {
+	err error
+}
+
+func (e *unsentError) Error() string { return e.err.Error() }
+func (e *unsentError) Unwrap() error { return e.err }
+
+// clientConn is a multiplexed version 1 connection
+type clientConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *Frame
+	err     error
+}
+
+// roundTrip sends a request frame and waits for its response
+func (cc *clientConn) roundTrip(ctx context.Context, method string, body []byte, timeout time.Duration) (*Frame, error) {
+	ch := make(chan *Frame, 1)
+	cc.mu.Lock()
+	if cc.err != nil {
+		err := cc.err
+		cc.mu.Unlock()
+		return nil, &unsentError{fmt.Errorf("signer connection lost: %v", err)}
+	}
+	cc.nextID++
+	id := cc.nextID
+	cc.pending[id] = ch
+	cc.mu.Unlock()
+
+	cc.writeMu.Lock()
+	cc.conn.SetWriteDeadline(time.Now().Add(timeout))
+	err := WriteFrame(cc.conn, &Frame{ID: id, Method: method, Body: body})
+	cc.writeMu.Unlock()
+	if err != nil {
+		cc.forget(id)
+		return nil, &unsentError{fmt.Errorf("failed to send request to signer: %v", err)}
+	}
+
+	select {
+	case frame, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("signer connection lost: %v", cc.failure())
+		}
+		return frame, nil
+	case <-ctx.Done():
+		cc.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+// readLoop delivers response frames to their waiting callers until the
+// connection fails
+func (cc *clientConn) readLoop() {
+	for {
+		var frame Frame
+		if err := ReadFrame(cc.reader, &frame); err != nil {
+			cc.fail(err)
+			return
+		}
+
+		cc.mu.Lock()
+		ch, ok := cc.pending[frame.ID]
+		delete(cc.pending, frame.ID)
+		cc.mu.Unlock()
+		if ok {
+			ch <- &frame
+		}
+	}
+}
+
+// fail records the connection error and wakes every waiting caller
+func (cc *clientConn) fail(err error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.err = err
+	for id, ch := range cc.pending {
+		close(ch)
+		delete(cc.pending, id)
+	}
+}
+
+// failure returns the error the connection failed with
+func (cc *clientConn) failure() error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.err
+}
+
+// forget stops waiting for the response to id
+func (cc *clientConn) forget(id uint64) {
+	cc.mu.Lock()
+	delete(cc.pending, id)
+	cc.mu.Unlock()
+}
@@ -0,0 +1,190 @@
+package signerproto
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSigner answers sign requests, reporting the protocol version they
+// came in as the certificate. It speaks v1 only once upgraded, and v0
+// always.
+type fakeSigner struct {
+	listener net.Listener
+	v1       atomic.Bool
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+func newFakeSigner(t *testing.T) *fakeSigner {
+	t.Helper()
+	s := &fakeSigner{conns: make(map[net.Conn]bool)}
+	s.listen(t, filepath.Join(t.TempDir(), "signer.sock"))
+	t.Cleanup(func() { s.stop() })
+	return s
+}
+
+// listen starts serving on the Unix socket at path
+func (s *fakeSigner) listen(t *testing.T, path string) {
+	t.Helper()
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.listener = listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[conn] = true
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+}
+
+// stop closes the listener and every connection, as a signer exiting does
+func (s *fakeSigner) stop() {
+	s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+// restart stops the signer and starts it again on the same socket
+func (s *fakeSigner) restart(t *testing.T) {
+	t.Helper()
+	path := s.listener.Addr().String()
+	s.stop()
+	s.listen(t, path)
+}
+
+func (s *fakeSigner) serve(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	first, err := reader.Peek(1)
+	if err != nil {
+		return
+	}
+	if first[0] == '{' || !s.v1.Load() {
+		var req map[string]interface{}
+		if err := json.NewDecoder(reader).Decode(&req); err != nil {
+			json.NewEncoder(conn).Encode(v0Response{Error: "Invalid request format"})
+			return
+		}
+		json.NewEncoder(conn).Encode(v0Response{Success: true, Data: json.RawMessage(`{"certificate":"v0"}`)})
+		return
+	}
+
+	preamble := make([]byte, len(Preamble))
+	if _, err := io.ReadFull(reader, preamble); err != nil || string(preamble) != Preamble {
+		return
+	}
+	io.WriteString(conn, Preamble)
+	for {
+		var req Frame
+		if err := ReadFrame(reader, &req); err != nil {
+			return
+		}
+		WriteFrame(conn, &Frame{ID: req.ID, Body: json.RawMessage(`{"certificate":"v1"}`)})
+	}
+}
+
+func (s *fakeSigner) sign(t *testing.T, client *Client) string {
+	t.Helper()
+	res, err := client.Sign(context.Background(), &SignRequest{RequestID: "req-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.Certificate
+}
+
+func TestClientFallsBackToV0(t *testing.T) {
+	s := newFakeSigner(t)
+	client := NewClient("unix", s.listener.Addr().String(), time.Second)
+	defer client.Close()
+
+	if got := s.sign(t, client); got != "v0" {
+		t.Fatalf("signed with %s, want v0", got)
+	}
+
+	// Until the re-probe interval has passed the client sticks to v0
+	s.v1.Store(true)
+	if got := s.sign(t, client); got != "v0" {
+		t.Errorf("signed with %s before the re-probe, want v0", got)
+	}
+
+	client.mu.Lock()
+	client.legacyUntil = time.Now()
+	client.mu.Unlock()
+	if got := s.sign(t, client); got != "v1" {
+		t.Errorf("signed with %s after the signer was upgraded, want v1", got)
+	}
+}
+
+func TestClientMultiplexes(t *testing.T) {
+	s := newFakeSigner(t)
+	s.v1.Store(true)
+	client := NewClient("unix", s.listener.Addr().String(), time.Second)
+	defer client.Close()
+
+	done := make(chan string)
+	for i := 0; i < 10; i++ {
+		go func() {
+			res, err := client.Sign(context.Background(), &SignRequest{RequestID: "req-1"})
+			if err != nil {
+				done <- err.Error()
+				return
+			}
+			done <- res.Certificate
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if got := <-done; got != "v1" {
+			t.Errorf("concurrent sign: %s", got)
+		}
+	}
+}
+
+func TestClientReconnectsAfterSignerRestart(t *testing.T) {
+	s := newFakeSigner(t)
+	s.v1.Store(true)
+	client := NewClient("unix", s.listener.Addr().String(), time.Second)
+	defer client.Close()
+
+	if got := s.sign(t, client); got != "v1" {
+		t.Fatalf("signed with %s, want v1", got)
+	}
+	s.restart(t)
+	if got := s.sign(t, client); got != "v1" {
+		t.Errorf("signed with %s after the restart, want v1", got)
+	}
+
+	// Still without waiting for the client to notice the old connection
+	// closing
+	for i := 0; i < 20; i++ {
+		s.restart(t)
+		if _, err := client.Sign(context.Background(), &SignRequest{RequestID: "req-1"}); err != nil {
+			t.Fatalf("sign right after restart %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package signerproto
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ogt11/certm3/mw/pkg/signerpb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// ErrorDomain identifies signer error codes carried in gRPC ErrorInfo
+// details
+const ErrorDomain = "signer.certm3"
+
+// GRPCCode returns the gRPC status code for an error code
+func (c Code) GRPCCode() codes.Code {
+	switch c {
+	case CodeBadRequest, CodeBadCSR:
+		return codes.InvalidArgument
+	case CodeUnauthenticated:
+		return codes.Unauthenticated
+	case CodePermissionDenied, CodePolicyDenied:
+		return codes.PermissionDenied
+	case CodeNotFound:
+		return codes.NotFound
+	case CodeGroupLookupFailed:
+		return codes.FailedPrecondition
+	case CodeCAUnavailable:
+		return codes.Unavailable
+	case CodeUnsupportedMethod:
+		return codes.Unimplemented
+	default:
+		return codes.Internal
+	}
+}
+
+// GRPCStatus converts the error to a gRPC status, keeping the signer error
+// code in an ErrorInfo detail so clients get the exact code back. gRPC
+// servers call it when a handler returns an *Error.
+// Deny reasons travel as the violations of a PreconditionFailure detail.
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(e.Code.GRPCCode(), e.Message)
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{
+		Reason: string(e.Code),
+		Domain: ErrorDomain,
+	}}
+	if len(e.Reasons) > 0 {
+		failure := &errdetails.PreconditionFailure{}
+		for _, reason := range e.Reasons {
+			failure.Violations = append(failure.Violations, &errdetails.PreconditionFailure_Violation{
+				Type:        reason.Rule,
+				Subject:     reason.Subject,
+				Description: reason.Message,
+			})
+		}
+		details = append(details, failure)
+	}
+	if detailed, err := st.WithDetails(details...); err == nil {
+		return detailed
+	}
+	return st
+}
+
+// FromGRPCError converts an error returned by a gRPC call back into an
+// *Error. Errors that are not gRPC statuses are returned unchanged.
+func FromGRPCError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	var signerErr *Error
+	var reasons []DenyReason
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if detail.Domain == ErrorDomain {
+				signerErr = &Error{Code: Code(detail.Reason), Message: st.Message()}
+			}
+		case *errdetails.PreconditionFailure:
+			for _, v := range detail.Violations {
+				reasons = append(reasons, DenyReason{Rule: v.Type, Subject: v.Subject, Message: v.Description})
+			}
+		}
+	}
+	if signerErr != nil {
+		signerErr.Reasons = reasons
+		return signerErr
+	}
+
+	// Not from the signer itself; treat transport problems as such
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return fmt.Errorf("signer unavailable: %s", st.Message())
+	case codes.Unauthenticated:
+		return &Error{Code: CodeUnauthenticated, Message: st.Message()}
+	case codes.PermissionDenied:
+		return &Error{Code: CodePermissionDenied, Message: st.Message()}
+	case codes.Unimplemented:
+		return &Error{Code: CodeUnsupportedMethod, Message: st.Message()}
+	default:
+		return &Error{Code: CodeInternal, Message: st.Message()}
+	}
+}
+
+// GRPCClient is a signer client using the gRPC service. It offers the same
+// calls as Client, so the app server can use either.
+type GRPCClient struct {
+	conn   *grpc.ClientConn
+	client signerpb.SignerServiceClient
+}
+
+// DialGRPC returns a gRPC signer client for target, which is either
+// "unix:///path/to/socket" or "host:port". creds secures TCP connections;
+// nil means no transport security, which is only appropriate for Unix
+// sockets.
+func DialGRPC(target string, creds credentials.TransportCredentials) (*GRPCClient, error) {
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up gRPC connection to %s: %v", target, err)
+	}
+	return &GRPCClient{
+		conn:   conn,
+		client: signerpb.NewSignerServiceClient(conn),
+	}, nil
+}
+
+// Sign asks the signer to sign a CSR
+func (c *GRPCClient) Sign(ctx context.Context, req *SignRequest) (*SignResult, error) {
+	resp, err := c.client.Sign(ctx, &signerpb.SignRequest{
+		RequestId:     req.RequestID,
+		Csr:           req.CSR,
+		Groups:        req.Groups,
+		Token:         req.Token,
+		Profile:       req.Profile,
+		UserId:        req.UserID,
+		Username:      req.Username,
+		Renews:        req.Renews,
+		RevokeRenewed: req.RevokeRenewed,
+	})
+	if err != nil {
+		return nil, FromGRPCError(err)
+	}
+	var revokeAt *time.Time
+	if resp.RenewedRevokeAt != nil {
+		t := resp.GetRenewedRevokeAt().AsTime()
+		revokeAt = &t
+	}
+	return &SignResult{
+		Certificate:          resp.GetCertificate(),
+		CACertificate:        resp.GetCaCertificate(),
+		Serial:               resp.GetSerial(),
+		Chain:                resp.GetChain(),
+		RenewedRevokeAt:      revokeAt,
+		AttributeCertificate: resp.GetAttributeCertificate(),
+	}, nil
+}
+
+// SignAttributeCert asks the signer for a fresh attribute certificate
+func (c *GRPCClient) SignAttributeCert(ctx context.Context, req *SignAttributeCertRequest) (*SignAttributeCertResult, error) {
+	resp, err := c.client.SignAttributeCertificate(ctx, &signerpb.SignAttributeCertificateRequest{
+		RequestId: req.RequestID,
+		Serial:    req.Serial,
+		Groups:    req.Groups,
+		Token:     req.Token,
+		UserId:    req.UserID,
+		Username:  req.Username,
+	})
+	if err != nil {
+		return nil, FromGRPCError(err)
+	}
+	return &SignAttributeCertResult{
+		AttributeCertificate: resp.GetAttributeCertificate(),
+	}, nil
+}
+
+// Status asks the signer for the status of a certificate, and the ledger
+// for its profile. Over TCP the signer only answers admin clients.
+func (c *GRPCClient) Status(ctx context.Context, req *StatusRequest) (*StatusResult, error) {
+	resp, err := c.client.GetStatus(ctx, &signerpb.GetStatusRequest{Serial: req.Serial})
+	if err != nil {
+		return nil, FromGRPCError(err)
+	}
+	result := &StatusResult{Serial: req.Serial, Status: StatusUnknown}
+	switch resp.GetStatus() {
+	case signerpb.GetStatusResponse_STATUS_GOOD:
+		result.Status = StatusGood
+		if notAfter := resp.GetNotAfter(); notAfter != nil && time.Now().After(notAfter.AsTime()) {
+			result.Status = StatusExpired
+		}
+	case signerpb.GetStatusResponse_STATUS_REVOKED:
+		result.Status = StatusRevoked
+	}
+	if result.Status == StatusUnknown {
+		return result, nil
+	}
+	records, err := c.client.ListCertificates(ctx, &signerpb.ListCertificatesRequest{
+		Query: &signerpb.ListCertificatesRequest_Serial{Serial: req.Serial},
+	})
+	if err != nil {
+		return nil, FromGRPCError(err)
+	}
+	for _, record := range records.GetCertificates() {
+		result.Profile = record.GetProfile()
+	}
+	return result, nil
+}
+
+// SignSSH asks the signer for an OpenSSH user certificate
+func (c *GRPCClient) SignSSH(ctx context.Context, req *SignSSHRequest) (*SignSSHResult, error) {
+	resp, err := c.client.SignSSH(ctx, &signerpb.SignSSHRequest{
+		RequestId: req.RequestID,
+		PublicKey: req.PublicKey,
+		Groups:    req.Groups,
+		Token:     req.Token,
+		Profile:   req.Profile,
+		UserId:    req.UserID,
+		Username:  req.Username,
+	})
+	if err != nil {
+		return nil, FromGRPCError(err)
+	}
+	return &SignSSHResult{
+		Certificate: resp.GetCertificate(),
+		CAPublicKey: resp.GetCaPublicKey(),
+		Serial:      resp.GetSerial(),
+		Principals:  resp.GetPrincipals(),
+		ValidBefore: resp.GetValidBefore().AsTime(),
+	}, nil
+}
+
+// Revoke asks the signer to revoke a certificate
+func (c *GRPCClient) Revoke(ctx context.Context, req *RevokeRequest) (*RevokeResult, error) {
+	resp, err := c.client.Revoke(ctx, &signerpb.RevokeRequest{
+		RequestId:   req.RequestID,
+		Serial:      req.Serial,
+		Reason:      req.Reason,
+		Token:       req.Token,
+		UserId:      req.UserID,
+		Username:    req.Username,
+		Admin:       req.Admin,
+		Fingerprint: req.Fingerprint,
+	})
+	if err != nil {
+		return nil, FromGRPCError(err)
+	}
+	return &RevokeResult{Serial: resp.GetSerial(), Reason: resp.GetReason()}, nil
+}
+
+// Close closes the underlying connection
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
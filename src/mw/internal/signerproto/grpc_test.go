@@ -0,0 +1,44 @@
+package signerproto
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCErrorRoundTrip(t *testing.T) {
+	for _, code := range []Code{CodeBadCSR, CodeUnauthenticated, CodePolicyDenied, CodeNotFound, CodeGroupLookupFailed, CodeCAUnavailable} {
+		err := FromGRPCError(Errorf(code, "failed").GRPCStatus().Err())
+		var signerErr *Error
+		if !errors.As(err, &signerErr) || signerErr.Code != code || signerErr.Message != "failed" {
+			t.Errorf("%s came back as %v", code, err)
+		}
+	}
+}
+
+func TestFromGRPCErrorWithoutDetails(t *testing.T) {
+	tests := map[codes.Code]Code{
+		codes.PermissionDenied: CodePermissionDenied,
+		codes.Unauthenticated:  CodeUnauthenticated,
+		codes.Unimplemented:    CodeUnsupportedMethod,
+		codes.Internal:         CodeInternal,
+	}
+	for grpcCode, want := range tests {
+		var signerErr *Error
+		if err := FromGRPCError(status.Error(grpcCode, "failed")); !errors.As(err, &signerErr) || signerErr.Code != want {
+			t.Errorf("%s: err = %v, want %s", grpcCode, err, want)
+		}
+	}
+
+	// Transport failures are not signer errors
+	var signerErr *Error
+	if err := FromGRPCError(status.Error(codes.Unavailable, "connection refused")); errors.As(err, &signerErr) {
+		t.Errorf("unavailable signer reported as %v", err)
+	}
+	plain := errors.New("plain")
+	if err := FromGRPCError(plain); err != plain {
+		t.Errorf("non-gRPC error changed to %v", err)
+	}
+}
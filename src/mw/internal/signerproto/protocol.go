@@ -0,0 +1,276 @@
+// Package signerproto implements the wire protocol between the app server
+// and the signer.
+//
+// Version 1 connections start with the client sending Preamble, which the
+// server echoes back. After that both sides exchange length-prefixed
+// frames: a 4-byte big-endian payload length followed by a JSON encoded
+// Frame. Frames carry an ID chosen by the client, so a single persistent
+// connection can have many requests in flight; responses may arrive in any
+// order.
+//
+// Version 0 is the original protocol: one bare JSON request object and one
+// JSON response object per connection. A v0 request starts with '{', which
+// is how the signer tells the two apart. The client falls back to v0 when a
+// signer answers the preamble with a JSON object.
+package signerproto
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Version is the protocol version implemented by this package
+const Version = 1
+
+// Preamble opens a version 1 connection
+const Preamble = "CERTM3/1\n"
+
+// MaxFrameSize bounds the payload of a single frame
+const MaxFrameSize = 1 << 20
+
+// Methods
+const (
+	MethodSign    = "sign"
+	MethodRevoke  = "revoke"
+	MethodSignSSH = "sign-ssh"
+
+	MethodSignAttributeCert = "sign-attribute-cert"
+	MethodStatus            = "status"
+)
+
+// Certificate statuses reported by status requests
+const (
+	StatusGood    = "good"
+	StatusRevoked = "revoked"
+	StatusExpired = "expired"
+	StatusUnknown = "unknown"
+)
+
+// Code is a machine-readable error code
+type Code string
+
+// Error codes
+const (
+	CodeBadRequest        Code = "bad_request"
+	CodeBadCSR            Code = "bad_csr"
+	CodeUnauthenticated   Code = "unauthenticated"
+	CodePermissionDenied  Code = "permission_denied"
+	CodePolicyDenied      Code = "policy_denied"
+	CodeNotFound          Code = "not_found"
+	CodeGroupLookupFailed Code = "group_lookup_failed"
+	CodeCAUnavailable     Code = "ca_unavailable"
+	CodeUnsupportedMethod Code = "unsupported_method"
+	CodeInternal          Code = "internal"
+)
+
+// HTTPStatus returns the HTTP status the app server answers with when the
+// signer fails a request with this code
+func (c Code) HTTPStatus() int {
+	switch c {
+	case CodeBadRequest, CodeBadCSR:
+		return http.StatusBadRequest
+	case CodePolicyDenied:
+		return http.StatusForbidden
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeGroupLookupFailed:
+		return http.StatusBadGateway
+	case CodeCAUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		// Authentication failures between app server and signer, and
+		// anything unexpected, are our problem rather than the user's
+		return http.StatusInternalServerError
+	}
+}
+
+// Error is an error reported by the signer. Policy denials list the rules
+// the request broke in Reasons.
+type Error struct {
+	Code    Code         `json:"code"`
+	Message string       `json:"message"`
+	Reasons []DenyReason `json:"reasons,omitempty"`
+}
+
+// DenyReason is one rule of the issuance policy a request broke
+type DenyReason struct {
+	Rule    string `json:"rule"`
+	Subject string `json:"subject,omitempty"` // the group or SAN concerned
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("signer error %s: %s", e.Code, e.Message)
+}
+
+// Errorf returns an Error with the given code and formatted message
+func Errorf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Frame is the unit of exchange on a version 1 connection. Requests set
+// Method and Body; responses echo the request ID and set either Body or
+// Error.
+type Frame struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// SignRequest asks the signer to sign a CSR
+type SignRequest struct {
+	RequestID string   `json:"requestId"`
+	CSR       string   `json:"csr"` // PEM-encoded
+	Groups    []string `json:"groups"`
+	Token     string   `json:"token"` // signing ticket
+	Profile   string   `json:"profile,omitempty"`
+	UserID    string   `json:"userId"`
+	Username  string   `json:"username"`
+
+	// Renews names, by hex serial, a certificate of the user's that the
+	// new one replaces; the ticket must then carry
+	// security.TicketActionRenew. RevokeRenewed asks for the replaced
+	// certificate to be revoked once the renewal overlap has passed.
+	Renews        string `json:"renews,omitempty"`
+	RevokeRenewed bool   `json:"revokeRenewed,omitempty"`
+}
+
+// SignResult is the result of a sign request
+type SignResult struct {
+	Certificate   string `json:"certificate"`   // PEM-encoded
+	CACertificate string `json:"caCertificate"` // PEM-encoded
+	Serial        string `json:"serial,omitempty"`
+
+	// PEM-encoded issuers above CACertificate, nearest first
+	Chain []string `json:"chain,omitempty"`
+
+	// When the certificate named by Renews will be revoked, if requested
+	RenewedRevokeAt *time.Time `json:"renewedRevokeAt,omitempty"`
+
+	// PEM-encoded RFC 5755 attribute certificate carrying the groups, for
+	// profiles with the attribute_certificate group encoding
+	AttributeCertificate string `json:"attributeCertificate,omitempty"`
+}
+
+// SignSSHRequest asks the signer for an OpenSSH user certificate
+type SignSSHRequest struct {
+	RequestID string   `json:"requestId"`
+	PublicKey string   `json:"publicKey"` // authorized_keys format
+	Groups    []string `json:"groups"`
+	Token     string   `json:"token"` // signing ticket for the public key
+	Profile   string   `json:"profile,omitempty"`
+	UserID    string   `json:"userId"`
+	Username  string   `json:"username"`
+}
+
+// SignSSHResult is the result of an SSH sign request
+type SignSSHResult struct {
+	Certificate string    `json:"certificate"` // authorized_keys format
+	CAPublicKey string    `json:"caPublicKey"` // authorized_keys format
+	Serial      string    `json:"serial"`      // hexadecimal
+	Principals  []string  `json:"principals"`
+	ValidBefore time.Time `json:"validBefore"`
+}
+
+// SignAttributeCertRequest asks the signer for a fresh attribute
+// certificate for one of the user's certificates
+type SignAttributeCertRequest struct {
+	RequestID string   `json:"requestId"`
+	Serial    string   `json:"serial"` // hexadecimal, of the holder
+	Groups    []string `json:"groups,omitempty"`
+	Token     string   `json:"token"` // signing ticket for the serial
+	UserID    string   `json:"userId"`
+	Username  string   `json:"username"`
+}
+
+// SignAttributeCertResult is the result of an attribute certificate
+// request
+type SignAttributeCertResult struct {
+	AttributeCertificate string `json:"attributeCertificate"` // PEM-encoded
+}
+
+// RevokeRequest asks the signer to revoke a certificate
+type RevokeRequest struct {
+	RequestID string `json:"requestId"`
+	Serial    string `json:"serial"` // hexadecimal
+	Reason    string `json:"reason,omitempty"`
+	Token     string `json:"token"` // signing ticket
+	UserID    string `json:"userId"`
+	Username  string `json:"username"`
+
+	// Admin marks a revocation by an administrator, which may name a
+	// certificate issued to someone else; the ticket must then carry
+	// security.TicketActionAdminRevoke
+	Admin bool `json:"admin,omitempty"`
+
+	// Fingerprint, the hex SHA-256 fingerprint of the whole certificate,
+	// must match the issuance ledger when set, so a certificate forged
+	// with a real serial revokes nothing
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// RevokeResult is the result of a revoke request
+type RevokeResult struct {
+	Serial string `json:"serial"`
+	Reason string `json:"reason,omitempty"` // RFC 5280 reason name
+}
+
+// StatusRequest asks for the status of a certificate issued by the signer
+type StatusRequest struct {
+	Serial string `json:"serial"` // hexadecimal
+}
+
+// StatusResult is the result of a status request
+type StatusResult struct {
+	Serial string `json:"serial"`
+	Status string `json:"status"` // StatusGood, StatusRevoked, ...
+
+	// The profile the certificate was issued with, for certificates the
+	// signer has records of
+	Profile string `json:"profile,omitempty"`
+}
+
+// WriteFrame writes f to w as a single length-prefixed frame
+func WriteFrame(w io.Writer, f *Frame) error {
+	payload, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("failed to encode frame: %v", err)
+	}
+	if len(payload) > MaxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds maximum of %d", len(payload), MaxFrameSize)
+	}
+
+	buf := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	copy(buf[4:], payload)
+	_, err = w.Write(buf)
+	return err
+}
+
+// ReadFrame reads one length-prefixed frame from r into f
+func ReadFrame(r io.Reader, f *Frame) error {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds maximum of %d", size, MaxFrameSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return err
+	}
+	*f = Frame{}
+	if err := json.Unmarshal(payload, f); err != nil {
+		return fmt.Errorf("failed to decode frame: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package signerproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	frames := []*Frame{
+		{ID: 1, Method: MethodSign, Body: []byte(`{"csr":"x"}`)},
+		{ID: 2, Error: &Error{Code: CodePolicyDenied, Message: "denied", Reasons: []DenyReason{{Rule: "max_groups", Message: "too many"}}}},
+	}
+	for _, f := range frames {
+		if err := WriteFrame(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var first, second Frame
+	if err := ReadFrame(&buf, &first); err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != 1 || first.Method != MethodSign || string(first.Body) != `{"csr":"x"}` || first.Error != nil {
+		t.Errorf("first frame = %+v", first)
+	}
+	if err := ReadFrame(&buf, &second); err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != 2 || second.Error == nil || second.Error.Code != CodePolicyDenied || len(second.Error.Reasons) != 1 {
+		t.Errorf("second frame = %+v", second)
+	}
+}
+
+func TestFrameSizeLimit(t *testing.T) {
+	big := &Frame{ID: 1, Body: []byte(`"` + strings.Repeat("x", MaxFrameSize) + `"`)}
+	if err := WriteFrame(&bytes.Buffer{}, big); err == nil {
+		t.Error("wrote a frame larger than MaxFrameSize")
+	}
+
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], MaxFrameSize+1)
+	if err := ReadFrame(bytes.NewReader(header[:]), &Frame{}); err == nil {
+		t.Error("read a frame larger than MaxFrameSize")
+	}
+}
+
+func TestCodeHTTPStatus(t *testing.T) {
+	tests := map[Code]int{
+		CodeBadCSR:          400,
+		CodePolicyDenied:    403,
+		CodeNotFound:        404,
+		CodeCAUnavailable:   503,
+		CodeUnauthenticated: 500,
+		Code("unheard-of"):  500,
+	}
+	for code, want := range tests {
+		if got := code.HTTPStatus(); got != want {
+			t.Errorf("%s: status %d, want %d", code, got, want)
+		}
+	}
+}
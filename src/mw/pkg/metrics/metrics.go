@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -31,6 +32,31 @@ type Metrics struct {
 	rateLimitExceeded   *prometheus.CounterVec
 	securityEventsTotal *prometheus.CounterVec
 
+	// Revocation metrics
+	revocationsTotal    *prometheus.CounterVec
+	crlGenerationsTotal *prometheus.CounterVec
+	crlEntries          *prometheus.GaugeVec
+	ocspResponsesTotal  *prometheus.CounterVec
+
+	// Identity binding metrics
+	csrSubjectMismatches *prometheus.CounterVec
+	peerRejections       *prometheus.CounterVec
+
+	// Certificate registration with the backend
+	certificateRegistrations *prometheus.CounterVec
+	backendRevocations       *prometheus.CounterVec
+	certificateOutboxPending prometheus.Gauge
+
+	// Revocation requests made through the app server
+	revocationRequests *prometheus.CounterVec
+
+	// ACME server
+	acmeRequests *prometheus.CounterVec
+	acmeOrders   *prometheus.CounterVec
+
+	// EST enrollment
+	estRequests *prometheus.CounterVec
+
 	// Backend API metrics
 	backendRequestsTotal   *prometheus.CounterVec
 	backendRequestDuration *prometheus.HistogramVec
@@ -138,6 +164,96 @@ func New() *Metrics {
 			},
 			[]string{"event_type"},
 		),
+		revocationsTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "certificate_revocations_total",
+				Help: "Total number of certificate revocations",
+			},
+			[]string{"reason"},
+		),
+		crlGenerationsTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "crl_generations_total",
+				Help: "Total number of CRLs generated",
+			},
+			[]string{"kind"},
+		),
+		crlEntries: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "crl_entries",
+				Help: "Number of entries in the most recently generated CRL",
+			},
+			[]string{"kind"},
+		),
+		ocspResponsesTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ocsp_responses_total",
+				Help: "Total number of OCSP responses by certificate status",
+			},
+			[]string{"status"},
+		),
+		csrSubjectMismatches: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "csr_subject_mismatches_total",
+				Help: "Total number of CSRs rejected because the subject did not match the authenticated user",
+			},
+			[]string{"reason"},
+		),
+		peerRejections: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "signer_peer_rejections_total",
+				Help: "Total number of signer socket connections rejected by peer credential checks",
+			},
+			[]string{"reason"},
+		),
+		certificateRegistrations: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "certificate_registrations_total",
+				Help: "Total number of attempts to register issued certificates with the backend",
+			},
+			[]string{"status"},
+		),
+		backendRevocations: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "certificate_backend_revocations_total",
+				Help: "Total number of attempts to record certificate revocations in the backend",
+			},
+			[]string{"status"},
+		),
+		certificateOutboxPending: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "certificate_outbox_pending",
+				Help: "Number of certificate registrations and revocations waiting to be sent to the backend",
+			},
+		),
+		revocationRequests: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "certificate_revocation_requests_total",
+				Help: "Total number of certificate revocation requests by kind (owner, admin) and outcome",
+			},
+			[]string{"kind", "status"},
+		),
+		acmeRequests: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "acme_requests_total",
+				Help: "Total number of ACME requests by resource and outcome",
+			},
+			[]string{"resource", "status"},
+		),
+		acmeOrders: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "acme_orders_total",
+				Help: "Total number of ACME orders by final status",
+			},
+			[]string{"status"},
+		),
+		estRequests: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "est_requests_total",
+				Help: "Total number of EST requests by operation and outcome",
+			},
+			[]string{"operation", "status"},
+		),
 		backendRequestsTotal: promauto.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "backend_requests_total",
@@ -186,7 +302,7 @@ func (m *Metrics) HTTPMiddleware(next http.Handler) http.Handler {
 
 		// Record metrics
 		m.httpRequestDuration.WithLabelValues(method, path).Observe(duration)
-		m.httpRequestsTotal.WithLabelValues(method, path, string(rw.statusCode)).Inc()
+		m.httpRequestsTotal.WithLabelValues(method, path, strconv.Itoa(rw.statusCode)).Inc()
 	})
 }
 
@@ -241,6 +357,73 @@ func (m *Metrics) RecordBackendRequest(method, path, status string, duration tim
 	}
 }
 
+// RecordRevocation records a certificate revocation with its RFC 5280 reason code
+func (m *Metrics) RecordRevocation(reason int) {
+	m.revocationsTotal.WithLabelValues(strconv.Itoa(reason)).Inc()
+}
+
+// RecordCRLGeneration records the generation of a full or delta CRL
+func (m *Metrics) RecordCRLGeneration(kind string, entries int) {
+	m.crlGenerationsTotal.WithLabelValues(kind).Inc()
+	m.crlEntries.WithLabelValues(kind).Set(float64(entries))
+}
+
+// RecordOCSPResponse records an OCSP response with the status it reported
+func (m *Metrics) RecordOCSPResponse(status string) {
+	m.ocspResponsesTotal.WithLabelValues(status).Inc()
+}
+
+// RecordCSRSubjectMismatch records a CSR rejected for naming someone other
+// than the authenticated user
+func (m *Metrics) RecordCSRSubjectMismatch(reason string) {
+	m.csrSubjectMismatches.WithLabelValues(reason).Inc()
+}
+
+// RecordPeerRejection records a signer socket peer that failed the
+// credential check
+func (m *Metrics) RecordPeerRejection(reason string) {
+	m.peerRejections.WithLabelValues(reason).Inc()
+}
+
+// RecordCertificateRegistration records an attempt to register an issued
+// certificate with the backend
+func (m *Metrics) RecordCertificateRegistration(status string) {
+	m.certificateRegistrations.WithLabelValues(status).Inc()
+}
+
+// RecordBackendRevocation records an attempt to record a revocation in the
+// backend
+func (m *Metrics) RecordBackendRevocation(status string) {
+	m.backendRevocations.WithLabelValues(status).Inc()
+}
+
+// RecordRevocationRequest records a revocation request and its outcome
+func (m *Metrics) RecordRevocationRequest(kind, status string) {
+	m.revocationRequests.WithLabelValues(kind, status).Inc()
+}
+
+// RecordACMERequest records an ACME request and its outcome, an ACME error
+// type or "ok"
+func (m *Metrics) RecordACMERequest(resource, status string) {
+	m.acmeRequests.WithLabelValues(resource, status).Inc()
+}
+
+// RecordACMEOrder records an ACME order reaching a final status
+func (m *Metrics) RecordACMEOrder(status string) {
+	m.acmeOrders.WithLabelValues(status).Inc()
+}
+
+// RecordESTRequest records an EST request and its outcome
+func (m *Metrics) RecordESTRequest(operation, status string) {
+	m.estRequests.WithLabelValues(operation, status).Inc()
+}
+
+// SetCertificateOutboxPending sets the number of registrations and
+// revocations waiting to be sent to the backend
+func (m *Metrics) SetCertificateOutboxPending(count int) {
+	m.certificateOutboxPending.Set(float64(count))
+}
+
 // SetActiveUsers sets the number of active users
 func (m *Metrics) SetActiveUsers(count float64) {
 	m.activeUsers.Set(count)
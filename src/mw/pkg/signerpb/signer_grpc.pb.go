@@ -0,0 +1,357 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: certm3/signer/v1/signer.proto
+
+// The signer service issues and revokes certificates from the certM3 CA.
+// It is served by certm3-signer on its Unix socket (alongside the socket
+// protocol in package signerproto) and, optionally, on an mTLS TCP
+// listener. Signing and revocation requests must carry a signing ticket
+// minted with the shared ticket secret, exactly as on the socket protocol.
+
+package signerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	SignerService_Sign_FullMethodName                     = "/certm3.signer.v1.SignerService/Sign"
+	SignerService_GetCACertificates_FullMethodName        = "/certm3.signer.v1.SignerService/GetCACertificates"
+	SignerService_Revoke_FullMethodName                   = "/certm3.signer.v1.SignerService/Revoke"
+	SignerService_GetStatus_FullMethodName                = "/certm3.signer.v1.SignerService/GetStatus"
+	SignerService_ListCertificates_FullMethodName         = "/certm3.signer.v1.SignerService/ListCertificates"
+	SignerService_SignSSH_FullMethodName                  = "/certm3.signer.v1.SignerService/SignSSH"
+	SignerService_SignAttributeCertificate_FullMethodName = "/certm3.signer.v1.SignerService/SignAttributeCertificate"
+)
+
+// SignerServiceClient is the client API for SignerService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SignerServiceClient interface {
+	// Sign signs a PKCS#10 CSR for an authenticated user
+	Sign(ctx context.Context, in *SignRequest, opts ...grpc.CallOption) (*SignResponse, error)
+	// GetCACertificates returns the CA certificates, issuing CA first
+	GetCACertificates(ctx context.Context, in *GetCACertificatesRequest, opts ...grpc.CallOption) (*GetCACertificatesResponse, error)
+	// Revoke revokes a certificate issued by the signer
+	Revoke(ctx context.Context, in *RevokeRequest, opts ...grpc.CallOption) (*RevokeResponse, error)
+	// GetStatus reports whether a certificate is good, revoked or unknown.
+	// Over TCP, only admin clients may call it or ListCertificates.
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error)
+	// ListCertificates queries the issuance ledger by serial, user or
+	// public key fingerprint
+	ListCertificates(ctx context.Context, in *ListCertificatesRequest, opts ...grpc.CallOption) (*ListCertificatesResponse, error)
+	// SignSSH issues an OpenSSH user certificate for an authenticated user
+	SignSSH(ctx context.Context, in *SignSSHRequest, opts ...grpc.CallOption) (*SignSSHResponse, error)
+	// SignAttributeCertificate issues a fresh RFC 5755 attribute certificate
+	// with the current groups of the holder of a certificate
+	SignAttributeCertificate(ctx context.Context, in *SignAttributeCertificateRequest, opts ...grpc.CallOption) (*SignAttributeCertificateResponse, error)
+}
+
+type signerServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSignerServiceClient(cc grpc.ClientConnInterface) SignerServiceClient {
+	return &signerServiceClient{cc}
+}
+
+func (c *signerServiceClient) Sign(ctx context.Context, in *SignRequest, opts ...grpc.CallOption) (*SignResponse, error) {
+	out := new(SignResponse)
+	err := c.cc.Invoke(ctx, SignerService_Sign_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signerServiceClient) GetCACertificates(ctx context.Context, in *GetCACertificatesRequest, opts ...grpc.CallOption) (*GetCACertificatesResponse, error) {
+	out := new(GetCACertificatesResponse)
+	err := c.cc.Invoke(ctx, SignerService_GetCACertificates_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signerServiceClient) Revoke(ctx context.Context, in *RevokeRequest, opts ...grpc.CallOption) (*RevokeResponse, error) {
+	out := new(RevokeResponse)
+	err := c.cc.Invoke(ctx, SignerService_Revoke_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signerServiceClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error) {
+	out := new(GetStatusResponse)
+	err := c.cc.Invoke(ctx, SignerService_GetStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signerServiceClient) ListCertificates(ctx context.Context, in *ListCertificatesRequest, opts ...grpc.CallOption) (*ListCertificatesResponse, error) {
+	out := new(ListCertificatesResponse)
+	err := c.cc.Invoke(ctx, SignerService_ListCertificates_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signerServiceClient) SignSSH(ctx context.Context, in *SignSSHRequest, opts ...grpc.CallOption) (*SignSSHResponse, error) {
+	out := new(SignSSHResponse)
+	err := c.cc.Invoke(ctx, SignerService_SignSSH_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signerServiceClient) SignAttributeCertificate(ctx context.Context, in *SignAttributeCertificateRequest, opts ...grpc.CallOption) (*SignAttributeCertificateResponse, error) {
+	out := new(SignAttributeCertificateResponse)
+	err := c.cc.Invoke(ctx, SignerService_SignAttributeCertificate_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SignerServiceServer is the server API for SignerService service.
+// All implementations must embed UnimplementedSignerServiceServer
+// for forward compatibility
+type SignerServiceServer interface {
+	// Sign signs a PKCS#10 CSR for an authenticated user
+	Sign(context.Context, *SignRequest) (*SignResponse, error)
+	// GetCACertificates returns the CA certificates, issuing CA first
+	GetCACertificates(context.Context, *GetCACertificatesRequest) (*GetCACertificatesResponse, error)
+	// Revoke revokes a certificate issued by the signer
+	Revoke(context.Context, *RevokeRequest) (*RevokeResponse, error)
+	// GetStatus reports whether a certificate is good, revoked or unknown.
+	// Over TCP, only admin clients may call it or ListCertificates.
+	GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error)
+	// ListCertificates queries the issuance ledger by serial, user or
+	// public key fingerprint
+	ListCertificates(context.Context, *ListCertificatesRequest) (*ListCertificatesResponse, error)
+	// SignSSH issues an OpenSSH user certificate for an authenticated user
+	SignSSH(context.Context, *SignSSHRequest) (*SignSSHResponse, error)
+	// SignAttributeCertificate issues a fresh RFC 5755 attribute certificate
+	// with the current groups of the holder of a certificate
+	SignAttributeCertificate(context.Context, *SignAttributeCertificateRequest) (*SignAttributeCertificateResponse, error)
+	mustEmbedUnimplementedSignerServiceServer()
+}
+
+// UnimplementedSignerServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedSignerServiceServer struct {
+}
+
+func (UnimplementedSignerServiceServer) Sign(context.Context, *SignRequest) (*SignResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sign not implemented")
+}
+func (UnimplementedSignerServiceServer) GetCACertificates(context.Context, *GetCACertificatesRequest) (*GetCACertificatesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCACertificates not implemented")
+}
+func (UnimplementedSignerServiceServer) Revoke(context.Context, *RevokeRequest) (*RevokeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Revoke not implemented")
+}
+func (UnimplementedSignerServiceServer) GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedSignerServiceServer) ListCertificates(context.Context, *ListCertificatesRequest) (*ListCertificatesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCertificates not implemented")
+}
+func (UnimplementedSignerServiceServer) SignSSH(context.Context, *SignSSHRequest) (*SignSSHResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SignSSH not implemented")
+}
+func (UnimplementedSignerServiceServer) SignAttributeCertificate(context.Context, *SignAttributeCertificateRequest) (*SignAttributeCertificateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SignAttributeCertificate not implemented")
+}
+func (UnimplementedSignerServiceServer) mustEmbedUnimplementedSignerServiceServer() {}
+
+// UnsafeSignerServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SignerServiceServer will
+// result in compilation errors.
+type UnsafeSignerServiceServer interface {
+	mustEmbedUnimplementedSignerServiceServer()
+}
+
+func RegisterSignerServiceServer(s grpc.ServiceRegistrar, srv SignerServiceServer) {
+	s.RegisterService(&SignerService_ServiceDesc, srv)
+}
+
+func _SignerService_Sign_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServiceServer).Sign(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignerService_Sign_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServiceServer).Sign(ctx, req.(*SignRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignerService_GetCACertificates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCACertificatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServiceServer).GetCACertificates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignerService_GetCACertificates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServiceServer).GetCACertificates(ctx, req.(*GetCACertificatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignerService_Revoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServiceServer).Revoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignerService_Revoke_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServiceServer).Revoke(ctx, req.(*RevokeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignerService_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServiceServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignerService_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServiceServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignerService_ListCertificates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCertificatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServiceServer).ListCertificates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignerService_ListCertificates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServiceServer).ListCertificates(ctx, req.(*ListCertificatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignerService_SignSSH_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignSSHRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServiceServer).SignSSH(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignerService_SignSSH_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServiceServer).SignSSH(ctx, req.(*SignSSHRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignerService_SignAttributeCertificate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignAttributeCertificateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServiceServer).SignAttributeCertificate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignerService_SignAttributeCertificate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServiceServer).SignAttributeCertificate(ctx, req.(*SignAttributeCertificateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SignerService_ServiceDesc is the grpc.ServiceDesc for SignerService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SignerService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "certm3.signer.v1.SignerService",
+	HandlerType: (*SignerServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Sign",
+			Handler:    _SignerService_Sign_Handler,
+		},
+		{
+			MethodName: "GetCACertificates",
+			Handler:    _SignerService_GetCACertificates_Handler,
+		},
+		{
+			MethodName: "Revoke",
+			Handler:    _SignerService_Revoke_Handler,
+		},
+		{
+			MethodName: "GetStatus",
+			Handler:    _SignerService_GetStatus_Handler,
+		},
+		{
+			MethodName: "ListCertificates",
+			Handler:    _SignerService_ListCertificates_Handler,
+		},
+		{
+			MethodName: "SignSSH",
+			Handler:    _SignerService_SignSSH_Handler,
+		},
+		{
+			MethodName: "SignAttributeCertificate",
+			Handler:    _SignerService_SignAttributeCertificate_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "certm3/signer/v1/signer.proto",
+}